@@ -16,6 +16,8 @@ import (
 
 	"github.com/FloatTech/ZeroBot-Plugin/kanban" // 打印 banner
 
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/hook" // 插件限速策略与耗时统计
+
 	// ---------以下插件均可通过前面加 // 注释，注释后停用并不加载插件--------- //
 	// ----------------------插件优先级按顺序从高到低---------------------- //
 	//                                                                  //
@@ -32,6 +34,8 @@ import (
 
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/antiabuse" // 违禁词
 
+	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/moderation" // 统一内容审核
+
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/chat" // 基础词库
 
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/chatcount" // 聊天时长统计
@@ -319,5 +323,6 @@ func main() {
 		Handle(func(ctx *zero.Ctx) {
 			ctx.SendChain(message.Text(strings.ReplaceAll(kanban.Kanban(), "\t", "")))
 		})
+	hook.Install() // 须在全部插件注册后调用
 	zero.RunAndBlock(&config.Z, process.GlobalInitMutex.Unlock)
 }
@@ -0,0 +1,65 @@
+// Package hook 为所有插件挂上 aifalse 的限速策略与耗时统计, 以及其它插件提供的 PostHandler
+package hook
+
+import (
+	"sync"
+	"time"
+	_ "unsafe" // for linkname to control.enmap
+
+	"github.com/FloatTech/zbputils/control"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/metrics"
+)
+
+// startkey Matcher 开始处理的时间在 ctx.State 中的键
+const startkey = "aifalse_start"
+
+// Recorder 各插件的处理次数与耗时
+var Recorder = metrics.NewRecorder()
+
+// engines 所有已注册插件, 同 control 对 ZeroBot.defaultEngine 的做法, 仅在 Install 时读取一次
+//
+//go:linkname engines github.com/FloatTech/zbputils/control.enmap
+var engines map[string]*control.Engine
+
+var (
+	installonce  sync.Once
+	posthandlers []zero.Handler
+)
+
+// UsePostHandler 添加挂到所有插件上的 PostHandler, 在任一插件的 Handler 返回后执行, 须在 init 中调用
+func UsePostHandler(handler ...zero.Handler) {
+	posthandlers = append(posthandlers, handler...)
+}
+
+// Install 为所有已注册插件挂上限速策略与耗时统计, 须在全部插件注册后, bot 开始接收事件前调用
+//
+//	限速策略在 Rule 全部通过后判断, 与插件自带的限速同时生效; 从放行开始计时, 到 Handler 返回为止
+func Install() {
+	installonce.Do(func() {
+		for service, e := range engines {
+			install(service, e)
+		}
+		logrus.Infoln("[aifalse] 已为", len(engines), "个插件挂上限速策略与耗时统计")
+	})
+}
+
+func install(service string, e *control.Engine) {
+	e.UseMidHandler(func(ctx *zero.Ctx) bool {
+		if !allow(service, ctx) {
+			return false
+		}
+		ctx.State[startkey] = time.Now()
+		return true
+	})
+	e.UsePostHandler(func(ctx *zero.Ctx) {
+		start, ok := ctx.State[startkey].(time.Time)
+		if !ok {
+			return
+		}
+		Recorder.Observe(service, time.Since(start))
+	})
+	e.UsePostHandler(posthandlers...)
+}
@@ -0,0 +1,158 @@
+package hook
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/zbputils/ctxext"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/extension/rate"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/ratelimit"
+)
+
+var (
+	table = ratelimit.NewTable()
+	// managers 策略 id -> 限速器
+	managers   = make(map[int64]*manager)
+	managersmu sync.RWMutex
+)
+
+// touch 计数对象最近一次触发时的限速器
+type touch struct {
+	lim *rate.Limiter
+	at  time.Time
+}
+
+// every 每 Interval 内 Burst 次, 即每个令牌的恢复时间
+func every(p *ratelimit.Policy) time.Duration {
+	return p.Interval / time.Duration(p.Burst)
+}
+
+// manager 一条策略的限速器, 按用户与按群时基于 ctxext.LimiterManager
+type manager struct {
+	p      ratelimit.Policy
+	lm     ctxext.LimiterManager
+	global *rate.Limiter
+	mu     sync.Mutex
+	// touched 供查看限速状态, 超过回满时间后删除
+	touched map[int64]touch
+}
+
+func newmanager(p *ratelimit.Policy) *manager {
+	d := every(p)
+	return &manager{
+		p:       *p,
+		lm:      ctxext.NewLimiterManager(d, p.Burst),
+		global:  rate.NewLimiter(d, p.Burst),
+		touched: make(map[int64]touch),
+	}
+}
+
+func (m *manager) load(ctx *zero.Ctx) *rate.Limiter {
+	var lim *rate.Limiter
+	switch {
+	case m.p.Scope == ratelimit.Global:
+		lim = m.global
+	case m.p.Scope == ratelimit.ByGroup && ctx.Event.GroupID != 0:
+		lim = m.lm.LimitByGroup(ctx)
+	default: // 按群时私聊按用户计
+		lim = m.lm.LimitByUser(ctx)
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.touched) >= 4096 {
+		m.sweep(now)
+	}
+	m.touched[m.p.Key(ctx.Event.GroupID, ctx.Event.UserID)] = touch{lim: lim, at: now}
+	return lim
+}
+
+// sweep 删除已回满的计数对象
+func (m *manager) sweep(now time.Time) {
+	for k, t := range m.touched {
+		if now.Sub(t.at) >= m.p.Interval {
+			delete(m.touched, k)
+		}
+	}
+}
+
+// allow 按限速策略判断 service 的本次触发是否放行, 白名单用户与未命中策略时不限速
+func allow(service string, ctx *zero.Ctx) bool {
+	if table.Whitelisted(ctx.Event.UserID) {
+		return true
+	}
+	p := table.Lookup(service, ctx.ExtractPlainText(), ctx.Event.GroupID, ctx.Event.UserID)
+	if p == nil {
+		return true
+	}
+	managersmu.RLock()
+	m, ok := managers[p.ID]
+	managersmu.RUnlock()
+	return !ok || m.load(ctx).Acquire()
+}
+
+// SetPolicies 替换全部策略, 有变动的策略重新计数
+func SetPolicies(ps []*ratelimit.Policy) {
+	managersmu.Lock()
+	defer managersmu.Unlock()
+	next := make(map[int64]*manager, len(ps))
+	for _, p := range ps {
+		if m, ok := managers[p.ID]; ok && m.p == *p {
+			next[p.ID] = m
+			continue
+		}
+		next[p.ID] = newmanager(p)
+	}
+	managers = next
+	table.SetPolicies(ps)
+}
+
+// SetWhitelist 替换白名单
+func SetWhitelist(uids []int64) {
+	table.SetWhitelist(uids)
+}
+
+// State 一个未回满的令牌桶
+type State struct {
+	Policy ratelimit.Policy
+	// Key 计数对象, 按群时私聊为负的用户号
+	Key    int64
+	Tokens float64
+}
+
+// States 当前所有未回满的令牌桶, 按策略与计数对象排序
+func States() []State {
+	managersmu.RLock()
+	ms := make([]*manager, 0, len(managers))
+	for _, m := range managers {
+		ms = append(ms, m)
+	}
+	managersmu.RUnlock()
+	now := time.Now()
+	var out []State
+	for _, m := range ms {
+		m.mu.Lock()
+		m.sweep(now)
+		for k, t := range m.touched {
+			t.lim.Lock()
+			tokens := t.lim.Tokens()
+			t.lim.Unlock()
+			// 令牌桶只在触发时更新, 此处补上之后回复的令牌
+			tokens += float64(now.Sub(t.at)) / float64(every(&m.p))
+			if tokens < float64(m.p.Burst) {
+				out = append(out, State{Policy: m.p, Key: k, Tokens: tokens})
+			}
+		}
+		m.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Policy.ID != out[j].Policy.ID {
+			return out[i].Policy.ID < out[j].Policy.ID
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
@@ -0,0 +1,189 @@
+package aifalse
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/hook"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/ratelimit"
+)
+
+var errLimitSyntax = errors.New("格式: 设置限速 插件名[:命令前缀] 每[N][秒|分钟|小时]M次 [用户|群|全局] [群号xxx] [用户xxx]")
+
+// reloadlimits 从数据库重新加载限速策略与白名单
+func reloadlimits() error {
+	ps, err := mdb.policies()
+	if err != nil {
+		return err
+	}
+	uids, err := mdb.whitelist()
+	if err != nil {
+		return err
+	}
+	hook.SetPolicies(ps)
+	hook.SetWhitelist(uids)
+	return nil
+}
+
+// parsepolicy 解析 设置限速 后的参数
+func parsepolicy(target, n, unit, burst, rest string) (*ratelimit.Policy, error) {
+	p := &ratelimit.Policy{}
+	p.Service, p.Command, _ = strings.Cut(target, ":")
+	if p.Service != ratelimit.AllServices {
+		if _, ok := control.Lookup(p.Service); !ok {
+			return nil, errors.New("没有找到插件 " + p.Service)
+		}
+	}
+	interval := int64(1)
+	if n != "" {
+		interval, _ = strconv.ParseInt(n, 10, 64)
+	}
+	switch unit {
+	case "分钟":
+		interval *= 60
+	case "小时":
+		interval *= 3600
+	}
+	b, _ := strconv.Atoi(burst)
+	if interval <= 0 || b <= 0 || b > 65535 {
+		return nil, errLimitSyntax
+	}
+	p.Interval, p.Burst = time.Duration(interval)*time.Second, b
+	for _, tok := range strings.Fields(rest) {
+		if s, ok := ratelimit.ParseScope(tok); ok {
+			p.Scope = s
+			continue
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(tok, "群号"):
+			p.GroupID, err = strconv.ParseInt(strings.TrimPrefix(tok, "群号"), 10, 64)
+		case strings.HasPrefix(tok, "用户"):
+			p.UserID, err = strconv.ParseInt(strings.TrimPrefix(tok, "用户"), 10, 64)
+		default:
+			err = errLimitSyntax
+		}
+		if err != nil {
+			return nil, errLimitSyntax
+		}
+	}
+	return p, nil
+}
+
+// limitcommands 注册限速相关的命令
+func limitcommands(engine *control.Engine, getdb zero.Rule) {
+	engine.OnRegex(`^设置限速\s*(\S+)\s+每\s*(\d*)\s*(秒|分钟|小时)\s*(\d+)\s*次(.*)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			regex := ctx.State["regex_matched"].([]string)
+			p, err := parsepolicy(regex[1], regex[2], regex[3], regex[4], regex[5])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = mdb.addPolicy(p)
+			if err == nil {
+				err = reloadlimits()
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已设置限速 ", p.String()))
+		})
+	engine.OnRegex(`^删除限速\s*(\d+)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			err := mdb.delPolicy(id)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: 没有编号为", id, "的限速策略"))
+				return
+			}
+			err = reloadlimits()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功"))
+		})
+	engine.OnFullMatch("查看限速", zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			m := c.GetData(0)
+			sb := strings.Builder{}
+			sb.WriteString("默认: ")
+			if m&0xffff == 0 {
+				sb.WriteString("每10秒5次")
+			} else {
+				sb.WriteString("每" + strconv.FormatInt(m&0xffff, 10) + "秒" + strconv.FormatInt((m>>16)&0xffff, 10) + "次")
+			}
+			ps, err := mdb.policies()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			for _, p := range ps {
+				sb.WriteString("\n" + p.String())
+			}
+			uids, err := mdb.whitelist()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(uids) > 0 {
+				sb.WriteString("\n白名单:")
+				for _, uid := range uids {
+					sb.WriteString(" " + strconv.FormatInt(uid, 10))
+				}
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnFullMatch("查看限速状态", zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			states := hook.States()
+			if len(states) == 0 {
+				ctx.SendChain(message.Text("所有令牌桶均已回满"))
+				return
+			}
+			sb := strings.Builder{}
+			for i, st := range states {
+				if i > 0 {
+					sb.WriteByte('\n')
+				}
+				sb.WriteString("[" + strconv.FormatInt(st.Policy.ID, 10) + "] ")
+				switch st.Policy.Scope {
+				case ratelimit.Global:
+					sb.WriteString("全局")
+				case ratelimit.ByGroup:
+					if st.Key < 0 {
+						sb.WriteString("私聊" + strconv.FormatInt(-st.Key, 10))
+					} else {
+						sb.WriteString("群" + strconv.FormatInt(st.Key, 10))
+					}
+				default:
+					sb.WriteString("用户" + strconv.FormatInt(st.Key, 10))
+				}
+				sb.WriteString(" 剩余" + strconv.FormatFloat(st.Tokens, 'f', 1, 64) + "/" + strconv.Itoa(st.Policy.Burst))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^(添加|删除)限速白名单\s*(\d+)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			uid, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[2], 10, 64)
+			err := mdb.setWhite(uid, ctx.State["regex_matched"].([]string)[1] == "添加")
+			if err == nil {
+				err = reloadlimits()
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功"))
+		})
+}
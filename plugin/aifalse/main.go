@@ -16,6 +16,7 @@ import (
 	"unsafe"
 
 	"github.com/FloatTech/AnimeAPI/bilibili"
+	fcext "github.com/FloatTech/floatbox/ctxext"
 	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/floatbox/web"
 	"github.com/FloatTech/gg"
@@ -59,7 +60,19 @@ func init() { // 插件主体
 		DisableOnDefault: false,
 		Brief:            "自检, 全局限速",
 		Help: "- 查询计算机当前活跃度: [检查身体 | 自检 | 启动自检 | 系统状态]\n" +
-			"- 设置默认限速为每 m [分钟 | 秒] n 次触发",
+			"- 设置默认限速为每 m [分钟 | 秒] n 次触发\n" +
+			"- 系统趋势[24h | 7d]\n" +
+			"- [查看 | 设置]告警阈值[磁盘 | 内存增长 | 离线] n\n" +
+			"- [开启 | 关闭]监控接口[端口]\n" +
+			"- 设置限速 插件名[:命令前缀] 每[N][秒 | 分钟 | 小时]M次 [用户 | 群 | 全局] [群号xxx] [用户xxx]\n" +
+			"例: 设置限速 tarot 每分钟3次 群\n" +
+			"- 删除限速[编号]\n" +
+			"- 查看限速[状态]\n" +
+			"- [添加 | 删除]限速白名单[qq]\n" +
+			"Tips: 插件启用后每分钟采样一次并保存 7 天, 同时统计所有插件的处理次数与耗时, 磁盘使用率(%), 1小时内进程内存增长(%)或离线时长(分钟)超过阈值时私聊通知主人, 阈值为 0 时不告警\n" +
+			"监控接口以 Prometheus 格式提供 http://ip:端口/metrics\n" +
+			"限速策略对所有插件生效, 与插件自带的限速同时生效, 插件名为 * 时匹配所有插件, 同时匹配多条时 用户 > 群 > 命令 > 插件, 白名单用户不受任何限速",
+		PrivateDataFolder: "aifalse",
 	})
 	c, ok := control.Lookup("aifalse")
 	if !ok {
@@ -72,6 +85,26 @@ func init() { // 插件主体
 		ctxext.SetDefaultLimiterManagerParam(time.Duration(m)*time.Second, int(n))
 		logrus.Infoln("设置默认限速为每", m, "秒触发", n, "次")
 	}
+	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+		err := mdb.init(engine.DataFolder() + "metrics.db")
+		if err != nil {
+			logrus.Errorln("[aifalse] 打开数据库失败:", err)
+			if ctx.Event.PostType == "message" {
+				ctx.SendChain(message.Text("ERROR: ", err))
+			}
+			return false
+		}
+		err = reloadlimits()
+		if err != nil {
+			logrus.Warnln("[aifalse] 加载限速策略失败:", err)
+		}
+		return true
+	})
+	// 插件启用时随 bot 的元事件开始采样
+	engine.OnMetaEvent(getdb).SetBlock(false).Handle(func(*zero.Ctx) {
+		startsampler()
+	})
+	limitcommands(engine, getdb)
 	engine.OnFullMatchGroup([]string{"检查身体", "自检", "启动自检", "系统状态"}, zero.AdminPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			now := time.Now().Hour()
@@ -143,6 +176,72 @@ func init() { // 插件主体
 			}
 			ctx.SendChain(message.Text("设置默认限速为每", m, "秒触发", n, "次"))
 		})
+	engine.OnRegex(`^系统趋势\s*(24h|7d|24小时|7天)?$`, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			span, bucket, format := trendrange(ctx.State["regex_matched"].([]string)[1])
+			usage, msgs, summary, err := drawtrend(span, bucket, format)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if id := ctx.SendChain(message.ImageBytes(usage), message.ImageBytes(msgs), message.Text(summary)); id.ID() == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+	engine.OnFullMatch("查看告警阈值", zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			th := mdb.thresholds()
+			ctx.SendChain(message.Text(
+				"磁盘: ", th.Disk, "%\n",
+				"内存增长: ", th.MemGrowth, "% / ", th.MemWindow, "\n",
+				"离线: ", th.Offline,
+			))
+		})
+	engine.OnRegex(`^设置告警阈值\s*(磁盘|内存增长|离线)\s*(\d+)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			key := map[string]string{"磁盘": settingDisk, "内存增长": settingMemGrowth, "离线": settingOffline}[ctx.State["regex_matched"].([]string)[1]]
+			n, err := strconv.ParseInt(ctx.State["regex_matched"].([]string)[2], 10, 64)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if key == settingDisk && n > 100 {
+				ctx.SendChain(message.Text("ERROR: 磁盘使用率阈值不能超过100"))
+				return
+			}
+			err = mdb.set(key, n)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功"))
+		})
+	engine.OnRegex(`^(开启|关闭)监控接口\s*(\d*)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			var port int64
+			if ctx.State["regex_matched"].([]string)[1] == "开启" {
+				port, _ = strconv.ParseInt(ctx.State["regex_matched"].([]string)[2], 10, 64)
+				if port <= 0 || port >= 65536 {
+					ctx.SendChain(message.Text("ERROR: 请指定有效的端口"))
+					return
+				}
+			}
+			err := servemetrics(port)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = mdb.set(settingPort, port)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if port == 0 {
+				ctx.SendChain(message.Text("已关闭监控接口"))
+				return
+			}
+			ctx.SendChain(message.Text("已在端口", port, "开启监控接口 /metrics"))
+		})
 }
 
 func drawstatus(m *ctrl.Control[*zero.Ctx], uid int64, botname string, botrunstatus string) (sendimg image.Image, err error) {
@@ -0,0 +1,332 @@
+// Package metrics 系统指标的采样聚合、插件耗时统计、阈值告警与 Prometheus 导出
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sample 一次采样
+type Sample struct {
+	Time time.Time
+	// CPU Mem Swap Disk 使用率, 百分比, Disk 取所有分区的最大值
+	CPU  float64
+	Mem  float64
+	Swap float64
+	Disk float64
+	// ProcMem 本进程占用的内存, 字节
+	ProcMem    uint64
+	Goroutines int
+	// Online bot 是否在线
+	Online bool
+	// Recv Sent bot 收发消息的累计数
+	Recv int64
+	Sent int64
+}
+
+// Slot 时间 t 在容量为 capacity, 间隔为 interval 的环形缓冲中的位置
+func Slot(t time.Time, interval time.Duration, capacity int) int64 {
+	return (t.UnixNano() / int64(interval)) % int64(capacity)
+}
+
+// Downsample 将按时间升序的样本按 bucket 聚合, 数值取平均, 在线取与, 累计数取末值
+func Downsample(samples []Sample, bucket time.Duration) []Sample {
+	var (
+		out []Sample
+		acc Sample
+		n   int
+		cur int64 = -1
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		acc.CPU /= float64(n)
+		acc.Mem /= float64(n)
+		acc.Swap /= float64(n)
+		acc.Disk /= float64(n)
+		acc.ProcMem /= uint64(n)
+		acc.Goroutines /= n
+		out = append(out, acc)
+	}
+	for _, s := range samples {
+		b := s.Time.UnixNano() / int64(bucket)
+		if b != cur {
+			flush()
+			cur, n = b, 0
+			acc = Sample{Time: time.Unix(0, b*int64(bucket)), Online: true}
+		}
+		n++
+		acc.CPU += s.CPU
+		acc.Mem += s.Mem
+		acc.Swap += s.Swap
+		acc.Disk += s.Disk
+		acc.ProcMem += s.ProcMem
+		acc.Goroutines += s.Goroutines
+		acc.Online = acc.Online && s.Online
+		acc.Recv, acc.Sent = s.Recv, s.Sent
+	}
+	flush()
+	return out
+}
+
+// HandlerStat 插件的处理次数与耗时
+type HandlerStat struct {
+	Service string
+	Count   int64
+	Total   time.Duration
+	Max     time.Duration
+}
+
+// Avg 平均耗时
+func (h HandlerStat) Avg() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+func (h *HandlerStat) add(o HandlerStat) {
+	h.Count += o.Count
+	h.Total += o.Total
+	if o.Max > h.Max {
+		h.Max = o.Max
+	}
+}
+
+// Merge 按插件合并多段统计, 按次数降序
+func Merge(stats []HandlerStat) []HandlerStat {
+	m := make(map[string]*HandlerStat, len(stats))
+	for _, s := range stats {
+		h, ok := m[s.Service]
+		if !ok {
+			h = &HandlerStat{Service: s.Service}
+			m[s.Service] = h
+		}
+		h.add(s)
+	}
+	out := make([]HandlerStat, 0, len(m))
+	for _, h := range m {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Service < out[j].Service
+	})
+	return out
+}
+
+// Recorder 记录插件的处理次数与耗时, 同时保存当前采样周期与启动以来的累计
+type Recorder struct {
+	mu    sync.Mutex
+	cur   map[string]*HandlerStat
+	total map[string]*HandlerStat
+}
+
+// NewRecorder 新建记录器
+func NewRecorder() *Recorder {
+	return &Recorder{
+		cur:   make(map[string]*HandlerStat),
+		total: make(map[string]*HandlerStat),
+	}
+}
+
+// Observe 记录一次处理
+func (r *Recorder) Observe(service string, d time.Duration) {
+	o := HandlerStat{Service: service, Count: 1, Total: d, Max: d}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range [...]map[string]*HandlerStat{r.cur, r.total} {
+		h, ok := m[service]
+		if !ok {
+			h = &HandlerStat{Service: service}
+			m[service] = h
+		}
+		h.add(o)
+	}
+}
+
+func values(m map[string]*HandlerStat) []HandlerStat {
+	out := make([]HandlerStat, 0, len(m))
+	for _, h := range m {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out
+}
+
+// Swap 取出当前采样周期的统计并清零
+func (r *Recorder) Swap() []HandlerStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := values(r.cur)
+	r.cur = make(map[string]*HandlerStat, len(r.cur))
+	return out
+}
+
+// Totals 启动以来的累计统计
+func (r *Recorder) Totals() []HandlerStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return values(r.total)
+}
+
+// Thresholds 告警阈值, 为 0 的项不检查
+type Thresholds struct {
+	// Disk 磁盘使用率, 百分比
+	Disk float64
+	// MemGrowth 进程内存在 MemWindow 内相对最低点的增长, 百分比
+	MemGrowth float64
+	MemWindow time.Duration
+	// Offline bot 持续离线的时长
+	Offline time.Duration
+}
+
+// Alert 一条告警
+type Alert struct {
+	Kind    string
+	Message string
+}
+
+const (
+	// AlertDisk 磁盘将满
+	AlertDisk = "磁盘"
+	// AlertMem 内存增长
+	AlertMem = "内存"
+	// AlertOffline bot 离线
+	AlertOffline = "离线"
+)
+
+// Check 检查按时间升序的样本, 返回当前触发的告警
+func (th Thresholds) Check(history []Sample) (alerts []Alert) {
+	if len(history) == 0 {
+		return
+	}
+	last := history[len(history)-1]
+	if th.Disk > 0 && last.Disk >= th.Disk {
+		alerts = append(alerts, Alert{AlertDisk, fmt.Sprintf("磁盘使用率已达 %.0f%%, 阈值 %.0f%%", last.Disk, th.Disk)})
+	}
+	if th.MemGrowth > 0 && th.MemWindow > 0 {
+		var low uint64
+		for i := len(history) - 1; i >= 0 && last.Time.Sub(history[i].Time) <= th.MemWindow; i-- {
+			if m := history[i].ProcMem; m > 0 && (low == 0 || m < low) {
+				low = m
+			}
+		}
+		if low > 0 {
+			growth := (float64(last.ProcMem) - float64(low)) / float64(low) * 100
+			if growth >= th.MemGrowth {
+				alerts = append(alerts, Alert{AlertMem, fmt.Sprintf("进程内存在 %s 内增长 %.0f%%, 阈值 %.0f%%", th.MemWindow, growth, th.MemGrowth)})
+			}
+		}
+	}
+	if th.Offline > 0 && !last.Online {
+		since := last.Time
+		for i := len(history) - 1; i >= 0 && !history[i].Online; i-- {
+			since = history[i].Time
+		}
+		if d := last.Time.Sub(since); d >= th.Offline {
+			alerts = append(alerts, Alert{AlertOffline, "bot 已离线 " + d.Round(time.Second).String()})
+		}
+	}
+	return
+}
+
+// Alerter 对告警去抖, 同一类告警在恢复前只上报一次
+type Alerter struct {
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// Evaluate 返回新触发的告警与已恢复的告警类型
+func (a *Alerter) Evaluate(th Thresholds, history []Sample) (fired []Alert, resolved []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.active == nil {
+		a.active = make(map[string]bool)
+	}
+	now := make(map[string]bool)
+	for _, al := range th.Check(history) {
+		now[al.Kind] = true
+		if !a.active[al.Kind] {
+			fired = append(fired, al)
+		}
+	}
+	for kind := range a.active {
+		if !now[kind] {
+			resolved = append(resolved, kind)
+		}
+	}
+	sort.Strings(resolved)
+	a.active = now
+	return
+}
+
+// WritePrometheus 以 Prometheus 文本格式写出最新的样本与插件累计统计
+func WritePrometheus(w io.Writer, s Sample, handlers []HandlerStat) error {
+	online := 0
+	if s.Online {
+		online = 1
+	}
+	gauges := []struct {
+		name, help string
+		value      string
+	}{
+		{"zbp_cpu_percent", "CPU usage percent.", strconv.FormatFloat(s.CPU, 'f', 2, 64)},
+		{"zbp_memory_percent", "Memory usage percent.", strconv.FormatFloat(s.Mem, 'f', 2, 64)},
+		{"zbp_swap_percent", "Swap usage percent.", strconv.FormatFloat(s.Swap, 'f', 2, 64)},
+		{"zbp_disk_percent", "Max disk usage percent among partitions.", strconv.FormatFloat(s.Disk, 'f', 2, 64)},
+		{"zbp_process_memory_bytes", "Memory obtained from the OS by the bot process.", strconv.FormatUint(s.ProcMem, 10)},
+		{"zbp_goroutines", "Number of goroutines.", strconv.Itoa(s.Goroutines)},
+		{"zbp_bot_online", "Whether the bot is online.", strconv.Itoa(online)},
+	}
+	for _, g := range gauges {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, g.value)
+		if err != nil {
+			return err
+		}
+	}
+	counters := []struct {
+		name, help string
+		value      int64
+	}{
+		{"zbp_messages_received_total", "Messages received by the bot.", s.Recv},
+		{"zbp_messages_sent_total", "Messages sent by the bot.", s.Sent},
+	}
+	for _, c := range counters {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value)
+		if err != nil {
+			return err
+		}
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, "# HELP zbp_handler_calls_total Handler calls per plugin.\n# TYPE zbp_handler_calls_total counter\n")
+	if err != nil {
+		return err
+	}
+	for _, h := range handlers {
+		_, err = fmt.Fprintf(w, "zbp_handler_calls_total{plugin=%q} %d\n", h.Service, h.Count)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "# HELP zbp_handler_seconds_total Handler time spent per plugin.\n# TYPE zbp_handler_seconds_total counter\n")
+	if err != nil {
+		return err
+	}
+	for _, h := range handlers {
+		_, err = fmt.Fprintf(w, "zbp_handler_seconds_total{plugin=%q} %s\n", h.Service, strconv.FormatFloat(h.Total.Seconds(), 'f', 6, 64))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
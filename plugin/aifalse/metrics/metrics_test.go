@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownsample(t *testing.T) {
+	base := time.Unix(3600, 0)
+	var ss []Sample
+	for i := 0; i < 10; i++ {
+		ss = append(ss, Sample{Time: base.Add(time.Duration(i) * time.Minute), CPU: float64(i), Online: i != 7, Recv: int64(i)})
+	}
+	out := Downsample(ss, 5*time.Minute)
+	if len(out) != 2 {
+		t.Fatalf("expect 2 buckets, got %d", len(out))
+	}
+	if out[0].CPU != 2 || out[1].CPU != 7 {
+		t.Fatalf("unexpected averages %v %v", out[0].CPU, out[1].CPU)
+	}
+	if !out[0].Online || out[1].Online {
+		t.Fatal("unexpected online")
+	}
+	if out[1].Recv != 9 {
+		t.Fatalf("counter should keep last value, got %d", out[1].Recv)
+	}
+}
+
+func TestCheckAndAlerter(t *testing.T) {
+	th := Thresholds{Disk: 90, MemGrowth: 50, MemWindow: time.Hour, Offline: 3 * time.Minute}
+	base := time.Unix(0, 0)
+	h := []Sample{
+		{Time: base, Disk: 80, ProcMem: 100, Online: true},
+		{Time: base.Add(time.Minute), Disk: 80, ProcMem: 120, Online: false},
+		{Time: base.Add(2 * time.Minute), Disk: 80, ProcMem: 140, Online: false},
+	}
+	if al := th.Check(h); len(al) != 0 {
+		t.Fatal("expect no alert", al)
+	}
+	h = append(h, Sample{Time: base.Add(4 * time.Minute), Disk: 95, ProcMem: 160, Online: false})
+	var a Alerter
+	fired, resolved := a.Evaluate(th, h)
+	if len(fired) != 3 || len(resolved) != 0 {
+		t.Fatal("expect 3 alerts", fired, resolved)
+	}
+	fired, _ = a.Evaluate(th, h)
+	if len(fired) != 0 {
+		t.Fatal("alerts should be reported once", fired)
+	}
+	h = append(h, Sample{Time: base.Add(5 * time.Minute), Disk: 50, ProcMem: 160, Online: true})
+	fired, resolved = a.Evaluate(th, h)
+	if len(fired) != 0 || strings.Join(resolved, ",") != AlertDisk+","+AlertOffline {
+		t.Fatal("unexpected resolve", fired, resolved)
+	}
+}
+
+func TestRecorderAndPrometheus(t *testing.T) {
+	r := NewRecorder()
+	r.Observe("b", 2*time.Millisecond)
+	r.Observe("a", time.Millisecond)
+	r.Observe("b", 4*time.Millisecond)
+	cur := r.Swap()
+	if len(cur) != 2 || cur[1].Count != 2 || cur[1].Max != 4*time.Millisecond || cur[1].Avg() != 3*time.Millisecond {
+		t.Fatal("unexpected stats", cur)
+	}
+	if len(r.Swap()) != 0 {
+		t.Fatal("swap should reset")
+	}
+	merged := Merge(append(cur, r.Totals()...))
+	if merged[0].Service != "b" || merged[0].Count != 4 {
+		t.Fatal("unexpected merge", merged)
+	}
+	var sb strings.Builder
+	err := WritePrometheus(&sb, Sample{CPU: 12.5, Online: true, Recv: 3}, r.Totals())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, want := range []string{"zbp_cpu_percent 12.50\n", "zbp_bot_online 1\n", "zbp_messages_received_total 3\n", `zbp_handler_calls_total{plugin="b"} 2`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestSlot(t *testing.T) {
+	a := Slot(time.Unix(60, 0), time.Minute, 10)
+	b := Slot(time.Unix(60+10*60, 0), time.Minute, 10)
+	if a != b || a != 1 {
+		t.Fatal("unexpected slot", a, b)
+	}
+}
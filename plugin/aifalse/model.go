@@ -0,0 +1,331 @@
+package aifalse
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/metrics"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/ratelimit"
+)
+
+const (
+	sampleTable  = "sample"
+	handlerTable = "handler"
+	settingTable = "setting"
+	limitTable   = "ratelimit"
+	whiteTable   = "ratewhite"
+)
+
+const (
+	// sampleInterval 采样间隔
+	sampleInterval = time.Minute
+	// sampleCapacity 环形缓冲容量, 保存 7 天
+	sampleCapacity = 7 * 24 * 60
+)
+
+// metricdb 指标的环形缓冲数据库
+type metricdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+type sampleItem struct {
+	Slot       int64   `db:"slot"`
+	Time       int64   `db:"time"`
+	CPU        float64 `db:"cpu"`
+	Mem        float64 `db:"mem"`
+	Swap       float64 `db:"swap"`
+	Disk       float64 `db:"disk"`
+	ProcMem    int64   `db:"procmem"`
+	Goroutines int64   `db:"goroutines"`
+	Online     bool    `db:"online"`
+	Recv       int64   `db:"recv"`
+	Sent       int64   `db:"sent"`
+}
+
+type handlerItem struct {
+	ID      string `db:"id"` // slot/service
+	Slot    int64  `db:"slot"`
+	Time    int64  `db:"time"`
+	Service string `db:"service"`
+	Count   int64  `db:"count"`
+	Total   int64  `db:"total"` // 微秒
+	Max     int64  `db:"max"`   // 微秒
+}
+
+type limitItem struct {
+	ID       int64  `db:"id"`
+	Service  string `db:"service"`
+	Command  string `db:"command"`
+	GroupID  int64  `db:"gid"`
+	UserID   int64  `db:"uid"`
+	Interval int64  `db:"interval"` // 秒
+	Burst    int64  `db:"burst"`
+	Scope    uint8  `db:"scope"`
+}
+
+type whiteItem struct {
+	UserID int64 `db:"uid"`
+}
+
+type settingItem struct {
+	Key   string `db:"name"`
+	Value int64  `db:"value"`
+}
+
+const (
+	settingDisk      = "disk"
+	settingMemGrowth = "memgrowth"
+	settingOffline   = "offline"
+	settingPort      = "port"
+)
+
+// defaultThresholds 默认告警阈值
+var defaultThresholds = metrics.Thresholds{
+	Disk:      90,
+	MemGrowth: 100,
+	MemWindow: time.Hour,
+	Offline:   5 * time.Minute,
+}
+
+var mdb = &metricdb{}
+
+func (db *metricdb) init(path string) error {
+	db.DBPath = path
+	err := db.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = db.Create(sampleTable, &sampleItem{})
+	if err != nil {
+		return err
+	}
+	err = db.Create(handlerTable, &handlerItem{})
+	if err != nil {
+		return err
+	}
+	err = db.Create(settingTable, &settingItem{})
+	if err != nil {
+		return err
+	}
+	err = db.Create(limitTable, &limitItem{})
+	if err != nil {
+		return err
+	}
+	return db.Create(whiteTable, &whiteItem{})
+}
+
+// add 写入一次采样与该周期的插件统计, 覆盖同一位置的旧数据
+func (db *metricdb) add(s *metrics.Sample, handlers []metrics.HandlerStat) error {
+	slot := metrics.Slot(s.Time, sampleInterval, sampleCapacity)
+	db.Lock()
+	defer db.Unlock()
+	err := db.Insert(sampleTable, &sampleItem{
+		Slot:       slot,
+		Time:       s.Time.Unix(),
+		CPU:        s.CPU,
+		Mem:        s.Mem,
+		Swap:       s.Swap,
+		Disk:       s.Disk,
+		ProcMem:    int64(s.ProcMem),
+		Goroutines: int64(s.Goroutines),
+		Online:     s.Online,
+		Recv:       s.Recv,
+		Sent:       s.Sent,
+	})
+	if err != nil {
+		return err
+	}
+	slotstr := strconv.FormatInt(slot, 10)
+	err = db.Del(handlerTable, "WHERE slot = "+slotstr)
+	if err != nil && err != sql.ErrNullResult {
+		return err
+	}
+	for _, h := range handlers {
+		err = db.Insert(handlerTable, &handlerItem{
+			ID:      slotstr + "/" + h.Service,
+			Slot:    slot,
+			Time:    s.Time.Unix(),
+			Service: h.Service,
+			Count:   h.Count,
+			Total:   h.Total.Microseconds(),
+			Max:     h.Max.Microseconds(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// samples since 之后的采样, 按时间升序
+func (db *metricdb) samples(since time.Time) ([]metrics.Sample, error) {
+	db.RLock()
+	defer db.RUnlock()
+	var (
+		item sampleItem
+		ss   []metrics.Sample
+	)
+	err := db.FindFor(sampleTable, &item, "WHERE time >= "+strconv.FormatInt(since.Unix(), 10)+" ORDER BY time ASC", func() error {
+		ss = append(ss, metrics.Sample{
+			Time:       time.Unix(item.Time, 0),
+			CPU:        item.CPU,
+			Mem:        item.Mem,
+			Swap:       item.Swap,
+			Disk:       item.Disk,
+			ProcMem:    uint64(item.ProcMem),
+			Goroutines: int(item.Goroutines),
+			Online:     item.Online,
+			Recv:       item.Recv,
+			Sent:       item.Sent,
+		})
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return ss, err
+}
+
+// handlers since 之后各插件的统计
+func (db *metricdb) handlers(since time.Time) ([]metrics.HandlerStat, error) {
+	db.RLock()
+	defer db.RUnlock()
+	var (
+		item handlerItem
+		hs   []metrics.HandlerStat
+	)
+	err := db.FindFor(handlerTable, &item, "WHERE time >= "+strconv.FormatInt(since.Unix(), 10), func() error {
+		hs = append(hs, metrics.HandlerStat{
+			Service: item.Service,
+			Count:   item.Count,
+			Total:   time.Duration(item.Total) * time.Microsecond,
+			Max:     time.Duration(item.Max) * time.Microsecond,
+		})
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return metrics.Merge(hs), err
+}
+
+func (db *metricdb) setting(key string, def int64) int64 {
+	db.RLock()
+	defer db.RUnlock()
+	var item settingItem
+	err := db.Find(settingTable, &item, "WHERE name = '"+key+"'")
+	if err != nil {
+		return def
+	}
+	return item.Value
+}
+
+func (db *metricdb) set(key string, value int64) error {
+	db.Lock()
+	defer db.Unlock()
+	return db.Insert(settingTable, &settingItem{Key: key, Value: value})
+}
+
+// thresholds 当前的告警阈值
+func (db *metricdb) thresholds() metrics.Thresholds {
+	th := defaultThresholds
+	th.Disk = float64(db.setting(settingDisk, int64(th.Disk)))
+	th.MemGrowth = float64(db.setting(settingMemGrowth, int64(th.MemGrowth)))
+	th.Offline = time.Duration(db.setting(settingOffline, int64(th.Offline/time.Minute))) * time.Minute
+	return th
+}
+
+func (db *metricdb) policies() ([]*ratelimit.Policy, error) {
+	db.RLock()
+	defer db.RUnlock()
+	var (
+		item limitItem
+		ps   []*ratelimit.Policy
+	)
+	err := db.FindFor(limitTable, &item, "ORDER BY id ASC", func() error {
+		ps = append(ps, &ratelimit.Policy{
+			ID:       item.ID,
+			Service:  item.Service,
+			Command:  item.Command,
+			GroupID:  item.GroupID,
+			UserID:   item.UserID,
+			Interval: time.Duration(item.Interval) * time.Second,
+			Burst:    int(item.Burst),
+			Scope:    ratelimit.Scope(item.Scope),
+		})
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return ps, err
+}
+
+// addPolicy 写入策略, 相同对象的旧策略被替换
+func (db *metricdb) addPolicy(p *ratelimit.Policy) error {
+	db.Lock()
+	defer db.Unlock()
+	var item limitItem
+	q := "WHERE service = " + quote(p.Service) + " AND command = " + quote(p.Command) +
+		" AND gid = " + strconv.FormatInt(p.GroupID, 10) + " AND uid = " + strconv.FormatInt(p.UserID, 10)
+	if db.Find(limitTable, &item, q) != nil {
+		_ = db.Find(limitTable, &item, "ORDER BY id DESC LIMIT 1")
+		item.ID++
+	}
+	p.ID = item.ID
+	return db.Insert(limitTable, &limitItem{
+		ID:       p.ID,
+		Service:  p.Service,
+		Command:  p.Command,
+		GroupID:  p.GroupID,
+		UserID:   p.UserID,
+		Interval: int64(p.Interval / time.Second),
+		Burst:    int64(p.Burst),
+		Scope:    uint8(p.Scope),
+	})
+}
+
+func (db *metricdb) delPolicy(id int64) error {
+	db.Lock()
+	defer db.Unlock()
+	q := "WHERE id = " + strconv.FormatInt(id, 10)
+	if !db.CanFind(limitTable, q) {
+		return sql.ErrNullResult
+	}
+	return db.Del(limitTable, q)
+}
+
+func (db *metricdb) whitelist() ([]int64, error) {
+	db.RLock()
+	defer db.RUnlock()
+	var (
+		item whiteItem
+		uids []int64
+	)
+	err := db.FindFor(whiteTable, &item, "ORDER BY uid ASC", func() error {
+		uids = append(uids, item.UserID)
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return uids, err
+}
+
+func (db *metricdb) setWhite(uid int64, on bool) error {
+	db.Lock()
+	defer db.Unlock()
+	if on {
+		return db.Insert(whiteTable, &whiteItem{UserID: uid})
+	}
+	return db.Del(whiteTable, "WHERE uid = "+strconv.FormatInt(uid, 10))
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,177 @@
+// Package ratelimit 限速策略, 可按插件、命令、群、用户匹配
+package ratelimit
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope 限速的计数对象
+type Scope uint8
+
+const (
+	// ByUser 每个用户单独计数
+	ByUser Scope = iota
+	// ByGroup 每个群单独计数
+	ByGroup
+	// Global 所有人共用
+	Global
+)
+
+var scopeNames = [...]string{"用户", "群", "全局"}
+
+// String 打印计数对象
+func (s Scope) String() string {
+	if int(s) < len(scopeNames) {
+		return scopeNames[s]
+	}
+	return "未知"
+}
+
+// ParseScope 解析计数对象
+func ParseScope(s string) (Scope, bool) {
+	for i, name := range scopeNames {
+		if s == name {
+			return Scope(i), true
+		}
+	}
+	return ByUser, false
+}
+
+// AllServices 匹配所有插件的服务名
+const AllServices = "*"
+
+// Policy 一条限速策略
+type Policy struct {
+	ID int64
+	// Service 插件名, * 表示所有插件
+	Service string
+	// Command 命令前缀, 为空时匹配该插件所有命令
+	Command string
+	// GroupID UserID 仅在该群/对该用户生效, 0 表示不限
+	GroupID int64
+	UserID  int64
+	// 每 Interval 内 Burst 次
+	Interval time.Duration
+	Burst    int
+	Scope    Scope
+}
+
+// String 打印策略
+func (p *Policy) String() string {
+	var sb strings.Builder
+	sb.WriteString("[" + strconv.FormatInt(p.ID, 10) + "] " + p.Service)
+	if p.Command != "" {
+		sb.WriteString(":" + p.Command)
+	}
+	sb.WriteString(" 每" + p.Interval.String() + strconv.Itoa(p.Burst) + "次 按" + p.Scope.String())
+	if p.GroupID != 0 {
+		sb.WriteString(" 群" + strconv.FormatInt(p.GroupID, 10))
+	}
+	if p.UserID != 0 {
+		sb.WriteString(" 用户" + strconv.FormatInt(p.UserID, 10))
+	}
+	return sb.String()
+}
+
+func (p *Policy) matches(service, text string, gid, uid int64) bool {
+	return (p.Service == AllServices || p.Service == service) &&
+		(p.Command == "" || strings.HasPrefix(text, p.Command)) &&
+		(p.GroupID == 0 || p.GroupID == gid) &&
+		(p.UserID == 0 || p.UserID == uid)
+}
+
+// specificity 越具体的策略优先: 用户 > 群 > 命令 > 插件 > 所有插件
+func (p *Policy) specificity() int {
+	n := 0
+	if p.UserID != 0 {
+		n += 8
+	}
+	if p.GroupID != 0 {
+		n += 4
+	}
+	if p.Command != "" {
+		n += 2
+	}
+	if p.Service != AllServices {
+		n++
+	}
+	return n
+}
+
+// Key 计数对象, 按群时私聊为负的用户号
+func (p *Policy) Key(gid, uid int64) int64 {
+	switch p.Scope {
+	case ByGroup:
+		if gid != 0 {
+			return gid
+		}
+		return -uid // 私聊按用户计
+	case Global:
+		return 0
+	}
+	return uid
+}
+
+// Table 限速策略表
+type Table struct {
+	mu       sync.RWMutex
+	policies []*Policy
+	white    map[int64]bool
+}
+
+// NewTable 新建策略表
+func NewTable() *Table {
+	return &Table{white: make(map[int64]bool)}
+}
+
+// SetPolicies 替换全部策略
+func (t *Table) SetPolicies(ps []*Policy) {
+	policies := append([]*Policy(nil), ps...)
+	sort.SliceStable(policies, func(i, j int) bool {
+		return policies[i].specificity() > policies[j].specificity()
+	})
+	t.mu.Lock()
+	t.policies = policies
+	t.mu.Unlock()
+}
+
+// Policies 按优先级排序的全部策略
+func (t *Table) Policies() []*Policy {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]*Policy(nil), t.policies...)
+}
+
+// SetWhitelist 替换白名单
+func (t *Table) SetWhitelist(uids []int64) {
+	white := make(map[int64]bool, len(uids))
+	for _, uid := range uids {
+		white[uid] = true
+	}
+	t.mu.Lock()
+	t.white = white
+	t.mu.Unlock()
+}
+
+// Whitelisted 用户是否不受任何限速
+func (t *Table) Whitelisted(uid int64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.white[uid]
+}
+
+// Lookup 最具体的匹配策略, 没有时返回 nil
+func (t *Table) Lookup(service, text string, gid, uid int64) *Policy {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, p := range t.policies {
+		if p.matches(service, text, gid, uid) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	tb := NewTable()
+	tb.SetPolicies([]*Policy{
+		{ID: 1, Service: "gif", Interval: time.Minute, Burst: 3, Scope: ByGroup},
+		{ID: 2, Service: "gif", GroupID: 100, UserID: 7, Interval: time.Minute, Burst: 1},
+		{ID: 3, Service: AllServices, Command: "来份", Interval: time.Minute, Burst: 2, Scope: Global},
+	})
+	if p := tb.Lookup("gif", "", 100, 9); p == nil || p.ID != 1 {
+		t.Fatal("expect plugin policy", p)
+	}
+	// 用户 7 在群 100 命中更具体的策略
+	if p := tb.Lookup("gif", "", 100, 7); p == nil || p.ID != 2 {
+		t.Fatal("expect user policy", p)
+	}
+	if p := tb.Lookup("gif", "", 200, 7); p == nil || p.ID != 1 {
+		t.Fatal("user policy is bound to group 100", p)
+	}
+	if tb.Lookup("other", "", 100, 9) != nil {
+		t.Fatal("unmatched plugin should have no policy")
+	}
+	if p := tb.Lookup("setu", "来份涩图", 1, 1); p == nil || p.ID != 3 {
+		t.Fatal("expect command policy", p)
+	}
+	if tb.Lookup("setu", "查看", 1, 1) != nil {
+		t.Fatal("command prefix should not match")
+	}
+	if len(tb.Policies()) != 3 || tb.Policies()[0].ID != 2 {
+		t.Fatal("policies should be sorted by specificity")
+	}
+	tb.SetWhitelist([]int64{9})
+	if !tb.Whitelisted(9) || tb.Whitelisted(7) {
+		t.Fatal("unexpected whitelist")
+	}
+}
+
+func TestKeyAndScope(t *testing.T) {
+	p := &Policy{Scope: ByGroup}
+	if p.Key(100, 7) != 100 || p.Key(0, 7) != -7 {
+		t.Fatal("group scope should count private chats by user")
+	}
+	p.Scope = Global
+	if p.Key(100, 7) != 0 {
+		t.Fatal("global scope should share one key")
+	}
+	p.Scope = ByUser
+	if p.Key(100, 7) != 7 {
+		t.Fatal("user scope should count by user")
+	}
+	if s, ok := ParseScope("群"); !ok || s != ByGroup || s.String() != "群" {
+		t.Fatal("unexpected scope")
+	}
+}
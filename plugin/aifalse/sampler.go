@@ -0,0 +1,155 @@
+package aifalse
+
+import (
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/hook"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/metrics"
+)
+
+var (
+	alerter metrics.Alerter
+	// latest 最近一次采样, 供 /metrics 使用
+	latest   metrics.Sample
+	latestmu sync.RWMutex
+)
+
+var sampleronce sync.Once
+
+// startsampler 启动采样器, 已配置端口时同时开启监控接口, 仅首次调用生效
+func startsampler() {
+	sampleronce.Do(func() {
+		if port := mdb.setting(settingPort, 0); port != 0 {
+			err := servemetrics(port)
+			if err != nil {
+				logrus.Warnln("[aifalse] 开启监控接口失败:", err)
+			}
+		}
+		go runsampler()
+	})
+}
+
+// runsampler 每分钟采样一次, 写入数据库并检查告警
+func runsampler() {
+	_, _ = cpu.Percent(0, false) // 首次调用作为基准
+	for range time.NewTicker(sampleInterval).C {
+		s := collect()
+		latestmu.Lock()
+		latest = s
+		latestmu.Unlock()
+		err := mdb.add(&s, hook.Recorder.Swap())
+		if err != nil {
+			logrus.Warnln("[aifalse] 保存采样失败:", err)
+			continue
+		}
+		th := mdb.thresholds()
+		history, err := mdb.samples(s.Time.Add(-th.MemWindow))
+		if err != nil {
+			logrus.Warnln("[aifalse] 读取采样失败:", err)
+			continue
+		}
+		fired, resolved := alerter.Evaluate(th, history)
+		for _, a := range fired {
+			alert("[告警] " + a.Message)
+		}
+		for _, kind := range resolved {
+			alert("[恢复] " + kind + "告警已解除")
+		}
+	}
+}
+
+// collect 采集一次系统与 bot 的状态
+func collect() (s metrics.Sample) {
+	s.Time = time.Now()
+	if percent, err := cpu.Percent(0, false); err == nil && len(percent) > 0 {
+		s.CPU = percent[0]
+	}
+	if raminfo, err := mem.VirtualMemory(); err == nil {
+		s.Mem = raminfo.UsedPercent
+	}
+	if swapinfo, err := mem.SwapMemory(); err == nil {
+		s.Swap = swapinfo.UsedPercent
+	}
+	if disks, err := diskstate(); err == nil {
+		for _, d := range disks {
+			if d.precent > s.Disk {
+				s.Disk = d.precent
+			}
+		}
+	}
+	var mems runtime.MemStats
+	runtime.ReadMemStats(&mems)
+	s.ProcMem = mems.Sys
+	s.Goroutines = runtime.NumGoroutine()
+	zero.RangeBot(func(_ int64, ctx *zero.Ctx) bool {
+		st := ctx.CallAction("get_status", zero.Params{}).Data
+		if !st.Get("online").Bool() {
+			return true
+		}
+		s.Online = true
+		s.Recv += st.Get("stat.message_received").Int()
+		s.Sent += st.Get("stat.message_sent").Int()
+		return true
+	})
+	return
+}
+
+// alert 私聊所有主人, 全部 bot 离线时仅记录日志
+func alert(msg string) {
+	logrus.Warnln("[aifalse]", msg)
+	zero.RangeBot(func(_ int64, ctx *zero.Ctx) bool {
+		for _, su := range zero.BotConfig.SuperUsers {
+			ctx.SendPrivateMessage(su, message.Text(msg))
+		}
+		return false
+	})
+}
+
+var (
+	metricsrv   *http.Server
+	metricsrvmu sync.Mutex
+)
+
+// servemetrics 在 port 上提供 Prometheus 格式的 /metrics, port 为 0 时关闭
+func servemetrics(port int64) error {
+	metricsrvmu.Lock()
+	defer metricsrvmu.Unlock()
+	if metricsrv != nil {
+		_ = metricsrv.Close()
+		metricsrv = nil
+	}
+	if port == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		latestmu.RLock()
+		s := latest
+		latestmu.RUnlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = metrics.WritePrometheus(w, s, hook.Recorder.Totals())
+	})
+	ln, err := net.Listen("tcp", ":"+strconv.FormatInt(port, 10))
+	if err != nil {
+		return err
+	}
+	metricsrv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func(srv *http.Server) {
+		err := srv.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			logrus.Warnln("[aifalse] metrics 接口退出:", err)
+		}
+	}(metricsrv)
+	return nil
+}
@@ -0,0 +1,138 @@
+package aifalse
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"github.com/wcharczuk/go-chart/v2"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/metrics"
+)
+
+var errNoSample = errors.New("还没有采样数据, 请稍后再试")
+
+// trendrange 趋势图的时间范围与聚合粒度
+func trendrange(s string) (span, bucket time.Duration, format string) {
+	if s == "7d" || s == "7天" {
+		return 7 * 24 * time.Hour, 30 * time.Minute, "01-02 15:04"
+	}
+	return 24 * time.Hour, 5 * time.Minute, "15:04"
+}
+
+// drawtrend 绘制资源占用与消息量的趋势图, 并列出处理次数最多的插件
+func drawtrend(span, bucket time.Duration, format string) (usage, msgs []byte, summary string, err error) {
+	since := time.Now().Add(-span)
+	ss, err := mdb.samples(since)
+	if err != nil {
+		return
+	}
+	if len(ss) < 2 {
+		err = errNoSample
+		return
+	}
+	ss = metrics.Downsample(ss, bucket)
+	_, err = file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return
+	}
+	b, err := os.ReadFile(text.FontFile)
+	if err != nil {
+		return
+	}
+	font, err := freetype.ParseFont(b)
+	if err != nil {
+		return
+	}
+
+	xs := make([]time.Time, len(ss))
+	cpus := make([]float64, len(ss))
+	mems := make([]float64, len(ss))
+	disks := make([]float64, len(ss))
+	for i, s := range ss {
+		xs[i], cpus[i], mems[i], disks[i] = s.Time, s.CPU, s.Mem, s.Disk
+	}
+	usage, err = render(font, "资源占用(%)", format, &chart.ContinuousRange{Min: 0, Max: 100},
+		chart.TimeSeries{Name: "CPU", XValues: xs, YValues: cpus},
+		chart.TimeSeries{Name: "RAM", XValues: xs, YValues: mems},
+		chart.TimeSeries{Name: "Disk", XValues: xs, YValues: disks},
+	)
+	if err != nil {
+		return
+	}
+
+	// 收发数为累计值, 取相邻两点之差, 重启导致的回退记为 0
+	recvs := make([]float64, len(ss)-1)
+	sents := make([]float64, len(ss)-1)
+	for i := 1; i < len(ss); i++ {
+		if d := ss[i].Recv - ss[i-1].Recv; d > 0 {
+			recvs[i-1] = float64(d)
+		}
+		if d := ss[i].Sent - ss[i-1].Sent; d > 0 {
+			sents[i-1] = float64(d)
+		}
+	}
+	msgs, err = render(font, "每"+strconv.Itoa(int(bucket.Minutes()))+"分钟消息数", format, nil,
+		chart.TimeSeries{Name: "收", XValues: xs[1:], YValues: recvs},
+		chart.TimeSeries{Name: "发", XValues: xs[1:], YValues: sents},
+	)
+	if err != nil {
+		return
+	}
+
+	hs, err := mdb.handlers(since)
+	if err != nil {
+		return
+	}
+	var sb strings.Builder
+	offline := 0
+	for _, s := range ss {
+		if !s.Online {
+			offline++
+		}
+	}
+	sb.WriteString("离线时段: " + strconv.Itoa(offline) + "/" + strconv.Itoa(len(ss)) + "\n")
+	sb.WriteString("插件处理次数 | 平均耗时 | 最大耗时\n")
+	if len(hs) > 10 {
+		hs = hs[:10]
+	}
+	for _, h := range hs {
+		sb.WriteString(h.Service + ": " + strconv.FormatInt(h.Count, 10) + " | " +
+			h.Avg().Round(time.Millisecond).String() + " | " + h.Max.Round(time.Millisecond).String() + "\n")
+	}
+	summary = sb.String()
+	return
+}
+
+func render(font *truetype.Font, title, format string, yrange chart.Range, series ...chart.TimeSeries) ([]byte, error) {
+	graph := chart.Chart{
+		Font:   font,
+		Title:  title,
+		Width:  1000,
+		Height: 400,
+		Background: chart.Style{
+			Padding: chart.Box{Top: 50, Left: 20},
+		},
+		XAxis: chart.XAxis{
+			ValueFormatter: chart.TimeValueFormatterWithFormat(format),
+		},
+	}
+	if yrange != nil {
+		graph.YAxis.Range = yrange
+	}
+	for _, s := range series {
+		graph.Series = append(graph.Series, s)
+	}
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+	var buf bytes.Buffer
+	err := graph.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
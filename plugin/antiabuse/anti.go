@@ -15,11 +15,18 @@ import (
 	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
 )
 
-const bandur time.Duration = time.Minute * 10
+// bantime 默认禁言/屏蔽时间, 分钟
+const bantime = 10
+
+const bandur time.Duration = time.Minute * bantime
 
 var (
+	engine   *control.Engine
+	onceRule zero.Rule
 	managers *ctrl.Manager[*zero.Ctx] // managers lazy load
 	cache    = ttl.NewCacheOn(bandur, [4]func(int64, struct{}){nil, nil, onDel, nil})
 	db       *antidb
@@ -37,15 +44,44 @@ func onDel(uid int64, _ struct{}) {
 	}
 }
 
+// clean 去掉消息中的换行等字符
+var clean = strings.NewReplacer("\n", "", "\r", "", "\t", "", ";", "")
+
+// detector 对 bot 说的话中含有违禁词时判为违规
+type detector struct{}
+
+func (detector) Name() string { return "antiabuse" }
+
+func (detector) Enabled(gid int64) bool { return engine.IsEnabledIn(gid) }
+
+func (detector) Detect(ctx *zero.Ctx, c *pipeline.Content) ([]pipeline.Verdict, error) {
+	if !c.ToMe || !onceRule(ctx) {
+		return nil, nil
+	}
+	word, ok := db.hitWord(c.GroupID, clean.Replace(c.Text))
+	if !ok {
+		return nil, nil
+	}
+	return []pipeline.Verdict{{Category: "违禁词", Level: pipeline.Violation, Detail: word}}, nil
+}
+
+// DefaultPolicy 与原先一致, 违规时禁言并屏蔽10分钟
+func (detector) DefaultPolicy(_ int64, lv pipeline.Level) pipeline.Policy {
+	if lv != pipeline.Violation {
+		return pipeline.Policy{}
+	}
+	return pipeline.Policy{Actions: pipeline.ActWarn | pipeline.ActBan | pipeline.ActBlock, BanTime: bantime}
+}
+
 func init() {
-	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault:  false,
 		Brief:             "违禁词检测",
-		Help:              "- /[添加|删除|查看]违禁词",
+		Help:              "- /[添加|删除|查看]违禁词\n注: 本群启用 moderation 插件时违规的处置由其审核策略决定, 否则封禁/屏蔽10分钟",
 		PrivateDataFolder: "anti_abuse",
 	})
 
-	onceRule := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+	onceRule = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
 		managers = ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).Manager
 		var err error
 		db, err = newantidb(engine.DataFolder() + "anti_abuse.db")
@@ -56,18 +92,16 @@ func init() {
 		return true
 	})
 
+	pipeline.Register(detector{})
+
+	// 本群未启用 moderation 插件时按原先的方式自行封禁/屏蔽
 	engine.OnMessage(onceRule, zero.OnlyGroup, func(ctx *zero.Ctx) bool {
-		if !ctx.Event.IsToMe {
+		if !ctx.Event.IsToMe || pipeline.Active(ctx.Event.GroupID) {
 			return true
 		}
 		uid := ctx.Event.UserID
-		gid := ctx.Event.GroupID
-		msg := strings.ReplaceAll(ctx.MessageString(), "\n", "")
-		msg = strings.ReplaceAll(msg, "\r", "")
-		msg = strings.ReplaceAll(msg, "\t", "")
-		msg = strings.ReplaceAll(msg, ";", "")
-		if db.isInAntiList(gid, msg) {
-			if err := ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).Manager.DoBlock(uid); err == nil {
+		if _, ok := db.hitWord(ctx.Event.GroupID, clean.Replace(ctx.MessageString())); ok {
+			if err := managers.DoBlock(uid); err == nil {
 				t := time.Now().Unix()
 				cache.Set(uid, struct{}{})
 				ctx.SetThisGroupBan(uid, int64(bandur.Minutes()))
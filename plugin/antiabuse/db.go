@@ -19,6 +19,7 @@ type banWord struct {
 	Word string `db:"word"`
 }
 
+// banTime 未启用 moderation 插件时自行屏蔽的开始时间
 type banTime struct {
 	ID   int64 `db:"id"`
 	Time int64 `db:"time"`
@@ -50,11 +51,14 @@ func newantidb(path string) (*antidb, error) {
 	return db, nil
 }
 
-func (db *antidb) isInAntiList(gid int64, msg string) bool {
+// hitWord 返回消息命中的违禁词
+func (db *antidb) hitWord(gid int64, msg string) (string, bool) {
 	grp := strconv.FormatInt(gid, 36)
+	word := &banWord{}
 	db.RLock()
 	defer db.RUnlock()
-	return db.CanFind(grp, "WHERE instr('"+msg+"', word)>0")
+	err := db.Find(grp, word, "WHERE instr('"+strings.ReplaceAll(msg, "'", "''")+"', word)>0")
+	return word.Word, err == nil
 }
 
 func (db *antidb) insertWord(gid int64, word string) error {
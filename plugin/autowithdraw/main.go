@@ -2,28 +2,196 @@
 package autowithdraw
 
 import (
+	"time"
+
+	fcext "github.com/FloatTech/floatbox/ctxext"
+	"github.com/FloatTech/floatbox/math"
 	"github.com/FloatTech/floatbox/process"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/aifalse/hook"
 )
 
+// defaultretain 回复记录默认保留时间, 小时
+const defaultretain = 24
+
+// setting 群设置, 第 0 位为关闭管理员撤回联动, 第 8 位以上为记录保留小时数
+type setting int64
+
+func (s setting) cascade() bool {
+	return s&1 == 0
+}
+
+func (s *setting) setcascade(on bool) {
+	if on {
+		*s &^= 1
+	} else {
+		*s |= 1
+	}
+}
+
+func (s setting) retain() time.Duration {
+	hours := int64(s >> 8)
+	if hours <= 0 {
+		hours = defaultretain
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func (s *setting) setretain(hours int64) {
+	*s = *s&0xff | setting(hours<<8)
+}
+
+// settingid 私聊使用负的用户 id
+func settingid(ctx *zero.Ctx) int64 {
+	if ctx.Event.GroupID != 0 {
+		return ctx.Event.GroupID
+	}
+	return -ctx.Event.UserID
+}
+
 func init() {
-	control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "触发者撤回时也自动撤回",
-		Help:             "- 撤回一条消息\n",
-	}).OnNotice(func(ctx *zero.Ctx) bool {
+		Help: "- 撤回一条消息\n" +
+			"- [群管] [开启|关闭]管理员撤回联动\n" +
+			"- [群管] 设置撤回记录保留[N]小时\n" +
+			"- [群管] 撤回bot最近[N]条\n" +
+			"Tips: 管理员撤回联动默认开启; 触发消息与回复的对应关系会持久保存, 重启后撤回仍会联动, 默认保留24小时; " +
+			"仅记录插件处理完时已有回复的消息, 两次回复间隔超过4分钟时, 之后的回复不会联动撤回",
+		PrivateDataFolder: "autowithdraw",
+	})
+
+	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+		err := db.init(engine.DataFolder() + "withdraw.db")
+		if err != nil {
+			logrus.Errorln("[autowithdraw] 打开数据库失败:", err)
+			return false
+		}
+		go collect()
+		return true
+	})
+
+	c, ok := control.Lookup("autowithdraw")
+	if !ok {
+		panic("register autowithdraw error")
+	}
+	// 在所有插件处理完消息后记录, 避免被高优先级的阻断命令跳过, 且只记录有回复的消息
+	hook.UsePostHandler(func(ctx *zero.Ctx) {
+		if ctx.Event.PostType != "message" || ctx.Event.UserID == ctx.Event.SelfID {
+			return
+		}
+		id, ok := ctx.Event.MessageID.(int64)
+		if !ok {
+			return
+		}
+		mid := message.NewMessageIDFromInteger(id)
+		if len(zero.GetTriggeredMessages(mid)) == 0 || !c.Handler(ctx.Event.GroupID, ctx.Event.UserID) || !getdb(ctx) {
+			return
+		}
+		enqueue(&trigger{
+			id:     mid,
+			gid:    ctx.Event.GroupID,
+			uid:    ctx.Event.UserID,
+			at:     time.Now(),
+			retain: setting(c.GetData(settingid(ctx))).retain(),
+		})
+	})
+	engine.OnNotice(func(ctx *zero.Ctx) bool {
 		return ctx.Event.NoticeType == "group_recall" || ctx.Event.NoticeType == "friend_recall"
-	}).SetBlock(false).Handle(func(ctx *zero.Ctx) {
+	}, getdb).SetBlock(false).Handle(func(ctx *zero.Ctx) {
 		id, ok := ctx.Event.MessageID.(int64)
 		if !ok {
 			return
 		}
-		for _, msg := range zero.GetTriggeredMessages(message.NewMessageIDFromInteger(id)) {
-			process.SleepAbout1sTo2s()
-			ctx.DeleteMessage(msg)
+		// 管理员撤回他人的消息时, 关闭联动后不撤回回复
+		if ctx.Event.NoticeType == "group_recall" && ctx.Event.OperatorID != ctx.Event.UserID {
+			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			if !ok || !setting(c.GetData(ctx.Event.GroupID)).cascade() {
+				return
+			}
+		}
+		mid := message.NewMessageIDFromInteger(id)
+		dequeue(mid.String())
+		ids := db.responses(mid.String())
+		for _, msg := range zero.GetTriggeredMessages(mid) {
+			ids = append(ids, msg.String())
+		}
+		withdraw(ctx, ids)
+		err := db.delTrigger(mid.String())
+		if err != nil {
+			logrus.Warnln("[autowithdraw] 删除记录失败:", err)
 		}
 	})
+	engine.OnRegex(`^(开启|关闭)管理员撤回联动$`, zero.AdminPermission, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			option := ctx.State["regex_matched"].([]string)[1]
+			s := setting(c.GetData(ctx.Event.GroupID))
+			s.setcascade(option == "开启")
+			err := c.SetData(ctx.Event.GroupID, int64(s))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已", option, "管理员撤回联动"))
+		})
+	engine.OnRegex(`^设置撤回记录保留(\d+)小时$`, zero.AdminPermission, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			hours := math.Str2Int64(ctx.State["regex_matched"].([]string)[1])
+			if hours <= 0 || hours > 720 {
+				ctx.SendChain(message.Text("保留时间需在1~720小时之间"))
+				return
+			}
+			s := setting(c.GetData(ctx.Event.GroupID))
+			s.setretain(hours)
+			err := c.SetData(ctx.Event.GroupID, int64(s))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已设置撤回记录保留", hours, "小时, 对之后的消息生效"))
+		})
+	engine.OnRegex(`^撤回bot最近(\d+)条$`, zero.AdminPermission, zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			n := int(math.Str2Int64(ctx.State["regex_matched"].([]string)[1]))
+			if n <= 0 || n > 50 {
+				ctx.SendChain(message.Text("一次最多撤回50条"))
+				return
+			}
+			flush(ctx.Event.GroupID)
+			ids := db.latest(ctx.Event.GroupID, n)
+			if len(ids) == 0 {
+				ctx.SendChain(message.Text("没有可撤回的消息"))
+				return
+			}
+			withdraw(ctx, ids)
+			ctx.SendChain(message.Text("已撤回", len(ids), "条消息"))
+		})
+}
+
+// withdraw 去重后逐条撤回并删除记录
+func withdraw(ctx *zero.Ctx, ids []string) {
+	seen := make(map[string]bool, len(ids))
+	done := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		process.SleepAbout1sTo2s()
+		ctx.DeleteMessage(message.NewMessageIDFromString(id))
+		withdrawn.Set(id, true)
+		done = append(done, id)
+	}
+	err := db.del(done...)
+	if err != nil {
+		logrus.Warnln("[autowithdraw] 删除记录失败:", err)
+	}
 }
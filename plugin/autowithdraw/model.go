@@ -0,0 +1,106 @@
+package autowithdraw
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const responseTable = "response"
+
+// withdrawdb 触发消息与 bot 回复的对应关系
+type withdrawdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// response bot 的一条回复
+type response struct {
+	ID      string `db:"id"`  // 回复的消息 id
+	Trigger string `db:"tid"` // 触发消息 id
+	GroupID int64  `db:"gid"` // 私聊为 0
+	UserID  int64  `db:"uid"` // 触发者
+	Time    int64  `db:"time"`
+	Expire  int64  `db:"expire"`
+}
+
+var db = &withdrawdb{}
+
+func (wdb *withdrawdb) init(path string) error {
+	wdb.DBPath = path
+	err := wdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	return wdb.Create(responseTable, &response{})
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (wdb *withdrawdb) add(rs ...*response) error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	for _, r := range rs {
+		err := wdb.Insert(responseTable, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// responses 由 trigger 触发的所有回复 id
+func (wdb *withdrawdb) responses(trigger string) (ids []string) {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	var r response
+	_ = wdb.FindFor(responseTable, &r, "WHERE tid = "+quote(trigger), func() error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	return
+}
+
+// latest 群内 bot 最近的 n 条回复 id
+func (wdb *withdrawdb) latest(gid int64, n int) (ids []string) {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	var r response
+	_ = wdb.FindFor(responseTable, &r, "WHERE gid = "+strconv.FormatInt(gid, 10)+
+		" ORDER BY time DESC LIMIT "+strconv.Itoa(n), func() error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	return
+}
+
+func (wdb *withdrawdb) delTrigger(trigger string) error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	return wdb.Del(responseTable, "WHERE tid = "+quote(trigger))
+}
+
+func (wdb *withdrawdb) del(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	q := make([]string, len(ids))
+	for i, id := range ids {
+		q[i] = quote(id)
+	}
+	wdb.Lock()
+	defer wdb.Unlock()
+	return wdb.Del(responseTable, "WHERE id IN ("+strings.Join(q, ",")+")")
+}
+
+// purge 删除过期的记录
+func (wdb *withdrawdb) purge() error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	return wdb.Del(responseTable, "WHERE expire < "+strconv.FormatInt(time.Now().Unix(), 10))
+}
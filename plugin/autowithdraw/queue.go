@@ -0,0 +1,132 @@
+package autowithdraw
+
+import (
+	"sync"
+	"time"
+
+	"github.com/FloatTech/ttl"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// snapshotdelay 最后一次回复后继续等待新回复的时间, 加上采样间隔需小于 ZeroBot 回复缓存自最后一次回复起的 5 分钟有效期
+//
+//	两次回复间隔超过该时间时, 之后的回复不会被记录
+const snapshotdelay = 4 * time.Minute
+
+// trigger 等待写入数据库的一条触发消息
+type trigger struct {
+	id     message.MessageID
+	gid    int64
+	uid    int64
+	at     time.Time
+	retain time.Duration
+	// seen 上次写入时的回复数, last 回复数最后一次变化的时间
+	seen int
+	last time.Time
+}
+
+var (
+	queuemu sync.Mutex
+	queue   []*trigger
+	// withdrawn 最近已撤回的回复, 避免写入后被再次撤回
+	withdrawn = ttl.NewCache[string, bool](10 * time.Minute)
+)
+
+// enqueue 加入有回复的触发消息, 同一消息由多个插件回复时只加入一次
+func enqueue(t *trigger) {
+	t.last = t.at
+	queuemu.Lock()
+	defer queuemu.Unlock()
+	for _, q := range queue {
+		if q.id == t.id {
+			return
+		}
+	}
+	queue = append(queue, t)
+}
+
+// dequeue 触发消息被撤回后不再写入
+func dequeue(id string) {
+	queuemu.Lock()
+	defer queuemu.Unlock()
+	for i, t := range queue {
+		if t.id.String() == id {
+			queue = append(queue[:i], queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// flush 立即写入群内尚在等待的回复, 触发消息仍留在队列中以便收集之后的回复
+func flush(gid int64) {
+	var rs []*response
+	queuemu.Lock()
+	for _, t := range queue {
+		if t.gid == gid {
+			rs = append(rs, t.responses()...)
+		}
+	}
+	queuemu.Unlock()
+	err := db.add(rs...)
+	if err != nil {
+		logrus.Warnln("[autowithdraw] 保存记录失败:", err)
+	}
+}
+
+// collect 定时将触发消息的新回复写入数据库并清理过期记录
+func collect() {
+	purge := time.NewTicker(time.Hour)
+	snapshot := time.NewTicker(30 * time.Second)
+	for {
+		select {
+		case <-purge.C:
+			err := db.purge()
+			if err != nil {
+				logrus.Warnln("[autowithdraw] 清理记录失败:", err)
+			}
+		case <-snapshot.C:
+			// 每次有新回复时重新写入, 直到 snapshotdelay 内没有新回复
+			var rs []*response
+			now := time.Now()
+			queuemu.Lock()
+			kept := queue[:0]
+			for _, t := range queue {
+				trs := t.responses()
+				if len(trs) != t.seen {
+					t.seen, t.last = len(trs), now
+					rs = append(rs, trs...)
+				}
+				if now.Sub(t.last) < snapshotdelay {
+					kept = append(kept, t)
+				}
+			}
+			queue = kept
+			queuemu.Unlock()
+			err := db.add(rs...)
+			if err != nil {
+				logrus.Warnln("[autowithdraw] 保存记录失败:", err)
+			}
+		}
+	}
+}
+
+func (t *trigger) responses() []*response {
+	ids := zero.GetTriggeredMessages(t.id)
+	rs := make([]*response, 0, len(ids))
+	for i, id := range ids {
+		if withdrawn.Get(id.String()) {
+			continue
+		}
+		rs = append(rs, &response{
+			ID:      id.String(),
+			Trigger: t.id.String(),
+			GroupID: t.gid,
+			UserID:  t.uid,
+			Time:    t.at.UnixNano() + int64(i),
+			Expire:  t.at.Add(t.retain).Unix(),
+		})
+	}
+	return rs
+}
@@ -4,6 +4,7 @@ package baiduaudit
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
@@ -16,11 +17,15 @@ import (
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/img/text"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/baiduaudit/local"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
 )
 
 var (
-	bdcli  *censor.ContentCensorClient // 百度云审核服务Client
-	txttyp = [...]string{
+	bdcli    censorClient  // 审核服务Client, 未配置key时使用本地审核
+	localcli = local.New() // 本地审核Client
+	txttyp   = [...]string{
 		0: "默认违禁词库",
 		1: "违禁违规",
 		2: "文本色情",
@@ -31,13 +36,15 @@ var (
 		7: "恶意推广-软文推广",
 	} // 文本类型
 	config = newconfig() // 插件配置
+	engine *control.Engine
 )
 
 func init() {
-	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "百度内容审核",
 		Help: "##该功能来自百度内容审核, 需购买相关服务, 并创建app##\n" +
+			"##未配置key时使用本地词库审核, 仅支持文本##\n" +
 			"- 获取BDAKey\n" +
 			"- 配置BDAKey [API key] [Secret Key]\n" +
 			"- 开启/关闭内容审核\n" +
@@ -56,6 +63,13 @@ func init() {
 			"- 设置不检测类型[类型编号]\n" +
 			"- 开启/关闭文本检测\n" +
 			"- 开启/关闭图像检测\n" +
+			"- 设置禁言衰减时间[小时, 默认:24, 0为不衰减]\n" +
+			"##处置## 以上撤回、禁言设置作为 moderation 插件中 baiduaudit 检测器的默认策略, 可被审核策略覆盖\n" +
+			"##违规记录##\n" +
+			"- 查看违规记录[@xxx|qq号]\n" +
+			"- 设置违规记录保留[天数, 默认:30, 0为永久]天\n" +
+			"##本地审核## 词库放在数据目录 local 文件夹下, 文件名为类型编号.txt, 每行一条, 以/包裹的为正则\n" +
+			"- 重载本地审核词库\n" +
 			"##测试功能##\n" +
 			"- ^文本检测[文本内容]\n" +
 			"- ^图像检测[图片]\n",
@@ -66,8 +80,20 @@ func init() {
 	err := config.load(configpath)
 	if err != nil {
 		logrus.Warnln("[baiduaudit] 加载配置错误:", err)
-	} else if config.Key1 != "" && config.Key2 != "" {
+	}
+	if config.Key1 != "" && config.Key2 != "" {
 		bdcli = censor.NewClient(config.Key1, config.Key2)
+	} else {
+		bdcli = localcli
+	}
+	localpath := engine.DataFolder() + "local"
+	err = os.MkdirAll(localpath, 0755)
+	if err != nil {
+		panic(err)
+	}
+	err = localcli.Load(localpath)
+	if err != nil {
+		logrus.Warnln("[baiduaudit] 加载本地词库错误:", err)
 	}
 
 	engine.OnFullMatch("获取BDAKey", zero.SuperUserPermission).SetBlock(true).
@@ -78,7 +104,7 @@ func init() {
 				"https://console.bce.baidu.com/ai/?_=1665977657185#/ai/antiporn/overview/resource/getFree"))
 		})
 
-	engine.OnRegex("^查看检测(类型|配置)$", zero.AdminPermission, hasinit).SetBlock(true).
+	engine.OnRegex("^查看检测(类型|配置)$", zero.AdminPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			// 获取群配置
 			group := config.groupof(ctx.Event.GroupID)
@@ -114,7 +140,11 @@ func init() {
 					"-禁言累加:%s\n"+
 					"-撤回禁言时间:%v分钟\n"+
 					"-每次累加时间:%v分钟\n"+
-					"-最大禁言时间:%v分钟", group.Enable, group.TextAudit, group.ImageAudit, group.DMRemind, group.MoreRemind, group.DMBAN, group.BANTimeAddEnable, group.BANTime, group.BANTimeAddTime, group.MaxBANTimeAddRange)
+					"-最大禁言时间:%v分钟\n"+
+					"-禁言衰减时间:%v小时\n"+
+					"违规记录保留:%v天\n"+
+					"审核服务:%s", group.Enable, group.TextAudit, group.ImageAudit, group.DMRemind, group.MoreRemind, group.DMBAN, group.BANTimeAddEnable, group.BANTime, group.BANTimeAddTime, group.MaxBANTimeAddRange,
+					group.BANTimeHalfLife, group.RetainDays, servicename())
 			}
 			b, err := text.RenderToBase64(msg, text.FontFile, 300, 20)
 			if err != nil {
@@ -124,7 +154,7 @@ func init() {
 			ctx.SendChain(message.Image("base64://" + binary.BytesToString(b)))
 		})
 
-	engine.OnRegex("^设置(不)?检测类型([0-7])$", zero.AdminPermission, hasinit).SetBlock(true).
+	engine.OnRegex("^设置(不)?检测类型([0-7])$", zero.AdminPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			k1 := ctx.State["regex_matched"].([]string)[1]
 			k2 := ctx.State["regex_matched"].([]string)[2]
@@ -139,11 +169,12 @@ func init() {
 			ctx.SendChain(message.At(ctx.Event.UserID), message.Text(fmt.Sprintf("本群将%s检测%s类型内容", k1, txttyp[inputType])))
 		})
 
-	engine.OnRegex("^设置(最大|每次|撤回)(累加|禁言)时间(\\d{1,5})$", zero.AdminPermission, hasinit).SetBlock(true).
+	engine.OnRegex("^设置(最大|每次|撤回)(累加|禁言)时间(\\d{1,5})$", zero.AdminPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			k1 := ctx.State["regex_matched"].([]string)[1]
 			k3 := ctx.State["regex_matched"].([]string)[3]
-			time, _ := strconv.ParseInt(k1, 10, 64)
+			k2 := ctx.State["regex_matched"].([]string)[2]
+			time, _ := strconv.ParseInt(k3, 10, 64)
 			config.groupof(ctx.Event.GroupID).set(func(g *group) {
 				switch k1 {
 				case "最大":
@@ -159,10 +190,10 @@ func init() {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			ctx.SendChain(message.At(ctx.Event.UserID), message.Text(fmt.Sprintf("本群%s禁言累加时间已设置为%s", k3, k1)))
+			ctx.SendChain(message.At(ctx.Event.UserID), message.Text(fmt.Sprintf("本群%s%s时间已设置为%s分钟", k1, k2, k3)))
 		})
 
-	engine.OnRegex("^(开启|关闭)(内容审核|撤回提示|撤回禁言|禁言累加|详细提示|文本检测|图像检测)$", zero.AdminPermission, hasinit).SetBlock(true).
+	engine.OnRegex("^(开启|关闭)(内容审核|撤回提示|撤回禁言|禁言累加|详细提示|文本检测|图像检测)$", zero.AdminPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			k1 := ctx.State["regex_matched"].([]string)[1]
 			k2 := ctx.State["regex_matched"].([]string)[2]
@@ -209,40 +240,117 @@ func init() {
 			}
 		})
 
-	engine.OnMessage(config.isgroupexist).SetBlock(false).Handle(func(ctx *zero.Ctx) {
-		group := config.groupof(ctx.Event.GroupID)
-		if !bool(group.Enable) {
-			return
-		}
-		var bdres baiduRes
-		var err error
-		for _, elem := range ctx.Event.Message {
-			switch elem.Type {
-			case "image":
-				if !group.ImageAudit || elem.Data["url"] == "" {
-					continue
-				}
-				res := bdcli.ImgCensorUrl(elem.Data["url"], nil)
-				bdres, err = parse2BaiduRes(res)
-				if err != nil {
-					continue
+	engine.OnFullMatch("重载本地审核词库", zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			err := localcli.Load(localpath)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功"))
+		})
+
+	engine.OnRegex(`^设置禁言衰减时间(\d{1,4})$`, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			hours, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			config.groupof(ctx.Event.GroupID).set(func(g *group) {
+				g.BANTimeHalfLife = hours
+			})
+			err := config.saveto(configpath)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.At(ctx.Event.UserID), message.Text(fmt.Sprintf("本群历史违规将每%d小时减半计入禁言累加", hours)))
+		})
+
+	engine.OnRegex(`^设置违规记录保留(\d{1,4})天$`, zero.AdminPermission, pipeline.OpenJournal).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			_ = migrate(ctx)
+			days, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			g := config.groupof(ctx.Event.GroupID)
+			g.set(func(g *group) {
+				g.RetainDays = days
+			})
+			err := config.saveto(configpath)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = g.purge(ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.At(ctx.Event.UserID), message.Text(fmt.Sprintf("本群违规记录将保留%d天", days)))
+		})
+
+	engine.OnRegex(`^查看违规记录\s*(\[CQ:at,qq=(\d+)\]|(\d+))?$`, zero.OnlyGroup, pipeline.OpenJournal).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			_ = migrate(ctx)
+			match := ctx.State["regex_matched"].([]string)
+			uid := ctx.Event.UserID
+			if match[2] != "" {
+				uid, _ = strconv.ParseInt(match[2], 10, 64)
+			} else if match[3] != "" {
+				uid, _ = strconv.ParseInt(match[3], 10, 64)
+			}
+			if uid != ctx.Event.UserID && !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Text("只有管理员可以查看他人的违规记录"))
+				return
+			}
+			g := config.groupof(ctx.Event.GroupID)
+			_ = g.purge(ctx.Event.GroupID)
+			rs, err := pipeline.Records(ctx.Event.GroupID, uid, detector{}.Name(), 20)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rs) == 0 {
+				ctx.SendChain(message.Text(uid, "在本群没有违规记录"))
+				return
+			}
+			sb := strings.Builder{}
+			sb.WriteString(strconv.FormatInt(uid, 10))
+			sb.WriteString("的违规记录:")
+			for _, r := range rs {
+				sb.WriteString("\n\n[")
+				sb.WriteString(strconv.FormatInt(r.ID, 10))
+				sb.WriteString("] ")
+				sb.WriteString(r.Time.Format("2006-01-02 15:04"))
+				sb.WriteString(" ")
+				sb.WriteString(r.Level.String())
+				sb.WriteString("\n")
+				sb.WriteString(r.Category)
+				if r.Detail != "" {
+					sb.WriteString("(")
+					sb.WriteString(r.Detail)
+					sb.WriteString(")")
 				}
-			case "text":
-				if !group.TextAudit || elem.Data["text"] == "" {
-					continue
+				sb.WriteString("\n处置: ")
+				sb.WriteString(r.Actions.String())
+				if r.BanTime > 0 {
+					sb.WriteString(" ")
+					sb.WriteString(strconv.FormatInt(r.BanTime, 10))
+					sb.WriteString("分钟")
 				}
-				bdres, err = parse2BaiduRes(bdcli.TextCensor(elem.Data["text"]))
-				if err != nil {
-					continue
+				if r.Undone {
+					sb.WriteString(" (已撤销)")
 				}
-			default:
-				continue
+				sb.WriteString("\n内容: ")
+				sb.WriteString(r.Content)
 			}
-		}
-		bdres.audit(ctx, configpath)
-	})
+			b, err := text.RenderToBase64(sb.String(), text.FontFile, 500, 20)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Image("base64://" + binary.BytesToString(b)))
+		})
+
+	pipeline.Register(detector{})
 
-	engine.OnPrefix("^文本检测", hasinit).SetBlock(false).
+	engine.OnPrefix("^文本检测").SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			args := ctx.ExtractPlainText()
 			res := bdcli.TextCensor(args)
@@ -254,7 +362,7 @@ func init() {
 			ctx.Send(config.groupof(ctx.Event.GroupID).reply(&bdres))
 		})
 
-	engine.OnPrefix("^图像检测", hasinit).SetBlock(false).
+	engine.OnPrefix("^图像检测").SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			var urls []string
 			for _, elem := range ctx.Event.Message {
@@ -277,13 +385,22 @@ func init() {
 		})
 }
 
-// 客户端是否初始化检测
-func hasinit(ctx *zero.Ctx) bool {
-	if bdcli == nil {
-		ctx.SendChain(message.Text("Key未配置"))
-		return false
+// censorClient 与 censor.ContentCensorClient 相同形状的审核接口
+type censorClient interface {
+	TextCensor(text string) string
+	ImgCensorUrl(imgURL string, options map[string]interface{}) string
+}
+
+var (
+	_ censorClient = (*censor.ContentCensorClient)(nil)
+	_ censorClient = (*local.Client)(nil)
+)
+
+func servicename() string {
+	if bdcli == censorClient(localcli) {
+		return "本地词库"
 	}
-	return true
+	return "百度内容审核"
 }
 
 func parse2BaiduRes(resjson string) (bdres baiduRes, err error) {
@@ -0,0 +1,125 @@
+package baiduaudit
+
+import (
+	"errors"
+	"strings"
+
+	fcext "github.com/FloatTech/floatbox/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
+)
+
+// detector 百度内容审核检测器, 不合规判为违规, 疑似判为疑似
+type detector struct{}
+
+func (detector) Name() string { return "baiduaudit" }
+
+func (detector) Enabled(gid int64) bool {
+	if !engine.IsEnabledIn(gid) || !config.isgroupexist(gid) {
+		return false
+	}
+	return bool(config.groupof(gid).Enable)
+}
+
+// migrate 处置记录可用后迁移旧版配置中的被禁次数, 失败时下次再试
+var migrate = fcext.DoOnceOnSuccess(func(*zero.Ctx) bool {
+	err := config.migrate(engine.DataFolder() + "config.json")
+	if err != nil {
+		logrus.Warnln("[baiduaudit] 迁移旧版违规记录失败:", err)
+		return false
+	}
+	return true
+})
+
+func (detector) Detect(ctx *zero.Ctx, c *pipeline.Content) (vs []pipeline.Verdict, err error) {
+	// 由 moderation 调用时处置记录已打开
+	_ = migrate(ctx)
+	group := config.groupof(c.GroupID)
+	var results []string
+	if group.TextAudit && c.Text != "" {
+		results = append(results, bdcli.TextCensor(c.Text))
+	}
+	if group.ImageAudit {
+		for _, url := range c.Images {
+			results = append(results, bdcli.ImgCensorUrl(url, nil))
+		}
+	}
+	for _, res := range results {
+		var bdres baiduRes
+		bdres, err = parse2BaiduRes(res)
+		if err != nil {
+			return
+		}
+		if bdres.ErrorCode != 0 {
+			return vs, errors.New(bdres.ErrorMsg)
+		}
+		if v, ok := group.verdict(&bdres); ok {
+			vs = append(vs, v)
+		}
+	}
+	if len(vs) > 0 {
+		// 新记录写入前清理过期的记录, 避免过期违规计入累加
+		_ = group.purge(c.GroupID)
+	}
+	return
+}
+
+// DefaultPolicy 由群内原有的撤回提示、撤回禁言、禁言累加设置生成
+func (detector) DefaultPolicy(gid int64, lv pipeline.Level) (p pipeline.Policy) {
+	if lv != pipeline.Violation {
+		return
+	}
+	g := config.groupof(gid)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p.Actions = pipeline.ActRecall
+	if g.DMRemind {
+		p.Actions |= pipeline.ActWarn
+	}
+	if g.DMBAN {
+		p.Actions |= pipeline.ActBan
+		p.BanTime = g.BANTime
+		if g.BANTimeAddEnable {
+			p.Accumulate = true
+			p.BanTime = g.BANTimeAddTime
+			p.MaxBanTime = g.MaxBANTimeAddRange
+			p.HalfLife = g.BANTimeHalfLife
+		}
+	}
+	return
+}
+
+// verdict 将审核结果转换为结论, 合规或处于不检测类型时返回 false
+func (g *group) verdict(bdres *baiduRes) (v pipeline.Verdict, ok bool) {
+	switch bdres.ConclusionType {
+	case 2:
+		v.Level = pipeline.Violation
+	case 3:
+		v.Level = pipeline.Suspect
+	default:
+		return
+	}
+	v.Category = bdres.Conclusion
+	if len(bdres.Data) > 0 {
+		whitelist := g.copyWhiteListType()
+		if t := bdres.Data[0].SubType; t >= 0 && t < len(whitelist) && whitelist[t] {
+			return
+		}
+		v.Category = bdres.Data[0].Msg
+	}
+	g.mu.Lock()
+	more := g.MoreRemind
+	g.mu.Unlock()
+	if more {
+		var words []string
+		for _, datum := range bdres.Data {
+			for _, hit := range datum.Hits {
+				words = append(words, hit.Words...)
+			}
+		}
+		v.Detail = strings.Join(words, ",")
+	}
+	return v, true
+}
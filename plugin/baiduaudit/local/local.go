@@ -0,0 +1,176 @@
+// Package local 本地内容审核, 使用词库与正则匹配, 返回与百度内容审核相同格式的结果
+package local
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TypeNames 检测类型名, 与百度内容审核的子类型编号一致
+var TypeNames = [...]string{
+	0: "默认违禁词库",
+	1: "违禁违规",
+	2: "文本色情",
+	3: "敏感信息",
+	4: "恶意推广",
+	5: "低俗辱骂",
+	6: "恶意推广-联系方式",
+	7: "恶意推广-软文推广",
+}
+
+// ErrInvalidType 类型编号超出范围
+var ErrInvalidType = errors.New("invalid censor type")
+
+// builtin 内置规则, 仅识别常见的联系方式
+var builtin = map[int][]string{
+	6: {
+		`/\b1[3-9]\d{9}\b/`,
+		`/(?i)(vx|wx|v信|微信|扣扣|qq)[:：\s]*[a-z0-9_-]{5,}/`,
+	},
+}
+
+type result struct {
+	Conclusion     string  `json:"conclusion"`
+	ConclusionType int     `json:"conclusionType"`
+	Data           []datum `json:"data,omitempty"`
+}
+
+type datum struct {
+	Type           int    `json:"type"`
+	SubType        int    `json:"subType"`
+	Conclusion     string `json:"conclusion"`
+	ConclusionType int    `json:"conclusionType"`
+	Msg            string `json:"msg"`
+	Hits           []hit  `json:"hits"`
+}
+
+type hit struct {
+	Words []string `json:"words"`
+}
+
+// Client 本地审核客户端, 方法签名与 censor.ContentCensorClient 一致
+type Client struct {
+	mu      sync.RWMutex
+	words   [len(TypeNames)][]string
+	regexps [len(TypeNames)][]*regexp.Regexp
+}
+
+// New 创建带有内置规则的客户端
+func New() *Client {
+	c := &Client{}
+	c.reset()
+	return c
+}
+
+func (c *Client) reset() {
+	c.words = [len(TypeNames)][]string{}
+	c.regexps = [len(TypeNames)][]*regexp.Regexp{}
+	for typ, rules := range builtin {
+		for _, r := range rules {
+			_ = c.add(typ, r)
+		}
+	}
+}
+
+// Add 添加一条规则, 以 / 包裹的规则视为正则表达式, 否则为关键词
+func (c *Client) Add(typ int, rule string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.add(typ, rule)
+}
+
+func (c *Client) add(typ int, rule string) error {
+	if typ < 0 || typ >= len(TypeNames) {
+		return ErrInvalidType
+	}
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return nil
+	}
+	if len(rule) > 2 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+		re, err := regexp.Compile(rule[1 : len(rule)-1])
+		if err != nil {
+			return err
+		}
+		c.regexps[typ] = append(c.regexps[typ], re)
+		return nil
+	}
+	c.words[typ] = append(c.words[typ], rule)
+	return nil
+}
+
+// Load 清空已加载的规则并从文件夹读取 0.txt ~ 7.txt, 每行一条规则
+func (c *Client) Load(dir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+	for typ := range TypeNames {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(typ)+".txt"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if err = c.add(typ, s.Text()); err != nil {
+				_ = f.Close()
+				return errors.New(f.Name() + ": " + err.Error())
+			}
+		}
+		_ = f.Close()
+		if err = s.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TextCensor 检测文本
+func (c *Client) TextCensor(text string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := result{Conclusion: "合规", ConclusionType: 1}
+	for typ := range TypeNames {
+		var words []string
+		for _, w := range c.words[typ] {
+			if strings.Contains(text, w) {
+				words = append(words, w)
+			}
+		}
+		for _, re := range c.regexps[typ] {
+			words = append(words, re.FindAllString(text, -1)...)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		res.Conclusion, res.ConclusionType = "不合规", 2
+		res.Data = append(res.Data, datum{
+			Type:           13,
+			SubType:        typ,
+			Conclusion:     "不合规",
+			ConclusionType: 2,
+			Msg:            "存在" + TypeNames[typ] + "不合规",
+			Hits:           []hit{{Words: words}},
+		})
+	}
+	return marshal(&res)
+}
+
+// ImgCensorUrl 本地无法识别图片, 总是返回合规
+func (c *Client) ImgCensorUrl(_ string, _ map[string]interface{}) string {
+	return marshal(&result{Conclusion: "合规", ConclusionType: 1})
+}
+
+func marshal(res *result) string {
+	data, _ := json.Marshal(res)
+	return string(data)
+}
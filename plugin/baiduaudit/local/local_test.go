@@ -0,0 +1,85 @@
+package local
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func parse(t *testing.T, s string) (res result) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(s), &res); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestTextCensor(t *testing.T) {
+	c := New()
+	if err := c.Add(5, "笨蛋"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(1, `/赌\S{0,2}场/`); err != nil {
+		t.Fatal(err)
+	}
+	res := parse(t, c.TextCensor("今天天气真好"))
+	if res.ConclusionType != 1 || len(res.Data) != 0 {
+		t.Fatalf("expect pass, got %+v", res)
+	}
+	res = parse(t, c.TextCensor("你这个笨蛋, 快来赌博场玩"))
+	if res.ConclusionType != 2 || len(res.Data) != 2 {
+		t.Fatalf("expect 2 violations, got %+v", res)
+	}
+	if res.Data[0].SubType != 1 || res.Data[0].Hits[0].Words[0] != "赌博场" {
+		t.Fatalf("unexpected regex hit %+v", res.Data[0])
+	}
+	if res.Data[1].SubType != 5 || res.Data[1].Hits[0].Words[0] != "笨蛋" {
+		t.Fatalf("unexpected word hit %+v", res.Data[1])
+	}
+	res = parse(t, c.TextCensor("加我vx: abc12345"))
+	if res.ConclusionType != 2 || res.Data[0].SubType != 6 {
+		t.Fatalf("expect builtin contact rule, got %+v", res)
+	}
+	res = parse(t, c.TextCensor("电话13812345678"))
+	if res.ConclusionType != 2 || res.Data[0].Hits[0].Words[0] != "13812345678" {
+		t.Fatalf("expect builtin phone rule, got %+v", res)
+	}
+	res = parse(t, c.TextCensor("订单号 2023113812345678901"))
+	if res.ConclusionType != 1 {
+		t.Fatalf("phone rule should not match inside longer numbers, got %+v", res)
+	}
+}
+
+func TestAddInvalid(t *testing.T) {
+	c := New()
+	if err := c.Add(8, "x"); err != ErrInvalidType {
+		t.Fatalf("expect ErrInvalidType, got %v", err)
+	}
+	if err := c.Add(1, "/(/"); err == nil {
+		t.Fatal("expect regexp error")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "2.txt"), []byte("色色\n\n/涩+图/\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	_ = c.Add(5, "笨蛋")
+	if err = c.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if res := parse(t, c.TextCensor("笨蛋")); res.ConclusionType != 1 {
+		t.Fatalf("Load should reset previous rules, got %+v", res)
+	}
+	res := parse(t, c.TextCensor("来点涩涩图"))
+	if res.ConclusionType != 2 || res.Data[0].SubType != 2 {
+		t.Fatalf("expect loaded regex hit, got %+v", res)
+	}
+	if res := parse(t, c.ImgCensorUrl("http://example.com/a.png", nil)); res.ConclusionType != 1 {
+		t.Fatalf("image should always pass, got %+v", res)
+	}
+}
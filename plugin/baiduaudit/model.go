@@ -4,17 +4,17 @@ import (
 	"encoding/json"
 	"os"
 	"sync"
-	"sync/atomic"
+	"time"
 
 	"github.com/FloatTech/floatbox/file"
-	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
 )
 
 // 服务网址:https://console.bce.baidu.com/ai/?_=1665977657185#/ai/antiporn/overview/index
 // 返回参数说明：https://cloud.baidu.com/doc/ANTIPORN/s/Nk3h6xbb2
 type baiduRes struct {
-	mu sync.Mutex `json:"-"`
 	// LogID          int          `json:"log_id"`         // 请求唯一id
 	Conclusion     string       `json:"conclusion"`     // 审核结果, 可取值：合规、不合规、疑似、审核失败
 	ConclusionType int          `json:"conclusionType"` // 审核结果类型, 可取值1.合规, 2.不合规, 3.疑似, 4.审核失败
@@ -23,58 +23,6 @@ type baiduRes struct {
 	ErrorMsg       string       `json:"error_msg"`  // 错误提示信息, 失败才返回, 成功不返回
 }
 
-// 禁言检测
-func (bdres *baiduRes) audit(ctx *zero.Ctx, configpath string) {
-	bdres.mu.Lock()
-	defer bdres.mu.Unlock()
-	// 如果返回类型为2（不合规）, 0为合规, 3为疑似
-	if bdres.ConclusionType != 2 {
-		return
-	}
-	// 获取群配置
-	group := config.groupof(ctx.Event.GroupID)
-	// 检测群配置里的不检测类型白名单, 忽略掉不检测的违规类型
-	for i, b := range group.copyWhiteListType() {
-		if i == bdres.Data[0].SubType && b {
-			return
-		}
-	}
-	// 生成回复文本
-	res := group.reply(bdres)
-	// 撤回消息
-	ctx.DeleteMessage(ctx.Event.MessageID)
-	// 查看是否启用撤回后禁言
-	if group.DMBAN {
-		// 从历史违规记录中获取指定用户
-		user := group.historyof(ctx.Event.UserID)
-		// 用户违规次数自增
-		atomic.AddInt64(&user.Count, 1)
-		user.mu.Lock()
-		// 用户违规原因记录
-		user.ResList = append(user.ResList, bdres)
-		user.mu.Unlock()
-		// 保存到json
-		err := config.saveto(configpath)
-		if err != nil {
-			ctx.SendChain(message.Text("ERROR: ", err))
-		}
-		var bantime int64
-		// 查看是否开启禁言累加功能, 并计算禁言时间
-		if group.BANTimeAddEnable {
-			bantime = atomic.LoadInt64(&user.Count) * group.BANTimeAddTime * 60
-		} else {
-			bantime = group.BANTime * 60
-		}
-		// 执行禁言
-		ctx.SetThisGroupBan(ctx.Event.UserID, bantime)
-	}
-	// 查看是否开启撤回提示
-	if group.DMRemind {
-		res = append(res, message.At(ctx.Event.Sender.ID))
-		ctx.Send(res)
-	}
-}
-
 type auditData struct {
 	// Type           int    `json:"type"`           // 审核主类型, 11：百度官方违禁词库、12：文本反作弊、13:自定义文本黑名单、14:自定义文本白名单
 	SubType int `json:"subType"` // 审核子类型, 0:含多种类型, 具体看官方链接, 1:违禁违规、2:文本色情、3:敏感信息、4:恶意推广、5:低俗辱骂 6:恶意推广-联系方式、7:恶意推广-软文推广
@@ -84,12 +32,6 @@ type auditData struct {
 	Hits []*hit `json:"hits"`
 } // 不合规/疑似/命中白名单项详细信息.响应成功并且conclusion为疑似或不合规或命中白名单时才返回, 响应失败或conclusion为合规且未命中白名单时不返回.
 
-type auditHistory struct {
-	mu      sync.Mutex  `json:"-"`
-	Count   int64       `json:"key2"`    // 被禁次数
-	ResList []*baiduRes `json:"reslist"` // 禁言原因
-}
-
 type hit struct {
 	// DatasetName string   `json:"datasetName"`           // 违规项目所属数据集名称
 	Words []string `json:"words"` // 送检文本命中词库的关键词（备注：建议参考新字段“wordHitPositions”, 包含信息更丰富：关键词以及对应的位置及标签信息）
@@ -129,10 +71,10 @@ func (kc *keyConfig) load(filename string) error {
 	return json.NewDecoder(f).Decode(kc)
 }
 
-func (kc *keyConfig) isgroupexist(ctx *zero.Ctx) (ok bool) {
+func (kc *keyConfig) isgroupexist(gid int64) (ok bool) {
 	kc.mu.Lock()
 	defer kc.mu.Unlock()
-	_, ok = kc.Groups[ctx.Event.GroupID]
+	_, ok = kc.Groups[gid]
 	return
 }
 
@@ -150,7 +92,8 @@ func (kc *keyConfig) groupof(groupID int64) *group {
 		BANTime:            1,
 		MaxBANTimeAddRange: 60,
 		BANTimeAddTime:     1,
-		AuditHistory:       map[int64]*auditHistory{},
+		BANTimeHalfLife:    defaultHalfLife,
+		RetainDays:         defaultRetainDays,
 	}
 	kc.Groups[groupID] = g
 	return g
@@ -168,20 +111,41 @@ func (kc *keyConfig) saveto(filename string) error {
 	return json.NewEncoder(f).Encode(kc)
 }
 
+const (
+	defaultHalfLife   = 24 // 默认禁言衰减时间, 小时
+	defaultRetainDays = 30 // 默认违规记录保留天数
+)
+
 type group struct {
 	mu                 sync.Mutex
-	Enable             mark                    // 是否启用内容审核
-	TextAudit          mark                    // 文本检测
-	ImageAudit         mark                    // 图像检测
-	DMRemind           mark                    // 撤回提示
-	MoreRemind         mark                    // 详细违规提示
-	DMBAN              mark                    // 撤回后禁言
-	BANTimeAddEnable   mark                    // 禁言累加
-	BANTime            int64                   // 标准禁言时间, 禁用累加, 但开启禁言的的情况下采用该值
-	MaxBANTimeAddRange int64                   // 最大禁言时间累加范围, 最高禁言时间
-	BANTimeAddTime     int64                   // 禁言累加时间, 该值是开启禁累加功能后, 再次触发时, 根据被禁次数X该值计算出的禁言时间
-	WhiteListType      [8]bool                 // 类型白名单, 处于白名单类型的违规, 不会被触发 0:含多种类型, 具体看官方链接, 1:违禁违规、2:文本色情、3:敏感信息、4:恶意推广、5:低俗辱骂 6:恶意推广-联系方式、7:恶意推广-软文推广
-	AuditHistory       map[int64]*auditHistory // 被封禁用户列表
+	Enable             mark    // 是否启用内容审核
+	TextAudit          mark    // 文本检测
+	ImageAudit         mark    // 图像检测
+	DMRemind           mark    // 撤回提示
+	MoreRemind         mark    // 详细违规提示
+	DMBAN              mark    // 撤回后禁言
+	BANTimeAddEnable   mark    // 禁言累加
+	BANTime            int64   // 标准禁言时间, 禁用累加, 但开启禁言的的情况下采用该值
+	MaxBANTimeAddRange int64   // 最大禁言时间累加范围, 最高禁言时间
+	BANTimeAddTime     int64   // 禁言累加时间, 该值是开启禁累加功能后, 再次触发时, 根据被禁次数X该值计算出的禁言时间
+	BANTimeHalfLife    int64   // 禁言累加时历史违规的半衰期, 小时, 0 为不衰减
+	RetainDays         int64   // 违规记录保留天数, 0 为永久
+	WhiteListType      [8]bool // 类型白名单, 处于白名单类型的违规, 不会被触发 0:含多种类型, 具体看官方链接, 1:违禁违规、2:文本色情、3:敏感信息、4:恶意推广、5:低俗辱骂 6:恶意推广-联系方式、7:恶意推广-软文推广
+	// AuditHistory 旧版记录的被禁用户, 迁移到 moderation 的处置记录后清空
+	AuditHistory map[int64]*auditHistory `json:",omitempty"`
+}
+
+// auditHistory 旧版的违规记录
+type auditHistory struct {
+	Count   int64       `json:"key2"`    // 被禁次数
+	ResList []*baiduRes `json:"reslist"` // 禁言原因
+}
+
+// UnmarshalJSON 旧版配置没有衰减与保留天数, 加载时补上默认值, 显式设置的 0 不受影响
+func (g *group) UnmarshalJSON(b []byte) error {
+	type rawgroup group
+	g.BANTimeHalfLife, g.RetainDays = defaultHalfLife, defaultRetainDays
+	return json.Unmarshal(b, (*rawgroup)(g))
 }
 
 func (g *group) set(f func(g *group)) {
@@ -202,21 +166,62 @@ func (g *group) copyWhiteListType() [8]bool {
 	return g.WhiteListType
 }
 
-// 从群历史违规记录中获取用户
-func (g *group) historyof(userID int64) *auditHistory {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-	audit, ok := g.AuditHistory[userID]
-	if ok {
-		return audit
+// 将旧版记录的被禁次数写入处置记录, 成功后从配置中删除
+func (kc *keyConfig) migrate(filename string) error {
+	now := time.Now()
+	var rs []pipeline.Record
+	kc.mu.Lock()
+	for gid, g := range kc.Groups {
+		g.mu.Lock()
+		for uid, h := range g.AuditHistory {
+			for i := int64(0); i < h.Count; i++ {
+				r := pipeline.Record{
+					Time:     now,
+					GroupID:  gid,
+					UserID:   uid,
+					Detector: detector{}.Name(),
+					Level:    pipeline.Violation,
+					Detail:   "旧版违规记录",
+					Actions:  pipeline.ActBan,
+				}
+				if i < int64(len(h.ResList)) && h.ResList[i] != nil {
+					r.Category = h.ResList[i].Conclusion
+					if len(h.ResList[i].Data) > 0 {
+						r.Category = h.ResList[i].Data[0].Msg
+					}
+				}
+				rs = append(rs, r)
+			}
+		}
+		g.mu.Unlock()
+	}
+	kc.mu.Unlock()
+	if len(rs) == 0 {
+		return nil
+	}
+	err := pipeline.Import(rs)
+	if err != nil {
+		return err
+	}
+	kc.mu.Lock()
+	for _, g := range kc.Groups {
+		g.set(func(g *group) {
+			g.AuditHistory = nil
+		})
 	}
-	// 如果没有用户, 则创建一个并返回
-	if g.AuditHistory == nil {
-		g.AuditHistory = make(map[int64]*auditHistory)
+	kc.mu.Unlock()
+	return kc.saveto(filename)
+}
+
+// 删除超出保留天数的违规记录
+func (g *group) purge(gid int64) error {
+	g.mu.Lock()
+	days := g.RetainDays
+	g.mu.Unlock()
+	if days <= 0 {
+		return nil
 	}
-	audit = &auditHistory{}
-	g.AuditHistory[userID] = audit
-	return audit
+	return pipeline.Purge(gid, detector{}.Name(), time.Now().AddDate(0, 0, -int(days)))
 }
 
 // 生成回复文本
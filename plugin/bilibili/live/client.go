@@ -0,0 +1,98 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/RomiChan/websocket"
+)
+
+// DefaultURL 未获取到服务器列表时使用的弹幕服务器
+const DefaultURL = "wss://broadcastlv.chat.bilibili.com/sub"
+
+// Client 一个直播间的弹幕连接
+type Client struct {
+	URL       string        // URL 弹幕服务器, 为空时使用 DefaultURL
+	Room      int64         // Room 真实房间号
+	UID       int64         // UID 登录用户, 匿名为 0
+	Token     string        // Token getDanmuInfo 返回的 key
+	Header    http.Header   // Header 握手时附加的请求头
+	Heartbeat time.Duration // Heartbeat 心跳间隔, 为 0 时 30 秒
+	Dialer    *websocket.Dialer
+}
+
+// authbody 认证包正文
+func (c *Client) authbody() []byte {
+	b, _ := json.Marshal(map[string]any{
+		"uid":      c.UID,
+		"roomid":   c.Room,
+		"protover": VerZlib,
+		"platform": "web",
+		"type":     2,
+		"key":      c.Token,
+	})
+	return b
+}
+
+// Run 连接并持续接收, 每个事件调用一次 handle, 直到 ctx 结束或连接断开
+func (c *Client) Run(ctx context.Context, handle func(Event)) error {
+	u := c.URL
+	if u == "" {
+		u = DefaultURL
+	}
+	d := c.Dialer
+	if d == nil {
+		d = websocket.DefaultDialer
+	}
+	conn, _, err := d.DialContext(ctx, u, c.Header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.WriteMessage(websocket.BinaryMessage, Encode(OpAuth, VerInt, c.authbody()))
+	if err != nil {
+		return err
+	}
+	hb := c.Heartbeat
+	if hb <= 0 {
+		hb = 30 * time.Second
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(hb)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// 使阻塞的 ReadMessage 返回
+				_ = conn.Close()
+				return
+			case <-done:
+				return
+			case <-t.C:
+				_ = conn.WriteMessage(websocket.BinaryMessage, Encode(OpHeartbeat, VerInt, nil))
+			}
+		}
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		ps, err := Decode(data)
+		for i := range ps {
+			if ev := Parse(&ps[i]); ev != nil {
+				handle(ev)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package live
+
+import (
+	"github.com/tidwall/gjson"
+)
+
+// Event 直播间事件, 为下列类型之一
+type Event interface{}
+
+type (
+	// Danmaku 弹幕
+	Danmaku struct {
+		UID  int64
+		Name string
+		Text string
+	}
+	// SuperChat 醒目留言
+	SuperChat struct {
+		UID     int64
+		Name    string
+		Price   int64 // Price 金额, 单位元
+		Message string
+	}
+	// Gift 礼物
+	Gift struct {
+		UID  int64
+		Name string
+		Gift string
+		Num  int64
+		Gold int64 // Gold 总价值, 单位金瓜子 (1000 金瓜子 = 1 元), 银瓜子礼物为 0
+	}
+	// Guard 上舰
+	Guard struct {
+		UID   int64
+		Name  string
+		Level string // Level 舰长 提督 总督
+		Num   int64
+		Gold  int64
+	}
+	// Popularity 人气值
+	Popularity struct {
+		Value int64
+	}
+	// Watched 看过的人数
+	Watched struct {
+		Num int64
+	}
+	// LiveStart 开播
+	LiveStart struct{}
+	// LiveEnd 下播
+	LiveEnd struct{}
+)
+
+// Yuan 礼物价值, 单位元
+func (g *Gift) Yuan() float64 {
+	return float64(g.Gold) / 1000
+}
+
+// Yuan 上舰价值, 单位元
+func (g *Guard) Yuan() float64 {
+	return float64(g.Gold) / 1000
+}
+
+var guardlevels = map[int64]string{1: "总督", 2: "提督", 3: "舰长"}
+
+// Parse 将数据包解析为事件, 不关心的包返回 nil
+func Parse(p *Packet) Event {
+	switch p.Op {
+	case OpHeartbeatReply:
+		return Popularity{Value: p.Popularity()}
+	case OpMessage:
+	default:
+		return nil
+	}
+	j := gjson.ParseBytes(p.Body)
+	d := j.Get("data")
+	switch cmd := j.Get("cmd").String(); {
+	case cmd == "DANMU_MSG" || len(cmd) > 9 && cmd[:10] == "DANMU_MSG:":
+		info := j.Get("info")
+		return Danmaku{
+			UID:  info.Get("2.0").Int(),
+			Name: info.Get("2.1").String(),
+			Text: info.Get("1").String(),
+		}
+	case cmd == "SUPER_CHAT_MESSAGE":
+		return SuperChat{
+			UID:     d.Get("uid").Int(),
+			Name:    d.Get("user_info.uname").String(),
+			Price:   d.Get("price").Int(),
+			Message: d.Get("message").String(),
+		}
+	case cmd == "SEND_GIFT":
+		g := Gift{
+			UID:  d.Get("uid").Int(),
+			Name: d.Get("uname").String(),
+			Gift: d.Get("giftName").String(),
+			Num:  d.Get("num").Int(),
+		}
+		if d.Get("coin_type").String() == "gold" {
+			g.Gold = d.Get("total_coin").Int()
+			if g.Gold == 0 {
+				g.Gold = d.Get("price").Int() * g.Num
+			}
+		}
+		return g
+	case cmd == "GUARD_BUY":
+		num := d.Get("num").Int()
+		return Guard{
+			UID:   d.Get("uid").Int(),
+			Name:  d.Get("username").String(),
+			Level: guardlevels[d.Get("guard_level").Int()],
+			Num:   num,
+			Gold:  d.Get("price").Int() * num,
+		}
+	case cmd == "WATCHED_CHANGE":
+		return Watched{Num: d.Get("num").Int()}
+	case cmd == "LIVE":
+		return LiveStart{}
+	case cmd == "PREPARING":
+		return LiveEnd{}
+	}
+	return nil
+}
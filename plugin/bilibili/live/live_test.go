@@ -0,0 +1,140 @@
+package live
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RomiChan/websocket"
+)
+
+func TestDecode(t *testing.T) {
+	a := Encode(OpMessage, VerJSON, []byte(`{"cmd":"LIVE"}`))
+	b := Encode(OpHeartbeatReply, VerInt, []byte{0, 0, 1, 0})
+	ps, err := Decode(append(Compress(a, a), b...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 {
+		t.Fatalf("got %d packets", len(ps))
+	}
+	if string(ps[1].Body) != `{"cmd":"LIVE"}` || ps[2].Popularity() != 256 {
+		t.Fatal(ps)
+	}
+	if _, err = Decode(a[:len(a)-1]); err != ErrBadPacket {
+		t.Fatal("want ErrBadPacket, got", err)
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := Words("草 好耶! Hello 主播唱得好听 的")
+	want := []string{"草", "好耶", "hello", "主播", "播唱", "唱得", "得好", "好听"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+}
+
+// standin 本地的弹幕服务器, 校验认证包后逐包回放录制的数据
+func standin(t *testing.T, record []byte, auth chan<- map[string]any) *httptest.Server {
+	var up websocket.Upgrader
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ps, err := Decode(data)
+		if err != nil || len(ps) != 1 || ps[0].Op != OpAuth {
+			t.Error("bad auth packet", ps, err)
+			return
+		}
+		m := map[string]any{}
+		_ = json.Unmarshal(ps[0].Body, &m)
+		auth <- m
+		for rec := record; len(rec) > 0; {
+			n := binary.BigEndian.Uint32(rec)
+			if err := conn.WriteMessage(websocket.BinaryMessage, rec[:n]); err != nil {
+				t.Error(err)
+				return
+			}
+			rec = rec[n:]
+		}
+		// 保持连接直到客户端断开
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestReplay(t *testing.T) {
+	record, err := os.ReadFile("testdata/replay.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make(chan map[string]any, 1)
+	srv := standin(t, record, auth)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := Client{URL: "ws" + strings.TrimPrefix(srv.URL, "http"), Room: 21452505, Token: "tok", Heartbeat: time.Hour}
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	st := NewStats(start)
+	var evs []Event
+	err = c.Run(ctx, func(ev Event) {
+		evs = append(evs, ev)
+		st.Add(ev)
+		if _, ok := ev.(LiveEnd); ok {
+			st.End = start.Add(90 * time.Minute)
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatal("run:", err)
+	}
+	m := <-auth
+	if m["roomid"] != float64(21452505) || m["key"] != "tok" || m["protover"] != float64(VerZlib) {
+		t.Fatal(m)
+	}
+	if _, ok := evs[0].(LiveStart); !ok {
+		t.Fatalf("first event %#v", evs[0])
+	}
+	if d, ok := evs[3].(Danmaku); !ok || d.Name != "小明" || d.Text != "好耶 hello world" {
+		t.Fatalf("danmaku %#v", evs[3])
+	}
+	if g, ok := evs[6].(Gift); !ok || g.Yuan() != 1245 {
+		t.Fatalf("gift %#v", evs[6])
+	}
+	if sc, ok := evs[7].(SuperChat); !ok || sc.Price != 30 || sc.Message != "加油!" {
+		t.Fatalf("sc %#v", evs[7])
+	}
+	if g, ok := evs[8].(Guard); !ok || g.Level != "舰长" || g.Yuan() != 198 {
+		t.Fatalf("guard %#v", evs[8])
+	}
+
+	if st.Danmaku != 3 || st.Peak != 54321 || st.Watched != 2333 || st.Duration(time.Now()) != 90*time.Minute {
+		t.Fatalf("stats %+v", st)
+	}
+	top := st.TopSenders(2)
+	if top[0].Name != "富哥" || top[1].Name != "舰长君" {
+		t.Fatal(top)
+	}
+	if ws := st.TopWords(1); ws[0] != (Word{Text: "好耶", Count: 2}) {
+		t.Fatal(ws)
+	}
+}
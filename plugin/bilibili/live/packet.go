@@ -0,0 +1,109 @@
+// Package live b站直播弹幕协议, 事件解析与场次统计
+package live
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 协议版本
+const (
+	VerJSON  = 0 // VerJSON 未压缩的 JSON
+	VerInt   = 1 // VerInt 心跳与认证, 或人气值
+	VerZlib  = 2 // VerZlib zlib 压缩的多个包
+	VerBrotl = 3 // VerBrotl brotli 压缩, 认证时不请求该版本
+)
+
+// 操作码
+const (
+	OpHeartbeat      = 2
+	OpHeartbeatReply = 3 // OpHeartbeatReply 正文为 4 字节人气值
+	OpMessage        = 5
+	OpAuth           = 7
+	OpAuthReply      = 8
+)
+
+const headerlen = 16
+
+// ErrBadPacket 包长度不正确
+var ErrBadPacket = errors.New("live: bad packet")
+
+// Packet 一个数据包
+type Packet struct {
+	Ver  uint16
+	Op   uint32
+	Body []byte
+}
+
+// Encode 编码为二进制, 序号固定为 1
+func Encode(op uint32, ver uint16, body []byte) []byte {
+	b := make([]byte, headerlen+len(body))
+	binary.BigEndian.PutUint32(b[0:], uint32(len(b)))
+	binary.BigEndian.PutUint16(b[4:], headerlen)
+	binary.BigEndian.PutUint16(b[6:], ver)
+	binary.BigEndian.PutUint32(b[8:], op)
+	binary.BigEndian.PutUint32(b[12:], 1)
+	copy(b[headerlen:], body)
+	return b
+}
+
+// Compress 将多个包用 zlib 压缩为一个 VerZlib 的包
+func Compress(packets ...[]byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	for _, p := range packets {
+		_, _ = w.Write(p)
+	}
+	_ = w.Close()
+	return Encode(OpMessage, VerZlib, buf.Bytes())
+}
+
+// Decode 解码一帧中的所有包, 压缩的包会被展开
+func Decode(data []byte) (ps []Packet, err error) {
+	for len(data) > 0 {
+		if len(data) < headerlen {
+			return ps, ErrBadPacket
+		}
+		total := int(binary.BigEndian.Uint32(data[0:]))
+		hl := int(binary.BigEndian.Uint16(data[4:]))
+		if total < hl || hl < headerlen || total > len(data) {
+			return ps, ErrBadPacket
+		}
+		p := Packet{
+			Ver:  binary.BigEndian.Uint16(data[6:]),
+			Op:   binary.BigEndian.Uint32(data[8:]),
+			Body: data[hl:total],
+		}
+		data = data[total:]
+		if p.Ver == VerZlib {
+			r, err := zlib.NewReader(bytes.NewReader(p.Body))
+			if err != nil {
+				return ps, err
+			}
+			raw, err := io.ReadAll(r)
+			_ = r.Close()
+			if err != nil {
+				return ps, err
+			}
+			inner, err := Decode(raw)
+			ps = append(ps, inner...)
+			if err != nil {
+				return ps, err
+			}
+			continue
+		}
+		ps = append(ps, p)
+	}
+	return
+}
+
+// Popularity 心跳回复中的人气值
+func (p *Packet) Popularity() int64 {
+	if p.Op != OpHeartbeatReply || len(p.Body) < 4 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(p.Body))
+}
@@ -0,0 +1,186 @@
+package live
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sender 送礼或发弹幕的人
+type Sender struct {
+	UID   int64
+	Name  string
+	Gold  int64 // Gold 礼物, 醒目留言与上舰的总价值, 单位金瓜子
+	Count int   // Count 弹幕条数
+}
+
+// Yuan 总价值, 单位元
+func (s *Sender) Yuan() float64 {
+	return float64(s.Gold) / 1000
+}
+
+// Word 词频
+type Word struct {
+	Text  string
+	Count int
+}
+
+// Stats 一场直播的统计, 非并发安全
+type Stats struct {
+	Start   time.Time
+	End     time.Time
+	Peak    int64 // Peak 最高人气
+	Watched int64 // Watched 看过的人数
+	Danmaku int
+	Gold    int64 // Gold 总收入, 单位金瓜子
+	senders map[int64]*Sender
+	words   map[string]int
+}
+
+// NewStats 从 start 开始统计
+func NewStats(start time.Time) *Stats {
+	return &Stats{Start: start, senders: map[int64]*Sender{}, words: map[string]int{}}
+}
+
+func (s *Stats) sender(uid int64, name string) *Sender {
+	x, ok := s.senders[uid]
+	if !ok {
+		x = &Sender{UID: uid}
+		s.senders[uid] = x
+	}
+	if name != "" {
+		x.Name = name
+	}
+	return x
+}
+
+// Add 计入一个事件
+func (s *Stats) Add(ev Event) {
+	switch e := ev.(type) {
+	case Danmaku:
+		s.Danmaku++
+		s.sender(e.UID, e.Name).Count++
+		for _, w := range Words(e.Text) {
+			s.words[w]++
+		}
+	case SuperChat:
+		s.sender(e.UID, e.Name).Gold += e.Price * 1000
+		s.Gold += e.Price * 1000
+	case Gift:
+		s.sender(e.UID, e.Name).Gold += e.Gold
+		s.Gold += e.Gold
+	case Guard:
+		s.sender(e.UID, e.Name).Gold += e.Gold
+		s.Gold += e.Gold
+	case Popularity:
+		if e.Value > s.Peak {
+			s.Peak = e.Value
+		}
+	case Watched:
+		if e.Num > s.Watched {
+			s.Watched = e.Num
+		}
+	}
+}
+
+// Duration 直播时长, 未结束时以 now 计
+func (s *Stats) Duration(now time.Time) time.Duration {
+	if !s.End.IsZero() {
+		now = s.End
+	}
+	return now.Sub(s.Start).Truncate(time.Second)
+}
+
+// TopSenders 按总价值排名的前 n 人, 价值相同时按弹幕数
+func (s *Stats) TopSenders(n int) []Sender {
+	ss := make([]Sender, 0, len(s.senders))
+	for _, x := range s.senders {
+		ss = append(ss, *x)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Gold != ss[j].Gold {
+			return ss[i].Gold > ss[j].Gold
+		}
+		if ss[i].Count != ss[j].Count {
+			return ss[i].Count > ss[j].Count
+		}
+		return ss[i].UID < ss[j].UID
+	})
+	if len(ss) > n {
+		ss = ss[:n]
+	}
+	return ss
+}
+
+// TopWords 出现最多的前 n 个词
+func (s *Stats) TopWords(n int) []Word {
+	ws := make([]Word, 0, len(s.words))
+	for w, c := range s.words {
+		ws = append(ws, Word{Text: w, Count: c})
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].Count != ws[j].Count {
+			return ws[i].Count > ws[j].Count
+		}
+		return ws[i].Text < ws[j].Text
+	})
+	if len(ws) > n {
+		ws = ws[:n]
+	}
+	return ws
+}
+
+var stopwords = map[string]bool{
+	"的": true, "了": true, "是": true, "我": true, "你": true, "他": true, "她": true, "这": true, "那": true,
+	"啊": true, "吗": true, "吧": true, "呢": true, "嘛": true, "就": true, "都": true, "也": true, "在": true,
+	"the": true, "and": true, "is": true, "to": true, "of": true, "a": true,
+}
+
+// Words 将弹幕切分为词: 连续的汉字不超过 4 个时整体计入, 否则按相邻两字切分; 字母数字按单词计入
+func Words(text string) (ws []string) {
+	var run []rune
+	cjk := false
+	flush := func() {
+		defer func() { run = run[:0] }()
+		if len(run) == 0 {
+			return
+		}
+		if !cjk {
+			w := strings.ToLower(string(run))
+			if len(run) > 1 && !stopwords[w] {
+				ws = append(ws, w)
+			}
+			return
+		}
+		if len(run) <= 4 {
+			if w := string(run); !stopwords[w] {
+				ws = append(ws, w)
+			}
+			return
+		}
+		for i := 0; i+1 < len(run); i++ {
+			ws = append(ws, string(run[i:i+2]))
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			if !cjk {
+				flush()
+			}
+			cjk = true
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if cjk {
+				flush()
+			}
+			cjk = false
+			run = append(run, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return
+}
@@ -0,0 +1,440 @@
+package bilibili
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bz "github.com/FloatTech/AnimeAPI/bilibili"
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/web"
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/bilibili/live"
+)
+
+const (
+	roomInitURL  = "https://api.live.bilibili.com/room/v1/Room/room_init?id=%v"
+	danmuInfoURL = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=%v&type=0"
+	// defaultThreshold 默认只转发 30 元以上的醒目留言与礼物
+	defaultThreshold = 30
+)
+
+var (
+	ldb        *livewatchdb
+	liveen     *control.Engine
+	watchmu    sync.Mutex
+	watchers   = map[int64]*roomwatcher{}
+	dedeuserid = regexp.MustCompile(`DedeUserID=(\d+)`)
+)
+
+func init() {
+	liveen = control.Register("bilibililive", &ctrl.Options[*zero.Ctx]{
+		DisableOnDefault: false,
+		Brief:            "b站直播间监控",
+		Help: "- 监控直播间[房间号] [阈值]元\n" +
+			"- 取消监控直播间[房间号]\n" +
+			"- 设置直播间[房间号]打赏阈值[N]元\n" +
+			"- 直播间监控列表\n" +
+			"- 直播间统计[房间号]\n" +
+			"Tips: 连接直播间弹幕服务器, 将不低于阈值(默认30元)的醒目留言、礼物与上舰转发到群, " +
+			"下播时发送本场总结(时长、人气峰值、打赏排行与弹幕词云)\n" +
+			"在 bilibili 插件中设置cookie后可以看到完整的用户名",
+		PrivateDataFolder: "bilibililive",
+	})
+	ldb = initializeLiveWatch(liveen.DataFolder() + "live.db")
+	go func() {
+		for _, r := range ldb.rooms() {
+			startWatch(r)
+		}
+	}()
+
+	liveen.OnRegex(`^监控直播间\s*(\d+)(?:\s+(\d+)元?)?$`, zero.UserOrGrpAdmin).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+		threshold := int64(defaultThreshold)
+		if s := ctx.State["regex_matched"].([]string)[2]; s != "" {
+			threshold, _ = strconv.ParseInt(s, 10, 64)
+		}
+		info, err := roomInit(id)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		room := liveroom{RoomID: info.Get("room_id").Int(), ShortID: info.Get("short_id").Int(), UID: info.Get("uid").Int()}
+		room.Name, err = getName(room.UID, cfg)
+		if err != nil || room.Name == "" {
+			room.Name = "直播间" + strconv.FormatInt(room.RoomID, 10)
+		}
+		if err = ldb.watch(room, groupOf(ctx), threshold); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		startWatch(room).reload()
+		ctx.SendChain(message.Text("已监控", room.Name, "的直播间", room.RoomID, ", 转发不低于", threshold, "元的醒目留言与礼物"))
+	})
+	liveen.OnRegex(`^取消监控直播间\s*(\d+)$`, zero.UserOrGrpAdmin).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		room, ok := lookupRoom(ctx)
+		if !ok {
+			return
+		}
+		empty, err := ldb.unwatch(room.RoomID, groupOf(ctx))
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if empty {
+			stopWatch(room.RoomID)
+		} else if w := getWatcher(room.RoomID); w != nil {
+			w.reload()
+		}
+		ctx.SendChain(message.Text("已取消监控", room.Name, "的直播间"))
+	})
+	liveen.OnRegex(`^设置直播间\s*(\d+)\s*打赏阈值\s*(\d+)元?$`, zero.UserOrGrpAdmin).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		room, ok := lookupRoom(ctx)
+		if !ok {
+			return
+		}
+		threshold, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[2], 10, 64)
+		err := ldb.setThreshold(room.RoomID, groupOf(ctx), threshold)
+		if gorm.IsRecordNotFoundError(err) {
+			ctx.SendChain(message.Text("本群没有监控", room.Name, "的直播间"))
+			return
+		}
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if w := getWatcher(room.RoomID); w != nil {
+			w.reload()
+		}
+		ctx.SendChain(message.Text("已将", room.Name, "直播间的转发阈值设为", threshold, "元"))
+	})
+	liveen.OnFullMatch("直播间监控列表", zero.UserOrGrpAdmin).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		ws := ldb.watchersOf(groupOf(ctx))
+		if len(ws) == 0 {
+			ctx.SendChain(message.Text("还没有监控任何直播间"))
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("--------直播间监控列表--------")
+		for _, v := range ws {
+			r, _ := ldb.room(v.RoomID)
+			state := "○"
+			if w := getWatcher(v.RoomID); w != nil && w.living() {
+				state = "●"
+			}
+			fmt.Fprintf(&sb, "\n%s 房间号:%-10d 阈值:%d元 up主:%s", state, v.RoomID, v.Threshold, r.Name)
+		}
+		ctx.SendChain(message.Text(sb.String()))
+	})
+	liveen.OnRegex(`^直播间统计\s*(\d+)$`).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		room, ok := lookupRoom(ctx)
+		if !ok {
+			return
+		}
+		w := getWatcher(room.RoomID)
+		if w == nil {
+			ctx.SendChain(message.Text("没有监控", room.Name, "的直播间"))
+			return
+		}
+		w.mu.Lock()
+		var text string
+		if w.stats != nil {
+			text = summary(room.Name+" 直播中", w.stats, time.Now())
+		}
+		w.mu.Unlock()
+		if text == "" {
+			ctx.SendChain(message.Text(room.Name, "当前没有在直播"))
+			return
+		}
+		ctx.SendChain(message.Text(text))
+	})
+}
+
+// groupOf 私聊时以负的QQ号作为群号, 与b站推送一致
+func groupOf(ctx *zero.Ctx) int64 {
+	if ctx.Event.GroupID != 0 {
+		return ctx.Event.GroupID
+	}
+	return -ctx.Event.UserID
+}
+
+// lookupRoom 在已监控的直播间中查找, 找不到时回复提示
+func lookupRoom(ctx *zero.Ctx) (liveroom, bool) {
+	id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+	r, err := ldb.room(id)
+	if err != nil {
+		ctx.SendChain(message.Text("没有监控直播间", id))
+		return r, false
+	}
+	return r, true
+}
+
+// liveGet 带上cookie请求直播接口, 返回 data
+func liveGet(url string) (gjson.Result, error) {
+	data, err := web.RequestDataWithHeaders(web.NewDefaultClient(), url, "GET", func(r *http.Request) error {
+		if cookie, err := cfg.Load(); err == nil {
+			r.Header.Add("Cookie", cookie)
+		}
+		r.Header.Set("User-Agent", ua)
+		r.Header.Set("Referer", "https://live.bilibili.com/")
+		return nil
+	}, nil)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	j := gjson.Parse(binary.BytesToString(data))
+	if j.Get("code").Int() != 0 {
+		return gjson.Result{}, errors.New(j.Get("message").String())
+	}
+	return j.Get("data"), nil
+}
+
+// roomInit 由短号或真实房间号获取房间信息
+func roomInit(id int64) (gjson.Result, error) {
+	return liveGet(fmt.Sprintf(roomInitURL, id))
+}
+
+// roomwatcher 一个直播间的弹幕连接与本场统计
+type roomwatcher struct {
+	mu     sync.Mutex
+	room   liveroom
+	groups []livewatch
+	stats  *live.Stats // stats 正在直播时非空
+	cancel context.CancelFunc
+}
+
+// startWatch 开始监控直播间, 已在监控时返回原有的
+func startWatch(room liveroom) *roomwatcher {
+	watchmu.Lock()
+	defer watchmu.Unlock()
+	if w, ok := watchers[room.RoomID]; ok {
+		return w
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &roomwatcher{room: room, cancel: cancel}
+	w.reload()
+	watchers[room.RoomID] = w
+	go w.run(ctx)
+	return w
+}
+
+func stopWatch(roomid int64) {
+	watchmu.Lock()
+	defer watchmu.Unlock()
+	if w, ok := watchers[roomid]; ok {
+		w.cancel()
+		delete(watchers, roomid)
+	}
+}
+
+func getWatcher(roomid int64) *roomwatcher {
+	watchmu.Lock()
+	defer watchmu.Unlock()
+	return watchers[roomid]
+}
+
+// reload 重新读取监控的群与阈值
+func (w *roomwatcher) reload() {
+	groups := ldb.watchers(w.room.RoomID)
+	w.mu.Lock()
+	w.groups = groups
+	w.mu.Unlock()
+}
+
+func (w *roomwatcher) living() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats != nil
+}
+
+// run 保持连接, 断开后重连, 间隔逐渐增加到 5 分钟
+func (w *roomwatcher) run(ctx context.Context) {
+	backoff := 5 * time.Second
+	for {
+		begin := time.Now()
+		c, err := w.client()
+		if err == nil {
+			err = c.Run(ctx, w.handle)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logrus.Warnln("[bilibililive] room", w.room.RoomID, "disconnected:", err)
+		if time.Since(begin) > time.Minute {
+			backoff = 5 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 5*time.Minute {
+			backoff = 5 * time.Minute
+		}
+	}
+}
+
+// client 同步开播状态并获取弹幕服务器, 获取失败时匿名连接默认服务器
+func (w *roomwatcher) client() (*live.Client, error) {
+	info, err := roomInit(w.room.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	w.mu.Lock()
+	switch {
+	case info.Get("live_status").Int() == 1 && w.stats == nil:
+		// 中途开始监控, 从开播时间算起
+		start := now
+		if t := info.Get("live_time").Int(); t > 0 {
+			start = time.Unix(t, 0)
+		}
+		w.stats = live.NewStats(start)
+	case info.Get("live_status").Int() != 1 && w.stats != nil:
+		// 断线期间下播了
+		w.finish(now)
+	}
+	w.mu.Unlock()
+
+	c := &live.Client{Room: w.room.RoomID, Header: http.Header{}}
+	c.Header.Set("User-Agent", ua)
+	c.Header.Set("Origin", "https://live.bilibili.com")
+	cookie, err := cfg.Load()
+	if err == nil && cookie != "" {
+		c.Header.Set("Cookie", cookie)
+		if m := dedeuserid.FindStringSubmatch(cookie); m != nil {
+			c.UID, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+	}
+	d, err := liveGet(bz.SignURL(fmt.Sprintf(danmuInfoURL, w.room.RoomID)))
+	if err != nil {
+		logrus.Debugln("[bilibililive] getDanmuInfo:", err)
+		c.UID = 0
+		return c, nil
+	}
+	c.Token = d.Get("token").String()
+	if h := d.Get("host_list.0"); h.Exists() {
+		c.URL = fmt.Sprintf("wss://%s:%d/sub", h.Get("host").String(), h.Get("wss_port").Int())
+	}
+	return c, nil
+}
+
+// handle 处理一个事件
+func (w *roomwatcher) handle(ev live.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch ev.(type) {
+	case live.LiveStart:
+		if w.stats == nil {
+			w.stats = live.NewStats(time.Now())
+		}
+		return
+	case live.LiveEnd:
+		if w.stats != nil {
+			w.finish(time.Now())
+		}
+		return
+	}
+	if w.stats != nil {
+		w.stats.Add(ev)
+	}
+	var yuan float64
+	var text string
+	switch e := ev.(type) {
+	case live.SuperChat:
+		yuan = float64(e.Price)
+		text = fmt.Sprintf("【%s】醒目留言 ¥%d\n%s: %s", w.room.Name, e.Price, e.Name, e.Message)
+	case live.Gift:
+		yuan = e.Yuan()
+		text = fmt.Sprintf("【%s】%s 赠送 %s×%d (¥%.1f)", w.room.Name, e.Name, e.Gift, e.Num, yuan)
+	case live.Guard:
+		yuan = e.Yuan()
+		text = fmt.Sprintf("【%s】%s 开通了%d个月%s (¥%.0f)", w.room.Name, e.Name, e.Num, e.Level, yuan)
+	}
+	if yuan <= 0 {
+		return
+	}
+	var gids []int64
+	for _, g := range w.groups {
+		if yuan >= float64(g.Threshold) {
+			gids = append(gids, g.GroupID)
+		}
+	}
+	go broadcast(gids, message.Message{message.Text(text)})
+}
+
+// finish 结束本场统计并发送总结, 调用时需持有 mu
+func (w *roomwatcher) finish(now time.Time) {
+	st := w.stats
+	w.stats = nil
+	st.End = now
+	gids := make([]int64, 0, len(w.groups))
+	for _, g := range w.groups {
+		gids = append(gids, g.GroupID)
+	}
+	name := w.room.Name
+	go func() {
+		msg := message.Message{message.Text(summary(name+" 下播了", st, now))}
+		if st.Danmaku > 0 {
+			img, err := drawWordCloud(st.TopWords(80), 800, 480)
+			if err != nil {
+				logrus.Warnln("[bilibililive] word cloud:", err)
+			} else {
+				msg = append(msg, message.ImageBytes(img))
+			}
+		}
+		broadcast(gids, msg)
+	}()
+}
+
+// summary 本场统计的文字
+func summary(title string, st *live.Stats, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(title)
+	fmt.Fprintf(&sb, "\n时长: %v", st.Duration(now))
+	fmt.Fprintf(&sb, "\n人气峰值: %d", st.Peak)
+	if st.Watched > 0 {
+		fmt.Fprintf(&sb, "  看过: %d人", st.Watched)
+	}
+	fmt.Fprintf(&sb, "\n弹幕: %d条  收入: ¥%.1f", st.Danmaku, float64(st.Gold)/1000)
+	for i, s := range st.TopSenders(5) {
+		if i == 0 {
+			sb.WriteString("\n—— 排行 ——")
+		}
+		fmt.Fprintf(&sb, "\n%d. %s ¥%.1f 弹幕%d条", i+1, s.Name, s.Yuan(), s.Count)
+	}
+	return sb.String()
+}
+
+// broadcast 通过第一个在线的bot发送到开启了本插件的群
+func broadcast(gids []int64, msg message.Message) {
+	if len(gids) == 0 {
+		return
+	}
+	zero.RangeBot(func(_ int64, ctx *zero.Ctx) bool {
+		for _, gid := range gids {
+			if !liveen.IsEnabledIn(gid) {
+				continue
+			}
+			if gid > 0 {
+				ctx.SendGroupMessage(gid, msg)
+			} else {
+				ctx.SendPrivateMessage(-gid, msg)
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,119 @@
+package bilibili
+
+import (
+	"os"
+
+	"github.com/jinzhu/gorm"
+)
+
+// livewatchdb 直播间监控数据库
+type livewatchdb gorm.DB
+
+type livewatch struct {
+	ID        int64 `gorm:"column:id;primary_key"`
+	RoomID    int64 `gorm:"column:room_id;index:idx_room_gid"` // RoomID 真实房间号
+	GroupID   int64 `gorm:"column:group_id;index:idx_room_gid"`
+	Threshold int64 `gorm:"column:threshold;default:30"` // Threshold 转发醒目留言与礼物的最低金额, 单位元
+}
+
+// TableName ...
+func (livewatch) TableName() string {
+	return "bilibili_live_watch"
+}
+
+type liveroom struct {
+	RoomID  int64  `gorm:"column:room_id;primary_key"`
+	ShortID int64  `gorm:"column:short_id"`
+	UID     int64  `gorm:"column:uid"`
+	Name    string `gorm:"column:name"`
+}
+
+// TableName ...
+func (liveroom) TableName() string {
+	return "bilibili_live_room"
+}
+
+// initializeLiveWatch 初始化直播间监控数据库
+func initializeLiveWatch(dbpath string) *livewatchdb {
+	if _, err := os.Stat(dbpath); err != nil || os.IsNotExist(err) {
+		// 生成文件
+		f, err := os.Create(dbpath)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+	}
+	gdb, err := gorm.Open("sqlite3", dbpath)
+	if err != nil {
+		panic(err)
+	}
+	gdb.AutoMigrate(&livewatch{}).AutoMigrate(&liveroom{})
+	return (*livewatchdb)(gdb)
+}
+
+// watch 添加或更新监控
+func (ldb *livewatchdb) watch(room liveroom, gid, threshold int64) error {
+	db := (*gorm.DB)(ldb)
+	if err := db.Model(&liveroom{}).Save(&room).Error; err != nil {
+		return err
+	}
+	var w livewatch
+	err := db.Model(&livewatch{}).First(&w, "room_id = ? and group_id = ?", room.RoomID, gid).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return db.Model(&livewatch{}).Create(&livewatch{RoomID: room.RoomID, GroupID: gid, Threshold: threshold}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Model(&livewatch{}).Where("id = ?", w.ID).Update("threshold", threshold).Error
+}
+
+// unwatch 取消监控, 返回该直播间是否已无人监控
+func (ldb *livewatchdb) unwatch(roomid, gid int64) (empty bool, err error) {
+	db := (*gorm.DB)(ldb)
+	err = db.Where("room_id = ? and group_id = ?", roomid, gid).Delete(&livewatch{}).Error
+	if err != nil {
+		return
+	}
+	n := 0
+	err = db.Model(&livewatch{}).Where("room_id = ?", roomid).Count(&n).Error
+	return n == 0, err
+}
+
+// setThreshold 设置转发阈值
+func (ldb *livewatchdb) setThreshold(roomid, gid, threshold int64) error {
+	db := (*gorm.DB)(ldb)
+	r := db.Model(&livewatch{}).Where("room_id = ? and group_id = ?", roomid, gid).Update("threshold", threshold)
+	if r.Error == nil && r.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return r.Error
+}
+
+// watchers 监控该直播间的群与阈值
+func (ldb *livewatchdb) watchers(roomid int64) (ws []livewatch) {
+	db := (*gorm.DB)(ldb)
+	db.Model(&livewatch{}).Find(&ws, "room_id = ?", roomid)
+	return
+}
+
+// watchersOf 群监控的所有直播间
+func (ldb *livewatchdb) watchersOf(gid int64) (ws []livewatch) {
+	db := (*gorm.DB)(ldb)
+	db.Model(&livewatch{}).Find(&ws, "group_id = ?", gid)
+	return
+}
+
+// rooms 所有被监控的直播间
+func (ldb *livewatchdb) rooms() (rs []liveroom) {
+	db := (*gorm.DB)(ldb)
+	db.Model(&liveroom{}).Where("room_id in (?)", db.Model(&livewatch{}).Select("room_id").QueryExpr()).Find(&rs)
+	return
+}
+
+// room 由真实房间号或短号查找直播间
+func (ldb *livewatchdb) room(id int64) (r liveroom, err error) {
+	db := (*gorm.DB)(ldb)
+	err = db.Model(&liveroom{}).First(&r, "room_id = ? or short_id = ?", id, id).Error
+	return
+}
@@ -0,0 +1,75 @@
+package bilibili
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/imgfactory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/bilibili/live"
+)
+
+var cloudcolors = []color.RGBA{
+	{0xe6, 0x4a, 0x19, 0xff}, {0x19, 0x76, 0xd2, 0xff}, {0x38, 0x8e, 0x3c, 0xff},
+	{0x7b, 0x1f, 0xa2, 0xff}, {0xf5, 0x7c, 0x00, 0xff}, {0x00, 0x83, 0x8f, 0xff},
+	{0xc2, 0x18, 0x5b, 0xff}, {0x5d, 0x40, 0x37, 0xff},
+}
+
+type rect struct{ x0, y0, x1, y1 float64 }
+
+func (a rect) overlaps(b rect) bool {
+	return a.x0 < b.x1 && b.x0 < a.x1 && a.y0 < b.y1 && b.y0 < a.y1
+}
+
+// drawWordCloud 按词频绘制词云, 词从中心沿螺线向外放置, 放不下的词跳过
+func drawWordCloud(words []live.Word, w, h int) ([]byte, error) {
+	fd, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	canvas := gg.NewContext(w, h)
+	canvas.SetRGB(1, 1, 1)
+	canvas.Clear()
+	if len(words) == 0 {
+		return imgfactory.ToBytes(canvas.Image())
+	}
+	const minsize, maxsize = 14.0, 72.0
+	maxc := float64(words[0].Count)
+	cx, cy := float64(w)/2, float64(h)/2
+	placed := make([]rect, 0, len(words))
+	for i, wd := range words {
+		size := minsize + (maxsize-minsize)*math.Sqrt(float64(wd.Count)/maxc)
+		if err = canvas.ParseFontFace(fd, size); err != nil {
+			return nil, err
+		}
+		tw, th := canvas.MeasureString(wd.Text)
+		for t := 0.0; t < 200; t += 0.1 {
+			// 横向拉伸的阿基米德螺线, 贴合宽画布
+			x := cx + 6*t*math.Cos(t)*float64(w)/float64(h) - tw/2
+			y := cy + 6*t*math.Sin(t) - th/2
+			r := rect{x - 2, y - 2, x + tw + 2, y + th + 2}
+			if r.x0 < 0 || r.y0 < 0 || r.x1 > float64(w) || r.y1 > float64(h) {
+				continue
+			}
+			ok := true
+			for _, p := range placed {
+				if r.overlaps(p) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			placed = append(placed, r)
+			canvas.SetColor(cloudcolors[i%len(cloudcolors)])
+			canvas.DrawStringAnchored(wd.Text, x, y, 0, 1)
+			break
+		}
+	}
+	return imgfactory.ToBytes(canvas.Image())
+}
@@ -1,5 +1,7 @@
 package event
 
+import "time"
+
 type storage int64
 
 // 申请
@@ -7,7 +9,7 @@ func (s *storage) setapply(on bool) {
 	if on {
 		*s |= 0b001
 	} else {
-		*s &= 0b110
+		*s &^= 0b001
 	}
 }
 
@@ -16,7 +18,7 @@ func (s *storage) setinvite(on bool) {
 	if on {
 		*s |= 0b010
 	} else {
-		*s &= 0b101
+		*s &^= 0b010
 	}
 }
 
@@ -25,7 +27,7 @@ func (s *storage) setmaster(on bool) {
 	if on {
 		*s |= 0b100
 	} else {
-		*s &= 0b011
+		*s &^= 0b100
 	}
 }
 
@@ -43,3 +45,20 @@ func (s *storage) isinviteon() bool {
 func (s *storage) ismasteroff() bool {
 	return *s&0b100 > 0
 }
+
+// defaultexpire 待处理请求的默认有效期, 小时
+const defaultexpire = 72
+
+// 有效期, 存放在第 8 位以上
+func (s *storage) setexpire(hours int64) {
+	*s = *s&0xff | storage(hours<<8)
+}
+
+// 有效期
+func (s *storage) expire() time.Duration {
+	hours := int64(*s >> 8)
+	if hours <= 0 {
+		hours = defaultexpire
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -4,8 +4,11 @@ package event
 import (
 	"encoding/binary"
 	"strconv"
+	"strings"
 	"time"
 
+	fcext "github.com/FloatTech/floatbox/ctxext"
+	"github.com/FloatTech/floatbox/math"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	base14 "github.com/fumiama/go-base16384"
@@ -20,88 +23,66 @@ func init() {
 		Brief:            "好友申请和群聊邀请事件处理",
 		Help: "- [开启|关闭]自动同意[申请|邀请|主人]\n" +
 			"- [同意|拒绝][申请|邀请][flag]\n" +
-			"Tips: 信息默认发送给主人列表第一位, 默认同意所有主人的事件, flag跟随事件一起发送",
+			"- 查看待处理请求\n" +
+			"- [同意|拒绝][编号] [理由]\n" +
+			"- 设置请求有效期[N]小时\n" +
+			"- 添加自动同意规则[申请|邀请] [白名单 qq|关键词 xxx|等级 N|人数 min-max]\n" +
+			"- 删除自动同意规则[编号]\n" +
+			"- 查看自动同意规则\n" +
+			"Tips: 信息发送给所有主人, 默认同意所有主人的事件, 待处理请求超过有效期自动失效\n" +
+			"自动同意规则: 白名单直接同意; 否则需满足其余所有规则, 多个关键词命中其一即可",
+		PrivateDataFolder: "event",
 	})
-	engine.On("request/group/invite").SetBlock(false).
+
+	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+		err := db.init(engine.DataFolder() + "event.db")
+		if err != nil {
+			logrus.Errorln("[event] 打开数据库失败:", err)
+			return false
+		}
+		return true
+	})
+
+	engine.On("request/group/invite", getdb).SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
-			if ok {
-				su := zero.BotConfig.SuperUsers[0]
-				now := time.Unix(ctx.Event.Time, 0).Format("2006-01-02 15:04:05")
-				flag, err := strconv.ParseInt(ctx.Event.Flag, 10, 64)
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return
-				}
-				var buf [8]byte
-				binary.BigEndian.PutUint64(buf[:], uint64(flag))
-				es := base14.EncodeToString(buf[1:])
-				userid := ctx.Event.UserID
-				username := ctx.CardOrNickName(userid)
-				data := (storage)(c.GetData(-su))
-				groupname := ctx.GetThisGroupInfo(true).Name
-				groupid := ctx.Event.GroupID
-				logrus.Info("[event]收到来自[", username, "](", userid, ")的群聊邀请，群:[", groupname, "](", groupid, ")")
-				if data.isinviteon() || (!data.ismasteroff() && zero.SuperUserPermission(ctx)) {
-					ctx.SetGroupAddRequest(ctx.Event.Flag, "invite", true, "")
-					ctx.SendPrivateForwardMessage(su, message.Message{message.CustomNode(username, userid,
-						"已自动同意在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")的群聊邀请"+
-							"\n群聊:["+groupname+"]("+strconv.FormatInt(groupid, 10)+")"+
-							"\nflag:"+es)})
-					return
-				}
-				ctx.SendPrivateForwardMessage(su,
-					message.Message{message.CustomNode(username, userid,
-						"在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")的群聊邀请"+
-							"\n群聊:["+groupname+"]("+strconv.FormatInt(groupid, 10)+")"+
-							"\n请在下方复制flag并在前面加上:"+
-							"\n同意/拒绝邀请，来决定同意还是拒绝"),
-						message.CustomNode(username, userid, es)})
+			if !ok {
+				return
 			}
+			data := (storage)(c.GetData(-zero.BotConfig.SuperUsers[0]))
+			r := &request{
+				Flag:      ctx.Event.Flag,
+				Kind:      kindInvite,
+				UserID:    ctx.Event.UserID,
+				UserName:  ctx.CardOrNickName(ctx.Event.UserID),
+				GroupID:   ctx.Event.GroupID,
+				GroupName: ctx.GetThisGroupInfo(true).Name,
+				Comment:   ctx.Event.Comment,
+				Time:      ctx.Event.Time,
+			}
+			logrus.Info("[event]收到来自[", r.UserName, "](", r.UserID, ")的群聊邀请，群:[", r.GroupName, "](", r.GroupID, ")")
+			handle(ctx, r, data)
 		})
-	engine.On("request/friend").SetBlock(false).
+	engine.On("request/friend", getdb).SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
-			if ok {
-				su := zero.BotConfig.SuperUsers[0]
-				now := time.Unix(ctx.Event.Time, 0).Format("2006-01-02 15:04:05")
-				flag, err := strconv.ParseInt(ctx.Event.Flag, 10, 64)
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return
-				}
-				var buf [8]byte
-				binary.BigEndian.PutUint64(buf[:], uint64(flag))
-				es := base14.EncodeToString(buf[1:])
-				comment := ctx.Event.Comment
-				userid := ctx.Event.UserID
-				username := ctx.CardOrNickName(userid)
-				data := (storage)(c.GetData(-su))
-				logrus.Info("[event]收到来自[", username, "](", userid, ")的好友申请")
-				if data.isapplyon() || (!data.ismasteroff() && zero.SuperUserPermission(ctx)) {
-					ctx.SetFriendAddRequest(ctx.Event.Flag, true, "")
-					ctx.SendPrivateForwardMessage(su, message.Message{message.CustomNode(username, userid,
-						"已自动同意在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")"+
-							"\n的好友请求:"+comment+
-							"\nflag:"+es)})
-					return
-				}
-				ctx.SendPrivateForwardMessage(su,
-					message.Message{message.CustomNode(username, userid,
-						"在"+now+"收到来自"+
-							"\n用户:["+username+"]("+strconv.FormatInt(userid, 10)+")"+
-							"\n的好友请求:"+comment+
-							"\n请在下方复制flag并在前面加上:"+
-							"\n同意/拒绝申请，来决定同意还是拒绝"),
-						message.CustomNode(username, userid, es)})
+			if !ok {
+				return
+			}
+			data := (storage)(c.GetData(-zero.BotConfig.SuperUsers[0]))
+			r := &request{
+				Flag:     ctx.Event.Flag,
+				Kind:     kindFriend,
+				UserID:   ctx.Event.UserID,
+				UserName: ctx.CardOrNickName(ctx.Event.UserID),
+				Comment:  ctx.Event.Comment,
+				Time:     ctx.Event.Time,
 			}
+			logrus.Info("[event]收到来自[", r.UserName, "](", r.UserID, ")的好友申请")
+			handle(ctx, r, data)
 		})
-	engine.OnRegex(`^(同意|拒绝)(申请|邀请)\s*([一-踀]{4})\s*(.*)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+	engine.OnRegex(`^(同意|拒绝)(申请|邀请)\s*([一-踀]{4})\s*(.*)$`, zero.SuperUserPermission, zero.OnlyPrivate, getdb).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			su := zero.BotConfig.SuperUsers[0]
 			cmd := ctx.State["regex_matched"].([]string)[1]
 			org := ctx.State["regex_matched"].([]string)[2]
 			es := ctx.State["regex_matched"].([]string)[3]
@@ -109,15 +90,110 @@ func init() {
 			var buf [8]byte
 			copy(buf[1:], base14.DecodeFromString(es))
 			flag := strconv.FormatInt(int64(binary.BigEndian.Uint64(buf[:])), 10)
-			ok := cmd == "同意"
-			switch org {
-			case "申请":
-				ctx.SetFriendAddRequest(flag, ok, other)
-				ctx.SendPrivateMessage(su, message.Text("已", cmd, org))
-			case "邀请":
-				ctx.SetGroupAddRequest(flag, "invite", ok, other)
-				ctx.SendPrivateMessage(su, message.Text("已", cmd, org))
+			reply(ctx, &request{Flag: flag, Kind: org}, cmd == "同意", other)
+		})
+	engine.OnRegex(`^(同意|拒绝)(\d{1,3})\s*(.*)$`, zero.SuperUserPermission, zero.OnlyPrivate, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			data := (storage)(c.GetData(-zero.BotConfig.SuperUsers[0]))
+			cmd := ctx.State["regex_matched"].([]string)[1]
+			idx, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[2])
+			other := ctx.State["regex_matched"].([]string)[3]
+			_ = db.expire(time.Now().Add(-data.expire()))
+			r, err := db.byIndex(idx)
+			if err != nil {
+				ctx.SendChain(message.Text("没有编号为", idx, "的待处理请求, 可能已过期或已被处理"))
+				return
+			}
+			reply(ctx, &r, cmd == "同意", other)
+		})
+	engine.OnFullMatch("查看待处理请求", zero.SuperUserPermission, zero.OnlyPrivate, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			data := (storage)(c.GetData(-zero.BotConfig.SuperUsers[0]))
+			err := db.expire(time.Now().Add(-data.expire()))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
 			}
+			rs, err := db.pending()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rs) == 0 {
+				ctx.SendChain(message.Text("没有待处理的请求"))
+				return
+			}
+			var sb strings.Builder
+			for _, r := range rs {
+				sb.WriteString("[" + strconv.Itoa(r.Index) + "] " + r.describe() + "\n")
+			}
+			sb.WriteString("发送 同意/拒绝+编号 处理, 有效期" + strconv.FormatFloat(data.expire().Hours(), 'f', 0, 64) + "小时")
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置请求有效期(\d+)小时$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			su := zero.BotConfig.SuperUsers[0]
+			hours := math.Str2Int64(ctx.State["regex_matched"].([]string)[1])
+			if hours <= 0 || hours > 720 {
+				ctx.SendChain(message.Text("有效期需在1~720小时之间"))
+				return
+			}
+			data := (storage)(c.GetData(-su))
+			data.setexpire(hours)
+			err := c.SetData(-su, int64(data))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已设置待处理请求有效期为", hours, "小时"))
+		})
+	engine.OnRegex(`^添加自动同意规则(申请|邀请)\s*(白名单|关键词|等级|人数)\s*(.+)$`, zero.SuperUserPermission, zero.OnlyPrivate, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			regex := ctx.State["regex_matched"].([]string)
+			r, err := newRule(regex[1], regex[2], regex[3])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = db.addRule(r)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已添加规则[", r.ID, "] ", r.Kind, " ", r.Type, " ", r.Value))
+		})
+	engine.OnRegex(`^删除自动同意规则(\d+)$`, zero.SuperUserPermission, zero.OnlyPrivate, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id := math.Str2Int64(ctx.State["regex_matched"].([]string)[1])
+			err := db.delRule(id)
+			if err != nil {
+				ctx.SendChain(message.Text("没有编号为", id, "的规则"))
+				return
+			}
+			ctx.SendChain(message.Text("已删除规则", id))
+		})
+	engine.OnFullMatch("查看自动同意规则", zero.SuperUserPermission, zero.OnlyPrivate, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			rs, err := db.rules("")
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rs) == 0 {
+				ctx.SendChain(message.Text("没有自动同意规则"))
+				return
+			}
+			var sb strings.Builder
+			for i, r := range rs {
+				if i > 0 {
+					sb.WriteByte('\n')
+				}
+				sb.WriteString("[" + strconv.FormatInt(r.ID, 10) + "] " + r.Kind + " " + r.Type + " " + r.Value)
+			}
+			ctx.SendChain(message.Text(sb.String()))
 		})
 	engine.OnRegex(`^(开启|关闭)自动同意(申请|邀请|主人)$`, zero.SuperUserPermission, zero.OnlyPrivate).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
@@ -142,3 +218,94 @@ func init() {
 			ctx.SendChain(message.Text("已设置自动同意" + from + "为" + option))
 		})
 }
+
+// handle 自动同意或加入待处理列表, 并通知所有主人
+func handle(ctx *zero.Ctx, r *request, data storage) {
+	es, err := encodeflag(r.Flag)
+	if err != nil {
+		logrus.Warnln("[event] 解析flag失败:", err)
+		return
+	}
+	on := data.isapplyon()
+	if r.Kind == kindInvite {
+		on = data.isinviteon()
+	}
+	reason := "全部同意"
+	switch {
+	case on:
+	case !data.ismasteroff() && zero.SuperUserPermission(ctx):
+		reason, on = "主人", true
+	default:
+		reason, on = autoapprove(ctx, r)
+	}
+	now := time.Unix(r.Time, 0).Format("2006-01-02 15:04:05")
+	if on {
+		accept(ctx, r, true, "")
+		notify(ctx, message.CustomNode(r.UserName, r.UserID,
+			"已自动同意("+reason+")在"+now+"收到的"+r.describe()+"\nflag:"+es))
+		return
+	}
+	_ = db.expire(time.Now().Add(-data.expire()))
+	err = db.add(r)
+	if err != nil {
+		logrus.Warnln("[event] 保存请求失败:", err)
+	}
+	notify(ctx,
+		message.CustomNode(r.UserName, r.UserID,
+			"在"+now+"收到"+r.describe()+
+				"\n请发送 同意"+strconv.Itoa(r.Index)+" 或 拒绝"+strconv.Itoa(r.Index)+" [理由] 处理"+
+				"\n或复制下方flag并在前面加上 同意/拒绝"+r.Kind+
+				"\n有效期"+strconv.FormatFloat(data.expire().Hours(), 'f', 0, 64)+"小时"),
+		message.CustomNode(r.UserName, r.UserID, es))
+}
+
+// reply 处理请求并从待处理列表移除
+func reply(ctx *zero.Ctx, r *request, ok bool, reason string) {
+	accept(ctx, r, ok, reason)
+	_ = db.done(r.Flag)
+	cmd := "拒绝"
+	if ok {
+		cmd = "同意"
+	}
+	msg := "已" + cmd + r.Kind
+	if r.UserID != 0 {
+		msg += ": " + r.describe()
+	}
+	for _, su := range zero.BotConfig.SuperUsers {
+		ctx.SendPrivateMessage(su, message.Text(msg))
+	}
+}
+
+func accept(ctx *zero.Ctx, r *request, ok bool, reason string) {
+	switch r.Kind {
+	case kindFriend:
+		ctx.SetFriendAddRequest(r.Flag, ok, reason)
+	case kindInvite:
+		ctx.SetGroupAddRequest(r.Flag, "invite", ok, reason)
+	}
+}
+
+// notify 将消息转发给所有主人
+func notify(ctx *zero.Ctx, nodes ...message.MessageSegment) {
+	for _, su := range zero.BotConfig.SuperUsers {
+		ctx.SendPrivateForwardMessage(su, nodes)
+	}
+}
+
+func encodeflag(flag string) (string, error) {
+	f, err := strconv.ParseInt(flag, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(f))
+	return base14.EncodeToString(buf[1:]), nil
+}
+
+func (r *request) describe() string {
+	s := "用户:[" + r.UserName + "](" + strconv.FormatInt(r.UserID, 10) + ")的"
+	if r.Kind == kindInvite {
+		return s + "群聊邀请\n群聊:[" + r.GroupName + "](" + strconv.FormatInt(r.GroupID, 10) + ")"
+	}
+	return s + "好友申请:" + r.Comment
+}
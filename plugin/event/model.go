@@ -0,0 +1,149 @@
+package event
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	pendingTable = "pending"
+	ruleTable    = "rule"
+)
+
+const (
+	kindFriend = "申请"
+	kindInvite = "邀请"
+)
+
+const (
+	ruleWhite   = "白名单"
+	ruleKeyword = "关键词"
+	ruleLevel   = "等级"
+	ruleMember  = "人数"
+)
+
+// eventdb 待处理请求与自动同意规则
+type eventdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// request 一条待处理的好友申请或群聊邀请
+type request struct {
+	Flag      string `db:"flag"`
+	Index     int    `db:"idx"` // 短编号, 用于同意/拒绝
+	Kind      string `db:"kind"`
+	UserID    int64  `db:"uid"`
+	UserName  string `db:"uname"`
+	GroupID   int64  `db:"gid"`
+	GroupName string `db:"gname"`
+	Comment   string `db:"comment"`
+	Time      int64  `db:"time"`
+}
+
+// rule 一条自动同意规则
+type rule struct {
+	ID    int64  `db:"id"`
+	Kind  string `db:"kind"`
+	Type  string `db:"type"`
+	Value string `db:"value"`
+}
+
+var db = &eventdb{}
+
+func (edb *eventdb) init(path string) error {
+	edb.DBPath = path
+	err := edb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = edb.Create(pendingTable, &request{})
+	if err != nil {
+		return err
+	}
+	return edb.Create(ruleTable, &rule{})
+}
+
+// add 加入待处理列表, 分配最小的空闲编号
+func (edb *eventdb) add(r *request) error {
+	edb.Lock()
+	defer edb.Unlock()
+	used := make(map[int]bool)
+	var p request
+	_ = edb.FindFor(pendingTable, &p, "", func() error {
+		used[p.Index] = true
+		return nil
+	})
+	r.Index = 1
+	for used[r.Index] {
+		r.Index++
+	}
+	return edb.Insert(pendingTable, r)
+}
+
+// expire 删除早于 before 的请求
+func (edb *eventdb) expire(before time.Time) error {
+	edb.Lock()
+	defer edb.Unlock()
+	return edb.Del(pendingTable, "WHERE time < "+strconv.FormatInt(before.Unix(), 10))
+}
+
+func (edb *eventdb) pending() ([]*request, error) {
+	edb.RLock()
+	defer edb.RUnlock()
+	rs, err := sql.FindAll[request](&edb.Sqlite, pendingTable, "ORDER BY idx ASC")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return rs, err
+}
+
+func (edb *eventdb) byIndex(idx int) (r request, err error) {
+	edb.RLock()
+	defer edb.RUnlock()
+	err = edb.Find(pendingTable, &r, "WHERE idx = "+strconv.Itoa(idx))
+	return
+}
+
+func (edb *eventdb) done(flag string) error {
+	edb.Lock()
+	defer edb.Unlock()
+	return edb.Del(pendingTable, "WHERE flag = '"+strings.ReplaceAll(flag, "'", "''")+"'")
+}
+
+func (edb *eventdb) addRule(r *rule) error {
+	edb.Lock()
+	defer edb.Unlock()
+	var last rule
+	_ = edb.Find(ruleTable, &last, "ORDER BY id DESC LIMIT 1")
+	r.ID = last.ID + 1
+	return edb.Insert(ruleTable, r)
+}
+
+func (edb *eventdb) delRule(id int64) error {
+	edb.Lock()
+	defer edb.Unlock()
+	if !edb.CanFind(ruleTable, "WHERE id = "+strconv.FormatInt(id, 10)) {
+		return sql.ErrNullResult
+	}
+	return edb.Del(ruleTable, "WHERE id = "+strconv.FormatInt(id, 10))
+}
+
+// rules 某类请求的所有规则, kind 为空时返回全部
+func (edb *eventdb) rules(kind string) ([]*rule, error) {
+	edb.RLock()
+	defer edb.RUnlock()
+	q := "ORDER BY id ASC"
+	if kind != "" {
+		q = "WHERE kind = '" + kind + "' " + q
+	}
+	rs, err := sql.FindAll[rule](&edb.Sqlite, ruleTable, q)
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return rs, err
+}
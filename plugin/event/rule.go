@@ -0,0 +1,116 @@
+package event
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+)
+
+var errInvalidRule = errors.New("规则格式错误, 例: 白名单 123456 | 关键词 xxx | 等级 16 | 人数 100-2000")
+
+// newRule 解析规则类型与取值
+func newRule(kind, typ, value string) (*rule, error) {
+	value = strings.TrimSpace(value)
+	switch typ {
+	case ruleWhite, ruleLevel:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, errInvalidRule
+		}
+	case ruleKeyword:
+		if value == "" {
+			return nil, errInvalidRule
+		}
+	case ruleMember:
+		if kind != kindInvite {
+			return nil, errors.New("人数规则仅适用于邀请")
+		}
+		if _, _, err := memberRange(value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errInvalidRule
+	}
+	return &rule{Kind: kind, Type: typ, Value: value}, nil
+}
+
+// memberRange 解析 min-max, 省略的一端不限制
+func memberRange(s string) (lo, hi int64, err error) {
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, errInvalidRule
+	}
+	if a != "" {
+		lo, err = strconv.ParseInt(a, 10, 64)
+		if err != nil {
+			return 0, 0, errInvalidRule
+		}
+	}
+	if b != "" {
+		hi, err = strconv.ParseInt(b, 10, 64)
+		if err != nil {
+			return 0, 0, errInvalidRule
+		}
+	}
+	return
+}
+
+// autoapprove 按规则判断是否自动同意, 返回命中的理由.
+// 白名单直接通过; 否则需满足所有其它规则, 多个关键词命中其一即可.
+func autoapprove(ctx *zero.Ctx, r *request) (string, bool) {
+	rules, err := db.rules(r.Kind)
+	if err != nil || len(rules) == 0 {
+		return "", false
+	}
+	var keywords []string
+	var conds []*rule
+	for _, ru := range rules {
+		switch ru.Type {
+		case ruleWhite:
+			if ru.Value == strconv.FormatInt(r.UserID, 10) {
+				return "白名单", true
+			}
+		case ruleKeyword:
+			keywords = append(keywords, ru.Value)
+		default:
+			conds = append(conds, ru)
+		}
+	}
+	if len(keywords) == 0 && len(conds) == 0 {
+		return "", false
+	}
+	var reasons []string
+	if len(keywords) > 0 {
+		hit := ""
+		for _, k := range keywords {
+			if strings.Contains(r.Comment, k) {
+				hit = k
+				break
+			}
+		}
+		if hit == "" {
+			return "", false
+		}
+		reasons = append(reasons, "关键词"+hit)
+	}
+	for _, ru := range conds {
+		switch ru.Type {
+		case ruleLevel:
+			least, _ := strconv.ParseInt(ru.Value, 10, 64)
+			lv := ctx.GetStrangerInfo(r.UserID, true).Get("level").Int()
+			if lv < least {
+				return "", false
+			}
+			reasons = append(reasons, "等级"+strconv.FormatInt(lv, 10))
+		case ruleMember:
+			lo, hi, _ := memberRange(ru.Value)
+			n := ctx.GetGroupInfo(r.GroupID, true).MemberCount
+			if n < lo || (hi > 0 && n > hi) {
+				return "", false
+			}
+			reasons = append(reasons, "人数"+strconv.FormatInt(n, 10))
+		}
+	}
+	return strings.Join(reasons, ","), true
+}
@@ -0,0 +1,154 @@
+package genshin
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/sirupsen/logrus"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/genshin/gacha"
+)
+
+// bannerfile 描述活动祈愿 Up 物品的元数据, 可放在 zip 根目录, 数据目录中的同名文件优先
+const bannerfile = "banners.json"
+
+// bannermeta 一个活动祈愿的元数据
+type bannermeta struct {
+	Name string   `json:"name"`
+	Five []string `json:"five"` // Five Up 五星
+	Four []string `json:"four"` // Four Up 四星
+}
+
+var (
+	pool    = &gacha.Pool{}
+	banners = map[gacha.Kind]*gacha.Banner{}
+	titles  = map[gacha.Kind]string{} // 卡池名称
+	// itemfiles 物品名到图片, 按 zip 中的目录区分
+	itemfiles = map[string]map[string]*zip.File{}
+)
+
+// folderof 物品所在的 zip 目录
+func folderof(rarity int, weapon bool) string {
+	switch {
+	case rarity == 5 && weapon:
+		return "five2"
+	case rarity == 5:
+		return "five"
+	case rarity == 4 && weapon:
+		return "four2"
+	case rarity == 4:
+		return "four"
+	}
+	return "Three"
+}
+
+// itemname 由图片文件名取出物品名
+func itemname(f *zip.File) string {
+	m := namereg.FindStringSubmatch(f.Name)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// loadbanners 由解析后的 zip 建立卡池, datafolder 中的 banners.json 覆盖 zip 中的
+func loadbanners(datafolder string) error {
+	names := func(folder string) []string {
+		m := make(map[string]*zip.File, len(filetree[folder]))
+		ns := make([]string, 0, len(filetree[folder]))
+		for _, f := range filetree[folder] {
+			n := itemname(f)
+			if n == "" {
+				continue
+			}
+			if _, ok := m[n]; !ok {
+				ns = append(ns, n)
+			}
+			m[n] = f
+		}
+		itemfiles[folder] = m
+		return ns
+	}
+	pool.Five, pool.FiveWeapon = names("five"), names("five2")
+	pool.Four, pool.FourWeapon = names("four"), names("four2")
+	pool.Three = names("Three")
+
+	var r io.ReadCloser
+	var err error
+	if p := datafolder + bannerfile; file.IsExist(p) {
+		r, err = os.Open(p)
+	} else if fs, ok := filetree[bannerfile]; ok && len(fs) > 0 {
+		r, err = fs[0].Open()
+	}
+	if err != nil {
+		return err
+	}
+	meta := map[string]bannermeta{}
+	if r != nil {
+		err = json.NewDecoder(r).Decode(&meta)
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	banners[gacha.Standard] = &gacha.Banner{Kind: gacha.Standard, Pool: pool}
+	titles[gacha.Standard] = "奔行世间"
+	for key, k := range map[string]gacha.Kind{"character": gacha.Character, "weapon": gacha.Weapon} {
+		m := meta[key]
+		b := &gacha.Banner{Kind: k, Pool: pool}
+		five, four := pool.Five, append(append([]string{}, pool.Four...), pool.FourWeapon...)
+		if k == gacha.Weapon {
+			five = pool.FiveWeapon
+		}
+		b.UpFive, b.UpFour = known(m.Five, five), known(m.Four, four)
+		banners[k] = b
+		titles[k] = m.Name
+		if titles[k] == "" {
+			titles[k] = k.String() + "活动祈愿"
+		}
+	}
+	return nil
+}
+
+// known 过滤掉卡池中没有的物品
+func known(ups, all []string) []string {
+	ret := make([]string, 0, len(ups))
+	for _, u := range ups {
+		found := false
+		for _, a := range all {
+			if a == u {
+				found = true
+				break
+			}
+		}
+		if !found {
+			logrus.Warnln("[genshin] unknown rate-up item", u)
+			continue
+		}
+		ret = append(ret, u)
+	}
+	return ret
+}
+
+// describe 卡池说明
+func describe(k gacha.Kind) string {
+	b, ok := banners[k]
+	if !ok {
+		return k.String() + "卡池"
+	}
+	s := k.String() + "卡池「" + titles[k] + "」"
+	if len(b.UpFive) > 0 {
+		s += "\nUp五星: " + strings.Join(b.UpFive, " ")
+	}
+	if len(b.UpFour) > 0 {
+		s += "\nUp四星: " + strings.Join(b.UpFour, " ")
+	}
+	if k != gacha.Standard && len(b.UpFive) == 0 {
+		s += "\n(未配置Up物品, 与常驻相同)"
+	}
+	return s
+}
@@ -1,5 +1,8 @@
 package genshin
 
+import "github.com/FloatTech/ZeroBot-Plugin/plugin/genshin/gacha"
+
+// storage 群设置, 第0位为五星模式, 第1-2位为卡池类型
 type storage uint64
 
 func (s *storage) is5starsmode() bool {
@@ -14,3 +17,11 @@ func (s *storage) setmode(is5stars bool) bool {
 	}
 	return is5stars
 }
+
+func (s *storage) kind() gacha.Kind {
+	return gacha.Kind((*s >> 1) & 3)
+}
+
+func (s *storage) setkind(k gacha.Kind) {
+	*s = *s&^(3<<1) | storage(k&3)<<1
+}
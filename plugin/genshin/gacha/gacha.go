@@ -0,0 +1,218 @@
+// Package gacha 原神祈愿的概率模型
+//
+// 五星与四星的概率随距上次出货的抽数上升 (软保底), 到达硬保底时必出;
+// 活动祈愿中五星/四星未抽到 Up 时, 下一次同星级必为 Up (大保底).
+package gacha
+
+import (
+	"math/rand"
+)
+
+// Kind 祈愿类型, 不同类型的保底互不影响
+type Kind int
+
+const (
+	// Standard 常驻祈愿
+	Standard Kind = iota
+	// Character 角色活动祈愿
+	Character
+	// Weapon 武器活动祈愿
+	Weapon
+)
+
+var kindnames = [...]string{"常驻", "角色", "武器"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindnames) {
+		return "未知"
+	}
+	return kindnames[k]
+}
+
+// ParseKind 由名称得到类型
+func ParseKind(s string) (Kind, bool) {
+	for i, n := range kindnames {
+		if n == s {
+			return Kind(i), true
+		}
+	}
+	return 0, false
+}
+
+// Hard 五星与四星的硬保底
+func Hard(k Kind) (five, four int) {
+	if k == Weapon {
+		return 80, 10
+	}
+	return 90, 10
+}
+
+// Rate5 距上次五星的第 n 抽出五星的概率
+func Rate5(k Kind, n int) float64 {
+	base, soft, step := 0.006, 73, 0.06
+	if k == Weapon {
+		base, soft, step = 0.007, 62, 0.07
+	}
+	hard, _ := Hard(k)
+	return rate(n, base, soft, step, hard)
+}
+
+// Rate4 距上次四星的第 n 抽出四星的概率
+func Rate4(k Kind, n int) float64 {
+	base, soft, step := 0.051, 8, 0.51
+	if k == Weapon {
+		base, soft, step = 0.06, 7, 0.6
+	}
+	_, hard := Hard(k)
+	return rate(n, base, soft, step, hard)
+}
+
+func rate(n int, base float64, soft int, step float64, hard int) float64 {
+	if n >= hard {
+		return 1
+	}
+	p := base
+	if n > soft {
+		p += step * float64(n-soft)
+	}
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+// upchance 活动祈愿中出 Up 的概率
+func upchance(k Kind) float64 {
+	if k == Weapon {
+		return 0.75
+	}
+	return 0.5
+}
+
+// Item 抽到的物品
+type Item struct {
+	Name   string
+	Rarity int
+	Weapon bool
+	Up     bool // Up 是否为概率提升的物品
+	Pity   int  // Pity 出货时距上次同星级的抽数, 三星为 0
+}
+
+// Pool 所有可抽到的物品
+type Pool struct {
+	Five       []string // Five 五星角色
+	FiveWeapon []string // FiveWeapon 五星武器
+	Four       []string // Four 四星角色
+	FourWeapon []string // FourWeapon 四星武器
+	Three      []string // Three 三星武器
+}
+
+func (p *Pool) isweapon(name string) bool {
+	return contains(p.FiveWeapon, name) || contains(p.FourWeapon, name)
+}
+
+// Banner 一个卡池
+type Banner struct {
+	Kind   Kind
+	Pool   *Pool
+	UpFive []string // UpFive 概率提升的五星, 为空时没有大小保底
+	UpFour []string // UpFour 概率提升的四星
+}
+
+// State 单个用户在一种祈愿中的保底状态
+type State struct {
+	Pity5      int  // Pity5 距上次五星已抽的次数
+	Pity4      int  // Pity4 距上次四星已抽的次数
+	Guarantee5 bool // Guarantee5 下次五星必为 Up
+	Guarantee4 bool // Guarantee4 下次四星必为 Up
+}
+
+// Pull 抽一次并更新保底状态
+func (b *Banner) Pull(r *rand.Rand, s *State) Item {
+	s.Pity5++
+	s.Pity4++
+	if r.Float64() < Rate5(b.Kind, s.Pity5) {
+		it := b.pick(r, 5, &s.Guarantee5)
+		it.Pity = s.Pity5
+		s.Pity5 = 0
+		return it
+	}
+	if r.Float64() < Rate4(b.Kind, s.Pity4) {
+		it := b.pick(r, 4, &s.Guarantee4)
+		it.Pity = s.Pity4
+		s.Pity4 = 0
+		return it
+	}
+	return Item{Name: choose(r, b.Pool.Three), Rarity: 3, Weapon: true}
+}
+
+// PullN 连续抽 n 次
+func (b *Banner) PullN(r *rand.Rand, s *State, n int) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = b.Pull(r, s)
+	}
+	return items
+}
+
+// pick 按卡池规则选出 rarity 星的物品
+func (b *Banner) pick(r *rand.Rand, rarity int, guarantee *bool) Item {
+	chars, weapons, ups := b.Pool.Five, b.Pool.FiveWeapon, b.UpFive
+	if rarity == 4 {
+		chars, weapons, ups = b.Pool.Four, b.Pool.FourWeapon, b.UpFour
+	}
+	switch b.Kind {
+	case Character:
+		if rarity == 5 {
+			weapons = nil // 角色活动祈愿歪了只会出常驻五星角色
+		}
+	case Weapon:
+		if rarity == 5 {
+			chars = nil
+		}
+	}
+	if b.Kind != Standard && len(ups) > 0 {
+		if *guarantee || r.Float64() < upchance(b.Kind) {
+			*guarantee = false
+			name := choose(r, ups)
+			return Item{Name: name, Rarity: rarity, Weapon: b.Pool.isweapon(name), Up: true}
+		}
+		*guarantee = true
+		chars, weapons = without(chars, ups), without(weapons, ups)
+	}
+	weapon := len(chars) == 0 || (len(weapons) > 0 && r.Intn(2) == 0)
+	if weapon {
+		return Item{Name: choose(r, weapons), Rarity: rarity, Weapon: true}
+	}
+	return Item{Name: choose(r, chars), Rarity: rarity}
+}
+
+func choose(r *rand.Rand, s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[r.Intn(len(s))]
+}
+
+func contains(s []string, x string) bool {
+	for _, v := range s {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// without s 中不在 ex 里的元素
+func without(s, ex []string) []string {
+	if len(ex) == 0 {
+		return s
+	}
+	ret := make([]string, 0, len(s))
+	for _, v := range s {
+		if !contains(ex, v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,188 @@
+package genshin
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/genshin/gacha"
+)
+
+const (
+	pityTable    = "pity"
+	ownedTable   = "owned"
+	historyTable = "history"
+)
+
+// pity 用户在一种祈愿中的保底状态
+type pity struct {
+	ID         string `db:"id"` // ID QQ/类型
+	UserID     int64  `db:"uid"`
+	Kind       int    `db:"kind"`
+	Pity5      int    `db:"pity5"`
+	Pity4      int    `db:"pity4"`
+	Guarantee5 bool   `db:"guarantee5"`
+	Guarantee4 bool   `db:"guarantee4"`
+	Total      int64  `db:"total"` // Total 累计抽数
+}
+
+func (p *pity) state() gacha.State {
+	return gacha.State{Pity5: p.Pity5, Pity4: p.Pity4, Guarantee5: p.Guarantee5, Guarantee4: p.Guarantee4}
+}
+
+// owned 仓库中的物品
+type owned struct {
+	ID     string `db:"id"` // ID QQ/物品名
+	UserID int64  `db:"uid"`
+	Name   string `db:"name"`
+	Rarity int    `db:"rarity"`
+	Weapon bool   `db:"weapon"`
+	Count  int    `db:"count"`
+	First  int64  `db:"first"` // First 首次获得的时间
+}
+
+// level 角色命之座或武器精炼等级
+func (o *owned) level() string {
+	if o.Weapon {
+		r := o.Count
+		if r > 5 {
+			r = 5
+		}
+		return "R" + strconv.Itoa(r)
+	}
+	c := o.Count - 1
+	if c > 6 {
+		return "C6(溢出" + strconv.Itoa(c-6) + ")"
+	}
+	return "C" + strconv.Itoa(c)
+}
+
+// record 四星及以上的抽卡记录
+type record struct {
+	ID     int64  `db:"id"` // ID 抽到时的时间戳 (ns)
+	UserID int64  `db:"uid"`
+	Kind   int    `db:"kind"`
+	Name   string `db:"name"`
+	Rarity int    `db:"rarity"`
+	Weapon bool   `db:"weapon"`
+	Up     bool   `db:"up"`
+	Pity   int    `db:"pity"`
+}
+
+var gdb = &gachadb{}
+
+type gachadb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+func (gdb *gachadb) init(dbpath string) error {
+	gdb.DBPath = dbpath
+	err := gdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = gdb.Create(pityTable, &pity{})
+	if err != nil {
+		return err
+	}
+	err = gdb.Create(ownedTable, &owned{})
+	if err != nil {
+		return err
+	}
+	return gdb.Create(historyTable, &record{})
+}
+
+func pityid(uid int64, k gacha.Kind) string {
+	return strconv.FormatInt(uid, 10) + "/" + strconv.Itoa(int(k))
+}
+
+// pity 用户的保底状态, 没有记录时从零开始
+func (gdb *gachadb) pity(uid int64, k gacha.Kind) *pity {
+	gdb.RLock()
+	defer gdb.RUnlock()
+	p := &pity{}
+	if gdb.Find(pityTable, p, "WHERE id = '"+pityid(uid, k)+"'") != nil {
+		p = &pity{ID: pityid(uid, k), UserID: uid, Kind: int(k)}
+	}
+	return p
+}
+
+// save 保存一次祈愿后的保底状态, 并将结果放入仓库与记录
+func (gdb *gachadb) save(p *pity, s *gacha.State, items []gacha.Item) error {
+	gdb.Lock()
+	defer gdb.Unlock()
+	p.Pity5, p.Pity4, p.Guarantee5, p.Guarantee4 = s.Pity5, s.Pity4, s.Guarantee5, s.Guarantee4
+	p.Total += int64(len(items))
+	err := gdb.Insert(pityTable, p)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, it := range items {
+		o := &owned{}
+		id := strconv.FormatInt(p.UserID, 10) + "/" + it.Name
+		if gdb.Find(ownedTable, o, "WHERE id = "+quote(id)) != nil {
+			o = &owned{ID: id, UserID: p.UserID, Name: it.Name, Rarity: it.Rarity, Weapon: it.Weapon, First: now.Unix()}
+		}
+		o.Count++
+		err = gdb.Insert(ownedTable, o)
+		if err != nil {
+			return err
+		}
+		if it.Rarity < 4 {
+			continue
+		}
+		err = gdb.Insert(historyTable, &record{
+			ID: now.UnixNano() + int64(i), UserID: p.UserID, Kind: p.Kind,
+			Name: it.Name, Rarity: it.Rarity, Weapon: it.Weapon, Up: it.Up, Pity: it.Pity,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// owned 用户的仓库, 按星级降序, 同星级按数量降序
+func (gdb *gachadb) owned(uid int64) ([]*owned, error) {
+	gdb.RLock()
+	defer gdb.RUnlock()
+	ol, err := sql.FindAll[owned](&gdb.Sqlite, ownedTable, "WHERE uid = "+strconv.FormatInt(uid, 10))
+	if err == sql.ErrNullResult {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ol, func(i, j int) bool {
+		if ol[i].Rarity != ol[j].Rarity {
+			return ol[i].Rarity > ol[j].Rarity
+		}
+		if ol[i].Count != ol[j].Count {
+			return ol[i].Count > ol[j].Count
+		}
+		return ol[i].First < ol[j].First
+	})
+	return ol, nil
+}
+
+// history 用户在一种祈愿中四星及以上的记录, 按时间升序
+func (gdb *gachadb) history(uid int64, k gacha.Kind) ([]*record, error) {
+	gdb.RLock()
+	defer gdb.RUnlock()
+	rs, err := sql.FindAll[record](&gdb.Sqlite, historyTable,
+		"WHERE uid = "+strconv.FormatInt(uid, 10)+" AND kind = "+strconv.Itoa(int(k))+" ORDER BY id")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return rs, err
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,108 @@
+package genshin
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/genshin/gacha"
+)
+
+// pitystatus 当前已垫的抽数与大保底状态
+func pitystatus(k gacha.Kind, p *pity) string {
+	five, four := gacha.Hard(k)
+	s := "五星已垫" + strconv.Itoa(p.Pity5) + "/" + strconv.Itoa(five) + "抽"
+	if k != gacha.Standard {
+		if p.Guarantee5 {
+			s += "(大保底)"
+		} else {
+			s += "(小保底)"
+		}
+	}
+	return s + ", 四星已垫" + strconv.Itoa(p.Pity4) + "/" + strconv.Itoa(four) + "抽"
+}
+
+// warehouse 仓库内容
+func warehouse(ol []*owned) string {
+	groups := [5][]string{}
+	titles := [5]string{"五星角色", "五星武器", "四星角色", "四星武器", "三星武器"}
+	for _, o := range ol {
+		i := 2 * (5 - o.Rarity)
+		if o.Weapon {
+			i++
+		}
+		if o.Rarity < 4 {
+			groups[4] = append(groups[4], o.Name+"*"+strconv.Itoa(o.Count))
+			continue
+		}
+		groups[i] = append(groups[i], o.Name+" "+o.level())
+	}
+	var sb strings.Builder
+	for i, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		sb.WriteString("\n" + titles[i] + "(" + strconv.Itoa(len(g)) + "): " + strings.Join(g, ", "))
+	}
+	return strings.TrimPrefix(sb.String(), "\n")
+}
+
+// statistics 一种祈愿的统计与最近的出货
+func statistics(k gacha.Kind, p *pity, rs []*record) string {
+	var sb strings.Builder
+	sb.WriteString("[" + k.String() + "] 共" + strconv.FormatInt(p.Total, 10) + "抽, " + pitystatus(k, p))
+	n5, n4, sum5, lost, up := 0, 0, 0, 0, 0
+	var recent []string
+	for _, r := range rs {
+		if r.Rarity == 4 {
+			n4++
+			continue
+		}
+		n5++
+		sum5 += r.Pity
+		if k != gacha.Standard {
+			if r.Up {
+				up++
+			} else {
+				lost++
+			}
+		}
+		s := r.Name + "(" + strconv.Itoa(r.Pity) + ")"
+		if k != gacha.Standard && !r.Up {
+			s += "歪"
+		}
+		recent = append(recent, s)
+	}
+	sb.WriteString("\n五星" + strconv.Itoa(n5) + "个, 四星" + strconv.Itoa(n4) + "个")
+	if n5 > 0 {
+		sb.WriteString(", 五星平均" + strconv.FormatFloat(float64(sum5)/float64(n5), 'f', 1, 64) + "抽")
+	}
+	if up+lost > 0 {
+		sb.WriteString(", 歪" + strconv.Itoa(lost) + "次")
+	}
+	if len(recent) > 10 {
+		recent = recent[len(recent)-10:]
+	}
+	if len(recent) > 0 {
+		sb.WriteString("\n最近的五星: " + strings.Join(recent, " "))
+	}
+	return sb.String()
+}
+
+// sendtext 较长的文字转为图片发送
+func sendtext(ctx *zero.Ctx, s string) {
+	if strings.Count(s, "\n") < 10 && len([]rune(s)) < 300 {
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(s))
+		return
+	}
+	data, err := text.RenderToBase64(s, text.FontFile, 600, 20)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Image("base64://"+binary.BytesToString(data)))
+}
@@ -3,6 +3,7 @@ package genshin
 
 import (
 	"archive/zip"
+	"errors"
 	"image"
 	"image/color"
 	"image/draw"
@@ -11,7 +12,8 @@ import (
 	"math/rand"
 	"regexp"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"time"
 
 	fcext "github.com/FloatTech/floatbox/ctxext"
 	"github.com/FloatTech/floatbox/process"
@@ -23,12 +25,15 @@ import (
 	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/genshin/gacha"
 )
 
 type zipfilestructure map[string][]*zip.File
 
 var (
-	totl                   uint64 // 累计抽奖次数
+	rng                    = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rngmu                  sync.Mutex // rng 不是并发安全的
 	filetree               = make(zipfilestructure, 32)
 	starN3, starN4, starN5 *zip.File
 	namereg                = regexp.MustCompile(`_(.*)\.png`)
@@ -38,11 +43,44 @@ func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "原神模拟抽卡",
-		Help:             "- 原神十连\n- 切换原神卡池",
+		Help: "- 原神十连\n" +
+			"- 切换原神卡池[常驻|角色|武器|五星]\n" +
+			"- 查看原神卡池\n" +
+			"- 我的原神仓库\n" +
+			"- 原神抽卡记录\n" +
+			"注: 每人在常驻/角色/武器卡池的保底分别计算, 五星卡池不计入保底与仓库\n" +
+			"注: 活动卡池的Up物品读取自 Genshin.zip 或数据目录中的 banners.json",
 		PublicDataFolder: "Genshin",
 	}).ApplySingle(ctxext.DefaultSingle)
 
-	engine.OnFullMatch("切换原神卡池").SetBlock(true).Limit(ctxext.LimitByUser).
+	err := gdb.init(engine.DataFolder() + "gacha.db")
+	if err != nil {
+		panic(err)
+	}
+
+	getzip := fcext.DoOnceOnSuccess(
+		func(ctx *zero.Ctx) bool {
+			zipfile := engine.DataFolder() + "Genshin.zip"
+			_, err := engine.GetLazyData("Genshin.zip", false)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return false
+			}
+			err = parsezip(zipfile)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return false
+			}
+			err = loadbanners(engine.DataFolder())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return false
+			}
+			return true
+		},
+	)
+
+	engine.OnRegex(`^切换原神卡池\s*(常驻|角色|武器|五星)?$`).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
 			if !ok {
@@ -54,12 +92,20 @@ func init() {
 				gid = -ctx.Event.UserID
 			}
 			store := (storage)(c.GetData(gid))
-			if store.setmode(!store.is5starsmode()) {
+			arg := ctx.State["regex_matched"].([]string)[1]
+			k, iskind := gacha.ParseKind(arg)
+			switch {
+			case iskind:
+				store.setmode(false)
+				store.setkind(k)
+				process.SleepAbout1sTo2s()
+				ctx.SendChain(message.Text("切换到", describe(k), "~"))
+			case store.setmode(arg == "五星" || (arg == "" && !store.is5starsmode())):
 				process.SleepAbout1sTo2s()
 				ctx.SendChain(message.Text("切换到五星卡池~"))
-			} else {
+			default:
 				process.SleepAbout1sTo2s()
-				ctx.SendChain(message.Text("切换到普通卡池~"))
+				ctx.SendChain(message.Text("切换到", describe(store.kind()), "~"))
 			}
 			err := c.SetData(gid, int64(store))
 			if err != nil {
@@ -68,22 +114,28 @@ func init() {
 			}
 		})
 
-	engine.OnFullMatch("原神十连", fcext.DoOnceOnSuccess(
-		func(ctx *zero.Ctx) bool {
-			zipfile := engine.DataFolder() + "Genshin.zip"
-			_, err := engine.GetLazyData("Genshin.zip", false)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return false
+	engine.OnFullMatch("查看原神卡池", getzip).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			if !ok {
+				ctx.SendChain(message.Text("找不到服务!"))
+				return
 			}
-			err = parsezip(zipfile)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return false
+			gid := ctx.Event.GroupID
+			if gid == 0 {
+				gid = -ctx.Event.UserID
 			}
-			return true
-		},
-	)).SetBlock(true).Limit(ctxext.LimitByUser).
+			store := (storage)(c.GetData(gid))
+			if store.is5starsmode() {
+				ctx.SendChain(message.Text("当前为五星卡池"))
+				return
+			}
+			k := store.kind()
+			p := gdb.pity(ctx.Event.UserID, k)
+			ctx.SendChain(message.Text("当前为", describe(k), "\n", pitystatus(k, p)))
+		})
+
+	engine.OnFullMatch("原神十连", getzip).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			c, ok := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
 			if !ok {
@@ -95,7 +147,27 @@ func init() {
 				gid = -ctx.Event.UserID
 			}
 			store := (storage)(c.GetData(gid))
-			img, str, mode, err := randnums(10, store)
+			var (
+				items  []gacha.Item
+				status string
+			)
+			if store.is5starsmode() {
+				items = fivestars(10)
+			} else {
+				k := store.kind()
+				p := gdb.pity(ctx.Event.UserID, k)
+				s := p.state()
+				rngmu.Lock()
+				items = banners[k].PullN(rng, &s, 10)
+				rngmu.Unlock()
+				err := gdb.save(p, &s, items)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				status = "\n" + k.String() + "卡池: " + pitystatus(k, p)
+			}
+			img, str, mode, err := drawitems(items)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -107,90 +179,99 @@ func init() {
 			}
 			if mode {
 				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID,
-					message.Text("恭喜你抽到了: \n", str), message.ImageBytes(b)))
+					message.Text("恭喜你抽到了: \n", str, status), message.ImageBytes(b)))
 			} else {
 				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID,
-					message.Text("十连成功~"), message.ImageBytes(b)))
+					message.Text("十连成功~", status), message.ImageBytes(b)))
+			}
+		})
+
+	engine.OnFullMatch("我的原神仓库").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ol, err := gdb.owned(ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ol) == 0 {
+				ctx.SendChain(message.Text("仓库空空如也, 快去原神十连吧~"))
+				return
+			}
+			sendtext(ctx, ctx.CardOrNickName(ctx.Event.UserID)+"的原神仓库\n"+warehouse(ol))
+		})
+
+	engine.OnFullMatch("原神抽卡记录").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			var sb strings.Builder
+			sb.WriteString(ctx.CardOrNickName(ctx.Event.UserID) + "的原神抽卡记录")
+			has := false
+			for _, k := range []gacha.Kind{gacha.Character, gacha.Weapon, gacha.Standard} {
+				p := gdb.pity(ctx.Event.UserID, k)
+				if p.Total == 0 {
+					continue
+				}
+				rs, err := gdb.history(ctx.Event.UserID, k)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				sb.WriteString("\n\n" + statistics(k, p, rs))
+				has = true
 			}
+			if !has {
+				ctx.SendChain(message.Text("还没有抽卡记录, 快去原神十连吧~"))
+				return
+			}
+			sendtext(ctx, sb.String())
 		})
 }
 
-func randnums(nums int, store storage) (rgba *image.RGBA, str string, replyMode bool, err error) {
+// fivestars 五星卡池, 全部为随机的五星角色或武器
+func fivestars(n int) []gacha.Item {
+	items := make([]gacha.Item, n)
+	rngmu.Lock()
+	defer rngmu.Unlock()
+	for i := range items {
+		if rng.Intn(2) == 0 || len(pool.FiveWeapon) == 0 {
+			items[i] = gacha.Item{Name: pool.Five[rng.Intn(len(pool.Five))], Rarity: 5}
+		} else {
+			items[i] = gacha.Item{Name: pool.FiveWeapon[rng.Intn(len(pool.FiveWeapon))], Rarity: 5, Weapon: true}
+		}
+	}
+	return items
+}
+
+func drawitems(items []gacha.Item) (rgba *image.RGBA, str string, replyMode bool, err error) {
 	var (
 		fours, fives                  = make([]*zip.File, 0, 10), make([]*zip.File, 0, 10)                           // 抽到 四, 五星角色
 		threeArms, fourArms, fiveArms = make([]*zip.File, 0, 10), make([]*zip.File, 0, 10), make([]*zip.File, 0, 10) // 抽到 三 , 四, 五星武器
-		fourN, fiveN                  = 0, 0                                                                         // 抽到 四, 五星角色的数量
 		bgs                           = make([]*zip.File, 0, 10)                                                     // 背景图片名
-		threeN2, fourN2, fiveN2       = 0, 0, 0                                                                      // 抽到 三 , 四, 五星武器的数量
 		hero, stars                   = make([]*zip.File, 0, 10), make([]*zip.File, 0, 10)                           // 角色武器名, 储存星级图标
 
 		cicon                   = make([]*zip.File, 0, 10)                                                            // 元素图标
 		fivebg, fourbg, threebg = filetree["five_bg.jpg"][0], filetree["four_bg.jpg"][0], filetree["three_bg.jpg"][0] // 背景图片名
-		fivelen                 = len(filetree["five"])
-		five2len                = len(filetree["five2"])
-		threelen                = len(filetree["Three"])
-		fourlen                 = len(filetree["four"])
-		four2len                = len(filetree["four2"])
 	)
 
-	if totl%9 == 0 { // 累计9次加入一个五星
-		switch rand.Intn(2) {
-		case 0:
-			fiveN++
-			fives = append(fives, filetree["five"][rand.Intn(fivelen)])
-		case 1:
-			fiveN2++
-			fiveArms = append(fiveArms, filetree["five2"][rand.Intn(five2len)])
+	for _, it := range items {
+		f, ok := itemfiles[folderof(it.Rarity, it.Weapon)][it.Name]
+		if !ok {
+			return nil, "", false, errors.New("找不到" + it.Name + "的图片")
 		}
-		nums--
-	}
-
-	if store.is5starsmode() { // 5星模式
-		for i := 0; i < nums; i++ {
-			switch rand.Intn(2) {
-			case 0:
-				fiveN++
-				fives = append(fives, filetree["five"][rand.Intn(fivelen)])
-			case 1:
-				fiveN2++
-				fiveArms = append(fiveArms, filetree["five2"][rand.Intn(five2len)])
-			}
-		}
-	} else { // 默认模式
-		for i := 0; i < nums; i++ {
-			a := rand.Intn(1000) // 抽卡几率 三星80% 四星17% 五星3%
-			switch {
-			case a >= 0 && a <= 800:
-				threeN2++
-				threeArms = append(threeArms, filetree["Three"][rand.Intn(threelen)])
-			case a > 800 && a <= 885:
-				fourN++
-				fours = append(fours, filetree["four"][rand.Intn(fourlen)]) // 随机角色
-			case a > 885 && a <= 970:
-				fourN2++
-				fourArms = append(fourArms, filetree["four2"][rand.Intn(four2len)]) // 随机武器
-			case a > 970 && a <= 985:
-				fiveN++
-				fives = append(fives, filetree["five"][rand.Intn(fivelen)])
-			default:
-				fiveN2++
-				fiveArms = append(fiveArms, filetree["five2"][rand.Intn(five2len)])
-			}
-		}
-		if fourN+fourN2 == 0 && threeN2 > 0 { // 没有四星时自动加入
-			threeN2--
-			threeArms = threeArms[:len(threeArms)-1]
-			switch rand.Intn(2) {
-			case 0:
-				fourN++
-				fours = append(fours, filetree["four"][rand.Intn(fourlen)]) // 随机角色
-			case 1:
-				fourN2++
-				fourArms = append(fourArms, filetree["four2"][rand.Intn(four2len)]) // 随机武器
-			}
+		switch {
+		case it.Rarity == 5 && it.Weapon:
+			fiveArms = append(fiveArms, f)
+		case it.Rarity == 5:
+			fives = append(fives, f)
+		case it.Rarity == 4 && it.Weapon:
+			fourArms = append(fourArms, f)
+		case it.Rarity == 4:
+			fours = append(fours, f)
+		default:
+			threeArms = append(threeArms, f)
 		}
-		_ = atomic.AddUint64(&totl, 1)
 	}
+	fourN, fiveN := len(fours), len(fives)                                  // 抽到 四, 五星角色的数量
+	threeN2, fourN2, fiveN2 := len(threeArms), len(fourArms), len(fiveArms) // 抽到 三 , 四, 五星武器的数量
 
 	icon := func(f *zip.File) *zip.File {
 		name := f.Name
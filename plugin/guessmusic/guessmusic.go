@@ -6,9 +6,10 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -33,9 +34,18 @@ func init() {
 		log.Infof("[guessmusic]:%s", err1)
 	}
 
-	engine.OnRegex(`^(个人|团队)猜歌(-(.*))?$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+	engine.OnRegex(`^(个人|团队)猜歌(\d*)首?(-(.*))?$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
-			mode := ctx.State["regex_matched"].([]string)[3]
+			mode := ctx.State["regex_matched"].([]string)[4]
+			personal := ctx.State["regex_matched"].([]string)[1] == "个人"
+			rounds, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[2])
+			if rounds <= 0 {
+				rounds = 1
+			}
+			if rounds > maxRounds {
+				ctx.SendChain(message.Text("一局最多", maxRounds, "首歌哦"))
+				return
+			}
 			gid := ctx.Event.GroupID
 			// 获取本地列表
 			filelist, err := getlist(cfg.MusicPath)
@@ -72,120 +82,252 @@ func init() {
 					}
 				}
 			}
-			ctx.SendChain(message.Text("正在准备歌曲,请稍等\n回答“-[歌曲信息(歌名歌手等)|提示|取消]”\n一共3段语音,6次机会"))
-			// 随机抽歌
-			pathOfMusic, musicName, err := musicLottery(cfg.MusicPath, mode)
-			if err != nil {
-				ctx.SendChain(message.Text(serviceErr, err))
-				return
-			}
-			// 解析歌曲信息
-			music := strings.Split(musicName, ".")
-			// 获取音乐后缀
-			musictype := music[len(music)-1]
-			if !strings.Contains(musictypelist, musictype) {
-				ctx.SendChain(message.Text("抽取到了歌曲：\n",
-					musicName, "\n该歌曲不是音乐后缀,请联系bot主人修改"))
-				return
-			}
-			// 获取音乐信息
-			musicInfo := strings.Split(strings.ReplaceAll(musicName, "."+musictype, ""), " - ")
-			infoNum := len(musicInfo)
-			if infoNum == 1 {
-				ctx.SendChain(message.Text("抽取到了歌曲：\n",
-					musicName, "\n该歌曲命名不符合命名规则,请联系bot主人修改"))
-				return
-			}
-			answerString := "歌名:" + musicInfo[0] + "\n歌手:" + musicInfo[1]
-			if infoNum > 2 {
-				musicInfo[2] = strings.ReplaceAll(musicInfo[2], "&", "\n")
-				answerString += "\n其他信息:\n" + musicInfo[2]
-			}
-			musicInfo = append(musicInfo, answerString)
-			// 切割音频,生成3个10秒的音频
-			outputPath := cachePath + strconv.FormatInt(gid, 10) + "/"
-			err = cutMusic(musicName, pathOfMusic, outputPath)
-			if err != nil {
-				ctx.SendChain(message.Text(err))
-				return
-			}
-			// 猜歌环节-提供猜歌选项
-			files, err := os.ReadDir(pathOfMusic)
-			if err != nil {
-				return
-			}
-			getMusicSelect(ctx, files, musicName)
-			// 进行猜歌环节
-			ctx.SendChain(message.Record("file:///" + file.BOTPATH + "/" + outputPath + "0.wav"))
+			ctx.SendChain(message.Text("正在准备歌曲,请稍等\n回答“-[歌曲信息(歌名歌手等)|提示|歌手提示|歌词提示|取消]”\n每首歌一共3段语音,6次机会\n",
+				"本局共", rounds, "首歌, 用越少的片段猜对得分越高, 每使用一次文字提示扣1分"))
 			var next *zero.FutureEvent
-			if ctx.State["regex_matched"].([]string)[1] == "个人" {
+			if personal {
 				next = zero.NewFutureEvent("message", 999, false, zero.OnlyGroup, zero.RegexRule(`^-\S{1,}`), ctx.CheckSession())
 			} else {
 				next = zero.NewFutureEvent("message", 999, false, zero.OnlyGroup, zero.RegexRule(`^-\S{1,}`), zero.CheckGroup(ctx.Event.GroupID))
 			}
 			recv, cancel := next.Repeat()
 			defer cancel()
-			wait := time.NewTimer(40 * time.Second)
-			tick := time.NewTimer(105 * time.Second)
-			after := time.NewTimer(120 * time.Second)
-			wg := sync.WaitGroup{}
-			var (
-				messageStr  message.MessageSegment // 文本信息
-				tickCount   = 0                    // 音频数量
-				answerCount = 0                    // 问答次数
-				win         bool                   // 是否赢得游戏
-			)
-			for {
-				select {
-				case <-tick.C:
-					ctx.SendChain(message.Text("猜歌游戏,你还有15s作答时间"))
-				case <-after.C:
-					ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID,
-						message.Text("时间超时,猜歌结束,公布答案：\n", answerString)))
+			scores := make(map[int64]int, 4)
+			for i := 1; i <= rounds; i++ {
+				if rounds > 1 {
+					ctx.SendChain(message.Text("第", i, "/", rounds, "首"))
+				}
+				res, err := playRound(ctx, recv, mode)
+				if err != nil {
+					ctx.SendChain(message.Text(serviceErr, err))
 					return
-				case <-wait.C:
-					wait.Reset(40 * time.Second)
-					tickCount++
-					if tickCount > 2 {
-						wait.Stop()
-						continue
+				}
+				if res.winner != 0 {
+					scores[res.winner] += res.points
+					err = sdb.addScore(gid, res.winner, res.points, mode, res.song)
+					if err != nil {
+						ctx.SendChain(message.Text(serviceErr, err))
 					}
-					ctx.SendChain(
-						message.Text("好像有些难度呢,再听这段音频,要仔细听哦"),
-					)
-					ctx.SendChain(message.Record("file:///" + file.BOTPATH + "/" + outputPath + strconv.Itoa(tickCount) + ".wav"))
-				case c := <-recv:
-					wg.Add(1)
-					go func() {
-						messageStr, answerCount, tickCount, win = gameMatch(c, ctx.Event.UserID, musicInfo, answerCount, tickCount)
-						if win { // 游戏结束的话
-							wait.Stop()
-							tick.Stop()
-							after.Stop()
-							ctx.SendChain(message.Reply(c.Event.MessageID), messageStr)
-							ctx.SendChain(message.Record("file:///" + pathOfMusic + musicName))
-						} else {
-							wait.Reset(40 * time.Second)
-							tick.Reset(105 * time.Second)
-							after.Reset(120 * time.Second)
-							if tickCount > 2 || messageStr.Data["text"] == "你无权限取消" {
-								ctx.SendChain(message.Reply(c.Event.MessageID), messageStr)
-							} else {
-								ctx.SendChain(message.Reply(c.Event.MessageID), messageStr)
-								ctx.SendChain(message.Record("file:///" + file.BOTPATH + "/" + outputPath + strconv.Itoa(tickCount) + ".wav"))
-							}
-						}
-						wg.Done()
-					}()
-					wg.Wait()
-					if win {
-						return
+				}
+				if !res.cancelled {
+					err = sdb.addPlay(mode, res.song, res.winner == 0)
+					if err != nil {
+						ctx.SendChain(message.Text(serviceErr, err))
 					}
 				}
+				if res.cancelled {
+					break
+				}
+			}
+			if rounds > 1 {
+				ctx.SendChain(message.Text(roundSummary(ctx, scores)))
 			}
 		})
 }
 
+const maxRounds = 10
+
+// 一首歌的猜歌结果
+type roundResult struct {
+	song      string // 歌曲文件名
+	winner    int64  // 猜对的人, 0 表示没人猜对
+	points    int    // 得分
+	cancelled bool   // 游戏被取消
+}
+
+// 猜对时的得分: 听1/2/3段分别得3/2/1分, 每次文字提示扣1分, 最低1分
+func roundPoints(clips, hints int) int {
+	p := 4 - clips - hints
+	if p < 1 {
+		p = 1
+	}
+	return p
+}
+
+// 进行一首歌的猜歌
+func playRound(ctx *zero.Ctx, recv <-chan *zero.Ctx, listName string) (res roundResult, err error) {
+	gid := ctx.Event.GroupID
+	// 随机抽歌
+	pathOfMusic, musicName, err := musicLottery(cfg.MusicPath, listName)
+	if err != nil {
+		return
+	}
+	res.song = musicName
+	// 解析歌曲信息
+	music := strings.Split(musicName, ".")
+	// 获取音乐后缀
+	musictype := music[len(music)-1]
+	if !strings.Contains(musictypelist, musictype) {
+		err = errors.Errorf("抽取到了歌曲：\n%s\n该歌曲不是音乐后缀,请联系bot主人修改", musicName)
+		return
+	}
+	// 获取音乐信息
+	musicInfo := strings.Split(strings.ReplaceAll(musicName, "."+musictype, ""), " - ")
+	infoNum := len(musicInfo)
+	if infoNum == 1 {
+		err = errors.Errorf("抽取到了歌曲：\n%s\n该歌曲命名不符合命名规则,请联系bot主人修改", musicName)
+		return
+	}
+	answerString := "歌名:" + musicInfo[0] + "\n歌手:" + musicInfo[1]
+	if infoNum > 2 {
+		musicInfo[2] = strings.ReplaceAll(musicInfo[2], "&", "\n")
+		answerString += "\n其他信息:\n" + musicInfo[2]
+	}
+	musicInfo = append(musicInfo, answerString)
+	// 切割音频,生成3个10秒的音频
+	outputPath := cachePath + strconv.FormatInt(gid, 10) + "/"
+	err = cutMusic(musicName, pathOfMusic, outputPath)
+	if err != nil {
+		return
+	}
+	// 猜歌环节-提供猜歌选项
+	files, err := os.ReadDir(pathOfMusic)
+	if err != nil {
+		return
+	}
+	getMusicSelect(ctx, files, musicName)
+	// 进行猜歌环节
+	ctx.SendChain(message.Record("file:///" + file.BOTPATH + "/" + outputPath + "0.wav"))
+	wait := time.NewTimer(40 * time.Second)
+	tick := time.NewTimer(105 * time.Second)
+	after := time.NewTimer(120 * time.Second)
+	defer func() {
+		wait.Stop()
+		tick.Stop()
+		after.Stop()
+	}()
+	var (
+		messageStr  message.MessageSegment // 文本信息
+		tickCount   = 0                    // 音频数量
+		answerCount = 0                    // 问答次数
+		hintCount   = 0                    // 文字提示次数
+		over        bool                   // 本首是否结束
+		correct     bool                   // 是否猜对
+		clips       int                    // 猜对时已听过的片段数
+	)
+	for {
+		select {
+		case <-tick.C:
+			ctx.SendChain(message.Text("猜歌游戏,你还有15s作答时间"))
+		case <-after.C:
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID,
+				message.Text("时间超时,猜歌结束,公布答案：\n", answerString)))
+			return
+		case <-wait.C:
+			wait.Reset(40 * time.Second)
+			tickCount++
+			if tickCount > 2 {
+				wait.Stop()
+				continue
+			}
+			ctx.SendChain(
+				message.Text("好像有些难度呢,再听这段音频,要仔细听哦"),
+			)
+			ctx.SendChain(message.Record("file:///" + file.BOTPATH + "/" + outputPath + strconv.Itoa(tickCount) + ".wav"))
+		case c := <-recv:
+			answer := strings.Replace(c.Event.Message.String(), "-", "", 1)
+			if answer == "歌手提示" || answer == "歌词提示" {
+				hintCount++
+				if answer == "歌手提示" {
+					ctx.SendChain(message.Reply(c.Event.MessageID), message.Text("歌手名的第一个字是: ", artistInitial(musicInfo[1])))
+				} else {
+					ctx.SendChain(message.Reply(c.Event.MessageID), message.Text(lyricHint(pathOfMusic, musicName)))
+				}
+				continue
+			}
+			// 回答前已经听过的片段数
+			clips = tickCount + 1
+			if clips > 3 {
+				clips = 3
+			}
+			messageStr, answerCount, tickCount, over, correct = gameMatch(c, ctx.Event.UserID, musicInfo, answerCount, tickCount)
+			if over {
+				if correct {
+					res.winner = c.Event.UserID
+					res.points = roundPoints(clips, hintCount)
+					messageStr = message.Text(messageStr.Data["text"], "\n", ctx.CardOrNickName(res.winner), " 获得", res.points, "分")
+				} else {
+					res.cancelled = answer == "取消"
+				}
+				ctx.SendChain(message.Reply(c.Event.MessageID), messageStr)
+				ctx.SendChain(message.Record("file:///" + pathOfMusic + musicName))
+				return
+			}
+			wait.Reset(40 * time.Second)
+			tick.Reset(105 * time.Second)
+			after.Reset(120 * time.Second)
+			ctx.SendChain(message.Reply(c.Event.MessageID), messageStr)
+			if tickCount <= 2 && messageStr.Data["text"] != "你无权限取消" {
+				ctx.SendChain(message.Record("file:///" + file.BOTPATH + "/" + outputPath + strconv.Itoa(tickCount) + ".wav"))
+			}
+		}
+	}
+}
+
+// 多首猜歌结束后的本局得分
+func roundSummary(ctx *zero.Ctx, scores map[int64]int) string {
+	if len(scores) == 0 {
+		return "本局结束, 没有人猜对呢"
+	}
+	uids := make([]int64, 0, len(scores))
+	for uid := range scores {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return scores[uids[i]] > scores[uids[j]] })
+	var sb strings.Builder
+	sb.WriteString("本局结束, 得分如下:")
+	for i, uid := range uids {
+		sb.WriteString("\n" + strconv.Itoa(i+1) + ". " + ctx.CardOrNickName(uid) + ": " + strconv.Itoa(scores[uid]) + "分")
+	}
+	return sb.String()
+}
+
+// 歌手名的第一个字
+func artistInitial(artist string) string {
+	artist = strings.TrimSpace(artist)
+	for _, r := range artist {
+		return strings.ToUpper(string(r))
+	}
+	return "?"
+}
+
+// 从歌词文件中随机取一句歌词
+func lyricHint(pathOfMusic, musicName string) string {
+	name := strings.TrimSuffix(musicName, path.Ext(musicName))
+	var data []byte
+	var err error
+	for _, lrc := range []string{pathOfMusic + "歌词/" + name + ".lrc", pathOfMusic + "歌词/" + musicName + ".lrc"} {
+		data, err = os.ReadFile(lrc)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "这首歌没有歌词文件, 没法提示了哦"
+	}
+	lines := make([]string, 0, 64)
+	for _, line := range strings.Split(string(data), "\n") {
+		// 去掉 [00:00.00] 形式的时间标签
+		for strings.HasPrefix(line, "[") {
+			i := strings.IndexByte(line, ']')
+			if i < 0 {
+				break
+			}
+			line = line[i+1:]
+		}
+		line = strings.TrimSpace(line)
+		// 跳过作词作曲等信息
+		if line == "" || strings.ContainsAny(line, ":：") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "这首歌没有歌词, 没法提示了哦"
+	}
+	return "其中一句歌词是: " + lines[rand.Intn(len(lines))]
+}
+
 // 随机抽取音乐
 func musicLottery(musicPath, listName string) (pathOfMusic, musicName string, err error) {
 	// 读取歌单文件
@@ -280,8 +422,8 @@ func cutMusic(musicName, pathOfMusic, outputPath string) (err error) {
 	return
 }
 
-// 数据匹配（结果信息，答题次数，提示次数，是否结束游戏）
-func gameMatch(c *zero.Ctx, beginner int64, musicInfo []string, answerTimes, tickTimes int) (message.MessageSegment, int, int, bool) {
+// 数据匹配（结果信息，答题次数，提示次数，是否结束本首，是否猜对）
+func gameMatch(c *zero.Ctx, beginner int64, musicInfo []string, answerTimes, tickTimes int) (message.MessageSegment, int, int, bool, bool) {
 	answer := strings.Replace(c.Event.Message.String(), "-", "", 1)
 	// 回答内容转小写，比对时再把标准答案转小写
 	answer = ConvertText(answer)
@@ -289,31 +431,31 @@ func gameMatch(c *zero.Ctx, beginner int64, musicInfo []string, answerTimes, tic
 	switch {
 	case answer == "取消":
 		if c.Event.UserID == beginner {
-			return message.Text("游戏已取消,猜歌答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true
+			return message.Text("游戏已取消,猜歌答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true, false
 		}
-		return message.Text("你无权限取消"), answerTimes, tickTimes, false
+		return message.Text("你无权限取消"), answerTimes, tickTimes, false, false
 	case answer == "提示":
 		tickTimes++
 		if tickTimes > 2 {
-			return message.Text("已经没有提示了哦"), answerTimes, tickTimes, false
+			return message.Text("已经没有提示了哦"), answerTimes, tickTimes, false, false
 		}
-		return message.Text("再听这段音频,要仔细听哦"), answerTimes, tickTimes, false
+		return message.Text("再听这段音频,要仔细听哦"), answerTimes, tickTimes, false, false
 	case strings.Contains(ConvertText(musicInfo[0]), answer) || strings.EqualFold(ConvertText(musicInfo[0]), answer):
-		return message.Text("太棒了,你猜对歌曲名了！答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true
+		return message.Text("太棒了,你猜对歌曲名了！答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true, true
 	case strings.Contains(ConvertText(musicInfo[1]), answer) || strings.EqualFold(ConvertText(musicInfo[1]), answer):
-		return message.Text("太棒了,你猜对歌手名了！答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true
+		return message.Text("太棒了,你猜对歌手名了！答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true, true
 	case len(musicInfo) == 4 && (strings.Contains(ConvertText(musicInfo[2]), answer) || strings.EqualFold(ConvertText(musicInfo[2]), answer)):
-		return message.Text("太棒了,你猜对相关信息了！答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true
+		return message.Text("太棒了,你猜对相关信息了！答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true, true
 	default:
 		answerTimes++
 		tickTimes++
 		switch {
 		case tickTimes > 2 && answerTimes < 6:
-			return message.Text("答案不对哦,还有", 6-answerTimes, "次答题,加油啊~"), answerTimes, tickTimes, false
+			return message.Text("答案不对哦,还有", 6-answerTimes, "次答题,加油啊~"), answerTimes, tickTimes, false, false
 		case tickTimes > 2:
-			return message.Text("次数到了,没能猜出来。答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true
+			return message.Text("次数到了,没能猜出来。答案是\n", musicInfo[len(musicInfo)-1], "\n\n下面欣赏猜歌的歌曲"), answerTimes, tickTimes, true, false
 		default:
-			return message.Text("答案不对,再听这段音频,要仔细听哦"), answerTimes, tickTimes, false
+			return message.Text("答案不对,再听这段音频,要仔细听哦"), answerTimes, tickTimes, false, false
 		}
 	}
 }
@@ -4,6 +4,7 @@ package guessmusic
 import (
 	"encoding/json"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -44,13 +45,16 @@ var (
 			"------公 用 指 令------\n" +
 			"- 歌单列表\n" +
 			"- [个人/团队]猜歌\n" +
+			"- [个人/团队]猜歌5首 (一局猜多首, 最多10首)\n" +
+			"- 猜歌排行榜\n" +
+			"- 歌单难度 [歌单名称]\n" +
 			"\n------重 要 事 项------\n" +
 			"1.本插件依赖ffmpeg\n" +
 			"2.\"删除[歌单名称]\"是将本地歌单数据全部删除, 慎用\n" +
 			"3.不支持下载VIP歌曲,如有需求请用群文件上传\n" +
 			"4.未设置默认歌单的场合,猜歌歌单为歌单列表第一个。\n" +
 			"此外可在\"[个人/团队]猜歌\"指令后面添加[-歌单名称]进行指定歌单猜歌\n" +
-			"5.猜歌内容必须以[-]开头才会识别\n" +
+			"5.猜歌内容必须以[-]开头才会识别, 可回答-歌手提示/-歌词提示获取文字提示\n" +
 			"6.歌曲命名规则为:\n歌名 - 歌手 - 其他(歌曲出处之类)" +
 			"\n------插 件 扩 展------\n" +
 			"内置了独角兽API,但API不保证可靠性。\n" +
@@ -90,6 +94,11 @@ func init() {
 	if err != nil {
 		panic(serviceErr + err.Error())
 	}
+	// 载入积分数据库
+	err = sdb.init(engine.DataFolder() + "score.db")
+	if err != nil {
+		panic(serviceErr + err.Error())
+	}
 	// 载入用户配置
 	if file.IsExist(cfgFile) {
 		reader, err := os.Open(cfgFile)
@@ -474,6 +483,45 @@ func init() {
 				ctx.SendChain(message.Text(serviceErr, err))
 			}
 		})
+	engine.OnFullMatch("猜歌排行榜", zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			items, err := sdb.rank(ctx.Event.GroupID, 10)
+			if err != nil || len(items) == 0 {
+				ctx.SendChain(message.Text("本群还没有人猜对过歌曲哦"))
+				return
+			}
+			msg := make([]string, 0, len(items)+1)
+			msg = append(msg, "猜歌排行榜:")
+			for i, item := range items {
+				msg = append(msg, strconv.Itoa(i+1)+". "+ctx.CardOrNickName(item.UserID)+
+					": "+strconv.Itoa(item.Points)+"分 (猜对"+strconv.Itoa(item.Hits)+"首)")
+			}
+			ctx.SendChain(message.Text(strings.Join(msg, "\n")))
+		})
+	engine.OnPrefix("歌单难度").SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			listName := strings.TrimSpace(ctx.State["args"].(string))
+			if listName == "" || file.IsNotExist(cfg.MusicPath+listName) {
+				ctx.SendChain(message.Text("歌单名称错误，可以发送“歌单列表”获取歌单名称"))
+				return
+			}
+			played, missed := sdb.total(listName)
+			if played == 0 {
+				ctx.SendChain(message.Text("歌单", listName, "还没有被猜过哦"))
+				return
+			}
+			msg := []string{"歌单" + listName + "共被猜" + strconv.Itoa(played) + "次, 猜错率" +
+				strconv.FormatFloat(float64(missed)*100/float64(played), 'f', 1, 64) + "%"}
+			stats, err := sdb.hardest(listName, 10)
+			if err == nil && len(stats) > 0 {
+				msg = append(msg, "最常猜错的歌曲:")
+				for i, s := range stats {
+					msg = append(msg, strconv.Itoa(i+1)+". "+strings.TrimSuffix(s.Song, path.Ext(s.Song))+
+						" ("+strconv.Itoa(s.Missed)+"/"+strconv.Itoa(s.Played)+")")
+				}
+			}
+			ctx.SendChain(message.Text(strings.Join(msg, "\n")))
+		})
 }
 
 // 保存用户配置
@@ -0,0 +1,125 @@
+package guessmusic
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	scoreTable = "score"
+	statTable  = "songstat"
+)
+
+// 猜歌数据库
+type scoredb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// 一次猜对的得分记录
+type scoreRecord struct {
+	ID      int64  `db:"id"` // 时间 UnixNano
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Points  int    `db:"points"`
+	List    string `db:"list"`
+	Song    string `db:"song"`
+}
+
+// 歌曲被猜的统计
+type songStat struct {
+	ID     string `db:"id"` // 歌单名/歌曲名
+	List   string `db:"list"`
+	Song   string `db:"song"`
+	Played int    `db:"played"`
+	Missed int    `db:"missed"`
+}
+
+// 群排行榜的一项
+type rankItem struct {
+	UserID int64 `db:"uid"`
+	Points int   `db:"points"`
+	Hits   int   `db:"hits"`
+}
+
+var sdb = &scoredb{}
+
+func (db *scoredb) init(path string) error {
+	db.DBPath = path
+	err := db.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = db.Create(scoreTable, &scoreRecord{})
+	if err != nil {
+		return err
+	}
+	return db.Create(statTable, &songStat{})
+}
+
+// quote 转义 sql 字符串
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// addScore 记录一次猜对
+func (db *scoredb) addScore(gid, uid int64, points int, list, song string) error {
+	db.Lock()
+	defer db.Unlock()
+	return db.Insert(scoreTable, &scoreRecord{
+		ID:      time.Now().UnixNano(),
+		GroupID: gid,
+		UserID:  uid,
+		Points:  points,
+		List:    list,
+		Song:    song,
+	})
+}
+
+// addPlay 记录一首歌被猜的结果
+func (db *scoredb) addPlay(list, song string, missed bool) error {
+	db.Lock()
+	defer db.Unlock()
+	s := songStat{ID: list + "/" + song, List: list, Song: song}
+	_ = db.Find(statTable, &s, "WHERE id = "+quote(s.ID))
+	s.Played++
+	if missed {
+		s.Missed++
+	}
+	return db.Insert(statTable, &s)
+}
+
+// rank 群积分排行榜
+func (db *scoredb) rank(gid int64, n int) ([]*rankItem, error) {
+	db.RLock()
+	defer db.RUnlock()
+	return sql.QueryAll[rankItem](&db.Sqlite,
+		"SELECT uid, SUM(points) AS points, COUNT(*) AS hits FROM "+scoreTable+
+			" WHERE gid = "+strconv.FormatInt(gid, 10)+
+			" GROUP BY uid ORDER BY points DESC LIMIT "+strconv.Itoa(n)+";")
+}
+
+// hardest 歌单中最常猜错的歌曲
+func (db *scoredb) hardest(list string, n int) ([]*songStat, error) {
+	db.RLock()
+	defer db.RUnlock()
+	return sql.FindAll[songStat](&db.Sqlite, statTable,
+		"WHERE list = "+quote(list)+" AND missed > 0 ORDER BY CAST(missed AS REAL) / played DESC, played DESC LIMIT "+strconv.Itoa(n))
+}
+
+// total 歌单的总体统计
+func (db *scoredb) total(list string) (played, missed int) {
+	db.RLock()
+	defer db.RUnlock()
+	var s songStat
+	_ = db.FindFor(statTable, &s, "WHERE list = "+quote(list), func() error {
+		played += s.Played
+		missed += s.Missed
+		return nil
+	})
+	return
+}
@@ -4,7 +4,6 @@ package midicreate
 import (
 	"bytes"
 	"fmt"
-	"math"
 	"math/rand"
 	"os"
 	"os/exec"
@@ -21,10 +20,13 @@ import (
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
-	"gitlab.com/gomidi/midi/v2"
 	"gitlab.com/gomidi/midi/v2/smf"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/midicreate/notation"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/midicreate/synth"
 )
 
 func init() {
@@ -32,13 +34,16 @@ func init() {
 		DisableOnDefault: false,
 		Brief:            "midi音乐制作",
 		Help: "- midi制作 CCGGAAGR FFEEDDCR GGFFEEDR GGFFEEDR CCGGAAGR FFEEDDCR\n" +
+			"- midi制作 {T120}{M3/4} C<1. [CEG]<1 E<-1~E<-1 R {V2}{I33} C3<2.\n" +
 			"- 个人听音练习\n" +
 			"- 团队听音练习\n" +
-			"- *.mid (midi 转 txt)\n" +
+			"- *.mid (midi 转 txt, 可直接重新上传转回midi)\n" +
 			"- midi制作*.txt (txt 转 midi)\n" +
 			"- 设置音色40 (0~127)\n" +
-			"重要事项: 该插件依赖timidity\n" +
-			"linux安装脚本可参考https://gitcode.net/anto_july/midi/-/raw/master/timidity.sh\nwindows安装脚本可参考https://gitcode.net/anto_july/midi/-/raw/master/timidity.bat?inline=false, windows需要管理员模式运行",
+			"符号说明: C5是中央C, 不写数字默认为5, b降调 #升调, <n音长×2^n(-4~3), .附点, ~连音线, R休止符, [CEG]和弦\n" +
+			"指令: {T120}速度 {M3/4}拍号 {I40}当前轨音色 {V2}切换到第2轨\n" +
+			"注: 音频由内置合成器生成 wav, 系统中安装了 ffmpeg 时转为 ogg 发送, 否则直接发送 wav\n" +
+			"将sf2音色库放入插件数据目录并命名为soundfont.sf2可获得更好的音质",
 		PrivateDataFolder: "midicreate",
 	})
 	cachePath := engine.DataFolder() + "cache/"
@@ -47,6 +52,14 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	var font *synth.SoundFont
+	if sf2 := engine.DataFolder() + "soundfont.sf2"; file.IsExist(sf2) {
+		font, err = synth.LoadSoundFont(sf2)
+		if err != nil {
+			logrus.Warnln("[midicreate] 加载音色库失败, 将使用内置音色:", err)
+		}
+	}
+	synthesizer = synth.New(synth.DefaultSampleRate, font)
 	engine.OnPrefix("midi制作").SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			uid := ctx.Event.UserID
@@ -225,8 +238,9 @@ func init() {
 				}
 			}
 		})
+	// 忽略 bot 自己上传的文件, 防止转换结果再次触发
 	engine.On("notice/group_upload", func(ctx *zero.Ctx) bool {
-		return path.Ext(ctx.Event.File.Name) == ".mid"
+		return ctx.Event.UserID != ctx.Event.SelfID && path.Ext(ctx.Event.File.Name) == ".mid"
 	}).SetBlock(false).Limit(ctxext.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			fileURL := ctx.GetThisGroupFileUrl(ctx.Event.File.BusID, ctx.Event.File.ID)
@@ -240,19 +254,17 @@ func init() {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			for i := 0; i < int(s.NumTracks()); i++ {
-				midStr := mid2txt(data, i)
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return
-				}
-				fileName := strings.ReplaceAll(cachePath+"/"+ctx.Event.File.Name, ".mid", fmt.Sprintf("-%d.txt", i))
-				_ = os.WriteFile(fileName, binary.StringToBytes(midStr), 0666)
-				ctx.UploadThisGroupFile(file.BOTPATH+"/"+fileName, filepath.Base(fileName), "")
+			midStr, err := mid2txt(s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
 			}
+			fileName := cachePath + "midi制作-" + strings.TrimSuffix(ctx.Event.File.Name, ".mid") + ".txt"
+			_ = os.WriteFile(fileName, binary.StringToBytes(midStr), 0666)
+			ctx.UploadThisGroupFile(file.BOTPATH+"/"+fileName, filepath.Base(fileName), "")
 		})
 	engine.On("notice/group_upload", func(ctx *zero.Ctx) bool {
-		return path.Ext(ctx.Event.File.Name) == ".txt" && strings.Contains(ctx.Event.File.Name, "midi制作")
+		return ctx.Event.UserID != ctx.Event.SelfID && path.Ext(ctx.Event.File.Name) == ".txt" && strings.Contains(ctx.Event.File.Name, "midi制作")
 	}).SetBlock(false).Limit(ctxext.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			fileURL := ctx.GetThisGroupFileUrl(ctx.Event.File.BusID, ctx.Event.File.ID)
@@ -287,7 +299,8 @@ func init() {
 }
 
 var (
-	noteMap = map[string]uint8{
+	synthesizer *synth.Synth
+	noteMap     = map[string]uint8{
 		"C":  60,
 		"Db": 61,
 		"D":  62,
@@ -309,108 +322,70 @@ func str2music(ctx *zero.Ctx, input, midiFile string) (cmidiFile string, err err
 		return
 	}
 	cmidiFile = strings.ReplaceAll(midiFile, ".mid", ".wav")
-	cmd := exec.Command("timidity", file.BOTPATH+"/"+midiFile, "-Ow", "-o", file.BOTPATH+"/"+cmidiFile)
-	err = cmd.Run()
+	err = renderWav(midiFile, cmidiFile)
+	if err != nil || ffmpeg == "" {
+		return
+	}
+	oggFile, oerr := wav2ogg(cmidiFile)
+	if oerr != nil {
+		logrus.Warnln("[midicreate] 转换ogg失败, 将发送wav:", oerr)
+		return
+	}
+	cmidiFile = oggFile
 	return
 }
 
-func mkMidi(ctx *zero.Ctx, filePath, input string) error {
-	if file.IsExist(filePath) {
-		return nil
-	}
-	var (
-		clock smf.MetricTicks
-		tr    smf.Track
-	)
-
-	tr.Add(0, smf.MetaMeter(4, 4))
-	tr.Add(0, smf.MetaTempo(72))
-	tr.Add(0, smf.MetaInstrument("Violin"))
-	timbre := getTimbreMode(ctx)
-	tr.Add(0, midi.ProgramChange(0, uint8(timbre)))
-
-	k := strings.ReplaceAll(input, " ", "")
+// ffmpeg 可选, 存在时将合成的 wav 转为 ogg 以减小语音体积
+var ffmpeg, _ = exec.LookPath("ffmpeg")
 
-	var (
-		base        uint8
-		level       uint8
-		delay       uint32
-		sleepFlag   bool
-		lengthBytes = make([]byte, 0)
-	)
-
-	for i := 0; i < len(k); {
-		base = 0
-		level = 0
-		sleepFlag = false
-		lengthBytes = lengthBytes[:0]
-		for {
-			switch {
-			case k[i] == 'R':
-				sleepFlag = true
-				i++
-			case k[i] >= 'A' && k[i] <= 'G':
-				base = noteMap[k[i:i+1]] % 12
-				i++
-			case k[i] == 'b':
-				base--
-				i++
-			case k[i] == '#':
-				base++
-				i++
-			case k[i] >= '0' && k[i] <= '9':
-				level = level*10 + k[i] - '0'
-				i++
-			case k[i] == '<':
-				i++
-				for i < len(k) && (k[i] == '-' || (k[i] >= '0' && k[i] <= '9')) {
-					lengthBytes = append(lengthBytes, k[i])
-					i++
-				}
-			default:
-				return errors.Errorf("无法解析第%d个位置的%c字符", i, k[i])
-			}
-			if i >= len(k) || (k[i] >= 'A' && k[i] <= 'G') || k[i] == 'R' {
-				break
-			}
-		}
-		length, _ := strconv.Atoi(string(lengthBytes))
-		if sleepFlag {
-			if length >= 0 {
-				delay = clock.Ticks4th() * (1 << length)
-			} else {
-				delay = clock.Ticks4th() / (1 << -length)
-			}
-			continue
-		}
-		if level == 0 {
-			level = 5
-		}
-		tr.Add(delay, midi.NoteOn(0, o(base, level), 120))
-		if length >= 0 {
-			tr.Add(clock.Ticks4th()*(1<<length), midi.NoteOff(0, o(base, level)))
-		} else {
-			tr.Add(clock.Ticks4th()/(1<<-length), midi.NoteOff(0, o(base, level)))
-		}
-		delay = 0
+// wav2ogg 使用 ffmpeg 将 wav 转为 ogg vorbis, 成功后删除 wav
+func wav2ogg(wavFile string) (string, error) {
+	oggFile := strings.TrimSuffix(wavFile, ".wav") + ".ogg"
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-hide_banner", "-y", "-i", wavFile, "-c:a", "libvorbis", "-q:a", "4", oggFile)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		_ = os.Remove(oggFile)
+		return "", errors.Errorf("%v: %s", err, stderr.String())
 	}
-	tr.Close(0)
+	_ = os.Remove(wavFile)
+	return oggFile, nil
+}
 
-	s := smf.New()
-	s.TimeFormat = clock
-	err := s.Add(tr)
+// renderWav 使用内置合成器将 midi 文件渲染为 wav
+func renderWav(midiFile, wavFile string) error {
+	s, err := smf.ReadFile(midiFile)
 	if err != nil {
 		return err
 	}
-	f, err := os.Create(filePath)
+	f, err := os.Create(wavFile)
 	if err != nil {
 		return err
 	}
-	_, err = s.WriteTo(f)
-	f.Close()
+	err = synthesizer.RenderWAV(f, s)
+	_ = f.Close()
+	if err != nil {
+		_ = os.Remove(wavFile)
+	}
 	return err
 }
 
+func mkMidi(ctx *zero.Ctx, filePath, input string) error {
+	if file.IsExist(filePath) {
+		return nil
+	}
+	sc, err := notation.Parse(input)
+	if err != nil {
+		return err
+	}
+	s, err := sc.SMF(uint8(getTimbreMode(ctx)))
+	if err != nil {
+		return err
+	}
+	return s.WriteFile(filePath)
+}
+
 func o(base uint8, oct uint8) uint8 {
 	if oct > 10 {
 		oct = 10
@@ -461,55 +436,12 @@ func processOne(note string) uint8 {
 	return o(base, level)
 }
 
-func mid2txt(midBytes []byte, trackNo int) (midStr string) {
-	var (
-		absTicksStart float64
-		absTicksEnd   float64
-		startNote     byte
-		endNote       byte
-		defaultMetric = 960.0
-	)
-	_ = smf.ReadTracksFrom(bytes.NewReader(midBytes), trackNo).
-		Do(
-			func(te smf.TrackEvent) {
-				if !te.Message.IsMeta() {
-					b := te.Message.Bytes()
-					if te.Message.Is(midi.NoteOnMsg) && b[2] > 0 {
-						absTicksStart = float64(te.AbsTicks)
-						startNote = b[1]
-					}
-					if te.Message.Is(midi.NoteOffMsg) || (te.Message.Is(midi.NoteOnMsg) && b[2] == 0x00) {
-						absTicksEnd = float64(te.AbsTicks)
-						endNote = b[1]
-						if startNote == endNote {
-							sign := name(b[1])
-							level := b[1] / 12
-							length := (absTicksEnd - absTicksStart) / defaultMetric
-							midStr += sign
-							if level != 5 {
-								midStr += strconv.Itoa(int(level))
-							}
-							pow := int(math.Round(math.Log2(length)))
-							if pow >= -4 && pow != 0 {
-								midStr += "<" + strconv.Itoa(pow)
-							}
-							startNote = 0
-							endNote = 0
-						}
-					}
-					if (te.Message.Is(midi.NoteOnMsg) && b[2] > 0) && absTicksStart > absTicksEnd {
-						length := (absTicksStart - absTicksEnd) / defaultMetric
-						pow := int(math.Round(math.Log2(length)))
-						if pow == 0 {
-							midStr += "R"
-						} else if pow >= -4 {
-							midStr += "R<" + strconv.Itoa(pow)
-						}
-					}
-				}
-			},
-		)
-	return
+func mid2txt(s *smf.SMF) (string, error) {
+	sc, err := notation.FromSMF(s)
+	if err != nil {
+		return "", err
+	}
+	return sc.Format(), nil
 }
 
 func setTimbreMode(ctx *zero.Ctx, timbre int64) error {
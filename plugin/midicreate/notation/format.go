@@ -0,0 +1,325 @@
+package notation
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// noteNames 与原有 midi 转 txt 一致, 使用降号表示黑键
+var noteNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "Gb", "G", "Ab", "A", "Bb", "B"}
+
+type rawNote struct {
+	start, end uint32
+	key        uint8
+}
+
+// FromSMF 将 smf 转换为乐谱, 时间量化到六十四分音符,
+// 同一轨道内互相重叠的音符会被拆分到多个轨道
+func FromSMF(s *smf.SMF) (*Score, error) {
+	mt, ok := s.TimeFormat.(smf.MetricTicks)
+	if !ok {
+		return nil, ErrSMPTE
+	}
+	res := float64(mt.Resolution())
+	if res == 0 {
+		res = Resolution
+	}
+	quantize := func(abs int64) uint32 {
+		return uint32(math.Round(float64(abs)*Resolution/res/minTick)) * minTick
+	}
+	sc := &Score{}
+	for _, tr := range s.Tracks {
+		var (
+			abs     int64
+			program = -1
+			pending = make(map[uint16][]uint32)
+			notes   []rawNote
+		)
+		for _, ev := range tr {
+			abs += int64(ev.Delta)
+			tick := quantize(abs)
+			var (
+				ch, key, vel, prog uint8
+				bpm                float64
+				num, denom         uint8
+			)
+			switch {
+			case ev.Message.GetMetaTempo(&bpm):
+				sc.Tempos = append(sc.Tempos, Tempo{Tick: tick, BPM: math.Round(bpm*100) / 100})
+			case ev.Message.GetMetaMeter(&num, &denom):
+				sc.Meters = append(sc.Meters, Meter{Tick: tick, Num: num, Denom: denom})
+			case ev.Message.GetProgramChange(&ch, &prog):
+				if program < 0 {
+					program = int(prog)
+				}
+			case ev.Message.GetNoteStart(&ch, &key, &vel):
+				id := uint16(ch)<<8 | uint16(key)
+				pending[id] = append(pending[id], tick)
+			case ev.Message.GetNoteEnd(&ch, &key):
+				id := uint16(ch)<<8 | uint16(key)
+				if len(pending[id]) == 0 {
+					continue
+				}
+				start := pending[id][0]
+				pending[id] = pending[id][1:]
+				if tick <= start {
+					tick = start + minTick
+				}
+				notes = append(notes, rawNote{start: start, end: tick, key: key})
+			}
+		}
+		for _, t := range split(notes) {
+			t.Program = program
+			sc.Tracks = append(sc.Tracks, t)
+		}
+	}
+	if len(sc.Tracks) > maxTracks {
+		return nil, ErrTooManyTracks
+	}
+	sc.Tempos = dedupTempos(sc.Tempos)
+	sc.Meters = dedupMeters(sc.Meters)
+	return sc, nil
+}
+
+// split 将音符组合为和弦, 并分配到互不重叠的若干轨道
+func split(notes []rawNote) []*Track {
+	sort.Slice(notes, func(i, j int) bool {
+		a, b := notes[i], notes[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end < b.end
+		}
+		return a.key < b.key
+	})
+	var tracks []*Track
+	for i := 0; i < len(notes); {
+		n := Note{Tick: notes[i].start, Duration: notes[i].end - notes[i].start}
+		for ; i < len(notes) && notes[i].start == n.Tick && notes[i].end == n.End(); i++ {
+			n.Keys = append(n.Keys, notes[i].key)
+		}
+		n.Keys = normalizeKeys(n.Keys)
+		var dst *Track
+		for _, t := range tracks {
+			if last := t.Notes[len(t.Notes)-1]; last.End() <= n.Tick {
+				dst = t
+				break
+			}
+		}
+		if dst == nil {
+			dst = &Track{}
+			tracks = append(tracks, dst)
+		}
+		dst.Notes = append(dst.Notes, n)
+	}
+	return tracks
+}
+
+// dedupTempos 按时间排序, 同一时刻只保留最后一个
+func dedupTempos(ts []Tempo) []Tempo {
+	sort.SliceStable(ts, func(i, j int) bool { return ts[i].Tick < ts[j].Tick })
+	out := ts[:0]
+	for _, t := range ts {
+		if len(out) > 0 && out[len(out)-1].Tick == t.Tick {
+			out[len(out)-1] = t
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// dedupMeters 按时间排序, 同一时刻只保留最后一个
+func dedupMeters(ms []Meter) []Meter {
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].Tick < ms[j].Tick })
+	out := ms[:0]
+	for _, m := range ms {
+		if len(out) > 0 && out[len(out)-1].Tick == m.Tick {
+			out[len(out)-1] = m
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// lengthToken 可用单个记号表示的时值
+type lengthToken struct {
+	ticks  uint32
+	suffix string
+}
+
+// lengths 所有可用单个记号表示的时值, 从大到小排列
+var lengths = func() (ls []lengthToken) {
+	for exp := 3; exp >= -4; exp-- {
+		base := scale(Resolution, exp)
+		for dots := 2; dots >= 0; dots-- {
+			d, add := base, base
+			for i := 0; i < dots; i++ {
+				add /= 2
+				d += add
+			}
+			if d%minTick != 0 {
+				continue
+			}
+			suffix := ""
+			if exp != 0 {
+				suffix = "<" + strconv.Itoa(exp)
+			}
+			suffix += strings.Repeat(".", dots)
+			ls = append(ls, lengthToken{d, suffix})
+		}
+	}
+	sort.SliceStable(ls, func(i, j int) bool { return ls[i].ticks > ls[j].ticks })
+	return
+}()
+
+// decompose 将时值拆分为若干可表示的记号后缀
+func decompose(d uint32) (suffixes []string) {
+	for _, l := range lengths {
+		for d >= l.ticks {
+			suffixes = append(suffixes, l.suffix)
+			d -= l.ticks
+		}
+	}
+	return
+}
+
+func keyName(k uint8) string {
+	s := noteNames[k%12]
+	if oct := k / 12; oct != 5 {
+		s += strconv.Itoa(int(oct))
+	}
+	return s
+}
+
+func chordName(keys []uint8) string {
+	if len(keys) == 1 {
+		return keyName(keys[0])
+	}
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for _, k := range keys {
+		sb.WriteString(keyName(k))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// formatter 输出单个轨道, 在 marks 处插入指令
+type formatter struct {
+	sb     strings.Builder
+	cursor uint32
+	marks  []uint32
+	// directives 每个 mark 对应的指令
+	directives map[uint32][]string
+}
+
+func (f *formatter) write(tok string) {
+	if f.sb.Len() > 0 {
+		f.sb.WriteByte(' ')
+	}
+	f.sb.WriteString(tok)
+}
+
+// flush 输出所有不晚于 tick 的指令
+func (f *formatter) flush(tick uint32) {
+	for len(f.marks) > 0 && f.marks[0] <= tick {
+		for _, d := range f.directives[f.marks[0]] {
+			f.write(d)
+		}
+		f.marks = f.marks[1:]
+	}
+}
+
+// segments 将 [f.cursor, end) 按指令位置切分
+func (f *formatter) segments(end uint32) (segs []uint32) {
+	start := f.cursor
+	for _, m := range f.marks {
+		if m > start && m < end {
+			segs = append(segs, m-start)
+			start = m
+		}
+	}
+	return append(segs, end-start)
+}
+
+func (f *formatter) rest(end uint32) {
+	for _, seg := range f.segments(end) {
+		f.flush(f.cursor)
+		for _, s := range decompose(seg) {
+			f.write("R" + s)
+		}
+		f.cursor += seg
+	}
+}
+
+func (f *formatter) note(n Note) {
+	name := chordName(n.Keys)
+	first := true
+	for _, seg := range f.segments(n.End()) {
+		if !first {
+			f.sb.WriteByte('~')
+		}
+		f.flush(f.cursor)
+		for i, s := range decompose(seg) {
+			if i > 0 {
+				f.sb.WriteByte('~')
+			}
+			f.write(name + s)
+		}
+		f.cursor += seg
+		first = false
+	}
+}
+
+// Format 将乐谱输出为文本, 可由 Parse 还原
+func (sc *Score) Format() string {
+	var lines []string
+	tracks := sc.Tracks
+	if len(tracks) == 0 {
+		tracks = []*Track{{Program: -1}}
+	}
+	for i, tr := range tracks {
+		f := &formatter{directives: make(map[uint32][]string)}
+		if len(tracks) > 1 {
+			f.write("{V" + strconv.Itoa(i+1) + "}")
+		}
+		if tr.Program >= 0 {
+			f.write("{I" + strconv.Itoa(tr.Program) + "}")
+		}
+		var last uint32
+		if i == 0 {
+			for _, m := range sc.Meters {
+				f.directives[m.Tick] = append(f.directives[m.Tick], "{M"+strconv.Itoa(int(m.Num))+"/"+strconv.Itoa(int(m.Denom))+"}")
+			}
+			for _, t := range sc.Tempos {
+				f.directives[t.Tick] = append(f.directives[t.Tick], "{T"+strconv.FormatFloat(t.BPM, 'f', -1, 64)+"}")
+			}
+			for tick := range f.directives {
+				f.marks = append(f.marks, tick)
+				if tick > last {
+					last = tick
+				}
+			}
+			sort.Slice(f.marks, func(i, j int) bool { return f.marks[i] < f.marks[j] })
+		}
+		for _, n := range tr.Notes {
+			if n.Tick > f.cursor {
+				f.rest(n.Tick)
+			}
+			f.note(n)
+		}
+		if last > f.cursor {
+			f.rest(last)
+		}
+		f.flush(last)
+		lines = append(lines, f.sb.String())
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,177 @@
+// Package notation midicreate 使用的文本乐谱格式, 可与 smf 互相转换
+//
+// 语法(空白与小节线 | 会被忽略):
+//
+//	C D E F G A B   音名, 后接 b 降调, # 升调
+//	C6              八度, C5 为中央C, 不写时默认为 5
+//	C<1 C<-2        音长, <n 表示四分音符时值 ×2^n, 范围 -4~3
+//	C. C<1..        附点, 每个点增加前一半时值
+//	C~C             连音线, 将后一个同音高音符并入前一个
+//	R R<1           休止符
+//	[CEG]<1         和弦, 括号内音符同时发声, 音长写在括号后
+//	{T120}          速度(bpm)
+//	{M3/4}          拍号
+//	{I40}           当前轨道的音色 (0~127)
+//	{V2}            切换到第 2 轨, 各轨独立计时, 同时开始
+package notation
+
+import (
+	"errors"
+	"sort"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+const (
+	// Resolution 每个四分音符的 tick 数
+	Resolution = 960
+	// minTick 最小时值, 即 <-4 (六十四分音符)
+	minTick = Resolution / 16
+	// maxTracks 最多轨道数, 受 midi 通道数限制
+	maxTracks = 15
+	// defaultVelocity 默认力度
+	defaultVelocity = 120
+	// drumChannel 打击乐通道, 分配轨道时跳过
+	drumChannel = 9
+	// DefaultTempo 未指定速度时使用的 bpm
+	DefaultTempo = 72
+)
+
+var (
+	// ErrTooManyTracks 轨道过多
+	ErrTooManyTracks = errors.New("最多支持15个轨道")
+	// ErrSMPTE 不支持 SMPTE 时间格式
+	ErrSMPTE = errors.New("不支持SMPTE时间格式的midi文件")
+)
+
+// Score 乐谱
+type Score struct {
+	Tempos []Tempo
+	Meters []Meter
+	Tracks []*Track
+}
+
+// Tempo 速度变化
+type Tempo struct {
+	Tick uint32
+	BPM  float64
+}
+
+// Meter 拍号变化
+type Meter struct {
+	Tick  uint32
+	Num   uint8
+	Denom uint8
+}
+
+// Track 一个轨道, 轨道内的音符按时间顺序排列且互不重叠
+type Track struct {
+	// Program 音色, 小于 0 时使用默认音色
+	Program int
+	Notes   []Note
+}
+
+// Note 一个音符或和弦
+type Note struct {
+	Tick     uint32
+	Duration uint32
+	Keys     []uint8
+}
+
+// End 音符结束的 tick
+func (n *Note) End() uint32 {
+	return n.Tick + n.Duration
+}
+
+// SMF 将乐谱转换为 smf, 未指定音色的轨道使用 defaultProgram
+func (sc *Score) SMF(defaultProgram uint8) (*smf.SMF, error) {
+	if len(sc.Tracks) > maxTracks {
+		return nil, ErrTooManyTracks
+	}
+	s := smf.New()
+	s.TimeFormat = smf.MetricTicks(Resolution)
+
+	// 第 0 轨存放速度与拍号
+	var conductor timeline
+	if len(sc.Meters) == 0 || sc.Meters[0].Tick > 0 {
+		conductor.add(0, 0, smf.MetaMeter(4, 4))
+	}
+	if len(sc.Tempos) == 0 || sc.Tempos[0].Tick > 0 {
+		conductor.add(0, 1, smf.MetaTempo(DefaultTempo))
+	}
+	for _, m := range sc.Meters {
+		conductor.add(m.Tick, 0, smf.MetaMeter(m.Num, m.Denom))
+	}
+	for _, t := range sc.Tempos {
+		conductor.add(t.Tick, 1, smf.MetaTempo(t.BPM))
+	}
+	if err := s.Add(conductor.track()); err != nil {
+		return nil, err
+	}
+
+	for i, tr := range sc.Tracks {
+		ch := channel(i)
+		program := defaultProgram
+		if tr.Program >= 0 {
+			program = uint8(tr.Program)
+		}
+		var tl timeline
+		tl.add(0, 0, midi.ProgramChange(ch, program))
+		for _, n := range tr.Notes {
+			for _, k := range n.Keys {
+				tl.add(n.Tick, 2, midi.NoteOn(ch, k, defaultVelocity))
+				// 结束事件优先于同一时刻的开始事件
+				tl.add(n.End(), 1, midi.NoteOff(ch, k))
+			}
+		}
+		if err := s.Add(tl.track()); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// channel 第 i 个轨道使用的 midi 通道
+func channel(i int) uint8 {
+	if i >= drumChannel {
+		i++
+	}
+	return uint8(i)
+}
+
+type timedMessage struct {
+	tick  uint32
+	order int
+	seq   int
+	msg   []byte
+}
+
+// timeline 按绝对时间收集事件, 最终转换为 delta 时间的轨道
+type timeline []timedMessage
+
+func (tl *timeline) add(tick uint32, order int, msg []byte) {
+	*tl = append(*tl, timedMessage{tick: tick, order: order, seq: len(*tl), msg: msg})
+}
+
+func (tl timeline) track() smf.Track {
+	sort.Slice(tl, func(i, j int) bool {
+		if tl[i].tick != tl[j].tick {
+			return tl[i].tick < tl[j].tick
+		}
+		if tl[i].order != tl[j].order {
+			return tl[i].order < tl[j].order
+		}
+		return tl[i].seq < tl[j].seq
+	})
+	var (
+		tr   smf.Track
+		last uint32
+	)
+	for _, m := range tl {
+		tr.Add(m.tick-last, m.msg)
+		last = m.tick
+	}
+	tr.Close(0)
+	return tr
+}
@@ -0,0 +1,86 @@
+package notation
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+func TestParse(t *testing.T) {
+	sc, err := Parse("C D<1. [CEG]<-1~[GEC]<-2 R E6 Bb4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Note{
+		{Tick: 0, Duration: 960, Keys: []uint8{60}},
+		{Tick: 960, Duration: 2880, Keys: []uint8{62}},
+		{Tick: 3840, Duration: 720, Keys: []uint8{60, 64, 67}},
+		{Tick: 5520, Duration: 960, Keys: []uint8{76}},
+		{Tick: 6480, Duration: 960, Keys: []uint8{58}},
+	}
+	if !reflect.DeepEqual(sc.Tracks[0].Notes, want) {
+		t.Fatalf("got %+v", sc.Tracks[0].Notes)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, c := range []struct {
+		in        string
+		line, col int
+		token     string
+	}{
+		{"CDE\nFXG", 2, 2, "X"},
+		{"C<9", 1, 2, "<9"},
+		{"C~D", 1, 3, "D"},
+		{"{T}", 1, 1, "{T}"},
+		{"[CE", 1, 1, "[CE"},
+		{"C {V2} D~{V1}", 1, 10, "{V1}"},
+	} {
+		_, err := Parse(c.in)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Fatalf("%q: expected ParseError, got %v", c.in, err)
+		}
+		if pe.Line != c.line || pe.Col != c.col || pe.Token != c.token {
+			t.Fatalf("%q: got %v", c.in, pe)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := "{I0} {M3/4} {T100} C<1. D E<-1~E<-3 R<-3 [CEG]<1 {T80} F\n" +
+		"{V2} {I33} C3<1 R G2<2. | Ab2<-2 Db3<-2..\n"
+	sc, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := sc.SMF(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, err = smf.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromSMF(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sc) {
+		t.Fatalf("smf round trip mismatch:\n%s\n%s", got.Format(), sc.Format())
+	}
+	again, err := Parse(got.Format())
+	if err != nil {
+		t.Fatal(err, "\n", got.Format())
+	}
+	if !reflect.DeepEqual(again, sc) {
+		t.Fatalf("text round trip mismatch:\n%s\n%s", again.Format(), sc.Format())
+	}
+}
@@ -0,0 +1,376 @@
+package notation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseError 乐谱解析错误, 指出出错的位置与记号
+type ParseError struct {
+	Line  int
+	Col   int
+	Token string
+	Msg   string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("第%d行第%d列的 %q 有误: %s", e.Line, e.Col, e.Token, e.Msg)
+}
+
+// pitchClass 音名对应的半音数
+var pitchClass = map[rune]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+func isPitch(r rune) bool {
+	_, ok := pitchClass[r]
+	return ok
+}
+
+type parser struct {
+	src  []rune
+	pos  int
+	line int
+	col  int
+
+	score *Score
+	track int
+	// cursor 各轨道当前的 tick
+	cursor []uint32
+	// tied 当前轨道最后一个音符带有连音线
+	tied bool
+}
+
+// Parse 解析文本乐谱
+func Parse(input string) (*Score, error) {
+	p := &parser{
+		src:   []rune(input),
+		line:  1,
+		col:   1,
+		score: &Score{Tracks: []*Track{{Program: -1}}},
+	}
+	p.cursor = []uint32{0}
+	for {
+		p.skip()
+		if p.eof() {
+			break
+		}
+		var err error
+		switch r := p.peek(); {
+		case r == '{':
+			err = p.directive()
+		case r == '[':
+			err = p.chord()
+		case r == 'R':
+			err = p.rest()
+		case isPitch(r):
+			err = p.note()
+		default:
+			return nil, p.errorf(p.line, p.col, string(r), "无法识别的字符")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.tied {
+		return nil, p.errorf(p.line, p.col, "~", "连音线后缺少音符")
+	}
+	// 去掉末尾未使用的空轨道
+	for len(p.score.Tracks) > 1 && len(p.score.Tracks[len(p.score.Tracks)-1].Notes) == 0 {
+		p.score.Tracks = p.score.Tracks[:len(p.score.Tracks)-1]
+	}
+	p.score.Tempos = dedupTempos(p.score.Tempos)
+	p.score.Meters = dedupMeters(p.score.Meters)
+	return p.score, nil
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) next() rune {
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+		p.col = 1
+	} else {
+		p.col++
+	}
+	return r
+}
+
+// skip 跳过空白与小节线
+func (p *parser) skip() {
+	for !p.eof() && (unicode.IsSpace(p.peek()) || p.peek() == '|') {
+		p.next()
+	}
+}
+
+func (p *parser) errorf(line, col int, token, format string, args ...any) error {
+	return &ParseError{Line: line, Col: col, Token: token, Msg: fmt.Sprintf(format, args...)}
+}
+
+// token 返回从 start 到当前位置的文本
+func (p *parser) token(start int) string {
+	return string(p.src[start:p.pos])
+}
+
+func (p *parser) digits() string {
+	start := p.pos
+	for !p.eof() && p.peek() >= '0' && p.peek() <= '9' {
+		p.next()
+	}
+	return string(p.src[start:p.pos])
+}
+
+// pitch 解析音名、升降号与八度, 返回 midi 音高
+func (p *parser) pitch() (key uint8, err error) {
+	line, col, start := p.line, p.col, p.pos
+	base := pitchClass[p.next()]
+	for p.peek() == 'b' || p.peek() == '#' {
+		if p.next() == 'b' {
+			base--
+		} else {
+			base++
+		}
+	}
+	octave := 5
+	if d := p.digits(); d != "" {
+		octave, _ = strconv.Atoi(d)
+		if octave > 10 {
+			return 0, p.errorf(line, col, p.token(start), "八度应在0~10之间")
+		}
+	}
+	k := base + 12*octave
+	if k < 0 || k > 127 {
+		return 0, p.errorf(line, col, p.token(start), "音高超出范围")
+	}
+	return uint8(k), nil
+}
+
+// length 解析可选的 <n 与附点, 返回 tick 数
+func (p *parser) length() (uint32, error) {
+	line, col, start := p.line, p.col, p.pos
+	exp := 0
+	if p.peek() == '<' {
+		p.next()
+		neg := false
+		if p.peek() == '-' {
+			p.next()
+			neg = true
+		}
+		d := p.digits()
+		if d == "" {
+			return 0, p.errorf(line, col, p.token(start), "<后应为-4~3的整数")
+		}
+		exp, _ = strconv.Atoi(d)
+		if neg {
+			exp = -exp
+		}
+		if exp < -4 || exp > 3 {
+			return 0, p.errorf(line, col, p.token(start), "音长应在-4~3之间")
+		}
+	}
+	d := scale(Resolution, exp)
+	add := d
+	for p.peek() == '.' {
+		p.next()
+		add /= 2
+		if add < minTick/2 {
+			return 0, p.errorf(line, col, p.token(start), "附点过多")
+		}
+		d += add
+	}
+	return d, nil
+}
+
+// scale 返回 d×2^exp
+func scale(d uint32, exp int) uint32 {
+	if exp >= 0 {
+		return d << exp
+	}
+	return d >> -exp
+}
+
+// emit 在当前轨道写入一个音符或和弦, 处理连音线
+func (p *parser) emit(line, col int, tok string, keys []uint8, d uint32) error {
+	tr := p.score.Tracks[p.track]
+	if p.tied {
+		last := &tr.Notes[len(tr.Notes)-1]
+		if !sameKeys(last.Keys, keys) {
+			return p.errorf(line, col, tok, "连音线两端的音高不一致")
+		}
+		last.Duration += d
+	} else {
+		tr.Notes = append(tr.Notes, Note{Tick: p.cursor[p.track], Duration: d, Keys: keys})
+	}
+	p.cursor[p.track] += d
+	p.tied = false
+	if p.peek() == '~' {
+		p.next()
+		p.tied = true
+	}
+	return nil
+}
+
+func (p *parser) note() error {
+	line, col, start := p.line, p.col, p.pos
+	key, err := p.pitch()
+	if err != nil {
+		return err
+	}
+	d, err := p.length()
+	if err != nil {
+		return err
+	}
+	return p.emit(line, col, p.token(start), []uint8{key}, d)
+}
+
+func (p *parser) chord() error {
+	line, col, start := p.line, p.col, p.pos
+	p.next()
+	var keys []uint8
+	for {
+		p.skip()
+		if p.eof() {
+			return p.errorf(line, col, p.token(start), "和弦缺少 ]")
+		}
+		r := p.peek()
+		if r == ']' {
+			p.next()
+			break
+		}
+		if !isPitch(r) {
+			return p.errorf(p.line, p.col, string(r), "和弦内只能包含音符")
+		}
+		k, err := p.pitch()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return p.errorf(line, col, p.token(start), "空和弦")
+	}
+	d, err := p.length()
+	if err != nil {
+		return err
+	}
+	return p.emit(line, col, p.token(start), normalizeKeys(keys), d)
+}
+
+func (p *parser) rest() error {
+	line, col, start := p.line, p.col, p.pos
+	p.next()
+	if p.tied {
+		return p.errorf(line, col, "R", "连音线后不能是休止符")
+	}
+	d, err := p.length()
+	if err != nil {
+		return err
+	}
+	if p.peek() == '~' {
+		p.next()
+		return p.errorf(line, col, p.token(start), "休止符不能使用连音线")
+	}
+	p.cursor[p.track] += d
+	return nil
+}
+
+func (p *parser) directive() error {
+	line, col, start := p.line, p.col, p.pos
+	p.next()
+	end := p.pos
+	for end < len(p.src) && p.src[end] != '}' && p.src[end] != '\n' {
+		end++
+	}
+	if end >= len(p.src) || p.src[end] != '}' {
+		return p.errorf(line, col, string(p.src[start:end]), "缺少 }")
+	}
+	body := strings.TrimSpace(string(p.src[p.pos:end]))
+	for p.pos <= end {
+		p.next()
+	}
+	tok := p.token(start)
+	if body == "" {
+		return p.errorf(line, col, tok, "空指令")
+	}
+	arg := strings.TrimSpace(body[1:])
+	tick := p.cursor[p.track]
+	switch body[0] {
+	case 'T':
+		bpm, err := strconv.ParseFloat(arg, 64)
+		if err != nil || bpm < 10 || bpm > 400 {
+			return p.errorf(line, col, tok, "速度应在10~400之间")
+		}
+		p.score.Tempos = append(p.score.Tempos, Tempo{Tick: tick, BPM: bpm})
+	case 'M':
+		num, denom, ok := strings.Cut(arg, "/")
+		n, err1 := strconv.Atoi(num)
+		d, err2 := strconv.Atoi(denom)
+		if !ok || err1 != nil || err2 != nil || n < 1 || n > 32 || d < 1 || d > 32 || d&(d-1) != 0 {
+			return p.errorf(line, col, tok, "拍号格式应为 {M4/4}, 分母为2的幂")
+		}
+		p.score.Meters = append(p.score.Meters, Meter{Tick: tick, Num: uint8(n), Denom: uint8(d)})
+	case 'I':
+		prog, err := strconv.Atoi(arg)
+		if err != nil || prog < 0 || prog > 127 {
+			return p.errorf(line, col, tok, "音色应在0~127之间")
+		}
+		p.score.Tracks[p.track].Program = prog
+	case 'V':
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > maxTracks {
+			return p.errorf(line, col, tok, "轨道应在1~%d之间", maxTracks)
+		}
+		if p.tied {
+			return p.errorf(line, col, tok, "连音线不能跨越轨道")
+		}
+		for len(p.score.Tracks) < n {
+			p.score.Tracks = append(p.score.Tracks, &Track{Program: -1})
+			p.cursor = append(p.cursor, 0)
+		}
+		p.track = n - 1
+	default:
+		return p.errorf(line, col, tok, "未知指令, 可用的指令有 T M I V")
+	}
+	return nil
+}
+
+// normalizeKeys 去重并升序排列
+func normalizeKeys(keys []uint8) []uint8 {
+	var seen [128]bool
+	out := keys[:0]
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	for i := 1; i < len(out); i++ {
+		for j := i; j > 0 && out[j] < out[j-1]; j-- {
+			out[j], out[j-1] = out[j-1], out[j]
+		}
+	}
+	return out
+}
+
+func sameKeys(a, b []uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package synth
+
+import (
+	"math"
+	"math/rand"
+)
+
+// releaseTail 音符结束后保留的释放时间(秒)
+const releaseTail = 0.5
+
+// voice 发声器, 将音符叠加写入 dst, dst[0] 对应音符开始
+type voice interface {
+	render(dst []float32, n note, rate float64)
+}
+
+// freq 返回 midi 音高对应的频率
+func freq(key float64) float64 {
+	return 440 * math.Pow(2, (key-69)/12)
+}
+
+// envelope ADSR 包络, 时间单位为秒
+type envelope struct {
+	attack, decay, sustain, release float64
+}
+
+// at 返回音符开始后 t 秒的包络值, hold 为按键时长
+func (e envelope) at(t, hold float64) float64 {
+	level := func(t float64) float64 {
+		switch {
+		case t < e.attack:
+			return t / e.attack
+		case t < e.attack+e.decay:
+			return 1 - (1-e.sustain)*(t-e.attack)/e.decay
+		default:
+			return e.sustain
+		}
+	}
+	if t < hold {
+		return level(t)
+	}
+	if e.release <= 0 {
+		return 0
+	}
+	r := 1 - (t-hold)/e.release
+	if r <= 0 {
+		return 0
+	}
+	return level(hold) * r
+}
+
+// oscillator 内置的加法合成乐器
+type oscillator struct {
+	// harmonics 各次谐波的振幅
+	harmonics []float64
+	env       envelope
+	// damping 指数衰减系数, 用于模拟拨弦、敲击类乐器
+	damping float64
+}
+
+func (o *oscillator) render(dst []float32, n note, rate float64) {
+	hold := n.end - n.start
+	f := freq(float64(n.key))
+	amp := 0.25 * float64(n.velocity) / 127 * n.volume
+	total := int((hold + o.env.release) * rate)
+	if total > len(dst) {
+		total = len(dst)
+	}
+	var norm float64
+	for _, h := range o.harmonics {
+		norm += h
+	}
+	for i := 0; i < total; i++ {
+		t := float64(i) / rate
+		e := o.env.at(t, hold)
+		if e == 0 && t > hold {
+			break
+		}
+		if o.damping > 0 {
+			e *= math.Exp(-o.damping * t)
+		}
+		var v float64
+		for k, h := range o.harmonics {
+			fk := f * float64(k+1)
+			if h == 0 || fk >= rate/2 {
+				continue
+			}
+			v += h * math.Sin(2*math.Pi*fk*t)
+		}
+		dst[i] += float32(amp * e * v / norm)
+	}
+}
+
+// families 按 GM 乐器族(program/8)划分的内置音色
+var families = [16]oscillator{
+	// 钢琴
+	{harmonics: []float64{1, 0.5, 0.3, 0.15, 0.08}, env: envelope{0.005, 0.1, 0.7, 0.3}, damping: 1.2},
+	// 半音阶打击乐
+	{harmonics: []float64{1, 0, 0.4, 0, 0.2}, env: envelope{0.002, 0.05, 0.6, 0.4}, damping: 2.5},
+	// 风琴
+	{harmonics: []float64{1, 0.7, 0.5, 0.3, 0.3, 0.1}, env: envelope{0.02, 0.01, 1, 0.08}},
+	// 吉他
+	{harmonics: []float64{1, 0.6, 0.4, 0.25, 0.15, 0.1}, env: envelope{0.003, 0.08, 0.6, 0.2}, damping: 2},
+	// 贝斯
+	{harmonics: []float64{1, 0.4, 0.15}, env: envelope{0.005, 0.1, 0.7, 0.15}, damping: 0.8},
+	// 弦乐
+	{harmonics: []float64{1, 0.5, 0.33, 0.25, 0.2, 0.16, 0.14}, env: envelope{0.08, 0.1, 0.85, 0.3}},
+	// 合奏
+	{harmonics: []float64{1, 0.45, 0.3, 0.2, 0.15}, env: envelope{0.15, 0.1, 0.9, 0.4}},
+	// 铜管
+	{harmonics: []float64{1, 0.8, 0.6, 0.45, 0.3, 0.2}, env: envelope{0.04, 0.1, 0.8, 0.15}},
+	// 簧管
+	{harmonics: []float64{1, 0, 0.33, 0, 0.2, 0, 0.14}, env: envelope{0.03, 0.05, 0.85, 0.1}},
+	// 吹管
+	{harmonics: []float64{1, 0.1, 0.05}, env: envelope{0.05, 0.05, 0.9, 0.12}},
+	// 合成主音
+	{harmonics: []float64{1, 0, 0.33, 0, 0.2, 0, 0.14, 0, 0.11}, env: envelope{0.01, 0.05, 0.8, 0.1}},
+	// 合成音色
+	{harmonics: []float64{1, 0.5, 0.33, 0.25}, env: envelope{0.3, 0.2, 0.8, 0.5}},
+	// 合成效果
+	{harmonics: []float64{1, 0.3, 0.5, 0.2}, env: envelope{0.2, 0.3, 0.6, 0.5}},
+	// 民族乐器
+	{harmonics: []float64{1, 0.7, 0.2, 0.3, 0.1}, env: envelope{0.005, 0.1, 0.5, 0.25}, damping: 1.5},
+	// 打击乐器
+	{harmonics: []float64{1, 0.2, 0.5, 0.1}, env: envelope{0.002, 0.05, 0.3, 0.2}, damping: 4},
+	// 音效
+	{harmonics: []float64{1, 0.5, 0.5, 0.5}, env: envelope{0.05, 0.2, 0.5, 0.3}},
+}
+
+// builtin 返回 program 对应的内置音色
+func builtin(program uint8) voice {
+	return &families[program/8%16]
+}
+
+// drum 打击乐通道使用的噪声鼓组
+type drum struct{}
+
+func (drum) render(dst []float32, n note, rate float64) {
+	amp := 0.3 * float64(n.velocity) / 127 * n.volume
+	var (
+		length float64 // 持续时间
+		tone   float64 // 音调成分频率, 0 表示纯噪声
+		noise  float64 // 噪声成分比例
+	)
+	switch n.key {
+	case 35, 36: // 底鼓
+		length, tone, noise = 0.25, 60, 0.1
+	case 38, 40: // 军鼓
+		length, tone, noise = 0.2, 180, 0.7
+	case 42, 44: // 闭镲
+		length, noise = 0.06, 1
+	case 46: // 开镲
+		length, noise = 0.3, 1
+	case 41, 43, 45, 47, 48, 50: // 通鼓
+		length, tone, noise = 0.3, freq(float64(n.key)-12), 0.2
+	case 49, 51, 52, 55, 57, 59: // 吊镲
+		length, noise = 0.8, 1
+	default:
+		length, tone, noise = 0.15, freq(float64(n.key)), 0.5
+	}
+	// 固定种子, 保证同一输入渲染结果一致
+	r := rand.New(rand.NewSource(int64(n.key)))
+	total := int(length * rate)
+	if total > len(dst) {
+		total = len(dst)
+	}
+	for i := 0; i < total; i++ {
+		t := float64(i) / rate
+		e := math.Exp(-5 * t / length)
+		var v float64
+		if tone > 0 {
+			// 底鼓音高快速下滑
+			v += (1 - noise) * math.Sin(2*math.Pi*tone*t*(1+math.Exp(-30*t)))
+		}
+		v += noise * (r.Float64()*2 - 1)
+		dst[i] += float32(amp * e * v)
+	}
+}
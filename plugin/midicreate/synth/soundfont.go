@@ -0,0 +1,359 @@
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// sf2 生成器编号
+const (
+	genStartAddrsOffset       = 0
+	genEndAddrsOffset         = 1
+	genStartloopAddrsOffset   = 2
+	genEndloopAddrsOffset     = 3
+	genStartAddrsCoarseOffset = 4
+	genEndAddrsCoarseOffset   = 12
+	genReleaseVolEnv          = 38
+	genInstrument             = 41
+	genKeyRange               = 43
+	genVelRange               = 44
+	genStartloopCoarseOffset  = 45
+	genInitialAttenuation     = 48
+	genEndloopCoarseOffset    = 50
+	genCoarseTune             = 51
+	genFineTune               = 52
+	genSampleID               = 53
+	genSampleModes            = 54
+	genOverridingRootKey      = 58
+)
+
+var (
+	// ErrInvalidSoundFont 不是合法的 sf2 文件
+	ErrInvalidSoundFont = errors.New("不是合法的sf2音色库")
+)
+
+// SoundFont 从 sf2 文件中载入的音色库
+//
+// 只实现了采样播放、循环、调音与音量衰减, 忽略调制器与滤波器
+type SoundFont struct {
+	samples []int16
+	presets map[uint16][]*Zone // key: bank<<8 | program
+}
+
+// Zone 音色库中的一个采样区域
+type Zone struct {
+	keyLo, keyHi uint8
+	velLo, velHi uint8
+	start, end   int
+	loopStart    int
+	loopEnd      int
+	loop         bool
+	sampleRate   float64
+	rootKey      int
+	tune         float64 // 音分
+	attenuation  float64 // dB
+	release      float64 // 秒
+	samples      []int16
+}
+
+// LoadSoundFont 从文件载入 sf2 音色库
+func LoadSoundFont(path string) (*SoundFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSoundFont(data)
+}
+
+type generator struct {
+	oper   uint16
+	amount uint16
+}
+
+func (g generator) lo() uint8     { return uint8(g.amount) }
+func (g generator) hi() uint8     { return uint8(g.amount >> 8) }
+func (g generator) signed() int16 { return int16(g.amount) }
+
+type bag struct {
+	gen uint16
+}
+
+type header struct {
+	bank, program, bag uint16
+}
+
+type sampleHeader struct {
+	start, end, loopStart, loopEnd, rate uint32
+	pitch                                uint8
+	correction                           int8
+}
+
+// ParseSoundFont 解析 sf2 数据
+func ParseSoundFont(data []byte) (*SoundFont, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, ErrInvalidSoundFont
+	}
+	chunks := make(map[string][]byte)
+	if err := walkChunks(data[12:], chunks); err != nil {
+		return nil, err
+	}
+	smpl := chunks["smpl"]
+	if smpl == nil || chunks["phdr"] == nil || chunks["shdr"] == nil {
+		return nil, ErrInvalidSoundFont
+	}
+	sf := &SoundFont{
+		samples: make([]int16, len(smpl)/2),
+		presets: make(map[uint16][]*Zone),
+	}
+	_ = binary.Read(bytes.NewReader(smpl), binary.LittleEndian, sf.samples)
+
+	var (
+		phdr = records(chunks["phdr"], 38, func(b []byte) header {
+			return header{program: le16(b[20:]), bank: le16(b[22:]), bag: le16(b[24:])}
+		})
+		pbag = records(chunks["pbag"], 4, func(b []byte) bag { return bag{gen: le16(b)} })
+		pgen = records(chunks["pgen"], 4, func(b []byte) generator { return generator{le16(b), le16(b[2:])} })
+		inst = records(chunks["inst"], 22, func(b []byte) uint16 { return le16(b[20:]) })
+		ibag = records(chunks["ibag"], 4, func(b []byte) bag { return bag{gen: le16(b)} })
+		igen = records(chunks["igen"], 4, func(b []byte) generator { return generator{le16(b), le16(b[2:])} })
+		shdr = records(chunks["shdr"], 46, func(b []byte) sampleHeader {
+			return sampleHeader{
+				start: le32(b[20:]), end: le32(b[24:]), loopStart: le32(b[28:]), loopEnd: le32(b[32:]),
+				rate: le32(b[36:]), pitch: b[40], correction: int8(b[41]),
+			}
+		})
+	)
+	// zoneGens 返回第 i 个 bag 的生成器
+	zoneGens := func(bags []bag, gens []generator, i int) []generator {
+		if i+1 >= len(bags) {
+			return nil
+		}
+		lo, hi := int(bags[i].gen), int(bags[i+1].gen)
+		if lo > hi || hi > len(gens) {
+			return nil
+		}
+		return gens[lo:hi]
+	}
+	// 最后一条记录为结束标记
+	for p := 0; p+1 < len(phdr); p++ {
+		h := phdr[p]
+		key := h.bank<<8 | h.program
+		for b := int(h.bag); b < int(phdr[p+1].bag); b++ {
+			gens := zoneGens(pbag, pgen, b)
+			pkLo, pkHi, pvLo, pvHi := uint8(0), uint8(127), uint8(0), uint8(127)
+			instrument := -1
+			for _, g := range gens {
+				switch g.oper {
+				case genKeyRange:
+					pkLo, pkHi = g.lo(), g.hi()
+				case genVelRange:
+					pvLo, pvHi = g.lo(), g.hi()
+				case genInstrument:
+					instrument = int(g.amount)
+				}
+			}
+			if instrument < 0 || instrument+1 >= len(inst) {
+				continue
+			}
+			var global []generator
+			for ib := int(inst[instrument]); ib < int(inst[instrument+1]); ib++ {
+				gens := zoneGens(ibag, igen, ib)
+				if len(gens) == 0 || gens[len(gens)-1].oper != genSampleID {
+					// 没有采样的第一个区域为全局区域
+					if ib == int(inst[instrument]) {
+						global = gens
+					}
+					continue
+				}
+				all := make([]generator, 0, len(global)+len(gens))
+				all = append(append(all, global...), gens...)
+				z := sf.newZone(all, shdr)
+				if z == nil {
+					continue
+				}
+				z.keyLo, z.keyHi = max8(z.keyLo, pkLo), min8(z.keyHi, pkHi)
+				z.velLo, z.velHi = max8(z.velLo, pvLo), min8(z.velHi, pvHi)
+				if z.keyLo > z.keyHi || z.velLo > z.velHi {
+					continue
+				}
+				sf.presets[key] = append(sf.presets[key], z)
+			}
+		}
+	}
+	if len(sf.presets) == 0 {
+		return nil, ErrInvalidSoundFont
+	}
+	return sf, nil
+}
+
+// newZone 由合并后的生成器构造采样区域, 后出现的生成器覆盖前面的
+func (sf *SoundFont) newZone(gens []generator, shdr []sampleHeader) *Zone {
+	z := &Zone{keyHi: 127, velHi: 127, rootKey: -1, release: 0.2}
+	var offStart, offEnd, offLoopStart, offLoopEnd, sampleID int
+	var coarse, fine int
+	for _, g := range gens {
+		switch g.oper {
+		case genKeyRange:
+			z.keyLo, z.keyHi = g.lo(), g.hi()
+		case genVelRange:
+			z.velLo, z.velHi = g.lo(), g.hi()
+		case genSampleID:
+			sampleID = int(g.amount)
+		case genSampleModes:
+			z.loop = g.amount&1 == 1
+		case genOverridingRootKey:
+			z.rootKey = int(g.signed())
+		case genCoarseTune:
+			coarse = int(g.signed())
+		case genFineTune:
+			fine = int(g.signed())
+		case genInitialAttenuation:
+			z.attenuation = float64(g.signed()) / 10
+		case genReleaseVolEnv:
+			z.release = math.Pow(2, float64(g.signed())/1200)
+		case genStartAddrsOffset:
+			offStart += int(g.signed())
+		case genStartAddrsCoarseOffset:
+			offStart += int(g.signed()) * 32768
+		case genEndAddrsOffset:
+			offEnd += int(g.signed())
+		case genEndAddrsCoarseOffset:
+			offEnd += int(g.signed()) * 32768
+		case genStartloopAddrsOffset:
+			offLoopStart += int(g.signed())
+		case genStartloopCoarseOffset:
+			offLoopStart += int(g.signed()) * 32768
+		case genEndloopAddrsOffset:
+			offLoopEnd += int(g.signed())
+		case genEndloopCoarseOffset:
+			offLoopEnd += int(g.signed()) * 32768
+		}
+	}
+	if sampleID >= len(shdr) {
+		return nil
+	}
+	sh := shdr[sampleID]
+	z.start = int(sh.start) + offStart
+	z.end = int(sh.end) + offEnd
+	z.loopStart = int(sh.loopStart) + offLoopStart - z.start
+	z.loopEnd = int(sh.loopEnd) + offLoopEnd - z.start
+	if z.start < 0 || z.end > len(sf.samples) || z.start >= z.end || sh.rate == 0 {
+		return nil
+	}
+	z.samples = sf.samples[z.start:z.end]
+	if z.loopStart < 0 || z.loopEnd > len(z.samples) || z.loopStart >= z.loopEnd {
+		z.loop = false
+	}
+	z.sampleRate = float64(sh.rate)
+	if z.rootKey < 0 || z.rootKey > 127 {
+		z.rootKey = int(sh.pitch)
+	}
+	z.tune = float64(coarse*100+fine) + float64(sh.correction)
+	if z.release > 10 {
+		z.release = 10
+	}
+	return z
+}
+
+// zone 查找匹配的采样区域, 不存在时返回 nil
+func (sf *SoundFont) zone(bank uint16, program, key, vel uint8) *Zone {
+	zs, ok := sf.presets[bank<<8|uint16(program)]
+	if !ok && bank == 0 {
+		// 退回到第一个旋律音色
+		zs = sf.presets[0]
+	}
+	for _, z := range zs {
+		if key >= z.keyLo && key <= z.keyHi && vel >= z.velLo && vel <= z.velHi {
+			return z
+		}
+	}
+	return nil
+}
+
+func (z *Zone) render(dst []float32, n note, rate float64) {
+	hold := n.end - n.start
+	release := math.Min(z.release, releaseTail)
+	step := math.Pow(2, (float64(int(n.key)-z.rootKey)*100+z.tune)/1200) * z.sampleRate / rate
+	amp := 0.5 * float64(n.velocity) / 127 * n.volume * math.Pow(10, -z.attenuation/20)
+	total := int((hold + release) * rate)
+	if total > len(dst) {
+		total = len(dst)
+	}
+	pos := 0.0
+	for i := 0; i < total; i++ {
+		idx := int(pos)
+		if z.loop && idx >= z.loopEnd {
+			pos -= float64(z.loopEnd - z.loopStart)
+			idx = int(pos)
+		}
+		if idx+1 >= len(z.samples) {
+			break
+		}
+		frac := pos - float64(idx)
+		v := (float64(z.samples[idx])*(1-frac) + float64(z.samples[idx+1])*frac) / 32768
+		t := float64(i) / rate
+		e := 1.0
+		if t > hold {
+			e = 1 - (t-hold)/release
+		}
+		dst[i] += float32(amp * e * v)
+		pos += step
+	}
+}
+
+// walkChunks 递归遍历 RIFF 块, 将叶子块按 id 存入 out
+func walkChunks(data []byte, out map[string][]byte) error {
+	for len(data) >= 8 {
+		id := string(data[0:4])
+		size := int(le32(data[4:]))
+		if size < 0 || 8+size > len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		body := data[8 : 8+size]
+		if id == "LIST" {
+			if len(body) < 4 {
+				return ErrInvalidSoundFont
+			}
+			if err := walkChunks(body[4:], out); err != nil {
+				return err
+			}
+		} else {
+			out[id] = body
+		}
+		size += size & 1
+		if 8+size > len(data) {
+			break
+		}
+		data = data[8+size:]
+	}
+	return nil
+}
+
+func records[T any](data []byte, size int, f func([]byte) T) []T {
+	out := make([]T, 0, len(data)/size)
+	for i := 0; i+size <= len(data); i += size {
+		out = append(out, f(data[i:i+size]))
+	}
+	return out
+}
+
+func le16(b []byte) uint16 { return binary.LittleEndian.Uint16(b) }
+func le32(b []byte) uint32 { return binary.LittleEndian.Uint32(b) }
+
+func max8(a, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
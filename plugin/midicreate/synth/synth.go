@@ -0,0 +1,228 @@
+// Package synth 纯Go实现的简易midi合成器, 可将smf渲染为wav
+package synth
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+const (
+	// DefaultSampleRate 默认采样率
+	DefaultSampleRate = 22050
+	// drumChannel GM 规范中的打击乐通道
+	drumChannel = 9
+	// maxDuration 渲染的最长时间(秒), 防止恶意输入占满内存
+	maxDuration = 600.0
+)
+
+var (
+	// ErrSMPTE 不支持 SMPTE 时间格式
+	ErrSMPTE = errors.New("不支持SMPTE时间格式的midi文件")
+	// ErrTooLong 乐曲过长
+	ErrTooLong = errors.New("乐曲过长, 最长支持10分钟")
+)
+
+// Synth 合成器
+type Synth struct {
+	// SampleRate 输出采样率
+	SampleRate int
+	// Font 可选的音色库, 为空或缺少对应音色时使用内置振荡器
+	Font *SoundFont
+}
+
+// New 新建合成器, sampleRate <= 0 时使用默认采样率
+func New(sampleRate int, font *SoundFont) *Synth {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &Synth{SampleRate: sampleRate, Font: font}
+}
+
+// note 一个已解析的音符
+type note struct {
+	start, end float64 // 秒
+	channel    uint8
+	key        uint8
+	velocity   uint8
+	program    uint8
+	volume     float64
+}
+
+type tempoPoint struct {
+	tick int64
+	bpm  float64
+	sec  float64 // 此点对应的绝对时间
+}
+
+// tempoMap 将绝对tick换算为秒
+type tempoMap struct {
+	resolution float64
+	points     []tempoPoint
+}
+
+func newTempoMap(s *smf.SMF) (*tempoMap, error) {
+	mt, ok := s.TimeFormat.(smf.MetricTicks)
+	if !ok {
+		return nil, ErrSMPTE
+	}
+	tm := &tempoMap{resolution: float64(mt.Resolution())}
+	if tm.resolution == 0 {
+		tm.resolution = 960
+	}
+	for _, tr := range s.Tracks {
+		var abs int64
+		for _, ev := range tr {
+			abs += int64(ev.Delta)
+			var bpm float64
+			if ev.Message.GetMetaTempo(&bpm) && bpm > 0 {
+				tm.points = append(tm.points, tempoPoint{tick: abs, bpm: bpm})
+			}
+		}
+	}
+	sort.SliceStable(tm.points, func(i, j int) bool { return tm.points[i].tick < tm.points[j].tick })
+	if len(tm.points) == 0 || tm.points[0].tick > 0 {
+		tm.points = append([]tempoPoint{{tick: 0, bpm: 120}}, tm.points...)
+	}
+	for i := 1; i < len(tm.points); i++ {
+		prev := tm.points[i-1]
+		tm.points[i].sec = prev.sec + float64(tm.points[i].tick-prev.tick)/tm.resolution*60/prev.bpm
+	}
+	return tm, nil
+}
+
+func (tm *tempoMap) seconds(tick int64) float64 {
+	i := sort.Search(len(tm.points), func(i int) bool { return tm.points[i].tick > tick }) - 1
+	if i < 0 {
+		i = 0
+	}
+	p := tm.points[i]
+	return p.sec + float64(tick-p.tick)/tm.resolution*60/p.bpm
+}
+
+// collect 从所有轨道中解析出音符
+func collect(s *smf.SMF) ([]note, error) {
+	tm, err := newTempoMap(s)
+	if err != nil {
+		return nil, err
+	}
+	var notes []note
+	for _, tr := range s.Tracks {
+		var (
+			abs      int64
+			programs [16]uint8
+			volumes  [16]float64
+			pending  = make(map[uint16][]note)
+		)
+		for i := range volumes {
+			volumes[i] = 100.0 / 127
+		}
+		for _, ev := range tr {
+			abs += int64(ev.Delta)
+			var ch, key, vel, prog, cc, val uint8
+			switch {
+			case ev.Message.GetNoteStart(&ch, &key, &vel):
+				id := uint16(ch)<<8 | uint16(key)
+				pending[id] = append(pending[id], note{
+					start: tm.seconds(abs), channel: ch, key: key, velocity: vel,
+					program: programs[ch], volume: volumes[ch],
+				})
+			case ev.Message.GetNoteEnd(&ch, &key):
+				id := uint16(ch)<<8 | uint16(key)
+				if len(pending[id]) == 0 {
+					continue
+				}
+				n := pending[id][0]
+				pending[id] = pending[id][1:]
+				n.end = tm.seconds(abs)
+				notes = append(notes, n)
+			case ev.Message.GetProgramChange(&ch, &prog):
+				programs[ch] = prog
+			case ev.Message.GetControlChange(&ch, &cc, &val):
+				if cc == 7 {
+					volumes[ch] = float64(val) / 127
+				}
+			}
+		}
+		// 未关闭的音符在轨道末尾结束
+		end := tm.seconds(abs)
+		for _, ns := range pending {
+			for _, n := range ns {
+				n.end = end
+				notes = append(notes, n)
+			}
+		}
+	}
+	for _, n := range notes {
+		if n.end > maxDuration {
+			return nil, ErrTooLong
+		}
+	}
+	return notes, nil
+}
+
+// Render 将 smf 渲染为单声道 PCM, 取值范围 [-1, 1]
+func (sy *Synth) Render(s *smf.SMF) ([]float32, error) {
+	notes, err := collect(s)
+	if err != nil {
+		return nil, err
+	}
+	rate := float64(sy.SampleRate)
+	var length float64
+	for _, n := range notes {
+		if n.end+releaseTail > length {
+			length = n.end + releaseTail
+		}
+	}
+	buf := make([]float32, int(length*rate)+1)
+	for _, n := range notes {
+		v := sy.voice(n)
+		v.render(buf[int(n.start*rate):], n, rate)
+	}
+	normalize(buf)
+	return buf, nil
+}
+
+// RenderWAV 将 smf 渲染为 16 位单声道 wav 写入 w
+func (sy *Synth) RenderWAV(w io.Writer, s *smf.SMF) error {
+	pcm, err := sy.Render(s)
+	if err != nil {
+		return err
+	}
+	return WriteWAV(w, pcm, sy.SampleRate)
+}
+
+// voice 选择音符使用的发声器, 优先使用音色库
+func (sy *Synth) voice(n note) voice {
+	if sy.Font != nil {
+		var bank uint16
+		if n.channel == drumChannel {
+			bank = 128
+		}
+		if z := sy.Font.zone(bank, n.program, n.key, n.velocity); z != nil {
+			return z
+		}
+	}
+	if n.channel == drumChannel {
+		return drum{}
+	}
+	return builtin(n.program)
+}
+
+// normalize 超过满幅时整体缩放, 避免爆音
+func normalize(buf []float32) {
+	var peak float64
+	for _, v := range buf {
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if peak <= 0.9 {
+		return
+	}
+	k := float32(0.9 / peak)
+	for i := range buf {
+		buf[i] *= k
+	}
+}
@@ -0,0 +1,81 @@
+package synth
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+func testSMF(t *testing.T, program uint8) *smf.SMF {
+	var (
+		clock smf.MetricTicks
+		tr    smf.Track
+	)
+	tr.Add(0, smf.MetaTempo(120))
+	tr.Add(0, midi.ProgramChange(0, program))
+	tr.Add(0, midi.NoteOn(0, 60, 100))
+	tr.Add(clock.Ticks4th(), midi.NoteOff(0, 60))
+	tr.Add(0, midi.NoteOn(0, 67, 100))
+	tr.Add(clock.Ticks4th(), midi.NoteOff(0, 67))
+	tr.Close(0)
+	s := smf.New()
+	s.TimeFormat = clock
+	if err := s.Add(tr); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, err := smf.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRender(t *testing.T) {
+	sy := New(0, nil)
+	for _, program := range []uint8{0, 40, 127} {
+		pcm, err := sy.Render(testSMF(t, program))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 两个四分音符 @120bpm = 1s, 加上释放时间
+		want := int((1 + releaseTail) * DefaultSampleRate)
+		if len(pcm) < want-1 || len(pcm) > want+1 {
+			t.Fatalf("program %d: got %d samples, want %d", program, len(pcm), want)
+		}
+		var peak float32
+		for _, v := range pcm {
+			if v > peak {
+				peak = v
+			}
+		}
+		if peak == 0 || peak > 1 {
+			t.Fatalf("program %d: bad peak %f", program, peak)
+		}
+	}
+}
+
+func TestRenderWAV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New(8000, nil).RenderWAV(&buf, testSMF(t, 0)); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" || string(b[36:40]) != "data" {
+		t.Fatal("invalid wav header")
+	}
+	if len(b) != 44+(int((1+releaseTail)*8000)+1)*2 {
+		t.Fatal("unexpected wav size", len(b))
+	}
+}
+
+func TestParseSoundFont(t *testing.T) {
+	if _, err := ParseSoundFont([]byte("RIFF\x04\x00\x00\x00WAVE")); err != ErrInvalidSoundFont {
+		t.Fatal("expected ErrInvalidSoundFont, got", err)
+	}
+}
@@ -0,0 +1,39 @@
+package synth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WriteWAV 将 PCM 以 16 位单声道 wav 格式写入 w
+func WriteWAV(w io.Writer, pcm []float32, sampleRate int) error {
+	bw := bufio.NewWriter(w)
+	dataSize := uint32(len(pcm) * 2)
+	hdr := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1),              // PCM
+		uint16(1),              // 声道数
+		uint32(sampleRate),     // 采样率
+		uint32(sampleRate * 2), // 字节率
+		uint16(2),              // 块对齐
+		uint16(16),             // 位深
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+	for _, v := range hdr {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	var b [2]byte
+	for _, v := range pcm {
+		s := math.Max(-1, math.Min(1, float64(v)))
+		binary.LittleEndian.PutUint16(b[:], uint16(int16(s*32767)))
+		if _, err := bw.Write(b[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
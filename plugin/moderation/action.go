@@ -0,0 +1,198 @@
+package moderation
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/FloatTech/ttl"
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
+)
+
+// blockttl 屏蔽缓存的默认时长, 实际时长通过 Touch 调整
+const blockttl = time.Minute
+
+var (
+	managers *ctrl.Manager[*zero.Ctx] // managers lazy load
+	blocked  = ttl.NewCacheOn(blockttl, [4]func(int64, struct{}){nil, nil, onUnblock, nil})
+)
+
+func onUnblock(uid int64, _ struct{}) {
+	if managers == nil {
+		return
+	}
+	if err := managers.DoUnblock(uid); err != nil {
+		logrus.Errorln("[moderation.onUnblock] unblock:", err)
+	}
+	if err := db.delBlock(uid); err != nil {
+		logrus.Errorln("[moderation.onUnblock] db:", err)
+	}
+}
+
+// restoreBlocks 恢复重启前的屏蔽, 已到期的直接解除
+func restoreBlocks() error {
+	bs, err := db.blocks()
+	if err != nil {
+		return err
+	}
+	for _, b := range bs {
+		d := time.Until(time.Unix(b.Until, 0))
+		if d < time.Second {
+			onUnblock(b.UserID, struct{}{})
+			continue
+		}
+		blocked.Set(b.UserID, struct{}{})
+		blocked.Touch(b.UserID, d-blockttl)
+	}
+	return nil
+}
+
+func block(uid int64, minutes int64) error {
+	err := managers.DoBlock(uid)
+	if err != nil {
+		return err
+	}
+	d := time.Duration(minutes) * time.Minute
+	blocked.Set(uid, struct{}{})
+	blocked.Touch(uid, d-blockttl)
+	return db.addBlock(uid, time.Now().Add(d))
+}
+
+// punish 对违规消息执行所有结论合并后的处置并写入记录
+func punish(ctx *zero.Ctx, c *pipeline.Content, verdicts []pipeline.Verdict) {
+	var (
+		all     pipeline.Action
+		bantime int64
+		entries = make([]*logEntry, 0, len(verdicts))
+	)
+	for _, v := range verdicts {
+		d, ok := pipeline.Lookup(v.Detector)
+		if !ok {
+			continue
+		}
+		p, _ := db.policy(c.GroupID, d, v.Level)
+		e := &logEntry{
+			GroupID:  c.GroupID,
+			UserID:   c.UserID,
+			Detector: v.Detector,
+			Category: v.Category,
+			Level:    uint8(v.Level),
+			Detail:   v.Detail,
+			Content:  abbr(c),
+			Actions:  uint8(p.Actions),
+		}
+		if p.Actions&(pipeline.ActBan|pipeline.ActBlock) != 0 {
+			e.BanTime = p.Duration(db.punished(c.GroupID, c.UserID, v.Detector, p) + 1)
+			if e.BanTime > bantime {
+				bantime = e.BanTime
+			}
+		}
+		err := db.addLog(e)
+		if err != nil {
+			logrus.Warnln("[moderation] 写入记录失败:", err)
+		}
+		all |= p.Actions
+		entries = append(entries, e)
+	}
+	if all == 0 {
+		return
+	}
+	if all&pipeline.ActRecall != 0 {
+		ctx.DeleteMessage(ctx.Event.MessageID)
+	}
+	if all&pipeline.ActKick != 0 {
+		ctx.SetThisGroupKick(c.UserID, false)
+	} else if all&pipeline.ActBan != 0 && bantime > 0 {
+		ctx.SetThisGroupBan(c.UserID, bantime*60)
+	}
+	if all&pipeline.ActBlock != 0 && bantime > 0 {
+		if err := block(c.UserID, bantime); err != nil {
+			ctx.SendChain(message.Text("ERROR: block user: ", err))
+		}
+	}
+	if all&pipeline.ActWarn != 0 {
+		msg := message.Message{message.At(c.UserID)}
+		for _, e := range entries {
+			msg = append(msg, message.Text("\n[", e.ID, "]检测到", pipeline.Level(e.Level), "内容: ", e.Category))
+			if e.Detail != "" {
+				msg = append(msg, message.Text("(", e.Detail, ")"))
+			}
+			if pipeline.Action(e.Actions)&^(pipeline.ActWarn|pipeline.ActReport) != 0 {
+				msg = append(msg, message.Text(", 已", pipeline.Action(e.Actions)&^(pipeline.ActWarn|pipeline.ActReport)))
+			}
+		}
+		msg = append(msg, message.Text("\n如有异议可发送 申诉[编号] [理由]"))
+		ctx.Send(msg)
+	}
+	if all&pipeline.ActReport != 0 {
+		for _, e := range entries {
+			if pipeline.Action(e.Actions)&pipeline.ActReport != 0 {
+				report(ctx, "审核上报", e)
+			}
+		}
+	}
+}
+
+// reporters 群的上报对象, 未设置时为群主与管理员
+func reporters(ctx *zero.Ctx, gid int64) []int64 {
+	if uids := db.reporters(gid); len(uids) > 0 {
+		return uids
+	}
+	var uids []int64
+	for _, m := range ctx.GetGroupMemberList(gid).Array() {
+		uid := m.Get("user_id").Int()
+		if r := m.Get("role").String(); (r == "owner" || r == "admin") && uid != ctx.Event.SelfID {
+			uids = append(uids, uid)
+		}
+	}
+	return uids
+}
+
+// report 将记录私聊发送给群的上报对象
+func report(ctx *zero.Ctx, title string, e *logEntry) {
+	txt := title + "\n编号: " + strconv.FormatInt(e.ID, 10) +
+		"\n群: " + strconv.FormatInt(e.GroupID, 10) +
+		"\n用户: " + strconv.FormatInt(e.UserID, 10) +
+		"\n检测器: " + e.Detector +
+		"\n类型: " + pipeline.Level(e.Level).String() + " " + e.Category +
+		"\n处置: " + pipeline.Action(e.Actions).String() +
+		"\n内容: " + e.Content
+	if e.Appeal != "" {
+		txt += "\n申诉理由: " + e.Appeal
+	}
+	for _, uid := range reporters(ctx, e.GroupID) {
+		ctx.SendPrivateMessage(uid, message.Text(txt))
+	}
+}
+
+// undo 撤销记录中的禁言与屏蔽, 踢出无法撤销
+func undo(ctx *zero.Ctx, e *logEntry) error {
+	a := pipeline.Action(e.Actions)
+	if a&pipeline.ActBan != 0 {
+		ctx.SetGroupBan(e.GroupID, e.UserID, 0)
+	}
+	if a&pipeline.ActBlock != 0 {
+		// 立即解除, 缓存项留给 gc 清理
+		onUnblock(e.UserID, struct{}{})
+		blocked.Touch(e.UserID, -time.Duration(e.BanTime)*time.Minute-blockttl)
+	}
+	e.Undone = true
+	return db.updateLog(e)
+}
+
+// abbr 记录中保存的消息摘要
+func abbr(c *pipeline.Content) string {
+	s := []rune(c.Text)
+	if len(s) > 100 {
+		s = append(s[:100], '…')
+	}
+	txt := string(s)
+	if len(c.Images) > 0 {
+		txt += "[图片x" + strconv.Itoa(len(c.Images)) + "]"
+	}
+	return txt
+}
@@ -0,0 +1,309 @@
+// Package moderation 统一内容审核, 将各检测插件的结论按群策略处置并记录
+package moderation
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/binary"
+	fcext "github.com/FloatTech/floatbox/ctxext"
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
+)
+
+var errBanTooLong = errors.New("禁言时间不能超过43200分钟")
+
+func init() {
+	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+		DisableOnDefault: false,
+		Brief:            "统一内容审核",
+		Help: "##检测器## antiabuse(违禁词), baiduaudit(百度内容审核), nsfwauto(nsfw图片), 需分别启用, 本插件在群内禁用时 antiabuse 与 nsfwauto 按原先的方式自行处置\n" +
+			"##动作## 警告 撤回 禁言 屏蔽 踢出 上报\n" +
+			"- [群管] 查看审核策略\n" +
+			"- [群管] 设置审核策略[检测器] [违规|疑似] [动作...] [禁言N] [累加] [上限N] [衰减N]\n" +
+			"例: 设置审核策略antiabuse 违规 撤回 禁言10 累加 上限60 衰减24 上报\n" +
+			"注: 累加时禁言时间为 禁言N×历史处罚次数, 衰减N 表示历史处罚每N小时权重减半\n" +
+			"- [群管] 重置审核策略[检测器]\n" +
+			"- [群管] 设置上报对象[qq号...] (不填时恢复为群主与管理员)\n" +
+			"- [群管] 查看审核记录[@xxx|qq号]\n" +
+			"- [群管] 撤销处罚[编号]\n" +
+			"- 申诉[编号] [理由]",
+		PrivateDataFolder: "moderation",
+	})
+
+	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+		managers = ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).Manager
+		err := db.init(engine.DataFolder() + "moderation.db")
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return false
+		}
+		err = restoreBlocks()
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return false
+		}
+		return true
+	})
+	pipeline.SetJournal(db, getdb)
+	pipeline.SetActive(engine.IsEnabledIn)
+
+	engine.OnMessage(zero.OnlyGroup, getdb).SetBlock(false).Handle(func(ctx *zero.Ctx) {
+		if ctx.Event.UserID == ctx.Event.SelfID {
+			return
+		}
+		c := &pipeline.Content{
+			GroupID: ctx.Event.GroupID,
+			UserID:  ctx.Event.UserID,
+			ToMe:    ctx.Event.IsToMe,
+			Text:    ctx.ExtractPlainText(),
+		}
+		for _, elem := range ctx.Event.Message {
+			if elem.Type == "image" && elem.Data["url"] != "" {
+				c.Images = append(c.Images, elem.Data["url"])
+			}
+		}
+		if c.Text == "" && len(c.Images) == 0 {
+			return
+		}
+		verdicts := pipeline.Check(ctx, c)
+		if len(verdicts) == 0 {
+			return
+		}
+		punish(ctx, c, verdicts)
+	})
+
+	engine.OnFullMatch("查看审核策略", zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		var sb strings.Builder
+		sb.WriteString("本群审核策略:")
+		for _, d := range pipeline.Detectors() {
+			sb.WriteString("\n\n")
+			sb.WriteString(d.Name())
+			if d.Enabled(ctx.Event.GroupID) {
+				sb.WriteString(" (已启用)")
+			} else {
+				sb.WriteString(" (未启用)")
+			}
+			for _, lv := range [...]pipeline.Level{pipeline.Violation, pipeline.Suspect} {
+				p, custom := db.policy(ctx.Event.GroupID, d, lv)
+				sb.WriteString("\n-")
+				sb.WriteString(lv.String())
+				sb.WriteString(": ")
+				sb.WriteString(p.String())
+				if !custom {
+					sb.WriteString(" [默认]")
+				}
+			}
+		}
+		b, err := text.RenderToBase64(sb.String(), text.FontFile, 500, 20)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Image("base64://" + binary.BytesToString(b)))
+	})
+
+	engine.OnRegex(`^设置审核策略\s*(\S+)\s+(违规|疑似)\s*(.*)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		match := ctx.State["regex_matched"].([]string)
+		if _, ok := pipeline.Lookup(match[1]); !ok {
+			ctx.SendChain(message.Text("ERROR: 没有名为", match[1], "的检测器"))
+			return
+		}
+		lv, _ := pipeline.ParseLevel(match[2])
+		p, err := parsePolicy(match[3])
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		err = db.setPolicy(ctx.Event.GroupID, match[1], lv, p)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("本群", match[1], lv, "的处置已设置为: ", p))
+	})
+
+	engine.OnPrefix("重置审核策略", zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		name := strings.TrimSpace(ctx.State["args"].(string))
+		if _, ok := pipeline.Lookup(name); !ok {
+			ctx.SendChain(message.Text("ERROR: 没有名为", name, "的检测器"))
+			return
+		}
+		err := db.resetPolicy(ctx.Event.GroupID, name)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("成功"))
+	})
+
+	engine.OnRegex(`^设置上报对象\s*((?:\d+\s*)*)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		var uids []int64
+		for _, s := range strings.Fields(ctx.State["regex_matched"].([]string)[1]) {
+			uid, _ := strconv.ParseInt(s, 10, 64)
+			uids = append(uids, uid)
+		}
+		err := db.setReporters(ctx.Event.GroupID, uids)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if len(uids) == 0 {
+			ctx.SendChain(message.Text("本群上报将私聊发送给群主与管理员"))
+			return
+		}
+		ctx.SendChain(message.Text("本群上报将私聊发送给", ctx.State["regex_matched"].([]string)[1]))
+	})
+
+	engine.OnRegex(`^查看审核记录\s*(\[CQ:at,qq=(\d+)\]|(\d+))?`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		match := ctx.State["regex_matched"].([]string)
+		var uid int64
+		if match[2] != "" {
+			uid, _ = strconv.ParseInt(match[2], 10, 64)
+		} else if match[3] != "" {
+			uid, _ = strconv.ParseInt(match[3], 10, 64)
+		}
+		es, err := db.logs(ctx.Event.GroupID, uid, 10)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if len(es) == 0 {
+			ctx.SendChain(message.Text("没有审核记录"))
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("最近的审核记录:")
+		for _, e := range es {
+			sb.WriteString("\n\n[")
+			sb.WriteString(strconv.FormatInt(e.ID, 10))
+			sb.WriteString("] ")
+			sb.WriteString(time.Unix(e.Time, 0).Format("01-02 15:04"))
+			sb.WriteString(" ")
+			sb.WriteString(strconv.FormatInt(e.UserID, 10))
+			sb.WriteString("\n")
+			sb.WriteString(e.Detector)
+			sb.WriteString(" ")
+			sb.WriteString(pipeline.Level(e.Level).String())
+			sb.WriteString(" ")
+			sb.WriteString(e.Category)
+			if e.Detail != "" {
+				sb.WriteString("(")
+				sb.WriteString(e.Detail)
+				sb.WriteString(")")
+			}
+			sb.WriteString("\n处置: ")
+			sb.WriteString(pipeline.Action(e.Actions).String())
+			if e.BanTime > 0 {
+				sb.WriteString(" ")
+				sb.WriteString(strconv.FormatInt(e.BanTime, 10))
+				sb.WriteString("分钟")
+			}
+			if e.Undone {
+				sb.WriteString(" (已撤销)")
+			}
+			sb.WriteString("\n内容: ")
+			sb.WriteString(e.Content)
+			if e.Appeal != "" {
+				sb.WriteString("\n申诉: ")
+				sb.WriteString(e.Appeal)
+			}
+		}
+		b, err := text.RenderToBase64(sb.String(), text.FontFile, 500, 20)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Image("base64://" + binary.BytesToString(b)))
+	})
+
+	engine.OnRegex(`^撤销处罚\s*(\d+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+		e, err := db.getLog(id)
+		if err != nil || e.GroupID != ctx.Event.GroupID {
+			ctx.SendChain(message.Text("ERROR: 本群没有编号为", id, "的记录"))
+			return
+		}
+		if e.Undone {
+			ctx.SendChain(message.Text("该处罚已经撤销过了"))
+			return
+		}
+		err = undo(ctx, &e)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		msg := message.Message{message.Text("已撤销"), message.At(e.UserID), message.Text(" 的处罚[", id, "]")}
+		if pipeline.Action(e.Actions)&pipeline.ActKick != 0 {
+			msg = append(msg, message.Text(", 踢出无法撤销, 请重新邀请"))
+		}
+		ctx.Send(msg)
+	})
+
+	engine.OnRegex(`^申诉\s*(\d+)\s*(.*)$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		match := ctx.State["regex_matched"].([]string)
+		id, _ := strconv.ParseInt(match[1], 10, 64)
+		e, err := db.getLog(id)
+		if err != nil || e.GroupID != ctx.Event.GroupID || e.UserID != ctx.Event.UserID {
+			ctx.SendChain(message.Text("ERROR: 你在本群没有编号为", id, "的记录"))
+			return
+		}
+		if e.Undone {
+			ctx.SendChain(message.Text("该处罚已经撤销了"))
+			return
+		}
+		reason := strings.TrimSpace(match[2])
+		if reason == "" {
+			reason = "无"
+		}
+		e.Appeal = reason
+		err = db.updateLog(&e)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		report(ctx, "审核申诉", &e)
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("申诉已提交, 群管理可发送 撤销处罚", id, " 撤销"))
+	})
+}
+
+// parsePolicy 解析 "撤回 禁言10 累加 上限60 衰减24" 形式的策略
+func parsePolicy(s string) (p pipeline.Policy, err error) {
+	for _, tok := range strings.Fields(s) {
+		switch {
+		case tok == "累加":
+			p.Accumulate = true
+		case strings.HasPrefix(tok, "衰减"):
+			p.HalfLife, err = strconv.ParseInt(strings.TrimPrefix(tok, "衰减"), 10, 64)
+		case strings.HasPrefix(tok, "上限"):
+			p.MaxBanTime, err = strconv.ParseInt(strings.TrimPrefix(tok, "上限"), 10, 64)
+		case strings.HasPrefix(tok, "禁言") && tok != "禁言":
+			p.Actions |= pipeline.ActBan
+			p.BanTime, err = strconv.ParseInt(strings.TrimPrefix(tok, "禁言"), 10, 64)
+		default:
+			a, ok := pipeline.ParseAction(tok)
+			if !ok {
+				return p, errors.New("未知的动作: " + tok)
+			}
+			p.Actions |= a
+		}
+		if err != nil {
+			return
+		}
+	}
+	if p.Actions&(pipeline.ActBan|pipeline.ActBlock) != 0 && p.BanTime <= 0 {
+		p.BanTime = 10
+	}
+	if p.BanTime > 43200 || p.MaxBanTime > 43200 {
+		return p, errBanTooLong
+	}
+	return
+}
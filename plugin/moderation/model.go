@@ -0,0 +1,318 @@
+package moderation
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
+)
+
+const (
+	logTable    = "log"
+	policyTable = "policy"
+	blockTable  = "block"
+	reportTable = "reporter"
+)
+
+// moddb 审核数据库
+type moddb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// logEntry 一条审核记录
+type logEntry struct {
+	ID       int64  `db:"id"` // 自增编号, 用于撤销与申诉
+	Time     int64  `db:"time"`
+	GroupID  int64  `db:"gid"`
+	UserID   int64  `db:"uid"`
+	Detector string `db:"detector"`
+	Category string `db:"category"`
+	Level    uint8  `db:"level"`
+	Detail   string `db:"detail"`
+	Content  string `db:"content"`
+	Actions  uint8  `db:"actions"`
+	BanTime  int64  `db:"bantime"` // 实际禁言分钟数
+	Undone   bool   `db:"undone"`
+	Appeal   string `db:"appeal"`
+}
+
+// policyItem 群设置的处置策略
+type policyItem struct {
+	ID         string `db:"id"` // gid/detector/level
+	GroupID    int64  `db:"gid"`
+	Detector   string `db:"detector"`
+	Level      uint8  `db:"level"`
+	Actions    uint8  `db:"actions"`
+	BanTime    int64  `db:"bantime"`
+	Accumulate bool   `db:"accumulate"`
+	MaxBanTime int64  `db:"maxbantime"`
+	HalfLife   int64  `db:"halflife"`
+}
+
+// blockItem 被屏蔽的用户, 到期自动解除
+type blockItem struct {
+	UserID int64 `db:"uid"`
+	Until  int64 `db:"until"`
+}
+
+// reportItem 群设置的上报对象
+type reportItem struct {
+	GroupID int64  `db:"gid"`
+	Targets string `db:"targets"` // 空格分隔的 qq 号
+}
+
+var db = &moddb{}
+
+func (mdb *moddb) init(path string) error {
+	mdb.DBPath = path
+	err := mdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(logTable, &logEntry{})
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(policyTable, &policyItem{})
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(blockTable, &blockItem{})
+	if err != nil {
+		return err
+	}
+	return mdb.Create(reportTable, &reportItem{})
+}
+
+// reporters 群设置的上报对象, 未设置时为空
+func (mdb *moddb) reporters(gid int64) (uids []int64) {
+	mdb.RLock()
+	var item reportItem
+	err := mdb.Find(reportTable, &item, "WHERE gid = "+strconv.FormatInt(gid, 10))
+	mdb.RUnlock()
+	if err != nil {
+		return nil
+	}
+	for _, s := range strings.Fields(item.Targets) {
+		if uid, err := strconv.ParseInt(s, 10, 64); err == nil {
+			uids = append(uids, uid)
+		}
+	}
+	return
+}
+
+// setReporters 设置群的上报对象, uids 为空时恢复为群主与管理员
+func (mdb *moddb) setReporters(gid int64, uids []int64) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	if len(uids) == 0 {
+		err := mdb.Del(reportTable, "WHERE gid = "+strconv.FormatInt(gid, 10))
+		if err == sql.ErrNullResult {
+			err = nil
+		}
+		return err
+	}
+	targets := make([]string, len(uids))
+	for i, uid := range uids {
+		targets[i] = strconv.FormatInt(uid, 10)
+	}
+	return mdb.Insert(reportTable, &reportItem{GroupID: gid, Targets: strings.Join(targets, " ")})
+}
+
+func policyID(gid int64, detector string, lv pipeline.Level) string {
+	return strconv.FormatInt(gid, 10) + "/" + detector + "/" + strconv.Itoa(int(lv))
+}
+
+// policy 群内生效的策略, 未设置时使用检测器的默认策略
+func (mdb *moddb) policy(gid int64, d pipeline.Detector, lv pipeline.Level) (p pipeline.Policy, custom bool) {
+	mdb.RLock()
+	var item policyItem
+	err := mdb.Find(policyTable, &item, "WHERE id = '"+policyID(gid, d.Name(), lv)+"'")
+	mdb.RUnlock()
+	if err != nil {
+		return pipeline.DefaultPolicy(d, gid, lv), false
+	}
+	return pipeline.Policy{
+		Actions:    pipeline.Action(item.Actions),
+		BanTime:    item.BanTime,
+		Accumulate: item.Accumulate,
+		MaxBanTime: item.MaxBanTime,
+		HalfLife:   item.HalfLife,
+	}, true
+}
+
+func (mdb *moddb) setPolicy(gid int64, detector string, lv pipeline.Level, p pipeline.Policy) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(policyTable, &policyItem{
+		ID:         policyID(gid, detector, lv),
+		GroupID:    gid,
+		Detector:   detector,
+		Level:      uint8(lv),
+		Actions:    uint8(p.Actions),
+		BanTime:    p.BanTime,
+		Accumulate: p.Accumulate,
+		MaxBanTime: p.MaxBanTime,
+		HalfLife:   p.HalfLife,
+	})
+}
+
+func (mdb *moddb) resetPolicy(gid int64, detector string) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Del(policyTable, "WHERE gid = "+strconv.FormatInt(gid, 10)+" AND detector = '"+detector+"'")
+}
+
+// punished 用户在群内被某检测器禁言且未撤销的次数, 按策略的半衰期衰减
+func (mdb *moddb) punished(gid, uid int64, detector string, p pipeline.Policy) (n float64) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	var e logEntry
+	now := time.Now()
+	_ = mdb.FindFor(logTable, &e, "WHERE gid = "+strconv.FormatInt(gid, 10)+" AND uid = "+strconv.FormatInt(uid, 10)+
+		" AND detector = '"+detector+"' AND undone = 0 AND actions & "+strconv.Itoa(int(pipeline.ActBan|pipeline.ActBlock))+" != 0", func() error {
+		n += p.Weight(now.Sub(time.Unix(e.Time, 0)))
+		return nil
+	})
+	return
+}
+
+// addLog 写入记录并分配编号
+func (mdb *moddb) addLog(e *logEntry) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	var last logEntry
+	_ = mdb.Find(logTable, &last, "ORDER BY id DESC LIMIT 1")
+	e.ID = last.ID + 1
+	e.Time = time.Now().Unix()
+	return mdb.Insert(logTable, e)
+}
+
+func (mdb *moddb) getLog(id int64) (e logEntry, err error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	err = mdb.Find(logTable, &e, "WHERE id = "+strconv.FormatInt(id, 10))
+	return
+}
+
+func (mdb *moddb) updateLog(e *logEntry) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(logTable, e)
+}
+
+// logs 群内最近的 n 条记录, uid 为 0 时不限用户
+func (mdb *moddb) logs(gid, uid int64, n int) ([]*logEntry, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	q := "WHERE gid = " + strconv.FormatInt(gid, 10)
+	if uid != 0 {
+		q += " AND uid = " + strconv.FormatInt(uid, 10)
+	}
+	es, err := sql.FindAll[logEntry](&mdb.Sqlite, logTable, q+" ORDER BY id DESC LIMIT "+strconv.Itoa(n))
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return es, err
+}
+
+func (mdb *moddb) addBlock(uid int64, until time.Time) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(blockTable, &blockItem{UserID: uid, Until: until.Unix()})
+}
+
+func (mdb *moddb) delBlock(uid int64) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Del(blockTable, "WHERE uid = "+strconv.FormatInt(uid, 10))
+}
+
+func (mdb *moddb) blocks() ([]*blockItem, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	bs, err := sql.FindAll[blockItem](&mdb.Sqlite, blockTable, "")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return bs, err
+}
+
+// Records 实现 pipeline.Journal
+func (mdb *moddb) Records(gid, uid int64, detector string, n int) ([]pipeline.Record, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	q := "WHERE gid = " + strconv.FormatInt(gid, 10)
+	if uid != 0 {
+		q += " AND uid = " + strconv.FormatInt(uid, 10)
+	}
+	if detector != "" {
+		q += " AND detector = '" + detector + "'"
+	}
+	var (
+		e  logEntry
+		rs []pipeline.Record
+	)
+	err := mdb.FindFor(logTable, &e, q+" ORDER BY id DESC LIMIT "+strconv.Itoa(n), func() error {
+		rs = append(rs, pipeline.Record{
+			ID:       e.ID,
+			Time:     time.Unix(e.Time, 0),
+			GroupID:  e.GroupID,
+			UserID:   e.UserID,
+			Detector: e.Detector,
+			Category: e.Category,
+			Level:    pipeline.Level(e.Level),
+			Detail:   e.Detail,
+			Content:  e.Content,
+			Actions:  pipeline.Action(e.Actions),
+			BanTime:  e.BanTime,
+			Undone:   e.Undone,
+		})
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return rs, err
+}
+
+// Purge 实现 pipeline.Journal
+func (mdb *moddb) Purge(gid int64, detector string, before time.Time) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Del(logTable, "WHERE gid = "+strconv.FormatInt(gid, 10)+
+		" AND detector = '"+detector+"' AND time < "+strconv.FormatInt(before.Unix(), 10))
+}
+
+// Import 按顺序写入迁移的记录并分配编号
+func (mdb *moddb) Import(rs []pipeline.Record) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	var last logEntry
+	_ = mdb.Find(logTable, &last, "ORDER BY id DESC LIMIT 1")
+	for i, r := range rs {
+		err := mdb.Insert(logTable, &logEntry{
+			ID:       last.ID + int64(i) + 1,
+			Time:     r.Time.Unix(),
+			GroupID:  r.GroupID,
+			UserID:   r.UserID,
+			Detector: r.Detector,
+			Category: r.Category,
+			Level:    uint8(r.Level),
+			Detail:   r.Detail,
+			Content:  r.Content,
+			Actions:  uint8(r.Actions),
+			BanTime:  r.BanTime,
+			Undone:   r.Undone,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// Package pipeline 内容审核流水线, 各检测插件在此注册检测器, 由 moderation 插件统一处置
+package pipeline
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Level 检测结果的严重程度
+type Level uint8
+
+const (
+	// Pass 合规
+	Pass Level = iota
+	// Suspect 疑似违规
+	Suspect
+	// Violation 违规
+	Violation
+)
+
+// String 打印严重程度
+func (lv Level) String() string {
+	switch lv {
+	case Suspect:
+		return "疑似"
+	case Violation:
+		return "违规"
+	default:
+		return "合规"
+	}
+}
+
+// ParseLevel 解析严重程度
+func ParseLevel(s string) (Level, bool) {
+	switch s {
+	case "疑似":
+		return Suspect, true
+	case "违规":
+		return Violation, true
+	}
+	return Pass, false
+}
+
+// Action 处置动作, 可按位组合
+type Action uint8
+
+const (
+	// ActWarn 警告
+	ActWarn Action = 1 << iota
+	// ActRecall 撤回
+	ActRecall
+	// ActBan 禁言
+	ActBan
+	// ActBlock 屏蔽, 在禁言时间内不响应该用户
+	ActBlock
+	// ActKick 踢出
+	ActKick
+	// ActReport 上报给超级用户
+	ActReport
+)
+
+var actionNames = [...]string{"警告", "撤回", "禁言", "屏蔽", "踢出", "上报"}
+
+// String 打印所有动作
+func (a Action) String() string {
+	var names []string
+	for i, name := range actionNames {
+		if a&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "无"
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseAction 解析单个动作名
+func ParseAction(s string) (Action, bool) {
+	for i, name := range actionNames {
+		if s == name {
+			return 1 << i, true
+		}
+	}
+	return 0, false
+}
+
+// Policy 对某一检测器某一严重程度的处置策略
+type Policy struct {
+	Actions Action
+	// BanTime 禁言/屏蔽时间, 分钟
+	BanTime int64
+	// Accumulate 按历史处罚次数累加禁言时间
+	Accumulate bool
+	// MaxBanTime 累加禁言时间的上限, 分钟, 0 表示不限
+	MaxBanTime int64
+	// HalfLife 累加时历史处罚的半衰期, 小时, 0 表示不衰减
+	HalfLife int64
+}
+
+// String 打印策略
+func (p Policy) String() string {
+	s := p.Actions.String()
+	if p.Actions&(ActBan|ActBlock) != 0 {
+		s += " " + strconv.FormatInt(p.BanTime, 10) + "分钟"
+		if p.Accumulate {
+			s += " 累加"
+			if p.MaxBanTime > 0 {
+				s += " 上限" + strconv.FormatInt(p.MaxBanTime, 10) + "分钟"
+			}
+			if p.HalfLife > 0 {
+				s += " 衰减" + strconv.FormatInt(p.HalfLife, 10) + "小时"
+			}
+		}
+	}
+	return s
+}
+
+// Weight 距今 age 的历史处罚在累加时的权重
+func (p Policy) Weight(age time.Duration) float64 {
+	if p.HalfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-age.Hours() / float64(p.HalfLife))
+}
+
+// Duration 累计处罚次数为 n (含本次, 可为衰减后的小数) 时的禁言分钟数
+func (p Policy) Duration(n float64) int64 {
+	if !p.Accumulate || n <= 1 {
+		return p.BanTime
+	}
+	t := int64(math.Round(float64(p.BanTime) * n))
+	if p.MaxBanTime > 0 && t > p.MaxBanTime {
+		t = p.MaxBanTime
+	}
+	return t
+}
+
+// Content 送检的一条消息
+type Content struct {
+	GroupID int64
+	UserID  int64
+	// ToMe 消息是否是对 bot 说的
+	ToMe   bool
+	Text   string
+	Images []string
+}
+
+// Verdict 检测器给出的一条结论
+type Verdict struct {
+	Detector string
+	Category string
+	Level    Level
+	// Detail 命中的关键词等详细信息, 可为空
+	Detail string
+}
+
+// Detector 检测器
+type Detector interface {
+	// Name 检测器名, 与所属插件的服务名一致
+	Name() string
+	// Enabled 是否在该群启用
+	Enabled(gid int64) bool
+	// Detect 检测消息, 合规时返回空
+	Detect(ctx *zero.Ctx, c *Content) ([]Verdict, error)
+}
+
+// DefaultPolicer 检测器可提供群内未设置策略时使用的默认策略
+type DefaultPolicer interface {
+	DefaultPolicy(gid int64, lv Level) Policy
+}
+
+// Record 一条处置记录
+type Record struct {
+	ID       int64
+	Time     time.Time
+	GroupID  int64
+	UserID   int64
+	Detector string
+	Category string
+	Level    Level
+	Detail   string
+	Content  string
+	Actions  Action
+	BanTime  int64
+	Undone   bool
+}
+
+// Journal 处置记录的存储, 由 moderation 插件提供
+type Journal interface {
+	// Records 群内用户最近的 n 条记录, detector 为空时不限检测器
+	Records(gid, uid int64, detector string, n int) ([]Record, error)
+	// Purge 删除群内该检测器早于 before 的记录
+	Purge(gid int64, detector string, before time.Time) error
+	// Import 写入从其它存储迁移来的记录, 忽略其编号
+	Import(rs []Record) error
+}
+
+// ErrNoJournal 没有加载 moderation 插件
+var ErrNoJournal = errors.New("pipeline: no journal, moderation plugin not loaded")
+
+var (
+	mu        sync.RWMutex
+	detectors []Detector
+	journal   Journal
+	opener    func(*zero.Ctx) bool
+	active    func(gid int64) bool
+)
+
+// SetActive 设置 moderation 插件是否在群内启用的判断, 由 moderation 插件调用
+func SetActive(enabled func(gid int64) bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	active = enabled
+}
+
+// Active 该群的消息是否由 moderation 插件统一处置, 为 false 时检测插件应按各自原先的方式处置
+func Active(gid int64) bool {
+	mu.RLock()
+	enabled := active
+	mu.RUnlock()
+	return enabled != nil && enabled(gid)
+}
+
+// SetJournal 设置处置记录的存储, open 在首次使用前打开存储, 失败时返回 false
+func SetJournal(j Journal, open func(*zero.Ctx) bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	journal, opener = j, open
+}
+
+// OpenJournal 打开处置记录的存储, 供其它插件作为 Rule 在查询前调用
+func OpenJournal(ctx *zero.Ctx) bool {
+	mu.RLock()
+	open := opener
+	mu.RUnlock()
+	if open == nil {
+		ctx.SendChain(message.Text("ERROR: ", ErrNoJournal))
+		return false
+	}
+	return open(ctx)
+}
+
+// Records 查询处置记录
+func Records(gid, uid int64, detector string, n int) ([]Record, error) {
+	mu.RLock()
+	j := journal
+	mu.RUnlock()
+	if j == nil {
+		return nil, ErrNoJournal
+	}
+	return j.Records(gid, uid, detector, n)
+}
+
+// Purge 删除过期的处置记录
+func Purge(gid int64, detector string, before time.Time) error {
+	mu.RLock()
+	j := journal
+	mu.RUnlock()
+	if j == nil {
+		return ErrNoJournal
+	}
+	return j.Purge(gid, detector, before)
+}
+
+// Import 导入迁移的处置记录
+func Import(rs []Record) error {
+	mu.RLock()
+	j := journal
+	mu.RUnlock()
+	if j == nil {
+		return ErrNoJournal
+	}
+	return j.Import(rs)
+}
+
+// Register 注册检测器, 应在 init 中调用
+func Register(d Detector) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, old := range detectors {
+		if old.Name() == d.Name() {
+			panic("pipeline: detector " + d.Name() + " already registered")
+		}
+	}
+	detectors = append(detectors, d)
+}
+
+// Detectors 所有已注册的检测器
+func Detectors() []Detector {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Detector(nil), detectors...)
+}
+
+// Lookup 按名称查找检测器
+func Lookup(name string) (Detector, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, d := range detectors {
+		if d.Name() == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// DefaultPolicy 检测器未提供默认策略时, 违规撤回并警告, 疑似仅警告
+func DefaultPolicy(d Detector, gid int64, lv Level) Policy {
+	if p, ok := d.(DefaultPolicer); ok {
+		return p.DefaultPolicy(gid, lv)
+	}
+	switch lv {
+	case Violation:
+		return Policy{Actions: ActWarn | ActRecall}
+	case Suspect:
+		return Policy{Actions: ActWarn}
+	}
+	return Policy{}
+}
+
+// Check 用所有在该群启用的检测器检测消息, 检测出错只记录日志
+func Check(ctx *zero.Ctx, c *Content) (verdicts []Verdict) {
+	for _, d := range Detectors() {
+		if !d.Enabled(c.GroupID) {
+			continue
+		}
+		vs, err := d.Detect(ctx, c)
+		if err != nil {
+			logrus.Warnln("[moderation]", d.Name(), "检测失败:", err)
+			continue
+		}
+		for _, v := range vs {
+			if v.Level == Pass {
+				continue
+			}
+			v.Detector = d.Name()
+			verdicts = append(verdicts, v)
+		}
+	}
+	return
+}
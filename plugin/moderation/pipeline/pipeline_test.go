@@ -0,0 +1,47 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyDuration(t *testing.T) {
+	p := Policy{Actions: ActBan, BanTime: 5}
+	if d := p.Duration(3); d != 5 {
+		t.Fatalf("without accumulate expect 5, got %d", d)
+	}
+	p.Accumulate = true
+	if d := p.Duration(3); d != 15 {
+		t.Fatalf("expect 15, got %d", d)
+	}
+	p.MaxBanTime = 12
+	if d := p.Duration(3); d != 12 {
+		t.Fatalf("expect capped 12, got %d", d)
+	}
+	p.HalfLife = 24
+	// 一天前和两天前的处罚分别计 0.5 与 0.25 次
+	n := 1 + p.Weight(24*time.Hour) + p.Weight(48*time.Hour)
+	if d := p.Duration(n); d != 9 {
+		t.Fatalf("expect decayed 9, got %d", d)
+	}
+}
+
+func TestParse(t *testing.T) {
+	var all Action
+	for _, name := range []string{"警告", "撤回", "禁言", "屏蔽", "踢出", "上报"} {
+		a, ok := ParseAction(name)
+		if !ok {
+			t.Fatal("unknown action", name)
+		}
+		all |= a
+	}
+	if all.String() != "警告|撤回|禁言|屏蔽|踢出|上报" {
+		t.Fatal("unexpected actions", all)
+	}
+	if _, ok := ParseAction("罚款"); ok {
+		t.Fatal("expect unknown action")
+	}
+	if lv, ok := ParseLevel("疑似"); !ok || lv != Suspect {
+		t.Fatal("expect Suspect")
+	}
+}
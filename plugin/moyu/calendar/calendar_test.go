@@ -0,0 +1,136 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation(layout, s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestLunar(t *testing.T) {
+	// 各年春节
+	for _, s := range []string{
+		"1950-02-17", "1985-02-20", "2000-02-05", "2001-01-24", "2010-02-14", "2020-01-25",
+		"2021-02-12", "2022-02-01", "2023-01-22", "2024-02-10", "2025-01-29", "2026-02-17",
+		"2027-02-06", "2028-01-26", "2030-02-03",
+	} {
+		d := date(s)
+		l, err := ToLunar(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.Month != 1 || l.Day != 1 || l.Leap || l.Year != d.Year() {
+			t.Fatal(s, "expect 正月初一, got", l)
+		}
+		back, err := FromLunar(l, time.Local)
+		if err != nil || !back.Equal(d) {
+			t.Fatal(s, "round trip failed", back, err)
+		}
+	}
+	l, err := ToLunar(date("2023-04-19"))
+	if err != nil || !l.Leap || l.Month != 2 || l.Day != 29 {
+		t.Fatal("expect 闰二月廿九, got", l, err)
+	}
+	if l, _ := ToLunar(date("2023-04-20")); l.Leap || l.Month != 3 || l.Day != 1 {
+		t.Fatal("expect 三月初一, got", l)
+	}
+	if s := l.String(); s != "癸卯(兔)年闰二月廿九" {
+		t.Fatal("unexpected", s)
+	}
+	if _, err := FromLunar(Lunar{Year: 2024, Month: 2, Day: 1, Leap: true}, time.Local); err != ErrOutOfRange {
+		t.Fatal("2024 has no 闰二月")
+	}
+}
+
+func TestFestivals(t *testing.T) {
+	want := map[string]string{
+		"除夕":  "2025-01-28",
+		"端午节": "2025-05-31",
+		"中秋节": "2025-10-06",
+		"清明节": "2025-04-04",
+		"冬至":  "2025-12-21",
+		"七夕":  "2025-08-29",
+		"腊八节": "2025-01-07",
+	}
+	got := map[string]string{}
+	for _, f := range Festivals(2025, time.Local) {
+		got[f.Name] = f.Date.Format(layout)
+	}
+	for name, d := range want {
+		if got[name] != d {
+			t.Fatal(name, "expect", d, "got", got[name])
+		}
+	}
+	if d := qingming.date(2024, time.Local).Format(layout); d != "2024-04-04" {
+		t.Fatal("unexpected 清明", d)
+	}
+	if d := dongzhi.date(2021, time.Local).Format(layout); d != "2021-12-21" {
+		t.Fatal("unexpected 冬至", d)
+	}
+	f, ok := NextFestival("中秋节", date("2024-09-18"))
+	if !ok || f.Date.Format(layout) != "2025-10-06" {
+		t.Fatal("unexpected next 中秋节", f)
+	}
+}
+
+func TestTable(t *testing.T) {
+	tb := NewTable(Bundled(time.Local)...)
+	cases := map[string]bool{
+		"2025-01-26": true,  // 周日调休上班
+		"2025-01-28": false, // 春节
+		"2025-02-07": true,
+		"2025-02-08": true, // 周六调休上班
+		"2025-02-09": false,
+		"2025-10-08": false,
+		"2025-10-11": true,
+	}
+	for s, want := range cases {
+		if tb.IsWorkday(date(s)) != want {
+			t.Fatal(s, "expect workday", want)
+		}
+	}
+	if d := tb.NextRestDay(date("2025-01-24")).Format(layout); d != "2025-01-25" {
+		t.Fatal("unexpected rest day", d)
+	}
+	if d := tb.NextRestDay(date("2025-01-26")).Format(layout); d != "2025-01-28" {
+		t.Fatal("unexpected rest day", d)
+	}
+	// 2025-10-05 在国庆假期内, 提前到 9 月 30 日
+	if d := tb.Payday(2025, time.October, 5, time.Local).Format(layout); d != "2025-09-30" {
+		t.Fatal("unexpected payday", d)
+	}
+	if d := tb.Payday(2025, time.February, 31, time.Local).Format(layout); d != "2025-02-28" {
+		t.Fatal("unexpected payday", d)
+	}
+	if d := tb.NextPayday(date("2025-03-16"), 15).Format(layout); d != "2025-04-15" {
+		t.Fatal("unexpected next payday", d)
+	}
+	if d := tb.NextPayday(date("2025-10-01"), 5).Format(layout); d != "2025-11-05" {
+		t.Fatal("unexpected next payday", d)
+	}
+	h, ok := tb.Next("春节", date("2025-02-03"))
+	if !ok || h.Start.Format(layout) != "2025-01-28" {
+		t.Fatal("expect ongoing 春节")
+	}
+	h2, err := ParseHoliday(h.String(), time.Local)
+	if err != nil || h2.String() != h.String() {
+		t.Fatal("round trip failed", err)
+	}
+	tb.Set(&Holiday{Name: "春节", Start: date("2025-01-29"), Days: 1})
+	if tb.IsWorkday(date("2025-01-26")) || !tb.IsWorkday(date("2025-01-28")) {
+		t.Fatal("override should replace the old entry")
+	}
+	if !tb.Delete(2025, "春节") || tb.Delete(2025, "春节") {
+		t.Fatal("unexpected delete result")
+	}
+	if _, err := ParseHolidays(strings.NewReader("# c\n\n元旦 2030-01-01 x"), time.Local); err != ErrSyntax {
+		t.Fatal("expect syntax error")
+	}
+}
@@ -0,0 +1,133 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+)
+
+// solarTerm 节气的世纪常数, 用寿星通用公式 [Y×D+C]-L 计算
+type solarTerm struct {
+	month      time.Month
+	c20, c21   float64
+	exceptions map[int]int // 公式计算有误差的年份的修正天数
+}
+
+var (
+	qingming = solarTerm{month: time.April, c20: 5.59, c21: 4.81}
+	dongzhi  = solarTerm{month: time.December, c20: 22.60, c21: 21.94, exceptions: map[int]int{1918: -1, 2021: -1}}
+)
+
+// date 该年的节气日期, 只支持 1901-2100 年
+func (st *solarTerm) date(year int, loc *time.Location) time.Time {
+	y, c := year%100, st.c21
+	if year <= 2000 {
+		c = st.c20
+		if year == 2000 {
+			y = 100
+		}
+	}
+	d := int(float64(y)*0.2422+c) - y/4 + st.exceptions[year]
+	return time.Date(year, st.month, d, 0, 0, 0, 0, loc)
+}
+
+// Festival 一个节日
+type Festival struct {
+	Name string
+	Date time.Time
+	// Lunar 是否为农历节日
+	Lunar bool
+}
+
+type lunarFestival struct {
+	name       string
+	month, day int
+}
+
+var (
+	solarFestivals = []struct {
+		name  string
+		month time.Month
+		day   int
+	}{
+		{"元旦", time.January, 1},
+		{"情人节", time.February, 14},
+		{"妇女节", time.March, 8},
+		{"劳动节", time.May, 1},
+		{"青年节", time.May, 4},
+		{"儿童节", time.June, 1},
+		{"国庆节", time.October, 1},
+		{"平安夜", time.December, 24},
+		{"圣诞节", time.December, 25},
+	}
+	lunarFestivals = []lunarFestival{
+		{"春节", 1, 1},
+		{"元宵节", 1, 15},
+		{"龙抬头", 2, 2},
+		{"端午节", 5, 5},
+		{"七夕", 7, 7},
+		{"中元节", 7, 15},
+		{"中秋节", 8, 15},
+		{"重阳节", 9, 9},
+		{"腊八节", 12, 8},
+		{"小年", 12, 23},
+	}
+)
+
+// Festivals 公历 year 年内的所有节日, 按日期排序
+func Festivals(year int, loc *time.Location) []Festival {
+	fs := make([]Festival, 0, len(solarFestivals)+len(lunarFestivals)+3)
+	for _, f := range solarFestivals {
+		fs = append(fs, Festival{Name: f.name, Date: time.Date(year, f.month, f.day, 0, 0, 0, 0, loc)})
+	}
+	if year > minYear && year <= maxYear {
+		fs = append(fs,
+			Festival{Name: "清明节", Date: qingming.date(year, loc)},
+			Festival{Name: "冬至", Date: dongzhi.date(year, loc)},
+		)
+	}
+	// 腊月的节日可能落在下一个公历年的年初
+	for ly := year - 1; ly <= year; ly++ {
+		for _, f := range lunarFestivals {
+			t, err := FromLunar(Lunar{Year: ly, Month: f.month, Day: f.day}, loc)
+			if err == nil && t.Year() == year {
+				fs = append(fs, Festival{Name: f.name, Date: t, Lunar: true})
+			}
+		}
+		// 除夕为下一年春节的前一天
+		t, err := FromLunar(Lunar{Year: ly + 1, Month: 1, Day: 1}, loc)
+		if err == nil {
+			t = t.AddDate(0, 0, -1)
+			if t.Year() == year {
+				fs = append(fs, Festival{Name: "除夕", Date: t, Lunar: true})
+			}
+		}
+	}
+	sort.SliceStable(fs, func(i, j int) bool {
+		return fs[i].Date.Before(fs[j].Date)
+	})
+	return fs
+}
+
+// NextFestival 今天及以后最近的一次该节日
+func NextFestival(name string, now time.Time) (Festival, bool) {
+	today := Date(now)
+	for y := now.Year(); y <= now.Year()+1; y++ {
+		for _, f := range Festivals(y, now.Location()) {
+			if f.Name == name && !f.Date.Before(today) {
+				return f, true
+			}
+		}
+	}
+	return Festival{}, false
+}
+
+// FestivalsOn 当天的节日
+func FestivalsOn(t time.Time) (names []string) {
+	today := Date(t)
+	for _, f := range Festivals(t.Year(), t.Location()) {
+		if f.Date.Equal(today) {
+			names = append(names, f.Name)
+		}
+	}
+	return
+}
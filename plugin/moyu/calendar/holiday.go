@@ -0,0 +1,238 @@
+package calendar
+
+import (
+	"bufio"
+	_ "embed" // 内置节假日表
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const layout = "2006-01-02"
+
+//go:embed holidays.txt
+var bundled string
+
+// ErrSyntax 节假日格式错误
+var ErrSyntax = errors.New("calendar: 格式应为 名称 放假首日(2006-01-02) 放假天数 [调休上班日,...]")
+
+// Holiday 一次法定节假日安排
+type Holiday struct {
+	Name  string
+	Start time.Time
+	Days  int
+	// Workdays 因该假期调休而上班的日期
+	Workdays []time.Time
+}
+
+// End 假期结束后的第一天
+func (h *Holiday) End() time.Time {
+	return h.Start.AddDate(0, 0, h.Days)
+}
+
+// Contains t 是否在假期内
+func (h *Holiday) Contains(t time.Time) bool {
+	d := Date(t)
+	return !d.Before(h.Start) && d.Before(h.End())
+}
+
+// key 同名假期每年只有一次
+func (h *Holiday) key() string {
+	return strconv.Itoa(h.Start.Year()) + "/" + h.Name
+}
+
+// String 与 ParseHoliday 的格式一致
+func (h *Holiday) String() string {
+	s := h.Name + " " + h.Start.Format(layout) + " " + strconv.Itoa(h.Days)
+	if len(h.Workdays) > 0 {
+		ws := make([]string, len(h.Workdays))
+		for i, w := range h.Workdays {
+			ws[i] = w.Format(layout)
+		}
+		s += " " + strings.Join(ws, ",")
+	}
+	return s
+}
+
+// ParseHoliday 解析一行 名称 放假首日 放假天数 [调休上班日,...]
+func ParseHoliday(line string, loc *time.Location) (*Holiday, error) {
+	fs := strings.Fields(line)
+	if len(fs) < 3 || len(fs) > 4 {
+		return nil, ErrSyntax
+	}
+	start, err := time.ParseInLocation(layout, fs[1], loc)
+	if err != nil {
+		return nil, ErrSyntax
+	}
+	n, err := strconv.Atoi(fs[2])
+	if err != nil || n <= 0 || n > 31 {
+		return nil, ErrSyntax
+	}
+	h := &Holiday{Name: fs[0], Start: start, Days: n}
+	if len(fs) == 4 {
+		for _, s := range strings.Split(fs[3], ",") {
+			w, err := time.ParseInLocation(layout, s, loc)
+			if err != nil {
+				return nil, ErrSyntax
+			}
+			h.Workdays = append(h.Workdays, w)
+		}
+	}
+	return h, nil
+}
+
+// ParseHolidays 逐行解析, 忽略空行与 # 开头的注释
+func ParseHolidays(r io.Reader, loc *time.Location) (hs []*Holiday, err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h, err := ParseHoliday(line, loc)
+		if err != nil {
+			return nil, err
+		}
+		hs = append(hs, h)
+	}
+	return hs, sc.Err()
+}
+
+// Bundled 内置的节假日表
+func Bundled(loc *time.Location) []*Holiday {
+	hs, err := ParseHolidays(strings.NewReader(bundled), loc)
+	if err != nil {
+		panic(err)
+	}
+	return hs
+}
+
+// Table 节假日与调休表
+type Table struct {
+	mu sync.RWMutex
+	hs map[string]*Holiday
+}
+
+// Default 以内置数据初始化的表
+var Default = NewTable(Bundled(time.Local)...)
+
+// NewTable 新建表
+func NewTable(hs ...*Holiday) *Table {
+	t := &Table{hs: make(map[string]*Holiday, len(hs))}
+	for _, h := range hs {
+		t.hs[h.key()] = h
+	}
+	return t
+}
+
+// Set 添加或替换同年同名的假期
+func (t *Table) Set(h *Holiday) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hs[h.key()] = h
+}
+
+// Delete 删除某年的假期
+func (t *Table) Delete(year int, name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := strconv.Itoa(year) + "/" + name
+	_, ok := t.hs[k]
+	delete(t.hs, k)
+	return ok
+}
+
+// Holidays 按日期排序的假期, year 为 0 时返回全部
+func (t *Table) Holidays(year int) []*Holiday {
+	t.mu.RLock()
+	hs := make([]*Holiday, 0, len(t.hs))
+	for _, h := range t.hs {
+		if year == 0 || h.Start.Year() == year {
+			hs = append(hs, h)
+		}
+	}
+	t.mu.RUnlock()
+	sort.Slice(hs, func(i, j int) bool {
+		return hs[i].Start.Before(hs[j].Start)
+	})
+	return hs
+}
+
+// Lookup 当天所在的假期, 或因哪个假期调休上班
+func (t *Table) Lookup(d time.Time) (h *Holiday, adjusted bool) {
+	d = Date(d)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, x := range t.hs {
+		if x.Contains(d) {
+			return x, false
+		}
+		for _, w := range x.Workdays {
+			if Date(w).Equal(d) {
+				return x, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// IsWorkday 是否需要上班: 调休上班日上班, 假期与周末休息
+func (t *Table) IsWorkday(d time.Time) bool {
+	h, adjusted := t.Lookup(d)
+	switch {
+	case adjusted:
+		return true
+	case h != nil:
+		return false
+	}
+	wd := d.Weekday()
+	return wd != time.Saturday && wd != time.Sunday
+}
+
+// NextRestDay 今天及以后第一个不用上班的日子
+func (t *Table) NextRestDay(now time.Time) time.Time {
+	d := Date(now)
+	for i := 0; i < 366 && t.IsWorkday(d); i++ {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// Next 最近一次尚未结束的该假期
+func (t *Table) Next(name string, now time.Time) (*Holiday, bool) {
+	d := Date(now)
+	for _, h := range t.Holidays(0) {
+		if h.Name == name && d.Before(h.End()) {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// Payday 某月的发薪日, 超过当月天数时取月末, 遇休息日提前到之前最近的工作日 (可能落在上月)
+func (t *Table) Payday(year int, month time.Month, day int, loc *time.Location) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	if day > last {
+		day = last
+	}
+	d := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	for i := 0; i < 31 && !t.IsWorkday(d); i++ {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// NextPayday 今天及以后最近的发薪日
+func (t *Table) NextPayday(now time.Time, day int) time.Time {
+	today := Date(now)
+	p := t.Payday(now.Year(), now.Month(), day, now.Location())
+	if p.Before(today) {
+		n := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+		p = t.Payday(n.Year(), n.Month(), day, now.Location())
+	}
+	return p
+}
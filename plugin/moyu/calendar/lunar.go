@@ -0,0 +1,222 @@
+// Package calendar 离线日历: 农历换算, 节日推算与法定节假日/调休表
+package calendar
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// lunarInfo 1900-2100 年的农历数据
+//
+// 低 4 位为闰月月份 (0 为无闰月), 第 5-16 位依次为正月至腊月是否为大月 (30 天),
+// 第 17 位为闰月是否为大月
+var lunarInfo = [...]uint32{
+	0x04bd8, 0x04ae0, 0x0a570, 0x054d5, 0x0d260, 0x0d950, 0x16554, 0x056a0, 0x09ad0, 0x055d2, // 1900-1909
+	0x04ae0, 0x0a5b6, 0x0a4d0, 0x0d250, 0x1d255, 0x0b540, 0x0d6a0, 0x0ada2, 0x095b0, 0x14977, // 1910-1919
+	0x04970, 0x0a4b0, 0x0b4b5, 0x06a50, 0x06d40, 0x1ab54, 0x02b60, 0x09570, 0x052f2, 0x04970, // 1920-1929
+	0x06566, 0x0d4a0, 0x0ea50, 0x16a95, 0x05ad0, 0x02b60, 0x186e3, 0x092e0, 0x1c8d7, 0x0c950, // 1930-1939
+	0x0d4a0, 0x1d8a6, 0x0b550, 0x056a0, 0x1a5b4, 0x025d0, 0x092d0, 0x0d2b2, 0x0a950, 0x0b557, // 1940-1949
+	0x06ca0, 0x0b550, 0x15355, 0x04da0, 0x0a5b0, 0x14573, 0x052b0, 0x0a9a8, 0x0e950, 0x06aa0, // 1950-1959
+	0x0aea6, 0x0ab50, 0x04b60, 0x0aae4, 0x0a570, 0x05260, 0x0f263, 0x0d950, 0x05b57, 0x056a0, // 1960-1969
+	0x096d0, 0x04dd5, 0x04ad0, 0x0a4d0, 0x0d4d4, 0x0d250, 0x0d558, 0x0b540, 0x0b6a0, 0x195a6, // 1970-1979
+	0x095b0, 0x049b0, 0x0a974, 0x0a4b0, 0x0b27a, 0x06a50, 0x06d40, 0x0af46, 0x0ab60, 0x09570, // 1980-1989
+	0x04af5, 0x04970, 0x064b0, 0x074a3, 0x0ea50, 0x06b58, 0x05ac0, 0x0ab60, 0x096d5, 0x092e0, // 1990-1999
+	0x0c960, 0x0d954, 0x0d4a0, 0x0da50, 0x07552, 0x056a0, 0x0abb7, 0x025d0, 0x092d0, 0x0cab5, // 2000-2009
+	0x0a950, 0x0b4a0, 0x0baa4, 0x0ad50, 0x055d9, 0x04ba0, 0x0a5b0, 0x15176, 0x052b0, 0x0a930, // 2010-2019
+	0x07954, 0x06aa0, 0x0ad50, 0x05b52, 0x04b60, 0x0a6e6, 0x0a4e0, 0x0d260, 0x0ea65, 0x0d530, // 2020-2029
+	0x05aa0, 0x076a3, 0x096d0, 0x04afb, 0x04ad0, 0x0a4d0, 0x1d0b6, 0x0d250, 0x0d520, 0x0dd45, // 2030-2039
+	0x0b5a0, 0x056d0, 0x055b2, 0x049b0, 0x0a577, 0x0a4b0, 0x0aa50, 0x1b255, 0x06d20, 0x0ada0, // 2040-2049
+	0x14b63, 0x09370, 0x049f8, 0x04970, 0x064b0, 0x168a6, 0x0ea50, 0x06b20, 0x1a6c4, 0x0aae0, // 2050-2059
+	0x092e0, 0x0d2e3, 0x0c960, 0x0d557, 0x0d4a0, 0x0da50, 0x05d55, 0x056a0, 0x0a6d0, 0x055d4, // 2060-2069
+	0x052d0, 0x0a9b8, 0x0a950, 0x0b4a0, 0x0b6a6, 0x0ad50, 0x055a0, 0x0aba4, 0x0a5b0, 0x052b0, // 2070-2079
+	0x0b273, 0x06930, 0x07337, 0x06aa0, 0x0ad50, 0x14b55, 0x04b60, 0x0a570, 0x054e4, 0x0d160, // 2080-2089
+	0x0e968, 0x0d520, 0x0daa0, 0x16aa6, 0x056d0, 0x04ae0, 0x0a9d4, 0x0a2d0, 0x0d150, 0x0f252, // 2090-2099
+	0x0d520, // 2100
+}
+
+const (
+	minYear = 1900
+	maxYear = minYear + len(lunarInfo) - 1
+)
+
+// ErrOutOfRange 超出 1900-2100 年的范围
+var ErrOutOfRange = errors.New("calendar: date out of range")
+
+// lunarEpoch 农历 1900 年正月初一
+var lunarEpoch = time.Date(1900, 1, 31, 0, 0, 0, 0, time.UTC)
+
+func leapMonth(y int) int {
+	return int(lunarInfo[y-minYear] & 0xf)
+}
+
+func leapDays(y int) int {
+	if leapMonth(y) == 0 {
+		return 0
+	}
+	if lunarInfo[y-minYear]&0x10000 != 0 {
+		return 30
+	}
+	return 29
+}
+
+func monthDays(y, m int) int {
+	if lunarInfo[y-minYear]&(0x10000>>uint(m)) != 0 {
+		return 30
+	}
+	return 29
+}
+
+func yearDays(y int) int {
+	sum := 348
+	for i := uint32(0x8000); i > 0x8; i >>= 1 {
+		if lunarInfo[y-minYear]&i != 0 {
+			sum++
+		}
+	}
+	return sum + leapDays(y)
+}
+
+// Date 取 t 所在的日期 (本地时区零点)
+func Date(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// days 自农历纪元起的天数
+func days(t time.Time) int {
+	y, m, d := t.Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(lunarEpoch).Hours() / 24)
+}
+
+// Lunar 农历日期
+type Lunar struct {
+	Year  int
+	Month int
+	Day   int
+	Leap  bool // Leap 是否为闰月
+}
+
+// ToLunar 公历转农历
+func ToLunar(t time.Time) (l Lunar, err error) {
+	offset := days(t)
+	if offset < 0 {
+		return l, ErrOutOfRange
+	}
+	y := minYear
+	for ; y <= maxYear; y++ {
+		yd := yearDays(y)
+		if offset < yd {
+			break
+		}
+		offset -= yd
+	}
+	if y > maxYear {
+		return l, ErrOutOfRange
+	}
+	leap := leapMonth(y)
+	for m := 1; m <= 12; m++ {
+		md := monthDays(y, m)
+		if offset < md {
+			return Lunar{Year: y, Month: m, Day: offset + 1}, nil
+		}
+		offset -= md
+		if m == leap {
+			ld := leapDays(y)
+			if offset < ld {
+				return Lunar{Year: y, Month: m, Day: offset + 1, Leap: true}, nil
+			}
+			offset -= ld
+		}
+	}
+	return l, ErrOutOfRange
+}
+
+// FromLunar 农历转公历, 返回 loc 时区的零点
+func FromLunar(l Lunar, loc *time.Location) (time.Time, error) {
+	if l.Year < minYear || l.Year > maxYear || l.Month < 1 || l.Month > 12 || l.Day < 1 {
+		return time.Time{}, ErrOutOfRange
+	}
+	leap := leapMonth(l.Year)
+	if l.Leap && leap != l.Month {
+		return time.Time{}, ErrOutOfRange
+	}
+	offset := 0
+	for y := minYear; y < l.Year; y++ {
+		offset += yearDays(y)
+	}
+	for m := 1; m < l.Month; m++ {
+		offset += monthDays(l.Year, m)
+		if m == leap {
+			offset += leapDays(l.Year)
+		}
+	}
+	md := monthDays(l.Year, l.Month)
+	if l.Leap {
+		offset += md
+		md = leapDays(l.Year)
+	}
+	if l.Day > md {
+		return time.Time{}, ErrOutOfRange
+	}
+	t := lunarEpoch.AddDate(0, 0, offset+l.Day-1)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+}
+
+var (
+	stems    = []rune("甲乙丙丁戊己庚辛壬癸")
+	branches = []rune("子丑寅卯辰巳午未申酉戌亥")
+	zodiacs  = []rune("鼠牛虎兔龙蛇马羊猴鸡狗猪")
+	months   = []string{"正", "二", "三", "四", "五", "六", "七", "八", "九", "十", "冬", "腊"}
+	digits   = []string{"", "一", "二", "三", "四", "五", "六", "七", "八", "九", "十"}
+	weekdays = []string{"日", "一", "二", "三", "四", "五", "六"}
+)
+
+// Weekday 星期几, 如 星期一
+func Weekday(t time.Time) string {
+	return "星期" + weekdays[t.Weekday()]
+}
+
+// GanZhi 干支纪年, 如 甲辰
+func (l Lunar) GanZhi() string {
+	return string(stems[(l.Year-4)%10]) + string(branches[(l.Year-4)%12])
+}
+
+// Zodiac 生肖
+func (l Lunar) Zodiac() string {
+	return string(zodiacs[(l.Year-4)%12])
+}
+
+// MonthName 月份名, 如 闰四月
+func (l Lunar) MonthName() string {
+	s := months[l.Month-1] + "月"
+	if l.Leap {
+		s = "闰" + s
+	}
+	return s
+}
+
+// DayName 日名, 如 初一 廿三
+func (l Lunar) DayName() string {
+	switch {
+	case l.Day <= 10:
+		return "初" + digits[l.Day]
+	case l.Day < 20:
+		return "十" + digits[l.Day-10]
+	case l.Day == 20:
+		return "二十"
+	case l.Day < 30:
+		return "廿" + digits[l.Day-20]
+	}
+	return "三十"
+}
+
+// String 如 甲辰(龙)年正月初一
+func (l Lunar) String() string {
+	var sb strings.Builder
+	sb.WriteString(l.GanZhi())
+	sb.WriteString("(" + l.Zodiac() + ")年")
+	sb.WriteString(l.MonthName())
+	sb.WriteString(l.DayName())
+	return sb.String()
+}
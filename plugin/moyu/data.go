@@ -0,0 +1,116 @@
+package moyu
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+	"github.com/sirupsen/logrus"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moyu/calendar"
+)
+
+const (
+	holidayTable  = "holiday"
+	worktimeTable = "worktime"
+)
+
+// override 管理员对节假日表的修改, 重启后重新应用到 calendar.Default
+type override struct {
+	ID   string `db:"id"`   // ID 年份/节日名
+	Line string `db:"line"` // Line 与 calendar.ParseHoliday 格式一致, 为空表示删除
+}
+
+// worktime 群内的上下班时间与发薪日, 私聊时 GroupID 为 -QQ
+type worktime struct {
+	GroupID int64 `db:"gid"`
+	Start   int   `db:"start"` // Start 上班时间, 自零点起的分钟数
+	End     int   `db:"end"`   // End 下班时间, 自零点起的分钟数
+	Payday  int   `db:"payday"`
+}
+
+// defaultWorktime 9:00-18:00, 每月15日发薪
+func defaultWorktime(gid int64) *worktime {
+	return &worktime{GroupID: gid, Start: 9 * 60, End: 18 * 60, Payday: 15}
+}
+
+var mdb = &moyudb{}
+
+type moyudb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+func (mdb *moyudb) init(dbpath string) error {
+	mdb.DBPath = dbpath
+	err := mdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(holidayTable, &override{})
+	if err != nil {
+		return err
+	}
+	return mdb.Create(worktimeTable, &worktime{})
+}
+
+// apply 将保存的修改应用到节假日表
+func (mdb *moyudb) apply(tb *calendar.Table) error {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	o := &override{}
+	err := mdb.FindFor(holidayTable, o, "", func() error {
+		if o.Line == "" {
+			year, name, _ := strings.Cut(o.ID, "/")
+			y, err := strconv.Atoi(year)
+			if err == nil {
+				tb.Delete(y, name)
+			}
+			return nil
+		}
+		h, err := calendar.ParseHoliday(o.Line, time.Local)
+		if err != nil {
+			logrus.Warnln("[moyu] skip holiday", o.ID, "err:", err)
+			return nil
+		}
+		tb.Set(h)
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return err
+}
+
+// setHoliday 添加或替换节假日
+func (mdb *moyudb) setHoliday(h *calendar.Holiday) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(holidayTable, &override{ID: strconv.Itoa(h.Start.Year()) + "/" + h.Name, Line: h.String()})
+}
+
+// delHoliday 删除节假日, 内置表中的记录也会被屏蔽
+func (mdb *moyudb) delHoliday(year int, name string) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(holidayTable, &override{ID: strconv.Itoa(year) + "/" + name})
+}
+
+// worktime 未设置时返回默认值
+func (mdb *moyudb) worktime(gid int64) *worktime {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	w := &worktime{}
+	if mdb.Find(worktimeTable, w, "WHERE gid = "+strconv.FormatInt(gid, 10)) != nil {
+		w = defaultWorktime(gid)
+	}
+	return w
+}
+
+func (mdb *moyudb) setWorktime(w *worktime) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(worktimeTable, w)
+}
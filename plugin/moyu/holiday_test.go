@@ -11,10 +11,12 @@ import (
 var sr = reg.NewRegedit("reilia.fumiama.top:32664", "", "fumiama", "--")
 
 func TestGetHoliday(t *testing.T) {
-	registry.Connect()
-	h := GetHoliday("元旦")
-	registry.Close()
-	t.Fatal(h)
+	for _, name := range []string{"元旦", "春节", "清明节", "劳动节", "端午节", "中秋节", "国庆节"} {
+		h := GetHoliday(name)
+		if h.name != name || h.dur == 0 || time.Until(h.date)+h.dur < 0 {
+			t.Fatal(h)
+		}
+	}
 }
 
 func TestSetHoliday(t *testing.T) {
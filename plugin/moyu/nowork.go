@@ -5,8 +5,7 @@ import (
 	"strconv"
 	"time"
 
-	reg "github.com/fumiama/go-registry"
-	"github.com/sirupsen/logrus"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moyu/calendar"
 )
 
 // Holiday 节日
@@ -21,23 +20,16 @@ func NewHoliday(name string, dur, year int, month time.Month, day int) *Holiday
 	return &Holiday{name: name, date: time.Date(year, month, day, 0, 0, 0, 0, time.Local), dur: time.Duration(dur) * time.Hour * 24}
 }
 
-var registry = reg.NewRegReader("reilia.fumiama.top:32664", "", "fumiama")
-
-// GetHoliday 从 reg 服务器获取节日
+// GetHoliday 从节假日表获取最近的节日, 表中没有时按计算出的节日当天放假一天
 func GetHoliday(name string) *Holiday {
-	var dur, year int
-	var month time.Month
-	var day int
-	ret, err := registry.Get("holiday/" + name)
-	if err != nil {
-		return NewHoliday(name+err.Error(), 0, 0, 0, 0)
+	now := time.Now()
+	if h, ok := calendar.Default.Next(name, now); ok {
+		return NewHoliday(name, h.Days, h.Start.Year(), h.Start.Month(), h.Start.Day())
 	}
-	_, err = fmt.Sscanf(ret, "%d_%d_%d_%d", &dur, &year, &month, &day)
-	if err != nil {
-		return NewHoliday(name+err.Error(), 0, 0, 0, 0)
+	if f, ok := calendar.NextFestival(name, now); ok {
+		return NewHoliday(name, 1, f.Date.Year(), f.Date.Month(), f.Date.Day())
 	}
-	logrus.Debugln("[moyu]获取节日:", name, dur, year, month, day)
-	return NewHoliday(name, dur, year, month, day)
+	return NewHoliday(name+"(未知节日)", 0, 0, 0, 0)
 }
 
 // String 获取两个时间相差
@@ -53,10 +45,23 @@ func (h *Holiday) String() string {
 	}
 }
 
-func weekend() string {
-	t := time.Now().Weekday()
-	if t == time.Sunday || t == time.Saturday {
+// daysBetween 两天零点之间相差的天数
+func daysBetween(from, to time.Time) int {
+	return int(calendar.Date(to).Sub(calendar.Date(from)).Hours()/24 + 0.5)
+}
+
+// weekend 考虑调休后距离下一个休息日的天数
+func weekend(now time.Time) string {
+	h, adjusted := calendar.Default.Lookup(now)
+	switch {
+	case h != nil && !adjusted:
+		return "好好享受" + h.Name + "假期吧！"
+	case !calendar.Default.IsWorkday(now):
 		return "好好享受周末吧！"
 	}
-	return fmt.Sprintf("距离周末还有:%d天！", 5-t)
+	s := fmt.Sprintf("距离休息日还有:%d天！", daysBetween(now, calendar.Default.NextRestDay(now)))
+	if adjusted {
+		s = "今天是" + h.Name + "调休上班日, " + s
+	}
+	return s
 }
@@ -2,6 +2,9 @@
 package moyu
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -9,6 +12,8 @@ import (
 	"github.com/FloatTech/zbputils/control"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moyu/calendar"
 )
 
 var (
@@ -18,25 +23,43 @@ var (
 )
 
 func init() { // 插件主体
-	control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: true,
 		Brief:            "摸鱼提醒",
 		Help: "- /启用 moyu\n" +
 			"- /禁用 moyu\n" +
 			"- 记录在\"0 10 * * *\"触发的指令\n" +
-			"   - 摸鱼提醒",
-	}).OnFullMatch("摸鱼提醒").SetBlock(true).
+			"   - 摸鱼提醒\n" +
+			"- 距离下班\n" +
+			"- 距离发薪日\n" +
+			"- 设置上班时间9:00-18:00\n" +
+			"- 设置发薪日15\n" +
+			"- 查看节假日[2025]\n" +
+			"- [超级用户] 设置节假日 春节 2025-01-28 8 2025-01-26,2025-02-08\n" +
+			"- [超级用户] 删除节假日 2025 春节\n" +
+			"注: 设置节假日的格式为 名称 放假首日 放假天数 [调休上班日,...]\n" +
+			"注: 发薪日遇休息日时提前到之前最近的工作日",
+		PrivateDataFolder: "moyu",
+	})
+	err := mdb.init(engine.DataFolder() + "moyu.db")
+	if err != nil {
+		panic(err)
+	}
+	err = mdb.apply(calendar.Default)
+	if err != nil {
+		panic(err)
+	}
+
+	engine.OnFullMatch("摸鱼提醒").SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			mu.Lock()
 			defer mu.Unlock()
 			if msg == nil || time.Since(lastupdate) > time.Hour*20 {
-				if registry.Connect() != nil {
-					return
-				}
+				now := time.Now()
 				msg = message.Message{
-					message.Text(time.Now().Format("2006-01-02")),
+					message.Text(today(now), "\n"),
 					message.Text("上午好，摸鱼人！\n工作再累，一定不要忘记摸鱼哦！有事没事起身去茶水间，去厕所，去廊道走走别老在工位上坐着，钱是老板的,但命是自己的。\n"),
-					message.Text(weekend()),
+					message.Text(weekend(now)),
 					message.Text("\n"),
 					message.Text(GetHoliday("元旦")),
 					message.Text("\n"),
@@ -54,9 +77,171 @@ func init() { // 插件主体
 					message.Text("\n"),
 					message.Text("上班是帮老板赚钱，摸鱼是赚老板的钱！最后，祝愿天下所有摸鱼人，都能愉快的渡过每一天…"),
 				}
-				_ = registry.Close()
-				lastupdate = time.Now()
+				lastupdate = now
 			}
 			ctx.Send(msg)
 		})
+	engine.OnFullMatch("距离下班").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ctx.SendChain(message.Text(offwork(mdb.worktime(worktimeID(ctx)), time.Now())))
+		})
+	engine.OnFullMatch("距离发薪日").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ctx.SendChain(message.Text(payday(mdb.worktime(worktimeID(ctx)), time.Now())))
+		})
+	engine.OnRegex(`^设置上班时间\s*(\d{1,2})[:：](\d{2})\s*[-~到]\s*(\d{1,2})[:：](\d{2})$`, canSetWorktime).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			m := ctx.State["regex_matched"].([]string)
+			sh, _ := strconv.Atoi(m[1])
+			sm, _ := strconv.Atoi(m[2])
+			eh, _ := strconv.Atoi(m[3])
+			em, _ := strconv.Atoi(m[4])
+			start, end := sh*60+sm, eh*60+em
+			if sm >= 60 || em >= 60 || end > 24*60 || start >= end {
+				ctx.SendChain(message.Text("ERROR: 时间不合法"))
+				return
+			}
+			w := mdb.worktime(worktimeID(ctx))
+			w.Start, w.End = start, end
+			err := mdb.setWorktime(w)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！上班时间: ", clock(start), "-", clock(end)))
+		})
+	engine.OnRegex(`^设置发薪日\s*(\d{1,2})$`, canSetWorktime).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			day, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if day < 1 || day > 31 {
+				ctx.SendChain(message.Text("ERROR: 发薪日应在1-31之间"))
+				return
+			}
+			w := mdb.worktime(worktimeID(ctx))
+			w.Payday = day
+			err := mdb.setWorktime(w)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！每月", day, "日发薪, 当月没有这一天时取月末"))
+		})
+	engine.OnRegex(`^查看节假日\s*(\d{4})?$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			year := time.Now().Year()
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				year, _ = strconv.Atoi(s)
+			}
+			hs := calendar.Default.Holidays(year)
+			if len(hs) == 0 {
+				ctx.SendChain(message.Text("没有", year, "年的节假日安排"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString(strconv.Itoa(year) + "年节假日安排:")
+			for _, h := range hs {
+				sb.WriteString("\n" + h.String())
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置节假日\s+(.+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			h, err := calendar.ParseHoliday(ctx.State["regex_matched"].([]string)[1], time.Local)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			err = mdb.setHoliday(h)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			calendar.Default.Set(h)
+			invalidate()
+			ctx.SendChain(message.Text("成功！", h.String()))
+		})
+	engine.OnRegex(`^删除节假日\s*(\d{4})\s*(\S+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			year, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			name := ctx.State["regex_matched"].([]string)[2]
+			if !calendar.Default.Delete(year, name) {
+				ctx.SendChain(message.Text("ERROR: 没有", year, "年的", name))
+				return
+			}
+			err := mdb.delHoliday(year, name)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			invalidate()
+			ctx.SendChain(message.Text("成功！"))
+		})
+}
+
+// invalidate 节假日表变动后重新生成摸鱼提醒
+func invalidate() {
+	mu.Lock()
+	msg = nil
+	mu.Unlock()
+}
+
+// today 日期, 星期与农历
+func today(now time.Time) string {
+	s := now.Format("2006-01-02") + " " + calendar.Weekday(now)
+	if l, err := calendar.ToLunar(now); err == nil {
+		s += " 农历" + l.MonthName() + l.DayName()
+	}
+	if fs := calendar.FestivalsOn(now); len(fs) > 0 {
+		s += " " + strings.Join(fs, " ")
+	}
+	return s
+}
+
+// worktimeID 群聊为群号, 私聊为 -QQ
+func worktimeID(ctx *zero.Ctx) int64 {
+	if ctx.Event.GroupID != 0 {
+		return ctx.Event.GroupID
+	}
+	return -ctx.Event.UserID
+}
+
+// canSetWorktime 群管理员可以设置本群, 私聊可以设置自己
+func canSetWorktime(ctx *zero.Ctx) bool {
+	return ctx.Event.GroupID == 0 || zero.AdminPermission(ctx)
+}
+
+func clock(m int) string {
+	return fmt.Sprintf("%d:%02d", m/60, m%60)
+}
+
+func minutes(m int) string {
+	if m < 60 {
+		return strconv.Itoa(m) + "分钟"
+	}
+	return fmt.Sprintf("%d小时%d分钟", m/60, m%60)
+}
+
+// offwork 距离下班的提示
+func offwork(w *worktime, now time.Time) string {
+	if !calendar.Default.IsWorkday(now) {
+		return "今天不用上班, 好好休息吧！"
+	}
+	m := now.Hour()*60 + now.Minute()
+	switch {
+	case m < w.Start:
+		return "还没上班呢, 距离上班(" + clock(w.Start) + ")还有" + minutes(w.Start-m)
+	case m < w.End:
+		return "距离下班(" + clock(w.End) + ")还有" + minutes(w.End-m) + ", 坚持住！"
+	}
+	return "已经下班啦, 快回家吧！"
+}
+
+// payday 距离发薪日的提示
+func payday(w *worktime, now time.Time) string {
+	p := calendar.Default.NextPayday(now, w.Payday)
+	n := daysBetween(now, p)
+	if n == 0 {
+		return "今天发薪！"
+	}
+	return fmt.Sprintf("距离发薪日(%s)还有%d天", p.Format("2006-01-02"), n)
 }
@@ -2,11 +2,20 @@
 package moyucalendar
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/binary"
 	"github.com/FloatTech/floatbox/web"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moyu/calendar"
 )
 
 func init() {
@@ -16,14 +25,59 @@ func init() {
 		Help: "- /启用 moyucalendar\n" +
 			"- /禁用 moyucalendar\n" +
 			"- 记录在\"30 8 * * *\"触发的指令\n" +
-			"   - 摸鱼人日历",
+			"   - 摸鱼人日历\n" +
+			"注: 接口不可用时发送离线生成的日历",
 	}).OnFullMatch("摸鱼人日历").SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			data, err := web.GetData("https://api.vvhan.com/api/moyu")
+			if err == nil {
+				ctx.SendChain(message.ImageBytes(data))
+				return
+			}
+			logrus.Warnln("[moyucalendar] fallback to offline calendar:", err)
+			data, err = text.RenderToBase64(offline(time.Now()), text.FontFile, 400, 24)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			ctx.SendChain(message.ImageBytes(data))
+			ctx.SendChain(message.Image("base64://" + binary.BytesToString(data)))
 		})
 }
+
+// offline 离线生成的摸鱼人日历
+func offline(now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("摸鱼人日历\n\n")
+	sb.WriteString(now.Format("2006年01月02日") + " " + calendar.Weekday(now) + "\n")
+	if l, err := calendar.ToLunar(now); err == nil {
+		sb.WriteString("农历" + l.String() + "\n")
+	}
+	if fs := calendar.FestivalsOn(now); len(fs) > 0 {
+		sb.WriteString("今天是" + strings.Join(fs, "、") + "\n")
+	}
+	sb.WriteString("\n")
+	today := calendar.Date(now)
+	switch h, adjusted := calendar.Default.Lookup(now); {
+	case h != nil && !adjusted:
+		sb.WriteString("正在放" + h.Name + "假, 好好休息吧！\n")
+	case adjusted:
+		sb.WriteString("今天是" + h.Name + "调休上班日\n")
+	}
+	if calendar.Default.IsWorkday(now) {
+		rest := calendar.Default.NextRestDay(now)
+		sb.WriteString("距离休息日还有" + strconv.Itoa(int(rest.Sub(today).Hours()/24+0.5)) + "天\n")
+	}
+	n := 0
+	for _, h := range calendar.Default.Holidays(0) {
+		if n >= 5 {
+			break
+		}
+		if !h.Start.After(today) {
+			continue
+		}
+		sb.WriteString("距离" + h.Name + "还有" + strconv.Itoa(int(h.Start.Sub(today).Hours()/24+0.5)) + "天\n")
+		n++
+	}
+	sb.WriteString("\n上班是帮老板赚钱，摸鱼是赚老板的钱！")
+	return sb.String()
+}
@@ -0,0 +1,195 @@
+package music
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/music/provider"
+)
+
+const (
+	playlistTable = "playlist"
+	historyTable  = "history"
+	settingTable  = "setting"
+	cookieTable   = "cookie"
+)
+
+// track 歌单中的一首歌, 群号为负数时为私聊的 QQ
+type track struct {
+	ID       string `db:"id"` // ID 群号/平台/歌曲ID
+	GroupID  int64  `db:"gid"`
+	Provider string `db:"provider"`
+	SongID   string `db:"songid"`
+	Name     string `db:"name"`
+	Artist   string `db:"artist"`
+	Album    string `db:"album"`
+	Cover    string `db:"cover"`
+	Page     string `db:"page"`
+	Audio    string `db:"audio"`
+	AddedBy  int64  `db:"addedby"`
+	AddedAt  int64  `db:"addedat"`
+}
+
+// played 一次点歌记录
+type played struct {
+	ID       int64  `db:"id"` // ID 点歌时间 (ns)
+	GroupID  int64  `db:"gid"`
+	UserID   int64  `db:"uid"`
+	Provider string `db:"provider"`
+	SongID   string `db:"songid"`
+	Name     string `db:"name"`
+	Artist   string `db:"artist"`
+	Album    string `db:"album"`
+	Cover    string `db:"cover"`
+	Page     string `db:"page"`
+	Audio    string `db:"audio"`
+}
+
+func (t *track) song() provider.Song {
+	return provider.Song{Provider: t.Provider, ID: t.SongID, Name: t.Name, Artist: t.Artist, Album: t.Album, Cover: t.Cover, Page: t.Page, Audio: t.Audio}
+}
+
+func (p *played) song() provider.Song {
+	return provider.Song{Provider: p.Provider, ID: p.SongID, Name: p.Name, Artist: p.Artist, Album: p.Album, Cover: p.Cover, Page: p.Page, Audio: p.Audio}
+}
+
+// setting 群的点歌设置
+type setting struct {
+	GroupID int64 `db:"gid"`
+	Record  bool  `db:"record"` // Record 发送语音而不是卡片
+}
+
+// cookie 平台的登录 Cookie
+type cookie struct {
+	Provider string `db:"provider"`
+	Value    string `db:"value"`
+}
+
+var mdb = &musicdb{}
+
+// musicdb 歌单与点歌记录
+type musicdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+func (mdb *musicdb) init(dbpath string) error {
+	mdb.DBPath = dbpath
+	err := mdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(playlistTable, &track{})
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(historyTable, &played{})
+	if err != nil {
+		return err
+	}
+	err = mdb.Create(settingTable, &setting{})
+	if err != nil {
+		return err
+	}
+	return mdb.Create(cookieTable, &cookie{})
+}
+
+// add 加入歌单, 已存在时返回 false
+func (mdb *musicdb) add(gid, uid int64, s *provider.Song) (bool, error) {
+	mdb.Lock()
+	defer mdb.Unlock()
+	id := strconv.FormatInt(gid, 10) + "/" + s.Provider + "/" + s.ID
+	if mdb.CanFind(playlistTable, "WHERE id = "+quote(id)) {
+		return false, nil
+	}
+	return true, mdb.Insert(playlistTable, &track{
+		ID: id, GroupID: gid, Provider: s.Provider, SongID: s.ID,
+		Name: s.Name, Artist: s.Artist, Album: s.Album, Cover: s.Cover, Page: s.Page, Audio: s.Audio,
+		AddedBy: uid, AddedAt: time.Now().Unix(),
+	})
+}
+
+// playlist 群歌单, 按加入顺序
+func (mdb *musicdb) playlist(gid int64) (ts []*track, err error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	ts, err = sql.FindAll[track](&mdb.Sqlite, playlistTable, "WHERE gid = "+strconv.FormatInt(gid, 10)+" ORDER BY addedat, id")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+func (mdb *musicdb) remove(id string) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Del(playlistTable, "WHERE id = "+quote(id))
+}
+
+func (mdb *musicdb) clear(gid int64) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Del(playlistTable, "WHERE gid = "+strconv.FormatInt(gid, 10))
+}
+
+// play 记录一次点歌
+func (mdb *musicdb) play(gid, uid int64, s *provider.Song) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(historyTable, &played{
+		ID: time.Now().UnixNano(), GroupID: gid, UserID: uid, Provider: s.Provider, SongID: s.ID,
+		Name: s.Name, Artist: s.Artist, Album: s.Album, Cover: s.Cover, Page: s.Page, Audio: s.Audio,
+	})
+}
+
+// history 群内最近 n 次点歌, 最新的在前
+func (mdb *musicdb) history(gid int64, n int) (ps []*played, err error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	ps, err = sql.FindAll[played](&mdb.Sqlite, historyTable, "WHERE gid = "+strconv.FormatInt(gid, 10)+" ORDER BY id DESC LIMIT "+strconv.Itoa(n))
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+// setting 群设置, 未设置时返回默认值
+func (mdb *musicdb) setting(gid int64) *setting {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	s := &setting{}
+	if mdb.Find(settingTable, s, "WHERE gid = "+strconv.FormatInt(gid, 10)) != nil {
+		s = &setting{GroupID: gid}
+	}
+	return s
+}
+
+func (mdb *musicdb) setSetting(s *setting) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(settingTable, s)
+}
+
+func (mdb *musicdb) cookies() (cs []*cookie, err error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	cs, err = sql.FindAll[cookie](&mdb.Sqlite, cookieTable, "")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+func (mdb *musicdb) setCookie(c *cookie) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	return mdb.Insert(cookieTable, c)
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,158 @@
+package music
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/music/provider"
+)
+
+func init() {
+	engine.OnRegex(`^加入歌单\s*(.*)$`, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			gid := groupof(ctx)
+			var s *provider.Song
+			args := strings.Fields(ctx.State["regex_matched"].([]string)[1])
+			if len(args) == 0 {
+				// 加入最近点的歌
+				ps, err := mdb.history(gid, 1)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				if len(ps) == 0 {
+					ctx.SendChain(message.Text("这里还没有人点过歌, 请发送: 加入歌单 歌名"))
+					return
+				}
+				song := ps[0].song()
+				s = &song
+			} else {
+				platform := ""
+				if _, ok := provider.Lookup(args[0]); ok && len(args) > 1 {
+					platform, args = args[0], args[1:]
+				}
+				var ok bool
+				_, s, ok = search(ctx, platform, strings.Join(args, " "))
+				if !ok {
+					return
+				}
+			}
+			ok, err := mdb.add(gid, ctx.Event.UserID, s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !ok {
+				ctx.SendChain(message.Text(s.String(), " 已经在歌单里了"))
+				return
+			}
+			ctx.SendChain(message.Text("已将 ", s.String(), " 加入歌单"))
+		})
+	engine.OnRegex(`^播放歌单\s*(\d*)$`, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ts, err := mdb.playlist(groupof(ctx))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ts) == 0 {
+				ctx.SendChain(message.Text("歌单是空的, 发送\"加入歌单 歌名\"添加"))
+				return
+			}
+			i := rand.Intn(len(ts))
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				i, _ = strconv.Atoi(s)
+				i--
+				if i < 0 || i >= len(ts) {
+					ctx.SendChain(message.Text("ERROR: 序号应在1-", len(ts), "之间"))
+					return
+				}
+			}
+			p, ok := provider.Lookup(ts[i].Provider)
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 平台", ts[i].Provider, "已不可用"))
+				return
+			}
+			s := ts[i].song()
+			ctx.SendChain(message.Text("正在播放歌单第", i+1, "首: ", s.String()))
+			play(ctx, p, &s)
+		})
+	engine.OnFullMatch("查看歌单", getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ts, err := mdb.playlist(groupof(ctx))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ts) == 0 {
+				ctx.SendChain(message.Text("歌单是空的, 发送\"加入歌单 歌名\"添加"))
+				return
+			}
+			sb := strings.Builder{}
+			sb.WriteString("歌单 (共" + strconv.Itoa(len(ts)) + "首):")
+			for i, t := range ts {
+				s := t.song()
+				sb.WriteString("\n[" + strconv.Itoa(i+1) + "] " + s.String() + " (" + t.Provider + ")")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^删除歌单\s*(\d+)$`, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ts, err := mdb.playlist(groupof(ctx))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			i, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			if i < 1 || i > len(ts) {
+				ctx.SendChain(message.Text("ERROR: 序号应在1-", len(ts), "之间"))
+				return
+			}
+			t := ts[i-1]
+			// 只有添加者与群管理员可以删除
+			if t.AddedBy != ctx.Event.UserID && !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Text("ERROR: 只能删除自己加入的歌"))
+				return
+			}
+			err = mdb.remove(t.ID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			s := t.song()
+			ctx.SendChain(message.Text("已从歌单删除 ", s.String()))
+		})
+	engine.OnFullMatch("清空歌单", zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			err := mdb.clear(groupof(ctx))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已清空歌单"))
+		})
+	engine.OnFullMatch("点播记录", getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ps, err := mdb.history(groupof(ctx), 10)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ps) == 0 {
+				ctx.SendChain(message.Text("这里还没有人点过歌"))
+				return
+			}
+			sb := strings.Builder{}
+			sb.WriteString("最近点播:")
+			for _, p := range ps {
+				s := p.song()
+				sb.WriteString("\n" + time.Unix(0, p.ID).Format("01-02 15:04") + " " + ctx.CardOrNickName(p.UserID) + ": " + s.String())
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+}
@@ -0,0 +1,386 @@
+package provider
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// cookie 可在运行时替换的 Cookie
+type cookie struct {
+	mu sync.RWMutex
+	v  string
+}
+
+// SetCookie 替换 Cookie
+func (c *cookie) SetCookie(v string) {
+	c.mu.Lock()
+	c.v = v
+	c.mu.Unlock()
+}
+
+// with 附加 Cookie 后的请求头
+func (c *cookie) with(h http.Header) http.Header {
+	h = clone(h)
+	c.mu.RLock()
+	if c.v != "" {
+		h.Set("Cookie", c.v)
+	}
+	c.mu.RUnlock()
+	return h
+}
+
+// songs 逐个转换搜索结果, 为空时返回 ErrNoResult
+func songs(list []gjson.Result, n int, conv func(gjson.Result) Song) ([]Song, error) {
+	if len(list) > n {
+		list = list[:n]
+	}
+	ss := make([]Song, 0, len(list))
+	for _, r := range list {
+		ss = append(ss, conv(r))
+	}
+	if len(ss) == 0 {
+		return nil, ErrNoResult
+	}
+	return ss, nil
+}
+
+// artists 拼接歌手名
+func artists(rs []gjson.Result, key string) string {
+	names := make([]string, 0, len(rs))
+	for _, r := range rs {
+		names = append(names, r.Get(key).String())
+	}
+	return strings.Join(names, "/")
+}
+
+// QQ QQ音乐, 只能发送卡片
+type QQ struct {
+	Client    *http.Client
+	SearchURL string
+}
+
+// NewQQ 默认配置的QQ音乐
+func NewQQ() *QQ {
+	return &QQ{SearchURL: "https://c.y.qq.com/splcloud/fcgi-bin/smartbox_new.fcg"}
+}
+
+// Name qq
+func (*QQ) Name() string { return "qq" }
+
+// Search 搜索
+func (q *QQ) Search(keyword string, n int) ([]Song, error) {
+	data, err := get(q.Client, q.SearchURL+"?platform=yqq.json&key="+url.QueryEscape(keyword), http.Header{
+		"User-Agent": []string{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return songs(gjson.GetBytes(data, "data.song.itemlist").Array(), n, func(r gjson.Result) Song {
+		return Song{
+			Provider: "qq",
+			ID:       r.Get("id").String(),
+			Name:     r.Get("name").String(),
+			Artist:   r.Get("singer").String(),
+			Page:     "https://y.qq.com/n/ryqq/songDetail/" + r.Get("mid").String(),
+		}
+	})
+}
+
+// Audio QQ音乐不提供直链
+func (*QQ) Audio(*Song) (string, error) {
+	return "", ErrNoAudio
+}
+
+// NetEase 网易云音乐
+type NetEase struct {
+	Client    *http.Client
+	SearchURL string
+	AudioURL  string
+}
+
+// NewNetEase 默认配置的网易云音乐
+func NewNetEase() *NetEase {
+	return &NetEase{
+		SearchURL: "http://music.163.com/api/search/get/web",
+		AudioURL:  "http://music.163.com/song/media/outer/url",
+	}
+}
+
+// Name 163
+func (*NetEase) Name() string { return "163" }
+
+// Search 搜索
+func (ne *NetEase) Search(keyword string, n int) ([]Song, error) {
+	data, err := get(ne.Client, ne.SearchURL+"?type=1&limit="+strconv.Itoa(n)+"&s="+url.QueryEscape(keyword), nil)
+	if err != nil {
+		return nil, err
+	}
+	return songs(gjson.GetBytes(data, "result.songs").Array(), n, func(r gjson.Result) Song {
+		id := r.Get("id").String()
+		return Song{
+			Provider: "163",
+			ID:       id,
+			Name:     r.Get("name").String(),
+			Artist:   artists(r.Get("artists").Array(), "name"),
+			Album:    r.Get("album.name").String(),
+			Page:     "https://music.163.com/#/song?id=" + id,
+		}
+	})
+}
+
+// Audio 外链播放地址
+func (ne *NetEase) Audio(s *Song) (string, error) {
+	return ne.AudioURL + "?id=" + url.QueryEscape(s.ID) + ".mp3", nil
+}
+
+// Kuwo 酷我音乐
+type Kuwo struct {
+	cookie
+	Client    *http.Client
+	SearchURL string
+	AudioURL  string
+	Header    http.Header
+}
+
+// NewKuwo 默认配置的酷我音乐
+func NewKuwo() *Kuwo {
+	k := &Kuwo{
+		SearchURL: "https://www.kuwo.cn/api/www/search/searchMusicBykeyWord",
+		AudioURL:  "http://www.kuwo.cn/api/v1/www/music/playUrl",
+		Header: http.Header{
+			"csrf":       []string{"LWKACV45JSQ"},
+			"User-Agent": []string{"Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:84.0) Gecko/20100101 Firefox/84.0"},
+			"Referer":    []string{"https://www.kuwo.cn/search/list?key="},
+		},
+	}
+	k.SetCookie("Hm_lvt_cdb524f42f0ce19b169a8071123a4797=1610284708,1610699237; _ga=GA1.2.1289529848.1591618534; kw_token=LWKACV45JSQ; Hm_lpvt_cdb524f42f0ce19b169a8071123a4797=1610699468; _gid=GA1.2.1868980507.1610699238; _gat=1")
+	return k
+}
+
+// Name kuwo
+func (*Kuwo) Name() string { return "kuwo" }
+
+// Search 搜索
+func (k *Kuwo) Search(keyword string, n int) ([]Song, error) {
+	data, err := get(k.Client, k.SearchURL+"?"+url.Values{
+		"key":         []string{keyword},
+		"pn":          []string{"1"},
+		"rn":          []string{strconv.Itoa(n)},
+		"httpsStatus": []string{"1"},
+	}.Encode(), k.with(k.Header))
+	if err != nil {
+		return nil, err
+	}
+	return songs(gjson.GetBytes(data, "data.list").Array(), n, func(r gjson.Result) Song {
+		id := r.Get("rid").String()
+		return Song{
+			Provider: "kuwo",
+			ID:       id,
+			Name:     r.Get("name").String(),
+			Artist:   r.Get("artist").String(),
+			Album:    r.Get("album").String(),
+			Cover:    r.Get("pic").String(),
+			Page:     "https://www.kuwo.cn/play_detail/" + id,
+		}
+	})
+}
+
+// Audio 获取播放地址
+func (k *Kuwo) Audio(s *Song) (string, error) {
+	data, err := get(k.Client, k.AudioURL+"?"+url.Values{
+		"mid":         []string{s.ID},
+		"type":        []string{"convert_url3"},
+		"br":          []string{"320kmp3"},
+		"httpsStatus": []string{"1"},
+	}.Encode(), k.with(k.Header))
+	if err != nil {
+		return "", err
+	}
+	u := gjson.GetBytes(data, "data.url").String()
+	if u == "" {
+		return "", ErrNoAudio
+	}
+	return u, nil
+}
+
+// Kugou 酷狗音乐, 歌曲 ID 为 FileHash|AlbumID
+type Kugou struct {
+	cookie
+	Client    *http.Client
+	SearchURL string
+	AudioURL  string
+	Header    http.Header
+}
+
+// NewKugou 默认配置的酷狗音乐
+func NewKugou() *Kugou {
+	k := &Kugou{
+		SearchURL: "https://complexsearch.kugou.com/v2/search/song",
+		AudioURL:  "https://wwwapi.kugou.com/yy/index.php",
+		Header: http.Header{
+			"User-Agent": []string{"Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:84.0) Gecko/20100101 Firefox/84.0"},
+		},
+	}
+	k.SetCookie("kg_mid=d8e70a262c93d47599c6196c612d6f4f; Hm_lvt_aedee6983d4cfc62f509129360d6bb3d=1610278505,1611631363,1611722252; kg_dfid=33ZWee1kircl0jcJ1h0WF1fX; Hm_lpvt_aedee6983d4cfc62f509129360d6bb3d=1611727348; kg_dfid_collect=d41d8cd98f00b204e9800998ecf8427e")
+	return k
+}
+
+// Name kugou
+func (*Kugou) Name() string { return "kugou" }
+
+// Search 搜索
+func (k *Kugou) Search(keyword string, n int) ([]Song, error) {
+	stamp := time.Now().UnixNano() / 1e6
+	size := strconv.Itoa(n)
+	hash := md5str(fmt.Sprintf(
+		"NVPh5oo715z5DIWAeQlhMDsWXXQV4hwtbitrate=0callback=callback123clienttime=%dclientver=2000dfid=-inputtype=0iscorrection=1isfuzzy=0keyword=%smid=%dpage=1pagesize=%splatform=WebFilterprivilege_filter=0srcappid=2919tag=emuserid=-1uuid=%dNVPh5oo715z5DIWAeQlhMDsWXXQV4hwt",
+		stamp, keyword, stamp, size, stamp,
+	))
+	ts := strconv.FormatInt(stamp, 10)
+	data, err := get(k.Client, k.SearchURL+"?"+url.Values{
+		"callback":         []string{"callback123"},
+		"keyword":          []string{keyword},
+		"page":             []string{"1"},
+		"pagesize":         []string{size},
+		"bitrate":          []string{"0"},
+		"isfuzzy":          []string{"0"},
+		"tag":              []string{"em"},
+		"inputtype":        []string{"0"},
+		"platform":         []string{"WebFilter"},
+		"userid":           []string{"-1"},
+		"clientver":        []string{"2000"},
+		"iscorrection":     []string{"1"},
+		"privilege_filter": []string{"0"},
+		"srcappid":         []string{"2919"},
+		"clienttime":       []string{ts},
+		"mid":              []string{ts},
+		"uuid":             []string{ts},
+		"dfid":             []string{"-"},
+		"signature":        []string{hash},
+	}.Encode(), k.Header)
+	if err != nil {
+		return nil, err
+	}
+	return songs(gjson.GetBytes(unjsonp(data), "data.lists").Array(), n, func(r gjson.Result) Song {
+		h, a := r.Get("FileHash").String(), r.Get("AlbumID").String()
+		return Song{
+			Provider: "kugou",
+			ID:       h + "|" + a,
+			// 搜索结果中的关键词带有 <em> 标签
+			Name:   stripem(r.Get("SongName").String()),
+			Artist: stripem(r.Get("SingerName").String()),
+			Album:  stripem(r.Get("AlbumName").String()),
+			Page:   "https://www.kugou.com/song/#hash=" + h + "&album_id=" + a,
+		}
+	})
+}
+
+// Audio 获取播放地址
+func (k *Kugou) Audio(s *Song) (string, error) {
+	h, a, _ := strings.Cut(s.ID, "|")
+	header := k.with(k.Header)
+	header.Set("Host", "wwwapi.kugou.com")
+	data, err := get(k.Client, k.AudioURL+"?r=play%2Fgetdata&hash="+url.QueryEscape(h)+"&album_id="+url.QueryEscape(a), header)
+	if err != nil {
+		return "", err
+	}
+	d := gjson.GetBytes(data, "data")
+	if s.Cover == "" {
+		s.Cover = d.Get("img").String()
+	}
+	u := strings.ReplaceAll(d.Get("play_backup_url").String(), "\\/", "/")
+	if u == "" {
+		u = d.Get("play_url").String()
+	}
+	if u == "" {
+		return "", ErrNoAudio
+	}
+	return u, nil
+}
+
+func stripem(s string) string {
+	return strings.NewReplacer("<em>", "", "</em>", "").Replace(s)
+}
+
+// md5str 返回字符串 MD5
+func md5str(s string) string {
+	h := md5.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+// Migu 咪咕音乐, 搜索结果中已带有音频直链
+type Migu struct {
+	cookie
+	Client    *http.Client
+	SearchURL string
+	Header    http.Header
+}
+
+// NewMigu 默认配置的咪咕音乐
+func NewMigu() *Migu {
+	m := &Migu{
+		SearchURL: "http://m.music.migu.cn/migu/remoting/scr_search_tag",
+		Header: http.Header{
+			"csrf":       []string{"LWKACV45JSQ"},
+			"User-Agent": []string{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"},
+			"Referer":    []string{"http://m.music.migu.cn"},
+			"proxy":      []string{"false"},
+		},
+	}
+	m.SetCookie("audioplayer_exist=1; audioplayer_open=0; migu_cn_cookie_id=3ad476db-f021-4bda-ab91-c485ac3d56a0; Hm_lvt_ec5a5474d9d871cb3d82b846d861979d=1671119573; Hm_lpvt_ec5a5474d9d871cb3d82b846d861979d=1671119573; WT_FPC=id=279ef92eaf314cbb8d01671116477485:lv=1671119583092:ss=1671116477485")
+	return m
+}
+
+// Name migu
+func (*Migu) Name() string { return "migu" }
+
+// Search 搜索
+func (m *Migu) Search(keyword string, n int) ([]Song, error) {
+	data, err := get(m.Client, m.SearchURL+"?"+url.Values{
+		"keyword": []string{keyword},
+		"type":    []string{"2"},
+		"pgc":     []string{"1"},
+		"rows":    []string{strconv.Itoa(n)},
+	}.Encode(), m.with(m.Header))
+	if err != nil {
+		return nil, err
+	}
+	return songs(gjson.GetBytes(data, "musics").Array(), n, func(r gjson.Result) Song {
+		id := r.Get("copyrightId").String()
+		return Song{
+			Provider: "migu",
+			ID:       id,
+			Name:     r.Get("songName").String(),
+			Artist:   r.Get("artist").String(),
+			Album:    r.Get("albumName").String(),
+			Cover:    r.Get("cover").String(),
+			Page:     "https://music.migu.cn/v3/music/song/" + id,
+			Audio:    r.Get("mp3").String(),
+		}
+	})
+}
+
+// Audio 搜索时已获取的直链
+func (*Migu) Audio(s *Song) (string, error) {
+	if s.Audio == "" {
+		return "", ErrNoAudio
+	}
+	return s.Audio, nil
+}
+
+func init() {
+	Register(NewQQ(), "QQ", "qq", "")
+	Register(NewNetEase(), "网易", "网易云")
+	Register(NewKuwo(), "酷我")
+	Register(NewKugou(), "酷狗")
+	Register(NewMigu(), "咪咕")
+}
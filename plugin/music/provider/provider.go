@@ -0,0 +1,166 @@
+// Package provider 点歌的音乐平台, 每个平台实现 Provider 后注册即可使用
+package provider
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNoResult 没有搜索到歌曲
+	ErrNoResult = errors.New("没有找到歌曲")
+	// ErrNoAudio 平台无法提供音频直链
+	ErrNoAudio = errors.New("无法获取音频")
+)
+
+// Song 一首歌
+type Song struct {
+	Provider string // Provider 平台名
+	ID       string // ID 平台内的歌曲 ID
+	Name     string
+	Artist   string
+	Album    string
+	Cover    string
+	Page     string // Page 歌曲页面
+	Audio    string // Audio 音频直链, 为空时由 Provider.Audio 获取
+}
+
+// String 歌名 - 歌手
+func (s *Song) String() string {
+	if s.Artist == "" {
+		return s.Name
+	}
+	return s.Name + " - " + s.Artist
+}
+
+// Provider 音乐平台
+type Provider interface {
+	// Name 平台名, 同时作为音乐卡片的 subtype
+	Name() string
+	// Search 搜索前 n 首歌
+	Search(keyword string, n int) ([]Song, error)
+	// Audio 获取歌曲的音频直链
+	Audio(s *Song) (string, error)
+}
+
+// CookieSetter 需要登录 Cookie 的平台
+type CookieSetter interface {
+	SetCookie(cookie string)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+	aliases   = map[string]string{}
+	order     []string
+)
+
+// Register 注册平台, alias 为点歌时使用的别名, 如 网易
+func Register(p Provider, alias ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	name := p.Name()
+	if _, ok := providers[name]; !ok {
+		order = append(order, name)
+	}
+	providers[name] = p
+	for _, a := range alias {
+		aliases[a] = name
+	}
+}
+
+// Unregister 移除平台及其别名
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(providers, name)
+	for a, n := range aliases {
+		if n == name {
+			delete(aliases, a)
+		}
+	}
+	for i, n := range order {
+		if n == name {
+			order = append(order[:i], order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Lookup 按平台名或别名查找
+func Lookup(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if n, ok := aliases[name]; ok {
+		name = n
+	}
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Names 已注册的平台名, 按注册顺序
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]string(nil), order...)
+}
+
+// Aliases 平台的所有别名
+func Aliases(name string) (as []string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for a, n := range aliases {
+		if n == name {
+			as = append(as, a)
+		}
+	}
+	return
+}
+
+// get 发送 GET 请求
+func get(client *http.Client, u string, header http.Header) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("HTTP " + resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// unjsonp 去掉 JSONP 的回调函数包装
+func unjsonp(data []byte) []byte {
+	s := strings.TrimSpace(string(data))
+	i, j := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if i < 0 || j < i || strings.HasPrefix(s, "{") {
+		return data
+	}
+	return []byte(s[i+1 : j])
+}
+
+// clone 复制请求头, 以便修改 Cookie
+func clone(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// fixture 按路径返回 testdata 中的文件, 并记录收到的请求
+func fixture(t *testing.T, files map[string]string) (*httptest.Server, *[]*http.Request) {
+	var reqs []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r)
+		f, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile("testdata/" + f)
+		if err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+func TestQQ(t *testing.T) {
+	srv, reqs := fixture(t, map[string]string{"/search": "qq_search.json"})
+	q := &QQ{SearchURL: srv.URL + "/search"}
+	ss, err := q.Search("晴天", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].ID != "102065756" || ss[0].String() != "晴天 - 周杰伦" || ss[0].Provider != "qq" {
+		t.Fatalf("unexpected %+v", ss)
+	}
+	if got := (*reqs)[0].URL.Query().Get("key"); got != "晴天" {
+		t.Fatal("keyword", got)
+	}
+	if _, err = q.Audio(&ss[0]); err != ErrNoAudio {
+		t.Fatal("expect ErrNoAudio, got", err)
+	}
+}
+
+func TestNetEase(t *testing.T) {
+	srv, reqs := fixture(t, map[string]string{"/search": "163_search.json", "/empty": "empty.json"})
+	ne := &NetEase{SearchURL: srv.URL + "/search", AudioURL: "http://audio"}
+	ss, err := ne.Search("晴天", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 2 || ss[1].Artist != "歌手甲/歌手乙" || ss[0].Album != "叶惠美" {
+		t.Fatalf("unexpected %+v", ss)
+	}
+	if got := (*reqs)[0].URL.Query().Get("limit"); got != "5" {
+		t.Fatal("limit", got)
+	}
+	a, err := ne.Audio(&ss[0])
+	if err != nil || a != "http://audio?id=186016.mp3" {
+		t.Fatal(a, err)
+	}
+	ne.SearchURL = srv.URL + "/empty"
+	if _, err = ne.Search("不存在的歌", 5); err != ErrNoResult {
+		t.Fatal("expect ErrNoResult, got", err)
+	}
+	ne.SearchURL = srv.URL + "/404"
+	if _, err = ne.Search("晴天", 5); err == nil {
+		t.Fatal("expect HTTP error")
+	}
+}
+
+func TestKuwo(t *testing.T) {
+	srv, reqs := fixture(t, map[string]string{"/search": "kuwo_search.json", "/play": "kuwo_play.json"})
+	k := NewKuwo()
+	k.SearchURL, k.AudioURL = srv.URL+"/search", srv.URL+"/play"
+	k.SetCookie("kw_token=TEST")
+	ss, err := k.Search("晴天", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].ID != "440616" || ss[0].Cover == "" {
+		t.Fatalf("unexpected %+v", ss)
+	}
+	a, err := k.Audio(&ss[0])
+	if err != nil || a != "https://other.player.rf01.sycdn.kuwo.cn/440616.mp3" {
+		t.Fatal(a, err)
+	}
+	if got := (*reqs)[1].URL.Query().Get("mid"); got != "440616" {
+		t.Fatal("mid", got)
+	}
+	if got := (*reqs)[0].Header.Get("Cookie"); got != "kw_token=TEST" {
+		t.Fatal("cookie", got)
+	}
+}
+
+func TestKugou(t *testing.T) {
+	srv, reqs := fixture(t, map[string]string{"/search": "kugou_search.txt", "/play": "kugou_play.json"})
+	k := NewKugou()
+	k.SearchURL, k.AudioURL = srv.URL+"/search", srv.URL+"/play"
+	ss, err := k.Search("晴天", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].Name != "晴天" || ss[0].ID != "0A1B2C3D|960399" {
+		t.Fatalf("unexpected %+v", ss)
+	}
+	a, err := k.Audio(&ss[0])
+	if err != nil || a != "https://webfs.kugou.com/0A1B2C3D.mp3" {
+		t.Fatal(a, err)
+	}
+	if ss[0].Cover != "http://imge.kugou.com/stdmusic/1.jpg" {
+		t.Fatal("cover", ss[0].Cover)
+	}
+	q := (*reqs)[1].URL.Query()
+	if q.Get("hash") != "0A1B2C3D" || q.Get("album_id") != "960399" {
+		t.Fatal("query", q)
+	}
+}
+
+func TestMigu(t *testing.T) {
+	srv, _ := fixture(t, map[string]string{"/search": "migu_search.json"})
+	m := NewMigu()
+	m.SearchURL = srv.URL + "/search"
+	ss, err := m.Search("晴天", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.Audio(&ss[0])
+	if err != nil || a != "https://freetyst.nf.migu.cn/1.mp3" {
+		t.Fatal(a, err)
+	}
+}
+
+func TestUnjsonp(t *testing.T) {
+	for in, want := range map[string]string{
+		`callback123({"a":1})`:   `{"a":1}`,
+		"cb({\"a\":(1)})\n":      `{"a":(1)}`,
+		`{"a":"(not jsonp)"}`:    `{"a":"(not jsonp)"}`,
+		`  {"already":"json"}  `: `  {"already":"json"}  `,
+	} {
+		if got := string(unjsonp([]byte(in))); got != want {
+			t.Errorf("unjsonp(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+type fake struct{ name string }
+
+func (f fake) Name() string                     { return f.name }
+func (fake) Search(string, int) ([]Song, error) { return nil, ErrNoResult }
+func (fake) Audio(*Song) (string, error)        { return "", ErrNoAudio }
+
+func TestRegistry(t *testing.T) {
+	Register(fake{"test"}, "测试", "t")
+	t.Cleanup(func() { Unregister("test") })
+	for _, n := range []string{"test", "测试", "t"} {
+		if p, ok := Lookup(n); !ok || p.Name() != "test" {
+			t.Fatal("lookup", n)
+		}
+	}
+	if p, ok := Lookup(""); !ok || p.Name() != "qq" {
+		t.Fatal("default provider should be qq")
+	}
+	names := Names()
+	if names[len(names)-1] != "test" {
+		t.Fatal("order", names)
+	}
+	Unregister("test")
+	if _, ok := Lookup("测试"); ok {
+		t.Fatal("alias should be removed")
+	}
+	for _, n := range Names() {
+		if n == "test" {
+			t.Fatal("name should be removed")
+		}
+	}
+}
@@ -2,208 +2,229 @@
 package music
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/FloatTech/floatbox/web"
-
+	fcext "github.com/FloatTech/floatbox/ctxext"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
-	"github.com/tidwall/gjson"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/music/provider"
 )
 
+// searchsize 搜索结果最多列出的数量
+const searchsize = 5
+
+var engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	DisableOnDefault: false,
+	Brief:            "点歌",
+	Help: "- 点歌[xxx]\n" +
+		"- 网易点歌[xxx]\n" +
+		"- 酷我点歌[xxx]\n" +
+		"- 酷狗点歌[xxx]\n" +
+		"- 咪咕点歌[xxx]\n" +
+		"(搜索到多首时回复序号选择)\n" +
+		"- 音乐[卡片|语音]模式 (群管理员, 语音模式发送可直接播放的语音, 不支持的平台仍发送卡片)\n" +
+		"- 加入歌单 [平台] [xxx] (平台与歌名以空格分隔, 不带歌名时加入本群最近点的歌)\n" +
+		"- 播放歌单[序号] (不带序号时随机播放)\n" +
+		"- 查看歌单\n" +
+		"- 删除歌单[序号]\n" +
+		"- 清空歌单 (群管理员)\n" +
+		"- 点播记录\n" +
+		"- 音乐平台列表\n" +
+		"- 设置音乐cookie [平台] [cookie] (超级用户)",
+	PrivateDataFolder: "music",
+})
+
+var getdb = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+	err := mdb.init(engine.DataFolder() + "music.db")
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return false
+	}
+	cs, err := mdb.cookies()
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return false
+	}
+	for _, c := range cs {
+		if p, ok := provider.Lookup(c.Provider); ok {
+			if cs, ok := p.(provider.CookieSetter); ok {
+				cs.SetCookie(c.Value)
+			}
+		}
+	}
+	return true
+})
+
 func init() {
-	control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault: false,
-		Brief:            "点歌",
-		Help: "- 点歌[xxx]\n" +
-			"- 网易点歌[xxx]\n" +
-			"- 酷我点歌[xxx]\n" +
-			"- 酷狗点歌[xxx]\n" +
-			"- 咪咕点歌[xxx]",
-	}).OnRegex(`^(.{0,2})点歌\s?(.{1,25})$`).SetBlock(true).Limit(ctxext.LimitByUser).
+	engine.OnRegex(`^(.{0,3})点歌\s?(.{1,25})$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			p, s, ok := search(ctx, args[1], args[2])
+			if !ok {
+				return
+			}
+			play(ctx, p, s)
+		})
+	engine.OnRegex(`^音乐(卡片|语音)模式$`, zero.AdminPermission, getdb).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			// switch 平台
-			switch ctx.State["regex_matched"].([]string)[1] {
-			case "咪咕":
-				ctx.SendChain(migu(ctx.State["regex_matched"].([]string)[2]))
-			case "酷我":
-				ctx.SendChain(kuwo(ctx.State["regex_matched"].([]string)[2]))
-			case "酷狗":
-				ctx.SendChain(kugou(ctx.State["regex_matched"].([]string)[2]))
-			case "网易":
-				ctx.SendChain(cloud163(ctx.State["regex_matched"].([]string)[2]))
-			default: // 默认 QQ音乐
-				ctx.SendChain(qqmusic(ctx.State["regex_matched"].([]string)[2]))
+			s := mdb.setting(groupof(ctx))
+			s.Record = ctx.State["regex_matched"].([]string)[1] == "语音"
+			err := mdb.setSetting(s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
 			}
+			ctx.SendChain(message.Text("已切换为", ctx.State["regex_matched"].([]string)[1], "模式"))
+		})
+	engine.OnFullMatch("音乐平台列表").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			sb := strings.Builder{}
+			sb.WriteString("已启用的平台:")
+			for _, n := range provider.Names() {
+				sb.WriteString("\n- ")
+				sb.WriteString(n)
+				as := provider.Aliases(n)
+				for i := 0; i < len(as); i++ {
+					if as[i] == "" || as[i] == n {
+						as = append(as[:i], as[i+1:]...)
+						i--
+					}
+				}
+				if len(as) > 0 {
+					sb.WriteString(" (" + strings.Join(as, ", ") + ")")
+				}
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置音乐cookie\s*(\S+)\s+(.+)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			p, ok := provider.Lookup(args[1])
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 未知的平台 ", args[1]))
+				return
+			}
+			cs, ok := p.(provider.CookieSetter)
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: ", p.Name(), "不需要cookie"))
+				return
+			}
+			err := mdb.setCookie(&cookie{Provider: p.Name(), Value: strings.TrimSpace(args[2])})
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			cs.SetCookie(strings.TrimSpace(args[2]))
+			ctx.SendChain(message.Text("已设置", p.Name(), "的cookie"))
 		})
 }
 
-// migu 返回咪咕音乐卡片
-func migu(keyword string) message.MessageSegment {
-	headers := http.Header{
-		"Cookie":     []string{"audioplayer_exist=1; audioplayer_open=0; migu_cn_cookie_id=3ad476db-f021-4bda-ab91-c485ac3d56a0; Hm_lvt_ec5a5474d9d871cb3d82b846d861979d=1671119573; Hm_lpvt_ec5a5474d9d871cb3d82b846d861979d=1671119573; WT_FPC=id=279ef92eaf314cbb8d01671116477485:lv=1671119583092:ss=1671116477485"},
-		"csrf":       []string{"LWKACV45JSQ"},
-		"User-Agent": []string{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"},
-		"Referer":    []string{"http://m.music.migu.cn"},
-		"proxy":      []string{"false"},
+// groupof 群号, 私聊时为 QQ 号的相反数
+func groupof(ctx *zero.Ctx) int64 {
+	if ctx.Event.GroupID != 0 {
+		return ctx.Event.GroupID
 	}
-	// 搜索音乐信息 第一首歌
-	search, _ := url.Parse("http://m.music.migu.cn/migu/remoting/scr_search_tag")
-	search.RawQuery = url.Values{
-		"keyword": []string{keyword},
-		"type":    []string{"2"},
-		"pgc":     []string{"1"},
-		"rows":    []string{"10"},
-	}.Encode()
-	info := gjson.ParseBytes(netGet(search.String(), headers)).Get("musics.0")
-	// 返回音乐卡片
-	return message.CustomMusic(
-		fmt.Sprintf("https://music.migu.cn/v3/music/song/%s", info.Get("copyrightId").String()),
-		info.Get("mp3").String(),
-		info.Get("songName").String(),
-	).Add("content", info.Get("artist").Str).Add("image", info.Get("cover").Str).Add("subtype", "migu")
+	return -ctx.Event.UserID
 }
 
-// kuwo 返回酷我音乐卡片
-func kuwo(keyword string) message.MessageSegment {
-	headers := http.Header{
-		"Cookie":     []string{"Hm_lvt_cdb524f42f0ce19b169a8071123a4797=1610284708,1610699237; _ga=GA1.2.1289529848.1591618534; kw_token=LWKACV45JSQ; Hm_lpvt_cdb524f42f0ce19b169a8071123a4797=1610699468; _gid=GA1.2.1868980507.1610699238; _gat=1"},
-		"csrf":       []string{"LWKACV45JSQ"},
-		"User-Agent": []string{"Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:84.0) Gecko/20100101 Firefox/84.0"},
-		"Referer":    []string{"https://www.kuwo.cn/search/list?key="},
+// search 在平台上搜索并让用户选择一首
+func search(ctx *zero.Ctx, platform, keyword string) (provider.Provider, *provider.Song, bool) {
+	p, ok := provider.Lookup(platform)
+	if !ok {
+		// 未知的前缀按默认平台搜索
+		p, ok = provider.Lookup("")
+		if !ok {
+			ctx.SendChain(message.Text("ERROR: 没有可用的音乐平台"))
+			return nil, nil, false
+		}
 	}
-	// 搜索音乐信息 第一首歌
-	search, _ := url.Parse("https://www.kuwo.cn/api/www/search/searchMusicBykeyWord")
-	search.RawQuery = url.Values{
-		"key":         []string{keyword},
-		"pn":          []string{"1"},
-		"rn":          []string{"1"},
-		"httpsStatus": []string{"1"},
-	}.Encode()
-	info := gjson.ParseBytes(netGet(search.String(), headers)).Get("data.list.0")
-	// 获得音乐直链
-	music, _ := url.Parse("http://www.kuwo.cn/api/v1/www/music/playUrl")
-	music.RawQuery = url.Values{
-		"mid":         []string{fmt.Sprintf("%d", info.Get("rid").Int())},
-		"type":        []string{"convert_url3"},
-		"br":          []string{"320kmp3"},
-		"httpsStatus": []string{"1"},
-	}.Encode()
-	audio := gjson.ParseBytes(netGet(music.String(), headers))
-	// 返回音乐卡片
-	return message.CustomMusic(
-		fmt.Sprintf("https://www.kuwo.cn/play_detail/%d", info.Get("rid").Int()),
-		audio.Get("data.url").Str,
-		info.Get("name").Str,
-	).Add("content", info.Get("artist").Str).Add("image", info.Get("pic").Str).Add("subtype", "kuwo")
-}
-
-// kugou 返回酷狗音乐卡片
-func kugou(keyword string) message.MessageSegment {
-	stamp := time.Now().UnixNano() / 1e6
-	hash := md5str(
-		fmt.Sprintf(
-			"NVPh5oo715z5DIWAeQlhMDsWXXQV4hwtbitrate=0callback=callback123clienttime=%dclientver=2000dfid=-inputtype=0iscorrection=1isfuzzy=0keyword=%smid=%dpage=1pagesize=30platform=WebFilterprivilege_filter=0srcappid=2919tag=emuserid=-1uuid=%dNVPh5oo715z5DIWAeQlhMDsWXXQV4hwt",
-			stamp, keyword, stamp, stamp,
-		),
-	)
-	// 搜索音乐信息 第一首歌
-	h1 := http.Header{
-		"User-Agent": []string{"Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:84.0) Gecko/20100101 Firefox/84.0"},
+	ss, err := p.Search(strings.TrimSpace(keyword), searchsize)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return nil, nil, false
 	}
-	search, _ := url.Parse("https://complexsearch.kugou.com/v2/search/song")
-	search.RawQuery = url.Values{
-		"callback":         []string{"callback123"},
-		"keyword":          []string{keyword},
-		"page":             []string{"1"},
-		"pagesize":         []string{"30"},
-		"bitrate":          []string{"0"},
-		"isfuzzy":          []string{"0"},
-		"tag":              []string{"em"},
-		"inputtype":        []string{"0"},
-		"platform":         []string{"WebFilter"},
-		"userid":           []string{"-1"},
-		"clientver":        []string{"2000"},
-		"iscorrection":     []string{"1"},
-		"privilege_filter": []string{"0"},
-		"srcappid":         []string{"2919"},
-		"clienttime":       []string{fmt.Sprintf("%d", stamp)},
-		"mid":              []string{fmt.Sprintf("%d", stamp)},
-		"uuid":             []string{fmt.Sprintf("%d", stamp)},
-		"dfid":             []string{"-"},
-		"signature":        []string{hash},
-	}.Encode()
-	res := netGet(search.String(), h1)
-	info := gjson.ParseBytes(res[12 : len(res)-2]).Get("data.lists.0")
-	// 获得音乐直链
-	h2 := http.Header{
-		"Cookie":     []string{"kg_mid=d8e70a262c93d47599c6196c612d6f4f; Hm_lvt_aedee6983d4cfc62f509129360d6bb3d=1610278505,1611631363,1611722252; kg_dfid=33ZWee1kircl0jcJ1h0WF1fX; Hm_lpvt_aedee6983d4cfc62f509129360d6bb3d=1611727348; kg_dfid_collect=d41d8cd98f00b204e9800998ecf8427e"},
-		"Host":       []string{"wwwapi.kugou.com"},
-		"TE":         []string{"Trailers"},
-		"User-Agent": []string{"Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:84.0) Gecko/20100101 Firefox/84.0"},
+	i := pick(ctx, ss)
+	if i < 0 {
+		return nil, nil, false
 	}
-	music := "https://wwwapi.kugou.com/yy/index.php?r=play%2Fgetdata&hash=" + info.Get("FileHash").Str + "&album_id=" + info.Get("AlbumID").Str
-	audio := gjson.ParseBytes(netGet(music, h2)).Get("data")
-	// 返回音乐卡片
-	return message.CustomMusic(
-		"https://www.kugou.com/song/#hash="+audio.Get("hash").Str+"&album_id="+audio.Get("album_id").Str,
-		strings.ReplaceAll(audio.Get("play_backup_url").Str, "\\/", "/"),
-		audio.Get("audio_name").Str,
-	).Add("content", audio.Get("author_name").Str).Add("image", audio.Get("img").Str).Add("subtype", "kugou")
+	return p, &ss[i], true
 }
 
-// cloud163 返回网易云音乐卡片
-func cloud163(keyword string) (msg message.MessageSegment) {
-	requestURL := "http://music.163.com/api/search/get/web?type=1&limit=1&s=" + url.QueryEscape(keyword)
-	data, err := web.GetData(requestURL)
-	if err != nil {
-		msg = message.Text("ERROR: ", err)
-		return
+// pick 多个结果时列出并等待用户回复序号, 返回负数表示取消或超时
+func pick(ctx *zero.Ctx, ss []provider.Song) int {
+	if len(ss) == 1 {
+		return 0
 	}
-	msg = message.Music("163", gjson.ParseBytes(data).Get("result.songs.0.id").Int())
-	return
-}
-
-// qqmusic 返回QQ音乐卡片
-func qqmusic(keyword string) (msg message.MessageSegment) {
-	requestURL := "https://c.y.qq.com/splcloud/fcgi-bin/smartbox_new.fcg?platform=yqq.json&key=" + url.QueryEscape(keyword)
-	data, err := web.RequestDataWith(web.NewDefaultClient(), requestURL, "GET", "", web.RandUA(), nil)
-	if err != nil {
-		msg = message.Text("ERROR: ", err)
-		return
+	sb := strings.Builder{}
+	sb.WriteString("找到以下歌曲, 请回复序号选择(30s内), 回复c取消:")
+	for i := range ss {
+		sb.WriteString("\n[" + strconv.Itoa(i+1) + "] " + ss[i].String())
+		if ss[i].Album != "" {
+			sb.WriteString(" 《" + ss[i].Album + "》")
+		}
+	}
+	ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sb.String()))
+	recv, cancel := zero.NewFutureEvent("message", 999, false, ctx.CheckSession()).Repeat()
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-time.After(time.Second * 30):
+			ctx.SendChain(message.Text("选择超时, 已取消"))
+			return -1
+		case e := <-recv:
+			msg := strings.TrimSpace(e.Event.Message.ExtractPlainText())
+			if msg == "c" {
+				ctx.SendChain(message.Text("已取消"))
+				return -2
+			}
+			n, err := strconv.Atoi(msg)
+			if err != nil || n < 1 || n > len(ss) {
+				ctx.SendChain(message.Text("请输入1-", len(ss), "的序号 (回复c取消)"))
+				continue
+			}
+			return n - 1
+		}
 	}
-	msg = message.Music("qq", gjson.ParseBytes(data).Get("data.song.itemlist.0.id").Int())
-	return
+	ctx.SendChain(message.Text("连续输入错误, 已取消"))
+	return -3
 }
 
-// md5str 返回字符串 MD5
-func md5str(s string) string {
-	h := md5.New()
-	h.Write([]byte(s))
-	result := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
-	return result
+// play 按群设置发送卡片或语音, 并记录点歌
+func play(ctx *zero.Ctx, p provider.Provider, s *provider.Song) {
+	gid := groupof(ctx)
+	if mdb.setting(gid).Record {
+		a, err := p.Audio(s)
+		if err == nil {
+			ctx.SendChain(message.Text(s.String()))
+			ctx.SendChain(message.Record(a))
+		} else {
+			ctx.SendChain(card(p, s))
+		}
+	} else {
+		ctx.SendChain(card(p, s))
+	}
+	if err := mdb.play(gid, ctx.Event.UserID, s); err != nil {
+		logrus.Warnln("[music] 记录点歌失败:", err)
+	}
 }
 
-// netGet 返回请求数据
-func netGet(url string, header http.Header) []byte {
-	client := &http.Client{}
-	request, _ := http.NewRequest("GET", url, nil)
-	request.Header = header
-	res, err := client.Do(request)
+// card 音乐卡片, QQ音乐与网易云使用平台卡片, 其余为自定义卡片
+func card(p provider.Provider, s *provider.Song) message.MessageSegment {
+	switch p.Name() {
+	case "qq", "163":
+		id, _ := strconv.ParseInt(s.ID, 10, 64)
+		return message.Music(p.Name(), id)
+	}
+	a, err := p.Audio(s)
 	if err != nil {
-		return nil
+		logrus.Debugln("[music]", p.Name(), "获取音频失败:", err)
 	}
-	defer res.Body.Close()
-	result, _ := io.ReadAll(res.Body)
-	return result
+	return message.CustomMusic(s.Page, a, s.Name).Add("content", s.Artist).Add("image", s.Cover).Add("subtype", p.Name())
 }
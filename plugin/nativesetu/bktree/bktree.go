@@ -0,0 +1,151 @@
+// Package bktree 以汉明距离为度量的 BK 树, 用于检索相近的 64 位感知哈希
+package bktree
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Distance 两个哈希的汉明距离
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+type node[T any] struct {
+	hash     uint64
+	values   []T // 哈希完全相同的条目
+	children map[int]*node[T]
+}
+
+// Tree BK 树, 非并发安全
+type Tree[T any] struct {
+	root *node[T]
+	size int
+}
+
+// New 新建空树
+func New[T any]() *Tree[T] {
+	return &Tree[T]{}
+}
+
+// Len 条目数
+func (t *Tree[T]) Len() int {
+	return t.size
+}
+
+// Add 插入一个条目
+func (t *Tree[T]) Add(hash uint64, v T) {
+	t.size++
+	if t.root == nil {
+		t.root = &node[T]{hash: hash, values: []T{v}}
+		return
+	}
+	n := t.root
+	for {
+		d := Distance(n.hash, hash)
+		if d == 0 {
+			n.values = append(n.values, v)
+			return
+		}
+		c, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*node[T])
+			}
+			n.children[d] = &node[T]{hash: hash, values: []T{v}}
+			return
+		}
+		n = c
+	}
+}
+
+// Match 一条检索结果
+type Match[T any] struct {
+	Hash     uint64
+	Distance int
+	Value    T
+}
+
+// Search 返回与 hash 距离不超过 radius 的所有条目, 按距离升序
+func (t *Tree[T]) Search(hash uint64, radius int) []Match[T] {
+	var out []Match[T]
+	if t.root == nil {
+		return out
+	}
+	stack := []*node[T]{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := Distance(n.hash, hash)
+		if d <= radius {
+			for _, v := range n.values {
+				out = append(out, Match[T]{Hash: n.hash, Distance: d, Value: v})
+			}
+		}
+		// 三角不等式: 只有距离在 [d-radius, d+radius] 内的子树可能命中
+		for k, c := range n.children {
+			if k >= d-radius && k <= d+radius {
+				stack = append(stack, c)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Distance < out[j].Distance
+	})
+	return out
+}
+
+// Nearest 返回距离不超过 radius 的最近 k 个条目
+func (t *Tree[T]) Nearest(hash uint64, k, radius int) []Match[T] {
+	out := t.Search(hash, radius)
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// Walk 遍历每个不同的哈希及其条目
+func (t *Tree[T]) Walk(f func(hash uint64, values []T)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*node[T]{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		f(n.hash, n.values)
+		for _, c := range n.children {
+			stack = append(stack, c)
+		}
+	}
+}
+
+// Pair 一对相近的条目
+type Pair[T any] struct {
+	A, B     T
+	Distance int
+}
+
+// Pairs 列出所有距离不超过 radius 的条目对, 按距离升序, 每对只出现一次
+func (t *Tree[T]) Pairs(radius int) []Pair[T] {
+	var out []Pair[T]
+	t.Walk(func(hash uint64, values []T) {
+		for i := 0; i < len(values); i++ {
+			for j := i + 1; j < len(values); j++ {
+				out = append(out, Pair[T]{A: values[i], B: values[j]})
+			}
+		}
+		for _, m := range t.Search(hash, radius) {
+			// 不同哈希的组合只在较小的一侧记录
+			if m.Hash > hash {
+				for _, v := range values {
+					out = append(out, Pair[T]{A: v, B: m.Value, Distance: m.Distance})
+				}
+			}
+		}
+	})
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Distance < out[j].Distance
+	})
+	return out
+}
@@ -0,0 +1,56 @@
+package bktree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	tr := New[string]()
+	tr.Add(0b0000, "a")
+	tr.Add(0b0001, "b")
+	tr.Add(0b0011, "c")
+	tr.Add(0b1111, "d")
+	tr.Add(0b0000, "a2")
+	if tr.Len() != 5 {
+		t.Fatal("unexpected len", tr.Len())
+	}
+	ms := tr.Search(0b0000, 1)
+	if len(ms) != 3 || ms[2].Value != "b" || ms[2].Distance != 1 {
+		t.Fatal("unexpected matches", ms)
+	}
+	ms = tr.Nearest(0b0111, 2, 64)
+	if len(ms) != 2 || ms[0].Distance != 1 || ms[1].Distance != 1 {
+		t.Fatal("unexpected nearest", ms)
+	}
+	ps := tr.Pairs(1)
+	// a-a2, a-b, a2-b, b-c
+	if len(ps) != 4 || ps[0].Distance != 0 {
+		t.Fatal("unexpected pairs", ps)
+	}
+}
+
+func TestSearchMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tr := New[int]()
+	hs := make([]uint64, 2000)
+	for i := range hs {
+		hs[i] = r.Uint64()
+		if i%10 == 0 && i > 0 {
+			hs[i] = hs[i-1] ^ (1 << uint(r.Intn(64)))
+		}
+		tr.Add(hs[i], i)
+	}
+	for q := 0; q < 50; q++ {
+		h := hs[r.Intn(len(hs))] ^ (1 << uint(r.Intn(64)))
+		want := 0
+		for _, x := range hs {
+			if Distance(x, h) <= 8 {
+				want++
+			}
+		}
+		if got := len(tr.Search(h, 8)); got != want {
+			t.Fatal("expect", want, "got", got)
+		}
+	}
+}
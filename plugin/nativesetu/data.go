@@ -5,9 +5,9 @@ import (
 	"image"
 	"io/fs"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/corona10/goimagehash"
 	"github.com/sirupsen/logrus"
@@ -19,16 +19,34 @@ import (
 
 // setuclass holds setus in a folder, which is the class name.
 type setuclass struct {
-	ImgID int64  `db:"imgid"` // ImgID 图片唯一 id (dhash)
+	Path  string `db:"path"`  // Path 图片路径, 增量刷新以此为键
+	ImgID int64  `db:"imgid"` // ImgID 图片 dhash
 	Name  string `db:"name"`  // Name 图片名
-	Path  string `db:"path"`  // Path 图片路径
+	Mtime int64  `db:"mtime"` // Mtime 图片与标签文件中较新的修改时间 (ns)
+	Tags  string `db:"tags"`  // Tags 空格分隔的标签, 首尾各有一个空格以便匹配
 }
 
 var ns = &nsetu{db: &sql.Sqlite{}}
 
 type nsetu struct {
-	db *sql.Sqlite
-	mu sync.RWMutex
+	db     *sql.Sqlite
+	mu     sync.RWMutex
+	scanmu sync.Mutex // 同一时间只进行一次扫描
+}
+
+// scanresult 一次扫描的增删改计数
+type scanresult struct {
+	added, updated, removed int
+}
+
+func (r *scanresult) merge(o scanresult) {
+	r.added += o.added
+	r.updated += o.updated
+	r.removed += o.removed
+}
+
+func (r *scanresult) String() string {
+	return "新增" + strconv.Itoa(r.added) + " 更新" + strconv.Itoa(r.updated) + " 删除" + strconv.Itoa(r.removed)
 }
 
 func (n *nsetu) List() (l []string) {
@@ -42,77 +60,199 @@ func (n *nsetu) List() (l []string) {
 	return
 }
 
-func (n *nsetu) scanall(path string) error {
-	model := &setuclass{}
-	root := os.DirFS(path)
-	_ = n.db.Close()
-	_ = os.Remove(n.db.DBPath)
-	err := n.db.Open(time.Hour)
-	if err != nil {
-		return err
+// outdated 旧版本的分类表没有 path 主键与 mtime, 需要重建
+func (n *nsetu) outdated(clsn string) bool {
+	_, err := n.db.DB.Exec("SELECT path, mtime, tags FROM " + quote(clsn) + " LIMIT 0;")
+	return err != nil
+}
+
+// hasoutdated 是否存在需要重建的分类
+func (n *nsetu) hasoutdated() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, c := range n.List() {
+		if n.outdated(c) {
+			return true
+		}
 	}
-	return fs.WalkDir(root, ".", func(path string, d fs.DirEntry, err error) error {
+	return false
+}
+
+// scanall 增量刷新所有分类, 并删除已不存在的分类
+func (n *nsetu) scanall(path string) (r scanresult, err error) {
+	n.scanmu.Lock()
+	defer n.scanmu.Unlock()
+	defer invalidate()
+	root := os.DirFS(path)
+	exist := make(map[string]bool)
+	err = fs.WalkDir(root, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() {
 			clsn := d.Name()
 			if clsn != "." {
-				n.mu.Lock()
-				err = n.db.Create(clsn, model)
-				n.mu.Unlock()
-				if err == nil {
-					err = n.scanclass(root, path, clsn)
-					if err != nil {
-						logrus.Errorln("[nsetu]", err)
-						return err
-					}
+				exist[clsn] = true
+				res, err := n.scanclass(root, path, clsn)
+				if err != nil {
+					logrus.Errorln("[nsetu]", err)
+					return err
 				}
+				r.merge(res)
 			}
 		}
 		return nil
 	})
+	if err != nil {
+		return
+	}
+	for _, c := range n.List() {
+		if !exist[c] {
+			n.mu.Lock()
+			cnt, _ := n.db.Count(c)
+			err = n.db.Drop(c)
+			n.mu.Unlock()
+			r.removed += cnt
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
 }
 
-func (n *nsetu) scanclass(root fs.FS, path, clsn string) error {
+// rescan 增量刷新一个分类
+func (n *nsetu) rescan(root fs.FS, path, clsn string) (scanresult, error) {
+	n.scanmu.Lock()
+	defer n.scanmu.Unlock()
+	defer invalidate()
+	return n.scanclass(root, path, clsn)
+}
+
+// scanclass 对比路径与修改时间, 只重新计算有变动的图片
+func (n *nsetu) scanclass(root fs.FS, path, clsn string) (r scanresult, err error) {
 	ds, err := fs.ReadDir(root, path)
 	if err != nil {
-		return err
+		return
 	}
 	n.mu.Lock()
-	_ = n.db.Drop(clsn)
-	_ = n.db.Create(clsn, &setuclass{})
+	if n.outdated(clsn) {
+		_ = n.db.Drop(clsn)
+	}
+	err = n.db.Create(clsn, &setuclass{})
 	n.mu.Unlock()
+	if err != nil {
+		return
+	}
+	old := make(map[string]setuclass)
+	sc := &setuclass{}
+	n.mu.RLock()
+	err = n.db.FindFor(clsn, sc, "", func() error {
+		old[sc.Path] = *sc
+		return nil
+	})
+	n.mu.RUnlock()
+	if err != nil && err != sql.ErrNullResult {
+		return
+	}
+	err = nil
+	names := make(map[string]bool, len(ds))
+	for _, d := range ds {
+		names[d.Name()] = true
+	}
 	for _, d := range ds {
 		nm := d.Name()
-		ln := strings.ToLower(nm)
-		if !d.IsDir() &&
-			(strings.HasSuffix(ln, ".jpg") || strings.HasSuffix(ln, ".jpeg") ||
-				strings.HasSuffix(ln, ".png") || strings.HasSuffix(ln, ".gif") || strings.HasSuffix(ln, ".webp")) {
-			relpath := path + "/" + nm
-			logrus.Debugln("[nsetu] read", relpath)
-			f, e := fs.ReadFile(root, relpath)
-			if e != nil {
-				return e
-			}
-			b := bytes.NewReader(f)
-			img, _, e := image.Decode(b)
-			if e != nil {
-				return e
-			}
-			dh, e := goimagehash.DifferenceHash(img)
-			if e != nil {
-				return e
+		if d.IsDir() || !isimage(nm) {
+			continue
+		}
+		relpath := path + "/" + nm
+		info, e := d.Info()
+		if e != nil {
+			return r, e
+		}
+		mtime := info.ModTime().UnixNano()
+		side := sidecar(names, nm)
+		if side != "" {
+			if si, e := fs.Stat(root, path+"/"+side); e == nil && si.ModTime().UnixNano() > mtime {
+				mtime = si.ModTime().UnixNano()
 			}
-			dhi := int64(dh.GetHash())
-			logrus.Debugln("[nsetu] insert", nm, "with id", dhi, "into", clsn)
-			n.mu.Lock()
-			err = n.db.Insert(clsn, &setuclass{ImgID: dhi, Name: nm, Path: relpath})
-			n.mu.Unlock()
-			if err != nil {
-				return err
+		}
+		o, ok := old[relpath]
+		delete(old, relpath)
+		if ok && o.Mtime == mtime {
+			continue
+		}
+		logrus.Debugln("[nsetu] read", relpath)
+		f, e := fs.ReadFile(root, relpath)
+		if e != nil {
+			return r, e
+		}
+		img, _, e := image.Decode(bytes.NewReader(f))
+		if e != nil {
+			return r, e
+		}
+		dh, e := goimagehash.DifferenceHash(img)
+		if e != nil {
+			return r, e
+		}
+		tags := exiftags(f)
+		if side != "" {
+			b, e := fs.ReadFile(root, path+"/"+side)
+			if e == nil {
+				tags = append(tags, splittags(string(b))...)
 			}
 		}
+		dhi := int64(dh.GetHash())
+		logrus.Debugln("[nsetu] insert", nm, "with id", dhi, "into", clsn)
+		n.mu.Lock()
+		err = n.db.Insert(clsn, &setuclass{Path: relpath, ImgID: dhi, Name: nm, Mtime: mtime, Tags: jointags(tags)})
+		n.mu.Unlock()
+		if err != nil {
+			return
+		}
+		if ok {
+			r.updated++
+		} else {
+			r.added++
+		}
+	}
+	for p := range old {
+		n.mu.Lock()
+		err = n.db.Del(clsn, "WHERE path = "+quote(p))
+		n.mu.Unlock()
+		if err != nil {
+			return
+		}
+		r.removed++
 	}
-	return nil
+	return
+}
+
+// drop 删除一个分类
+func (n *nsetu) drop(clsn string) error {
+	defer invalidate()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.db.Drop(clsn)
+}
+
+// pick 随机抽取一张图片, tag 不为空时只在带有该标签的图片中抽取
+func (n *nsetu) pick(clsn, tag string) (*setuclass, error) {
+	sc := &setuclass{}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if tag == "" {
+		return sc, n.db.Pick(clsn, sc)
+	}
+	return sc, n.db.Find(clsn, sc, "WHERE tags LIKE "+quote("% "+tag+" %")+" ORDER BY RANDOM() limit 1")
+}
+
+func isimage(nm string) bool {
+	ln := strings.ToLower(nm)
+	return strings.HasSuffix(ln, ".jpg") || strings.HasSuffix(ln, ".jpeg") ||
+		strings.HasSuffix(ln, ".png") || strings.HasSuffix(ln, ".gif") || strings.HasSuffix(ln, ".webp")
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
 }
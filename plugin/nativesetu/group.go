@@ -0,0 +1,84 @@
+package nativesetu
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const allowTable = "allow"
+
+// allowclass 群内允许使用的分类, 某群没有记录时允许所有分类
+type allowclass struct {
+	ID      string `db:"id"` // ID 群号/分类
+	GroupID int64  `db:"gid"`
+	Class   string `db:"class"`
+}
+
+var gdb = &groupdb{}
+
+type groupdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+func (gdb *groupdb) init(dbpath string) error {
+	gdb.DBPath = dbpath
+	err := gdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	return gdb.Create(allowTable, &allowclass{})
+}
+
+// allowed 群内允许的分类, 为空表示不限
+func (gdb *groupdb) allowed(gid int64) (cls []string, err error) {
+	gdb.RLock()
+	defer gdb.RUnlock()
+	a := &allowclass{}
+	err = gdb.FindFor(allowTable, a, "WHERE gid = "+strconv.FormatInt(gid, 10)+" ORDER BY class", func() error {
+		cls = append(cls, a.Class)
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+// isallowed 群内是否可以使用该分类, 私聊不限
+func (gdb *groupdb) isallowed(gid int64, clsn string) bool {
+	if gid == 0 {
+		return true
+	}
+	cls, err := gdb.allowed(gid)
+	if err != nil || len(cls) == 0 {
+		return true
+	}
+	for _, c := range cls {
+		if c == clsn {
+			return true
+		}
+	}
+	return false
+}
+
+// setallowed 替换群内允许的分类, cls 为空时取消限制
+func (gdb *groupdb) setallowed(gid int64, cls []string) error {
+	gdb.Lock()
+	defer gdb.Unlock()
+	g := strconv.FormatInt(gid, 10)
+	err := gdb.Del(allowTable, "WHERE gid = "+g)
+	if err != nil {
+		return err
+	}
+	for _, c := range cls {
+		err = gdb.Insert(allowTable, &allowclass{ID: g + "/" + c, GroupID: gid, Class: c})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package nativesetu
+
+import (
+	"bytes"
+	"image"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/corona10/goimagehash"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/nativesetu/bktree"
+)
+
+// entry 索引中的一张图
+type entry struct {
+	Class string
+	setuclass
+}
+
+func (e *entry) String() string {
+	return e.Class + "/" + e.Name
+}
+
+var (
+	// index 所有分类的 dhash 索引, 为 nil 时在下次检索时重建
+	index   *bktree.Tree[*entry]
+	indexmu sync.Mutex
+)
+
+// invalidate 使索引失效
+func invalidate() {
+	indexmu.Lock()
+	index = nil
+	indexmu.Unlock()
+}
+
+// getindex 获取索引, 必要时从数据库重建
+func (n *nsetu) getindex() (*bktree.Tree[*entry], error) {
+	indexmu.Lock()
+	defer indexmu.Unlock()
+	if index != nil {
+		return index, nil
+	}
+	t := bktree.New[*entry]()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for _, c := range n.List() {
+		sc := &setuclass{}
+		err := n.db.FindFor(c, sc, "", func() error {
+			t.Add(uint64(sc.ImgID), &entry{Class: c, setuclass: *sc})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	index = t
+	return t, nil
+}
+
+// search 检索与图片最相近的 k 张本地图片
+func (n *nsetu) search(data []byte, k, radius int) ([]bktree.Match[*entry], error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	dh, err := goimagehash.DifferenceHash(img)
+	if err != nil {
+		return nil, err
+	}
+	t, err := n.getindex()
+	if err != nil {
+		return nil, err
+	}
+	return t.Nearest(dh.GetHash(), k, radius), nil
+}
+
+// duplicates 列出距离不超过 radius 的图片对, crossonly 时只列出不同分类间的
+func (n *nsetu) duplicates(radius int, crossonly bool) ([]bktree.Pair[*entry], error) {
+	t, err := n.getindex()
+	if err != nil {
+		return nil, err
+	}
+	ps := t.Pairs(radius)
+	if !crossonly {
+		return ps, nil
+	}
+	out := ps[:0]
+	for _, p := range ps {
+		if p.A.Class != p.B.Class {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// formatpairs 打印图片对
+func formatpairs(ps []bktree.Pair[*entry]) string {
+	var sb strings.Builder
+	for i, p := range ps {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(strconv.Itoa(i+1) + ". [" + strconv.Itoa(p.Distance) + "] " + p.A.String() + " <-> " + p.B.String())
+	}
+	return sb.String()
+}
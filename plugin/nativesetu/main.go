@@ -4,6 +4,8 @@ package nativesetu
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -11,26 +13,41 @@ import (
 	"github.com/wdvxdr1123/ZeroBot/message"
 	"github.com/wdvxdr1123/ZeroBot/utils/helper"
 
+	"github.com/FloatTech/floatbox/binary"
 	fcext "github.com/FloatTech/floatbox/ctxext"
 	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/floatbox/web"
+	sql "github.com/FloatTech/sqlite"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
 )
 
 var (
 	setupath = "/tmp" // 绝对路径，图片根目录
 )
 
+// maxdistance 搜图与查重允许的最大汉明距离
+const maxdistance = 16
+
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "本地涩图",
 		Help: "- 本地[xxx]\n" +
+			"- 本地[xxx] 标签[yyy]\n" +
 			"- 刷新本地[xxx]\n" +
 			"- 设置本地setu绝对路径[xxx]\n" +
 			"- 刷新所有本地setu\n" +
-			"- 所有本地setu分类",
+			"- 所有本地setu分类\n" +
+			"- 本地搜图[图片]\n" +
+			"- 本地setu查重[阈值]\n" +
+			"- [开启|关闭]本地setu监听\n" +
+			"- 设置本群本地setu分类[xxx yyy ...]\n" +
+			"- 清除本群本地setu分类\n" +
+			"注: 搜图与查重按 dhash 的汉明距离比较, 查重阈值默认为4, 最大16\n" +
+			"注: 标签读取自同名的 .txt 文件 (如 a.jpg.txt 或 a.txt) 与 EXIF 的描述/关键字",
 		PrivateDataFolder: "nsetu",
 	})
 
@@ -47,14 +64,42 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	err = gdb.init(engine.DataFolder() + "group.db")
+	if err != nil {
+		panic(err)
+	}
+	if ns.hasoutdated() {
+		// 旧版本的数据库缺少增量刷新所需的字段, 在后台重建
+		go func() {
+			r, err := ns.scanall(setupath)
+			if err != nil {
+				logrus.Errorln("[nsetu] rebuild err:", err)
+				return
+			}
+			logrus.Infoln("[nsetu] rebuild", r.String())
+		}()
+	}
+	watchfile := engine.DataFolder() + "watch"
+	if file.IsExist(watchfile) {
+		err = fw.start(setupath)
+		if err != nil {
+			logrus.Errorln("[nsetu] watch err:", err)
+		}
+	}
 
-	engine.OnRegex(`^本地(.*)$`, fcext.ValueInList(func(ctx *zero.Ctx) string { return ctx.State["regex_matched"].([]string)[1] }, ns)).SetBlock(true).
+	engine.OnRegex(`^本地(.+?)(?:\s+标签\s*(\S+))?$`, fcext.ValueInList(func(ctx *zero.Ctx) string { return ctx.State["regex_matched"].([]string)[1] }, ns)).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			imgtype := ctx.State["regex_matched"].([]string)[1]
-			sc := new(setuclass)
-			ns.mu.RLock()
-			err := ns.db.Pick(imgtype, sc)
-			ns.mu.RUnlock()
+			tag := ctx.State["regex_matched"].([]string)[2]
+			if !gdb.isallowed(ctx.Event.GroupID, imgtype) {
+				ctx.SendChain(message.Text("本群未开放分类", imgtype))
+				return
+			}
+			sc, err := ns.pick(imgtype, tag)
+			if err == sql.ErrNullResult && tag != "" {
+				ctx.SendChain(message.Text(imgtype, "中没有带标签", tag, "的图片"))
+				return
+			}
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 			} else {
@@ -72,9 +117,9 @@ func init() {
 	engine.OnRegex(`^刷新本地(.*)$`, fcext.ValueInList(func(ctx *zero.Ctx) string { return ctx.State["regex_matched"].([]string)[1] }, ns), zero.SuperUserPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			imgtype := ctx.State["regex_matched"].([]string)[1]
-			err := ns.scanclass(os.DirFS(setupath), imgtype, imgtype)
+			r, err := ns.rescan(os.DirFS(setupath), imgtype, imgtype)
 			if err == nil {
-				ctx.SendChain(message.Text("成功！"))
+				ctx.SendChain(message.Text("成功！", r.String()))
 			} else {
 				ctx.SendChain(message.Text("ERROR: ", err))
 			}
@@ -83,6 +128,9 @@ func init() {
 		Handle(func(ctx *zero.Ctx) {
 			setupath = ctx.State["regex_matched"].([]string)[1]
 			err := os.WriteFile(cfgfile, helper.StringToBytes(setupath), 0644)
+			if err == nil && fw.running() {
+				err = fw.start(setupath)
+			}
 			if err == nil {
 				ctx.SendChain(message.Text("成功！"))
 			} else {
@@ -91,19 +139,150 @@ func init() {
 		})
 	engine.OnFullMatch("刷新所有本地setu", zero.SuperUserPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			err := ns.scanall(setupath)
-			if err == nil {
-				ctx.SendChain(message.Text("成功！"))
+			r, err := ns.scanall(setupath)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ps, err := ns.duplicates(0, true)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ps) == 0 {
+				ctx.SendChain(message.Text("成功！", r.String()))
+				return
+			}
+			msg := "成功！" + r.String() + "\n发现" + strconv.Itoa(len(ps)) + "组跨分类的重复图片:\n"
+			if len(ps) > 10 {
+				msg += formatpairs(ps[:10]) + "\n...\n发送\"本地setu查重0\"查看全部"
 			} else {
+				msg += formatpairs(ps)
+			}
+			ctx.SendChain(message.Text(msg))
+		})
+	engine.OnPrefix("本地搜图", zero.MustProvidePicture).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			data, err := web.GetData(ctx.State["image_url"].([]string)[0])
+			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ms, err := ns.search(data, 50, maxdistance)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			// 只展示本群允许的分类
+			allowed := ms[:0]
+			for _, m := range ms {
+				if len(allowed) < 5 && gdb.isallowed(ctx.Event.GroupID, m.Value.Class) {
+					allowed = append(allowed, m)
+				}
+			}
+			ms = allowed
+			if len(ms) == 0 {
+				ctx.SendChain(message.Text("没有找到相似的本地图片"))
+				return
+			}
+			msg := "本地搜图结果:"
+			for i, m := range ms {
+				msg += fmt.Sprintf("\n%d. %s 相似度%.1f%%", i+1, m.Value, float64(64-m.Distance)*100/64)
+			}
+			p := "file:///" + setupath + "/" + ms[0].Value.Path
+			if ctx.Event.GroupID != 0 {
+				ctx.SendGroupForwardMessage(ctx.Event.GroupID, message.Message{
+					ctxext.FakeSenderForwardNode(ctx, message.Text(msg, "\n"), message.Image(p)),
+				})
+				return
 			}
+			ctx.SendChain(message.Text(msg, "\n"), message.Image(p))
+		})
+	engine.OnRegex(`^本地setu查重\s*(\d*)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			radius := 4
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				radius, _ = strconv.Atoi(s)
+			}
+			if radius > maxdistance {
+				radius = maxdistance
+			}
+			ps, err := ns.duplicates(radius, false)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ps) == 0 {
+				ctx.SendChain(message.Text("没有相似度在阈值内的图片"))
+				return
+			}
+			msg := "共" + strconv.Itoa(len(ps)) + "组相似图片 [距离]\n" + formatpairs(ps)
+			if len(ps) <= 10 {
+				ctx.SendChain(message.Text(msg))
+				return
+			}
+			data, err := text.RenderToBase64(msg, text.FontFile, 800, 18)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Image("base64://" + binary.BytesToString(data)))
+		})
+	engine.OnRegex(`^(开启|关闭)本地setu监听$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			var err error
+			if ctx.State["regex_matched"].([]string)[1] == "开启" {
+				err = fw.start(setupath)
+				if err == nil {
+					err = os.WriteFile(watchfile, nil, 0644)
+				}
+			} else {
+				fw.stop()
+				if file.IsExist(watchfile) {
+					err = os.Remove(watchfile)
+				}
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！"))
+		})
+	engine.OnRegex(`^设置本群本地setu分类\s*(.+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			cls := strings.Fields(ctx.State["regex_matched"].([]string)[1])
+			for _, c := range cls {
+				if !isclass(c) {
+					ctx.SendChain(message.Text("ERROR: 没有分类", c))
+					return
+				}
+			}
+			err := gdb.setallowed(ctx.Event.GroupID, cls)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！本群仅可使用: ", strings.Join(cls, " ")))
+		})
+	engine.OnFullMatch("清除本群本地setu分类", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			err := gdb.setallowed(ctx.Event.GroupID, nil)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！本群可使用所有分类"))
 		})
 	engine.OnFullMatch("所有本地setu分类").SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			msg := "本地setu分类一览"
 			hasnotchange := true
+			i := 0
 			ns.mu.RLock()
-			for i, c := range ns.List() {
+			for _, c := range ns.List() {
+				if !gdb.isallowed(ctx.Event.GroupID, c) {
+					continue
+				}
 				n, err := ns.db.Count(c)
 				if err == nil {
 					msg += fmt.Sprintf("\n%02d. %s(%d)", i, c, n)
@@ -112,6 +291,7 @@ func init() {
 					logrus.Errorln("[nsetu]", err)
 				}
 				hasnotchange = false
+				i++
 			}
 			ns.mu.RUnlock()
 			if hasnotchange {
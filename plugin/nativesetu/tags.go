@@ -0,0 +1,69 @@
+package nativesetu
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// sidecar 图片对应的标签文件名, 可为 xxx.jpg.txt 或 xxx.txt, 不存在时返回空
+func sidecar(names map[string]bool, nm string) string {
+	for _, s := range [...]string{nm + ".txt", strings.TrimSuffix(nm, path.Ext(nm)) + ".txt"} {
+		if names[s] {
+			return s
+		}
+	}
+	return ""
+}
+
+// exiftags 读取 EXIF 中的图片描述与 Windows 关键字 (XPKeywords)
+func exiftags(data []byte) (tags []string) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	if t, err := x.Get(exif.ImageDescription); err == nil {
+		if s, err := t.StringVal(); err == nil {
+			tags = append(tags, splittags(s)...)
+		}
+	}
+	if t, err := x.Get(exif.XPKeywords); err == nil && len(t.Val) >= 2 {
+		// XPKeywords 为 UTF-16LE, 以分号分隔
+		u := make([]uint16, len(t.Val)/2)
+		for i := range u {
+			u[i] = uint16(t.Val[2*i]) | uint16(t.Val[2*i+1])<<8
+		}
+		tags = append(tags, splittags(string(utf16.Decode(u)))...)
+	}
+	return
+}
+
+// splittags 按空白与常见分隔符拆分标签
+func splittags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == 0 || strings.ContainsRune(",;，；、#", r)
+	})
+}
+
+// jointags 去重后以空格连接, 首尾各留一个空格
+func jointags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	seen := make(map[string]bool, len(tags))
+	var sb strings.Builder
+	sb.WriteByte(' ')
+	for _, t := range tags {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		sb.WriteString(t)
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
@@ -0,0 +1,173 @@
+package nativesetu
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// debounce 文件变动后等待该时长再刷新, 以合并连续的写入
+const debounce = 3 * time.Second
+
+var fw = &folderwatcher{}
+
+// folderwatcher 监听图片根目录及各分类目录, 有变动时增量刷新对应分类
+type folderwatcher struct {
+	mu     sync.Mutex
+	w      *fsnotify.Watcher
+	root   string
+	timers map[string]*time.Timer // 分类目录 -> 待执行的刷新
+}
+
+// running 是否正在监听
+func (f *folderwatcher) running() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.w != nil
+}
+
+// start 开始监听 root, 已在监听时先停止
+func (f *folderwatcher) start(root string) error {
+	f.stop()
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.Add(p)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	f.mu.Lock()
+	f.w, f.root, f.timers = w, root, make(map[string]*time.Timer)
+	f.mu.Unlock()
+	go f.loop(w)
+	return nil
+}
+
+// stop 停止监听
+func (f *folderwatcher) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.w == nil {
+		return
+	}
+	_ = f.w.Close()
+	f.w = nil
+	for _, t := range f.timers {
+		t.Stop()
+	}
+	f.timers = nil
+}
+
+func (f *folderwatcher) loop(w *fsnotify.Watcher) {
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			f.handle(w, ev)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			logrus.Warnln("[nsetu] watcher:", err)
+		}
+	}
+}
+
+func (f *folderwatcher) handle(w *fsnotify.Watcher, ev fsnotify.Event) {
+	if ev.Has(fsnotify.Chmod) && !ev.Has(fsnotify.Write) {
+		return
+	}
+	f.mu.Lock()
+	root := f.root
+	f.mu.Unlock()
+	if ev.Name == root {
+		return
+	}
+	if ev.Has(fsnotify.Create) {
+		if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+			// 新分类
+			_ = w.Add(ev.Name)
+			f.schedule(ev.Name)
+			return
+		}
+	}
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		// 可能是分类目录本身被删除或移走, 由 refresh 判断
+		f.schedule(ev.Name)
+	}
+	f.schedule(filepath.Dir(ev.Name))
+}
+
+// schedule 延迟刷新目录 dir 对应的分类
+func (f *folderwatcher) schedule(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.w == nil || dir == f.root {
+		return
+	}
+	if t, ok := f.timers[dir]; ok {
+		t.Reset(debounce)
+		return
+	}
+	root := f.root
+	f.timers[dir] = time.AfterFunc(debounce, func() {
+		f.mu.Lock()
+		if f.timers != nil {
+			delete(f.timers, dir)
+		}
+		f.mu.Unlock()
+		f.refresh(root, dir)
+	})
+}
+
+// refresh 增量刷新 dir 对应的分类, 目录已不存在时删除该分类
+func (f *folderwatcher) refresh(root, dir string) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return
+	}
+	clsn := filepath.Base(dir)
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		if os.IsNotExist(err) && isclass(clsn) {
+			err = ns.drop(clsn)
+			if err != nil {
+				logrus.Warnln("[nsetu] drop", clsn, "err:", err)
+				return
+			}
+			logrus.Infoln("[nsetu] class", clsn, "removed")
+		}
+		return
+	}
+	r, err := ns.rescan(os.DirFS(root), filepath.ToSlash(rel), clsn)
+	if err != nil {
+		logrus.Warnln("[nsetu] rescan", clsn, "err:", err)
+		return
+	}
+	logrus.Infoln("[nsetu] rescan", clsn, r.String())
+}
+
+func isclass(clsn string) bool {
+	for _, c := range ns.List() {
+		if c == clsn {
+			return true
+		}
+	}
+	return false
+}
@@ -9,10 +9,15 @@ import (
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
 )
 
 const hso = "https://gchat.qpic.cn/gchatpic_new//--4234EDEC5F147A4C319A41149D7E0EA9/0"
 
+// auto 自动识别的开关, 作为审核检测器使用
+var auto *control.Engine
+
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
@@ -33,11 +38,16 @@ func init() {
 				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(judge(p))))
 			}
 		})
-	control.Register("nsfwauto", &ctrl.Options[*zero.Ctx]{
+	auto = control.Register("nsfwauto", &ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: true,
 		Brief:            "nsfw图片自动识别",
-		Help:             "- 当图片属于非 neutral 类别时自动发送评价",
-	}).OnMessage(zero.HasPicture).SetBlock(false).
+		Help:             "- 当图片属于非 neutral 类别时自动发送评价\n注: 本群启用 moderation 插件时改为判为疑似违规, 处置由其审核策略决定",
+	})
+	pipeline.Register(detector{})
+	// 本群未启用 moderation 插件时按原先的方式自动发送评价
+	auto.OnMessage(zero.HasPicture, func(ctx *zero.Ctx) bool {
+		return !pipeline.Active(ctx.Event.GroupID)
+	}).SetBlock(false).
 		Handle(func(ctx *zero.Ctx) {
 			url := ctx.State["image_url"].([]string)
 			if len(url) > 0 {
@@ -47,11 +57,34 @@ func init() {
 					return
 				}
 				process.SleepAbout1sTo2s()
-				autojudge(ctx, p)
+				if c, ok := autojudge(p); ok {
+					ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(c, "\n"), message.Image(hso)))
+				}
 			}
 		})
 }
 
+// detector 将非 neutral 类别的图片判为疑似违规
+type detector struct{}
+
+func (detector) Name() string { return "nsfwauto" }
+
+func (detector) Enabled(gid int64) bool { return auto.IsEnabledIn(gid) }
+
+func (detector) Detect(_ *zero.Ctx, c *pipeline.Content) (vs []pipeline.Verdict, err error) {
+	for _, url := range c.Images {
+		var p *nsfw.Picture
+		p, err = nsfw.Classify(url)
+		if err != nil {
+			return
+		}
+		if desc, ok := autojudge(p); ok {
+			vs = append(vs, pipeline.Verdict{Category: "nsfw", Level: pipeline.Suspect, Detail: desc})
+		}
+	}
+	return
+}
+
 func judge(p *nsfw.Picture) string {
 	if p.Neutral > 0.3 {
 		return "普通哦"
@@ -74,9 +107,9 @@ func judge(p *nsfw.Picture) string {
 	return c
 }
 
-func autojudge(ctx *zero.Ctx, p *nsfw.Picture) {
+func autojudge(p *nsfw.Picture) (string, bool) {
 	if p.Neutral > 0.3 {
-		return
+		return "", false
 	}
 	c := ""
 	if p.Drawings > 0.3 {
@@ -97,7 +130,5 @@ func autojudge(ctx *zero.Ctx, p *nsfw.Picture) {
 		c += " hso"
 		i++
 	}
-	if i > 0 {
-		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(c, "\n"), message.Image(hso)))
-	}
+	return c, i > 0
 }
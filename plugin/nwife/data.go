@@ -0,0 +1,265 @@
+package nativewife
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"  // import gif decoding
+	_ "image/jpeg" // import jpeg decoding
+	_ "image/png"  // import png decoding
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corona10/goimagehash"
+	"github.com/sirupsen/logrus"
+	_ "golang.org/x/image/webp" // import webp decoding
+
+	fcext "github.com/FloatTech/floatbox/ctxext"
+	sql "github.com/FloatTech/sqlite"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	// dupDistance 感知哈希的汉明距离不超过此值时视为重复
+	dupDistance = 6
+	// recentDays 尽量不重复抽到最近几天抽到过的wife
+	recentDays = 7
+	// keepDays 抽取记录保留的天数
+	keepDays = 30
+)
+
+// wifeinfo 一张wife图片的信息, 图片本身仍按 群号/名字 存放在数据目录
+type wifeinfo struct {
+	ID       string `db:"id"`       // ID 群号(36进制)/名字
+	GroupID  int64  `db:"gid"`      // GroupID 所在群
+	Name     string `db:"name"`     // Name 名字, 也是文件名
+	Uploader int64  `db:"uploader"` // Uploader 上传者, 旧图片为 0
+	Source   string `db:"source"`   // Source 出处
+	PHash    int64  `db:"phash"`    // PHash 感知哈希, 无法识别的图片为 0
+	Added    int64  `db:"added"`    // Added 添加时间
+	Votes    int64  `db:"votes"`    // Votes 点赞数
+}
+
+// wifevote 一次点赞
+type wifevote struct {
+	ID     string `db:"id"` // ID wifeID|QQ号
+	WifeID string `db:"wid"`
+	UserID int64  `db:"uid"`
+	At     int64  `db:"at"`
+}
+
+// wifedraw 一次抽取, 同一个人每天在每个群只抽一次
+type wifedraw struct {
+	ID      string `db:"id"` // ID 群号_QQ号_日期
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Day     string `db:"day"` // Day 形如 20060102
+	WifeID  string `db:"wid"`
+	At      int64  `db:"at"`
+}
+
+const (
+	tablewife = "wife"
+	tablevote = "vote"
+	tabledraw = "draw"
+)
+
+type wifedb struct {
+	db sql.Sqlite
+	mu sync.Mutex
+}
+
+var (
+	wdb   wifedb
+	getdb = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+		err := wdb.db.Open(time.Hour)
+		if err == nil {
+			err = wdb.db.Create(tablewife, &wifeinfo{})
+		}
+		if err == nil {
+			err = wdb.db.Create(tablevote, &wifevote{})
+		}
+		if err == nil {
+			err = wdb.db.Create(tabledraw, &wifedraw{})
+		}
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return false
+		}
+		return true
+	})
+)
+
+// q 转义为 sql 字符串
+func q(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func wifeid(grpf, name string) string {
+	return grpf + "/" + name
+}
+
+// phash 计算图片的感知哈希
+func phash(data []byte) (int64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	h, err := goimagehash.PerceptionHash(img)
+	if err != nil {
+		return 0, err
+	}
+	return int64(h.GetHash()), nil
+}
+
+// list 列出群内所有wife, 并与文件夹同步: 补全旧图片的信息, 删除文件已不存在的记录
+func (w *wifedb) list(gid int64, folder string) ([]*wifeinfo, error) {
+	grpf := strconv.FormatInt(gid, 36)
+	files, err := os.ReadDir(folder)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ws, err := sql.FindAll[wifeinfo](&w.db, tablewife, "WHERE gid = "+strconv.FormatInt(gid, 10))
+	if err != nil && err != sql.ErrNullResult {
+		return nil, err
+	}
+	known := make(map[string]*wifeinfo, len(ws))
+	for _, x := range ws {
+		known[x.Name] = x
+	}
+	out := make([]*wifeinfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := f.Name()
+		if x, ok := known[name]; ok {
+			out = append(out, x)
+			delete(known, name)
+			continue
+		}
+		x := &wifeinfo{ID: wifeid(grpf, name), GroupID: gid, Name: name}
+		if fi, err := f.Info(); err == nil {
+			x.Added = fi.ModTime().Unix()
+		}
+		if data, err := os.ReadFile(folder + "/" + name); err == nil {
+			x.PHash, err = phash(data)
+			if err != nil {
+				logrus.Debugln("[nwife] phash", x.ID, "err:", err)
+			}
+		}
+		if err = w.db.Insert(tablewife, x); err != nil {
+			return nil, err
+		}
+		out = append(out, x)
+	}
+	for _, x := range known {
+		if err = w.remove(x.ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// save 插入或覆盖
+func (w *wifedb) save(x *wifeinfo) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.db.Insert(tablewife, x)
+}
+
+// del 删除wife及其点赞, 调用者需自行删除图片
+func (w *wifedb) del(gid int64, name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.remove(wifeid(strconv.FormatInt(gid, 36), name))
+}
+
+func (w *wifedb) remove(id string) error {
+	err := w.db.Del(tablewife, "WHERE id = "+q(id))
+	if err != nil {
+		return err
+	}
+	return w.db.Del(tablevote, "WHERE wid = "+q(id))
+}
+
+// vote 点赞或取消点赞, 返回是否改变了状态
+func (w *wifedb) vote(x *wifeinfo, uid int64, up bool) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := x.ID + "|" + strconv.FormatInt(uid, 10)
+	cond := "WHERE id = " + q(id)
+	if w.db.CanFind(tablevote, cond) == up {
+		return false, nil
+	}
+	var err error
+	if up {
+		err = w.db.Insert(tablevote, &wifevote{ID: id, WifeID: x.ID, UserID: uid, At: time.Now().Unix()})
+		x.Votes++
+	} else {
+		err = w.db.Del(tablevote, cond)
+		x.Votes--
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, w.db.Insert(tablewife, x)
+}
+
+func drawid(gid, uid int64, day string) string {
+	return strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10) + "_" + day
+}
+
+// today 今天抽到的wife
+func (w *wifedb) today(gid, uid int64, now time.Time) (wid string, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var d wifedraw
+	if w.db.Find(tabledraw, &d, "WHERE id = "+q(drawid(gid, uid, now.Format("20060102")))) != nil {
+		return "", false
+	}
+	return d.WifeID, true
+}
+
+// recent 最近 recentDays 天抽到过的wife
+func (w *wifedb) recent(gid, uid int64, now time.Time) map[string]bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	since := now.AddDate(0, 0, -recentDays).Unix()
+	ds, _ := sql.FindAll[wifedraw](&w.db, tabledraw,
+		"WHERE gid = "+strconv.FormatInt(gid, 10)+" AND uid = "+strconv.FormatInt(uid, 10)+" AND at > "+strconv.FormatInt(since, 10))
+	m := make(map[string]bool, len(ds))
+	for _, d := range ds {
+		m[d.WifeID] = true
+	}
+	return m
+}
+
+// record 记录今天的抽取, 并清理过期记录
+func (w *wifedb) record(gid, uid int64, wid string, now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	day := now.Format("20060102")
+	err := w.db.Insert(tabledraw, &wifedraw{ID: drawid(gid, uid, day), GroupID: gid, UserID: uid, Day: day, WifeID: wid, At: now.Unix()})
+	if err != nil {
+		return err
+	}
+	return w.db.Del(tabledraw, "WHERE at < "+strconv.FormatInt(now.AddDate(0, 0, -keepDays).Unix(), 10))
+}
+
+// history 最近抽到的wife, 新的在前
+func (w *wifedb) history(gid, uid int64, n int) ([]*wifedraw, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ds, err := sql.FindAll[wifedraw](&w.db, tabledraw,
+		"WHERE gid = "+strconv.FormatInt(gid, 10)+" AND uid = "+strconv.FormatInt(uid, 10)+" ORDER BY at DESC LIMIT "+strconv.Itoa(n))
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return ds, err
+}
@@ -0,0 +1,111 @@
+package nativewife
+
+import (
+	"image"
+	"sort"
+	"strconv"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/imgfactory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+)
+
+const (
+	galleryCols = 4
+	galleryRows = 3
+	pageSize    = galleryCols * galleryRows
+	thumbSize   = 200
+	cellW       = thumbSize + 20
+	cellH       = thumbSize + 56
+	titleH      = 60
+)
+
+// sortbyvotes 按点赞数降序, 相同时先添加的在前
+func sortbyvotes(ws []*wifeinfo) {
+	sort.SliceStable(ws, func(i, j int) bool {
+		if ws[i].Votes != ws[j].Votes {
+			return ws[i].Votes > ws[j].Votes
+		}
+		if ws[i].Added != ws[j].Added {
+			return ws[i].Added < ws[j].Added
+		}
+		return ws[i].Name < ws[j].Name
+	})
+}
+
+// pages 总页数
+func pages(n int) int {
+	return (n + pageSize - 1) / pageSize
+}
+
+// thumbnail 缩放到 thumbSize 以内并保持比例
+func thumbnail(path string) (image.Image, error) {
+	im, err := imgfactory.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	sz := im.Bounds().Size()
+	if sz.X >= sz.Y {
+		return imgfactory.Size(im, thumbSize, 0).Image(), nil
+	}
+	return imgfactory.Size(im, 0, thumbSize).Image(), nil
+}
+
+// drawgallery 绘制第 page 页(从 1 开始)的图鉴, ws 需已排序
+func drawgallery(ws []*wifeinfo, folder string, page int) ([]byte, error) {
+	fd, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	begin := (page - 1) * pageSize
+	end := begin + pageSize
+	if end > len(ws) {
+		end = len(ws)
+	}
+	rows := (end - begin + galleryCols - 1) / galleryCols
+	canvas := gg.NewContext(cellW*galleryCols+20, titleH+cellH*rows+10)
+	canvas.SetRGB(1, 1, 1)
+	canvas.Clear()
+	if err = canvas.ParseFontFace(fd, 28); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB(0, 0, 0)
+	canvas.DrawStringAnchored("wife图鉴 第"+strconv.Itoa(page)+"/"+strconv.Itoa(pages(len(ws)))+"页 共"+strconv.Itoa(len(ws))+"位",
+		float64(canvas.W())/2, titleH/2, 0.5, 0.5)
+	if err = canvas.ParseFontFace(fd, 18); err != nil {
+		return nil, err
+	}
+	for i, x := range ws[begin:end] {
+		cx := 20 + (i%galleryCols)*cellW
+		cy := titleH + (i/galleryCols)*cellH
+		canvas.SetRGB(0.95, 0.95, 0.95)
+		canvas.DrawRectangle(float64(cx), float64(cy), thumbSize, thumbSize)
+		canvas.Fill()
+		if im, err := thumbnail(folder + "/" + x.Name); err == nil {
+			sz := im.Bounds().Size()
+			canvas.DrawImage(im, cx+(thumbSize-sz.X)/2, cy+(thumbSize-sz.Y)/2)
+		}
+		canvas.SetRGB(0, 0, 0)
+		canvas.DrawStringAnchored(truncate(canvas, x.Name, thumbSize), float64(cx+thumbSize/2), float64(cy+thumbSize+16), 0.5, 0.5)
+		canvas.SetRGB(0.85, 0.2, 0.35)
+		canvas.DrawStringAnchored("♥ "+strconv.FormatInt(x.Votes, 10), float64(cx+thumbSize/2), float64(cy+thumbSize+38), 0.5, 0.5)
+	}
+	return imgfactory.ToBytes(canvas.Image())
+}
+
+// truncate 截断过长的名字
+func truncate(canvas *gg.Context, s string, width float64) string {
+	if w, _ := canvas.MeasureString(s); w <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 1 {
+		r = r[:len(r)-1]
+		if w, _ := canvas.MeasureString(string(r) + "…"); w <= width {
+			break
+		}
+	}
+	return string(r) + "…"
+}
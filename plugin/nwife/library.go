@@ -0,0 +1,186 @@
+package nativewife
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/zbputils/control"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+	"github.com/wdvxdr1123/ZeroBot/utils/helper"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/nwife/pool"
+)
+
+// drawwife 抽取今天的wife: 今天抽过时返回同一个, 否则按点赞加权并尽量避开最近抽到过的
+func drawwife(gid, uid int64, wifes []*wifeinfo, now time.Time) (*wifeinfo, error) {
+	if wid, ok := wdb.today(gid, uid, now); ok {
+		for _, x := range wifes {
+			if x.ID == wid {
+				return x, nil
+			}
+		}
+		// 今天抽到的已被删除, 重新抽
+	}
+	items := make([]pool.Item, len(wifes))
+	for i, x := range wifes {
+		items[i] = pool.Item{Key: x.ID, Votes: x.Votes}
+	}
+	s := md5.Sum(helper.StringToBytes(fmt.Sprintf("%d%d%d%d", uid, now.Year(), now.Month(), now.Day())))
+	r := rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(s[:]))))
+	x := wifes[pool.Pick(items, wdb.recent(gid, uid, now), r)]
+	return x, wdb.record(gid, uid, x.ID, now)
+}
+
+// findwife 在群内按名字查找, 找不到时回复提示
+func findwife(ctx *zero.Ctx, folder, name string) (*wifeinfo, bool) {
+	wifes, err := wdb.list(ctx.Event.GroupID, folder)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return nil, false
+	}
+	for _, x := range wifes {
+		if x.Name == name {
+			return x, true
+		}
+	}
+	ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有叫", name, "的wife"))
+	return nil, false
+}
+
+// registerlibrary 图鉴、信息、点赞与抽取记录
+func registerlibrary(engine *control.Engine, base, baseuri string) {
+	engine.OnRegex(`^wife图鉴\s*(\d*)$`, zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			folder := base + strconv.FormatInt(ctx.Event.GroupID, 36)
+			wifes, err := wdb.list(ctx.Event.GroupID, folder)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(wifes) == 0 {
+				ctx.SendChain(message.Text("一个wife也没有哦~"))
+				return
+			}
+			page := 1
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				page, _ = strconv.Atoi(s)
+			}
+			if page < 1 || page > pages(len(wifes)) {
+				ctx.SendChain(message.Text("页码应在1到", pages(len(wifes)), "之间"))
+				return
+			}
+			sortbyvotes(wifes)
+			data, err := drawgallery(wifes, folder, page)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if id := ctx.SendChain(message.ImageBytes(data)); id.ID() == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			}
+		})
+	engine.OnFullMatch("wife排行", zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			wifes, err := wdb.list(ctx.Event.GroupID, base+strconv.FormatInt(ctx.Event.GroupID, 36))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(wifes) == 0 {
+				ctx.SendChain(message.Text("一个wife也没有哦~"))
+				return
+			}
+			sortbyvotes(wifes)
+			var sb strings.Builder
+			sb.WriteString("本群wife人气排行:")
+			for i, x := range wifes {
+				if i == 10 {
+					break
+				}
+				sb.WriteString(fmt.Sprintf("\n%d. %s ♥%d", i+1, x.Name, x.Votes))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^wife信息\s*(.+)$`, zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			grpf := strconv.FormatInt(ctx.Event.GroupID, 36)
+			x, ok := findwife(ctx, base+grpf, strings.TrimSpace(ctx.State["regex_matched"].([]string)[1]))
+			if !ok {
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("名字: " + x.Name)
+			if x.Uploader != 0 {
+				sb.WriteString("\n上传者: " + ctx.CardOrNickName(x.Uploader))
+			}
+			if x.Source != "" {
+				sb.WriteString("\n来源: " + x.Source)
+			}
+			if x.Added != 0 {
+				sb.WriteString("\n添加于: " + time.Unix(x.Added, 0).Format("2006-01-02"))
+			}
+			sb.WriteString("\n点赞: " + strconv.FormatInt(x.Votes, 10))
+			ctx.SendChain(message.Image(baseuri+grpf+"/"+x.Name), message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置wife来源\s*(\S+)\s+(.+)$`, zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			x, ok := findwife(ctx, base+strconv.FormatInt(ctx.Event.GroupID, 36), ctx.State["regex_matched"].([]string)[1])
+			if !ok {
+				return
+			}
+			if x.Uploader != ctx.Event.UserID && !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("只有上传者或管理员可以修改来源"))
+				return
+			}
+			x.Source = strings.TrimSpace(ctx.State["regex_matched"].([]string)[2])
+			if err := wdb.save(x); err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！"))
+		})
+	engine.OnRegex(`^(取消)?点赞wife\s*(.+)$`, zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			up := ctx.State["regex_matched"].([]string)[1] == ""
+			x, ok := findwife(ctx, base+strconv.FormatInt(ctx.Event.GroupID, 36), strings.TrimSpace(ctx.State["regex_matched"].([]string)[2]))
+			if !ok {
+				return
+			}
+			changed, err := wdb.vote(x, ctx.Event.UserID, up)
+			switch {
+			case err != nil:
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
+			case !changed && up:
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你已经点赞过", x.Name, "了"))
+			case !changed:
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你还没有点赞过", x.Name))
+			default:
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(x.Name, "现在有", x.Votes, "个赞"))
+			}
+		})
+	engine.OnFullMatch("我的wife记录", zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ds, err := wdb.history(ctx.Event.GroupID, ctx.Event.UserID, recentDays)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ds) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你还没有抽过wife"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("最近抽到的wife:")
+			for _, d := range ds {
+				_, name, _ := strings.Cut(d.WifeID, "/")
+				sb.WriteString("\n" + time.Unix(d.At, 0).Format("01-02") + " " + name)
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sb.String()))
+		})
+}
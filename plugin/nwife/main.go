@@ -2,11 +2,7 @@
 package nativewife
 
 import (
-	"crypto/md5"
-	"encoding/binary"
 	"errors"
-	"fmt"
-	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -14,83 +10,140 @@ import (
 
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
-	"github.com/wdvxdr1123/ZeroBot/utils/helper"
 
 	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/floatbox/process"
+	"github.com/FloatTech/floatbox/web"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/nwife/pool"
 )
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault:  false,
-		Brief:             "本地老婆",
-		Help:              "- 抽wife[@xxx]\n- 添加wife[名字][图片]\n- 删除wife[名字]\n- [让 | 不让]所有人均可添加wife",
+		DisableOnDefault: false,
+		Brief:            "本地老婆",
+		Help: "- 抽wife[@xxx]\n- 添加wife[名字][来源xxx][图片]\n- 删除wife[名字]\n- [让 | 不让]所有人均可添加wife\n" +
+			"- wife图鉴[页码]\n- wife排行\n- wife信息[名字]\n- 设置wife来源[名字] [来源]\n- [取消]点赞wife[名字]\n- 我的wife记录\n" +
+			"Tips: 每人每天抽到的wife固定, 点赞越多越容易被抽到, 7天内尽量不会重复; 添加时会拒绝与已有wife重复的图片",
 		PrivateDataFolder: "nwife",
 	})
 	base := engine.DataFolder()
 	baseuri := "file:///" + file.BOTPATH + "/" + base
-	engine.OnPrefix("抽wife", zero.OnlyGroup).SetBlock(true).
+	wdb.db.DBPath = base + "wife.db"
+	engine.OnPrefix("抽wife", zero.OnlyGroup, getdb).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			grpf := strconv.FormatInt(ctx.Event.GroupID, 36)
-			wifes, err := os.ReadDir(base + grpf)
+			gid := ctx.Event.GroupID
+			grpf := strconv.FormatInt(gid, 36)
+			wifes, err := wdb.list(gid, base+grpf)
 			if err != nil {
-				ctx.SendChain(message.Text("一个wife也没有哦~"))
+				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
 			switch len(wifes) {
 			case 0:
 				ctx.SendChain(message.Text("一个wife也没有哦~"))
 			case 1:
-				wn := wifes[0].Name()
+				wn := wifes[0].Name
 				ctx.SendChain(message.Text("大家的wife都是", wn, "\n"), message.Image(baseuri+grpf+"/"+wn), message.Text("\n哦~"))
 			default:
-				// 获取名字
+				// 获取名字, 可以帮别人抽
+				uid := ctx.Event.UserID
 				name := ctx.NickName()
-				now := time.Now()
-				s := md5.Sum(helper.StringToBytes(fmt.Sprintf("%s%d%d%d", name, now.Year(), now.Month(), now.Day())))
-				r := rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(s[:]))))
-				n := r.Intn(len(wifes))
-				wn := wifes[n].Name()
-				ctx.SendChain(message.Text(name, "的wife是", wn, "\n"), message.Image(baseuri+grpf+"/"+wn), message.Text("\n哦~"))
+				for _, elem := range ctx.Event.Message {
+					if elem.Type == "at" {
+						if qq, err := strconv.ParseInt(elem.Data["qq"], 10, 64); err == nil {
+							uid, name = qq, ctx.CardOrNickName(qq)
+						}
+						break
+					}
+				}
+				x, err := drawwife(gid, uid, wifes, time.Now())
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				ctx.SendChain(message.Text(name, "的wife是", x.Name, "\n"), message.Image(baseuri+grpf+"/"+x.Name), message.Text("\n哦~"))
 			}
 		})
 	// 上传一张图
-	engine.OnPrefix("添加wife", zero.OnlyGroup, chkAddWifePermission, zero.MustProvidePicture).SetBlock(true).
+	engine.OnPrefix("添加wife", zero.OnlyGroup, chkAddWifePermission, zero.MustProvidePicture, getdb).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			name := ""
+			name, source := "", ""
 			for _, elem := range ctx.Event.Message {
 				if elem.Type == "text" {
 					name = strings.ReplaceAll(elem.Data["text"], " ", "")
 					name = name[strings.LastIndex(name, "添加wife")+10:]
+					if i := strings.Index(name, "来源"); i >= 0 {
+						source = strings.TrimLeft(name[i+len("来源"):], ":：")
+						name = name[:i]
+					}
 					name = strings.ReplaceAll(name, "/", "")
 					name = strings.ReplaceAll(name, "\\", "")
 					break
 				}
 			}
-			if name != "" {
-				url := ctx.State["image_url"].([]string)[0]
-				grpfolder := base + strconv.FormatInt(ctx.Event.GroupID, 36)
-				if file.IsNotExist(grpfolder) {
-					err := os.Mkdir(grpfolder, 0755)
-					if err != nil {
-						ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
-						return
-					}
+			if name == "" {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有找到wife的名字！"))
+				return
+			}
+			gid := ctx.Event.GroupID
+			grpfolder := base + strconv.FormatInt(gid, 36)
+			wifes, err := wdb.list(gid, grpfolder)
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
+				return
+			}
+			for _, x := range wifes {
+				if x.Name == name {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已经有叫", name, "的wife了, 请换个名字或先删除"))
+					return
 				}
-				err := file.DownloadTo(url, grpfolder+"/"+name)
-				if err == nil {
-					process.SleepAbout1sTo2s()
-					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！"))
-				} else {
+			}
+			data, err := web.GetData(ctx.State["image_url"].([]string)[0])
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
+				return
+			}
+			h, err := phash(data)
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：无法识别的图片, ", err.Error()))
+				return
+			}
+			for _, x := range wifes {
+				if x.PHash != 0 && pool.Distance(uint64(x.PHash), uint64(h)) <= dupDistance {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("这张图和已有的wife ", x.Name, " 重复了"))
+					return
+				}
+			}
+			if file.IsNotExist(grpfolder) {
+				err := os.Mkdir(grpfolder, 0755)
+				if err != nil {
 					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
+					return
 				}
+			}
+			err = os.WriteFile(grpfolder+"/"+name, data, 0644)
+			if err == nil {
+				err = wdb.save(&wifeinfo{
+					ID:       wifeid(strconv.FormatInt(gid, 36), name),
+					GroupID:  gid,
+					Name:     name,
+					Uploader: ctx.Event.UserID,
+					Source:   source,
+					PHash:    h,
+					Added:    time.Now().Unix(),
+				})
+			}
+			if err == nil {
+				process.SleepAbout1sTo2s()
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！"))
 			} else {
-				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有找到wife的名字！"))
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("错误：", err.Error()))
 			}
 		})
-	engine.OnPrefix("删除wife", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+	engine.OnPrefix("删除wife", zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			name := ""
 			for _, elem := range ctx.Event.Message {
@@ -105,6 +158,9 @@ func init() {
 			if name != "" {
 				grpfolder := base + strconv.FormatInt(ctx.Event.GroupID, 36)
 				err := os.Remove(grpfolder + "/" + name)
+				if err == nil {
+					err = wdb.del(ctx.Event.GroupID, name)
+				}
 				if err == nil {
 					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！"))
 				} else {
@@ -114,6 +170,7 @@ func init() {
 				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有找到wife的名字！"))
 			}
 		})
+	registerlibrary(engine, base, baseuri)
 	engine.OnSuffix("所有人均可添加wife", zero.SuperUserPermission, zero.OnlyGroup).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			text := ""
@@ -0,0 +1,60 @@
+// Package pool 按票数加权、避开近期结果的抽取
+package pool
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// Item 一个候选
+type Item struct {
+	Key   string
+	Votes int64
+}
+
+// Weight 票数越多越容易抽到, 但增长逐渐放缓: 1 + √票数
+func Weight(votes int64) float64 {
+	if votes <= 0 {
+		return 1
+	}
+	return 1 + math.Sqrt(float64(votes))
+}
+
+// Pick 按权重抽取一个, 尽量避开 recent 中近期抽到过的,
+// 全部都抽到过时忽略 recent. items 为空时返回 -1
+func Pick(items []Item, recent map[string]bool, r *rand.Rand) int {
+	if len(items) == 0 {
+		return -1
+	}
+	total := 0.0
+	for _, it := range items {
+		if !recent[it.Key] {
+			total += Weight(it.Votes)
+		}
+	}
+	if total == 0 {
+		recent = nil
+		for _, it := range items {
+			total += Weight(it.Votes)
+		}
+	}
+	x := r.Float64() * total
+	last := -1
+	for i, it := range items {
+		if recent[it.Key] {
+			continue
+		}
+		last = i
+		if x -= Weight(it.Votes); x < 0 {
+			return i
+		}
+	}
+	// 浮点误差时取最后一个候选
+	return last
+}
+
+// Distance 两个感知哈希的汉明距离
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
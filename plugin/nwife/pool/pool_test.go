@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPickWeighted(t *testing.T) {
+	items := []Item{{Key: "a"}, {Key: "b", Votes: 100}, {Key: "c"}}
+	r := rand.New(rand.NewSource(1))
+	var cnt [3]int
+	for i := 0; i < 12000; i++ {
+		cnt[Pick(items, nil, r)]++
+	}
+	// 权重 1:11:1
+	if cnt[1] < 9000 || cnt[1] > 11000 || cnt[0] < 500 || cnt[2] < 500 {
+		t.Fatal("unexpected distribution", cnt)
+	}
+}
+
+func TestPickAvoidsRecent(t *testing.T) {
+	items := []Item{{Key: "a", Votes: 1000}, {Key: "b"}, {Key: "c"}}
+	r := rand.New(rand.NewSource(2))
+	recent := map[string]bool{"a": true, "b": true}
+	for i := 0; i < 100; i++ {
+		if n := Pick(items, recent, r); n != 2 {
+			t.Fatal("picked recent item", items[n].Key)
+		}
+	}
+	recent["c"] = true
+	seen := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		seen[Pick(items, recent, r)] = true
+	}
+	if len(seen) != 3 {
+		t.Fatal("should fall back to all items when all are recent", seen)
+	}
+	if Pick(nil, nil, r) != -1 {
+		t.Fatal("empty items should return -1")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if Distance(0b1011, 0b0001) != 2 || Distance(42, 42) != 0 {
+		t.Fatal("bad distance")
+	}
+}
@@ -0,0 +1,249 @@
+package poker
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/blackjack"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+const (
+	bjBet      = 10
+	bjMaxBet   = 1000
+	bjMaxSeats = 6
+)
+
+// bjroom 一个群的21点, 机器人坐庄
+type bjroom struct {
+	gid     int64
+	players []*blackjack.Player
+	game    *blackjack.Game
+	timer   turntimer
+}
+
+var (
+	bjmu sync.Mutex
+	bjs  = map[int64]*bjroom{}
+)
+
+func (r *bjroom) player(uid int64) *blackjack.Player {
+	for _, p := range r.players {
+		if p.ID == uid {
+			return p
+		}
+	}
+	return nil
+}
+
+// savestakes 记录各玩家已下注尚未结算的ATRI币
+func (r *bjroom) savestakes() {
+	amounts := make(map[int64]int, len(r.players))
+	for _, p := range r.players {
+		amounts[p.ID] = p.Bet
+	}
+	stakes.save("blackjack", r.gid, amounts)
+}
+
+// bjplaying 本群有进行中的21点且发送者已下注, 其余消息交给后续插件
+func bjplaying(ctx *zero.Ctx) bool {
+	bjmu.Lock()
+	defer bjmu.Unlock()
+	r, ok := bjs[ctx.Event.GroupID]
+	return ok && r.game != nil && r.player(ctx.Event.UserID) != nil
+}
+
+// handtext 手牌与点数
+func handtext(h blackjack.Hand) string {
+	v, soft := h.Value()
+	s := cards.Format(h) + " (" + strconv.Itoa(v)
+	if soft {
+		s += ", 软"
+	}
+	return s + "点)"
+}
+
+// prompt 提示当前行动者, 并开始计时, 所有人停牌后结算
+func (r *bjroom) prompt(ctx *zero.Ctx) {
+	p := r.game.Current()
+	if p == nil {
+		r.settle(ctx)
+		return
+	}
+	hint := "要牌/停牌"
+	if len(p.Hand) == 2 {
+		hint += "/加倍"
+	}
+	msg := message.Message{message.At(p.ID), message.Text(" 轮到你了, 下注", p.Bet, ", 手牌: ", handtext(p.Hand), "\n可以 ", hint, "\n")}
+	ctx.Send(append(msg, cardsmsg(p.Hand)...))
+	r.timer.reset(&bjmu, func() {
+		_ = r.game.Stand(p.ID)
+		ctx.SendChain(message.Text(name(ctx, p.ID), " 超时, 自动停牌"))
+		r.prompt(ctx)
+	})
+}
+
+// settle 庄家亮牌并结算
+func (r *bjroom) settle(ctx *zero.Ctx) {
+	r.timer.stop()
+	var sb strings.Builder
+	sb.WriteString("庄家: " + handtext(r.game.Dealer))
+	if r.game.Dealer.Bust() {
+		sb.WriteString(" 爆牌")
+	}
+	for _, res := range r.game.Settle() {
+		refund(res.ID, res.Bet+res.Net)
+		sb.WriteString("\n" + name(ctx, res.ID) + ": " + handtext(r.player(res.ID).Hand) + " " + res.Outcome)
+		if res.Net > 0 {
+			sb.WriteString(" +" + strconv.Itoa(res.Net))
+		} else if res.Net < 0 {
+			sb.WriteString(" " + strconv.Itoa(res.Net))
+		}
+	}
+	msg := message.Message{message.Text(sb.String(), "\n")}
+	ctx.Send(append(msg, cardsmsg(r.game.Dealer)...))
+	stakes.save("blackjack", r.gid, nil)
+	delete(bjs, r.gid)
+}
+
+func init() {
+	engine.OnRegex(`^21点\s*(\d*)$`, zero.OnlyGroup, getImg).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			bet := bjBet
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				bet, _ = strconv.Atoi(s)
+			}
+			if bet <= 0 || bet > bjMaxBet {
+				ctx.SendChain(message.Text("ERROR: 下注应在1-", bjMaxBet, "之间"))
+				return
+			}
+			bjmu.Lock()
+			defer bjmu.Unlock()
+			gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+			r, ok := bjs[gid]
+			if !ok {
+				r = &bjroom{gid: gid}
+			}
+			switch {
+			case r.game != nil:
+				ctx.SendChain(message.Text("本群21点进行中, 请等待本局结束"))
+				return
+			case r.player(uid) != nil:
+				ctx.SendChain(message.Text("你已下注, 发送\"开始21点\"开局"))
+				return
+			case len(r.players) >= bjMaxSeats:
+				ctx.SendChain(message.Text("人数已满"))
+				return
+			}
+			if err := pay(uid, bet); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			r.players = append(r.players, &blackjack.Player{ID: uid, Bet: bet})
+			bjs[gid] = r
+			r.savestakes()
+			ctx.SendChain(message.Text("下注", bet, "成功, 当前", len(r.players), "人, 发送\"21点\"加入, \"开始21点\"开局"))
+		})
+	engine.OnFullMatch("开始21点", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			bjmu.Lock()
+			defer bjmu.Unlock()
+			r, ok := bjs[ctx.Event.GroupID]
+			if !ok || r.player(ctx.Event.UserID) == nil {
+				ctx.SendChain(message.Text("你还没有下注, 发送\"21点\"加入"))
+				return
+			}
+			if r.game != nil {
+				ctx.SendChain(message.Text("本局已开始"))
+				return
+			}
+			r.game = blackjack.New(r.players, newrand())
+			var sb strings.Builder
+			sb.WriteString("21点开始! 庄家明牌: " + r.game.Dealer[0].String())
+			for _, p := range r.players {
+				sb.WriteString("\n" + name(ctx, p.ID) + ": " + handtext(p.Hand))
+				if p.Hand.Blackjack() {
+					sb.WriteString(" 黑杰克!")
+				}
+			}
+			ctx.SendChain(message.Text(sb.String()))
+			r.prompt(ctx)
+		})
+	engine.OnRegex(`^(要牌|停牌|加倍)$`, zero.OnlyGroup, bjplaying).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			bjmu.Lock()
+			defer bjmu.Unlock()
+			r, ok := bjs[ctx.Event.GroupID]
+			if !ok || r.game == nil || r.player(ctx.Event.UserID) == nil {
+				return
+			}
+			uid := ctx.Event.UserID
+			var err error
+			switch ctx.State["regex_matched"].([]string)[1] {
+			case "要牌":
+				var c cards.Card
+				c, err = r.game.Hit(uid)
+				if err == nil {
+					ctx.SendChain(message.Text(name(ctx, uid), " 要到 ", c, ", ", handtext(r.player(uid).Hand)))
+				}
+			case "停牌":
+				err = r.game.Stand(uid)
+			case "加倍":
+				p := r.game.Current()
+				if p == nil || p.ID != uid {
+					err = blackjack.ErrNotYourTurn
+					break
+				}
+				if len(p.Hand) != 2 {
+					err = blackjack.ErrCannotDouble
+					break
+				}
+				bet := p.Bet
+				if err = pay(uid, bet); err != nil {
+					break
+				}
+				var c cards.Card
+				c, err = r.game.Double(uid)
+				if err != nil {
+					refund(uid, bet)
+					break
+				}
+				r.savestakes()
+				ctx.SendChain(message.Text(name(ctx, uid), " 加倍, 要到 ", c, ", ", handtext(p.Hand)))
+			}
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: ", err))
+				return
+			}
+			r.prompt(ctx)
+		})
+	engine.OnFullMatch("退出21点", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			bjmu.Lock()
+			defer bjmu.Unlock()
+			r, ok := bjs[ctx.Event.GroupID]
+			if !ok || r.player(ctx.Event.UserID) == nil {
+				return
+			}
+			if r.game != nil {
+				ctx.SendChain(message.Text("本局已开始, 不能退出"))
+				return
+			}
+			for i, p := range r.players {
+				if p.ID == ctx.Event.UserID {
+					refund(p.ID, p.Bet)
+					r.players = append(r.players[:i], r.players[i+1:]...)
+					ctx.SendChain(message.Text("已退出, 退还", p.Bet, "ATRI币"))
+					break
+				}
+			}
+			r.savestakes()
+			if len(r.players) == 0 {
+				delete(bjs, r.gid)
+			}
+		})
+}
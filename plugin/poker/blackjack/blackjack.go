@@ -0,0 +1,216 @@
+// Package blackjack 以机器人为庄家的21点
+package blackjack
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+var (
+	// ErrNotYourTurn 还没轮到
+	ErrNotYourTurn = errors.New("还没轮到你")
+	// ErrFinished 本局已结束
+	ErrFinished = errors.New("本局已结束")
+	// ErrCannotDouble 只有前两张牌时可以加倍
+	ErrCannotDouble = errors.New("只有前两张牌时可以加倍")
+)
+
+// Hand 一手牌
+type Hand []cards.Card
+
+// Value 点数, soft 表示有 A 按 11 计
+func (h Hand) Value() (total int, soft bool) {
+	aces := 0
+	for _, c := range h {
+		switch {
+		case c.Rank == cards.Ace:
+			aces++
+			total++
+		case c.Rank >= cards.Ten:
+			total += 10
+		default:
+			total += int(c.Rank)
+		}
+	}
+	if aces > 0 && total+10 <= 21 {
+		return total + 10, true
+	}
+	return total, false
+}
+
+// Blackjack 前两张即为21点
+func (h Hand) Blackjack() bool {
+	v, _ := h.Value()
+	return len(h) == 2 && v == 21
+}
+
+// Bust 爆牌
+func (h Hand) Bust() bool {
+	v, _ := h.Value()
+	return v > 21
+}
+
+// Player 闲家
+type Player struct {
+	ID      int64
+	Bet     int
+	Hand    Hand
+	Done    bool
+	Doubled bool
+}
+
+// Result 结算结果
+type Result struct {
+	ID      int64
+	Bet     int    // Bet 最终下注额, 加倍后为两倍
+	Net     int    // Net 净输赢, 正数为赢
+	Outcome string // Outcome 如 黑杰克 爆牌 赢 输 平
+}
+
+// Game 一局
+type Game struct {
+	Players []*Player
+	Dealer  Hand
+	Turn    int
+	deck    cards.Deck
+}
+
+// New 发牌, 前两张即为21点的闲家直接停牌
+func New(players []*Player, r *rand.Rand) *Game {
+	g := &Game{Players: players, deck: cards.Shuffled(r, false)}
+	for i := 0; i < 2; i++ {
+		for _, p := range players {
+			p.Hand = append(p.Hand, g.deck.Draw(1)...)
+		}
+		g.Dealer = append(g.Dealer, g.deck.Draw(1)...)
+	}
+	for _, p := range players {
+		p.Done = p.Hand.Blackjack()
+	}
+	g.Turn = -1
+	g.advance()
+	return g
+}
+
+// Current 当前行动的闲家, 已结束时为 nil
+func (g *Game) Current() *Player {
+	if g.Over() {
+		return nil
+	}
+	return g.Players[g.Turn]
+}
+
+// Over 所有闲家都已停牌, 庄家已补完牌
+func (g *Game) Over() bool {
+	return g.Turn >= len(g.Players)
+}
+
+func (g *Game) check(id int64) (*Player, error) {
+	if g.Over() {
+		return nil, ErrFinished
+	}
+	p := g.Players[g.Turn]
+	if p.ID != id {
+		return nil, ErrNotYourTurn
+	}
+	return p, nil
+}
+
+// Hit 要牌, 爆牌或到21点时自动停牌
+func (g *Game) Hit(id int64) (cards.Card, error) {
+	p, err := g.check(id)
+	if err != nil {
+		return cards.Card{}, err
+	}
+	c := g.deck.Draw(1)[0]
+	p.Hand = append(p.Hand, c)
+	if v, _ := p.Hand.Value(); v >= 21 {
+		p.Done = true
+		g.advance()
+	}
+	return c, nil
+}
+
+// Stand 停牌
+func (g *Game) Stand(id int64) error {
+	p, err := g.check(id)
+	if err != nil {
+		return err
+	}
+	p.Done = true
+	g.advance()
+	return nil
+}
+
+// Double 加倍, 下注翻倍并只再要一张牌
+func (g *Game) Double(id int64) (cards.Card, error) {
+	p, err := g.check(id)
+	if err != nil {
+		return cards.Card{}, err
+	}
+	if len(p.Hand) != 2 {
+		return cards.Card{}, ErrCannotDouble
+	}
+	c := g.deck.Draw(1)[0]
+	p.Hand = append(p.Hand, c)
+	p.Bet *= 2
+	p.Doubled, p.Done = true, true
+	g.advance()
+	return c, nil
+}
+
+// advance 轮到下一个未停牌的闲家, 都停牌后庄家补牌到17点以上
+func (g *Game) advance() {
+	for g.Turn++; g.Turn < len(g.Players); g.Turn++ {
+		if !g.Players[g.Turn].Done {
+			return
+		}
+	}
+	// 所有闲家都爆牌或黑杰克时庄家无需补牌
+	need := false
+	for _, p := range g.Players {
+		if !p.Hand.Bust() && !p.Hand.Blackjack() {
+			need = true
+			break
+		}
+	}
+	for need {
+		if v, _ := g.Dealer.Value(); v >= 17 {
+			break
+		}
+		g.Dealer = append(g.Dealer, g.deck.Draw(1)...)
+	}
+}
+
+// Settle 结算, 黑杰克赔 3:2
+func (g *Game) Settle() []Result {
+	if !g.Over() {
+		return nil
+	}
+	dv, _ := g.Dealer.Value()
+	rs := make([]Result, len(g.Players))
+	for i, p := range g.Players {
+		pv, _ := p.Hand.Value()
+		r := Result{ID: p.ID, Bet: p.Bet}
+		switch {
+		case p.Hand.Bust():
+			r.Net, r.Outcome = -p.Bet, "爆牌"
+		case p.Hand.Blackjack() && g.Dealer.Blackjack():
+			r.Outcome = "平"
+		case p.Hand.Blackjack():
+			r.Net, r.Outcome = p.Bet*3/2, "黑杰克"
+		case g.Dealer.Blackjack():
+			r.Net, r.Outcome = -p.Bet, "庄家黑杰克"
+		case g.Dealer.Bust() || pv > dv:
+			r.Net, r.Outcome = p.Bet, "赢"
+		case pv < dv:
+			r.Net, r.Outcome = -p.Bet, "输"
+		default:
+			r.Outcome = "平"
+		}
+		rs[i] = r
+	}
+	return rs
+}
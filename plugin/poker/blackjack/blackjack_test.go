@@ -0,0 +1,77 @@
+package blackjack
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+func TestValue(t *testing.T) {
+	for _, c := range []struct {
+		h     Hand
+		total int
+		soft  bool
+	}{
+		{Hand{{Rank: cards.Ace}, {Rank: cards.King}}, 21, true},
+		{Hand{{Rank: cards.Ace}, {Rank: cards.Ace}, {Rank: 9}}, 21, true},
+		{Hand{{Rank: cards.Ace}, {Rank: 6}, {Rank: 9}}, 16, false},
+		{Hand{{Rank: cards.Queen}, {Rank: 6}, {Rank: 9}}, 25, false},
+	} {
+		if v, s := c.h.Value(); v != c.total || s != c.soft {
+			t.Fatal(c.h, "expect", c.total, c.soft, "got", v, s)
+		}
+	}
+	if !(Hand{{Rank: cards.Ace}, {Rank: cards.Ten}}).Blackjack() {
+		t.Fatal("expect blackjack")
+	}
+}
+
+func TestGame(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		ps := []*Player{{ID: 1, Bet: 10}, {ID: 2, Bet: 20}}
+		g := New(ps, rand.New(rand.NewSource(seed)))
+		for i := 0; !g.Over(); i++ {
+			if i > 20 {
+				t.Fatal("game does not end")
+			}
+			p := g.Current()
+			v, _ := p.Hand.Value()
+			var err error
+			switch {
+			case len(p.Hand) == 2 && v == 11:
+				_, err = g.Double(p.ID)
+			case v < 17:
+				_, err = g.Hit(p.ID)
+			default:
+				err = g.Stand(p.ID)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if dv, _ := g.Dealer.Value(); dv < 17 {
+			for _, p := range ps {
+				if !p.Hand.Bust() && !p.Hand.Blackjack() {
+					t.Fatal("dealer must draw to 17")
+				}
+			}
+		}
+		for _, r := range g.Settle() {
+			if r.Outcome == "" || (r.Outcome == "黑杰克" && r.Net != r.Bet*3/2) {
+				t.Fatal("unexpected result", r)
+			}
+		}
+	}
+	// 相同种子得到相同的牌局
+	a := New([]*Player{{ID: 1, Bet: 1}}, rand.New(rand.NewSource(9)))
+	b := New([]*Player{{ID: 1, Bet: 1}}, rand.New(rand.NewSource(9)))
+	if cards.Format(a.Dealer) != cards.Format(b.Dealer) || cards.Format(a.Players[0].Hand) != cards.Format(b.Players[0].Hand) {
+		t.Fatal("same seed must deal the same cards")
+	}
+	if !a.Over() {
+		if _, err := a.Hit(2); err != ErrNotYourTurn {
+			t.Fatal("expect not your turn")
+		}
+	}
+}
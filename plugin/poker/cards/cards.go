@@ -0,0 +1,129 @@
+// Package cards 扑克牌与牌堆
+package cards
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// Suit 花色
+type Suit uint8
+
+const (
+	// Spade 黑桃
+	Spade Suit = iota
+	// Heart 红桃
+	Heart
+	// Club 梅花
+	Club
+	// Diamond 方块
+	Diamond
+	// Joker 大小王
+	Joker
+)
+
+// Rank 点数, A 为 14
+type Rank uint8
+
+const (
+	// Two 2
+	Two Rank = 2
+	// Ten 10
+	Ten Rank = 10
+	// Jack J
+	Jack Rank = 11
+	// Queen Q
+	Queen Rank = 12
+	// King K
+	King Rank = 13
+	// Ace A
+	Ace Rank = 14
+	// BlackJoker 小王
+	BlackJoker Rank = 16
+	// RedJoker 大王
+	RedJoker Rank = 17
+)
+
+var (
+	suitnames = [...]string{"♠", "♥", "♣", "♦"}
+	ranknames = [...]string{2: "2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K", "A"}
+)
+
+// String 如 10, A, 小王
+func (r Rank) String() string {
+	switch {
+	case r == BlackJoker:
+		return "小王"
+	case r == RedJoker:
+		return "大王"
+	case r >= Two && r <= Ace:
+		return ranknames[r]
+	}
+	return "?"
+}
+
+// Card 一张牌
+type Card struct {
+	Suit Suit
+	Rank Rank
+}
+
+// String 如 ♠A, ♥10, 大王
+func (c Card) String() string {
+	if c.Suit == Joker {
+		return c.Rank.String()
+	}
+	if c.Suit > Diamond {
+		return "?"
+	}
+	return suitnames[c.Suit] + c.Rank.String()
+}
+
+// Format 以空格连接
+func Format(cs []Card) string {
+	s := make([]string, len(cs))
+	for i, c := range cs {
+		s[i] = c.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// Deck 牌堆, 从末尾发牌
+type Deck []Card
+
+// NewDeck 按花色与点数排列的一副牌
+func NewDeck(jokers bool) Deck {
+	d := make(Deck, 0, 54)
+	for s := Spade; s <= Diamond; s++ {
+		for r := Two; r <= Ace; r++ {
+			d = append(d, Card{Suit: s, Rank: r})
+		}
+	}
+	if jokers {
+		d = append(d, Card{Suit: Joker, Rank: BlackJoker}, Card{Suit: Joker, Rank: RedJoker})
+	}
+	return d
+}
+
+// Shuffle 用 r 洗牌, 相同的种子得到相同的顺序
+func (d Deck) Shuffle(r *rand.Rand) {
+	r.Shuffle(len(d), func(i, j int) { d[i], d[j] = d[j], d[i] })
+}
+
+// Draw 发 n 张牌, 不够时返回剩下的全部
+func (d *Deck) Draw(n int) []Card {
+	if n > len(*d) {
+		n = len(*d)
+	}
+	cs := make([]Card, n)
+	copy(cs, (*d)[len(*d)-n:])
+	*d = (*d)[:len(*d)-n]
+	return cs
+}
+
+// Shuffled 用 r 洗好的一副新牌
+func Shuffled(r *rand.Rand, jokers bool) Deck {
+	d := NewDeck(jokers)
+	d.Shuffle(r)
+	return d
+}
@@ -0,0 +1,34 @@
+package cards
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDeck(t *testing.T) {
+	d := NewDeck(true)
+	if len(d) != 54 {
+		t.Fatal("unexpected deck size", len(d))
+	}
+	seen := map[Card]bool{}
+	for _, c := range d {
+		if seen[c] {
+			t.Fatal("duplicate card", c)
+		}
+		seen[c] = true
+	}
+	a, b := Shuffled(rand.New(rand.NewSource(7)), false), Shuffled(rand.New(rand.NewSource(7)), false)
+	if Format(a) != Format(b) {
+		t.Fatal("same seed must give same deck")
+	}
+	hand := a.Draw(5)
+	if len(hand) != 5 || len(a) != 47 || hand[4] != b[51] {
+		t.Fatal("unexpected draw", hand)
+	}
+	if s := (Card{Suit: Heart, Rank: Ten}).String(); s != "♥10" {
+		t.Fatal("unexpected", s)
+	}
+	if s := (Card{Suit: Joker, Rank: RedJoker}).String(); s != "大王" {
+		t.Fatal("unexpected", s)
+	}
+}
@@ -0,0 +1,334 @@
+package poker
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/doudizhu"
+)
+
+const (
+	ddzBase    = 10
+	ddzMaxBase = 1000
+)
+
+// ddzroom 一个群的斗地主
+type ddzroom struct {
+	gid   int64
+	base  int // base 底分, 每倍输赢的ATRI币
+	ids   []int64
+	first int // first 下一局首先叫分的座位
+	game  *doudizhu.Game
+	timer turntimer
+}
+
+var (
+	ddzmu sync.Mutex
+	ddzs  = map[int64]*ddzroom{}
+)
+
+func (r *ddzroom) joined(uid int64) bool {
+	for _, id := range r.ids {
+		if id == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// ddzplaying 本群有进行中的斗地主且发送者是玩家, 其余消息交给后续插件
+func ddzplaying(ctx *zero.Ctx) bool {
+	ddzmu.Lock()
+	defer ddzmu.Unlock()
+	r, ok := ddzs[ctx.Event.GroupID]
+	return ok && r.game != nil && r.game.Seat(ctx.Event.UserID) >= 0
+}
+
+// start 发牌并私聊发送手牌
+func (r *ddzroom) start(ctx *zero.Ctx) {
+	r.game = doudizhu.New([3]int64{r.ids[0], r.ids[1], r.ids[2]}, r.first, newrand())
+	r.first = (r.first + 1) % 3
+	hands := make(map[int64]message.Message, 3)
+	for i, id := range r.game.IDs {
+		hands[id] = message.Message{message.Text("群", r.gid, "斗地主, 你的手牌(", len(r.game.Hands[i]), "张):\n", cards.Format(r.game.Hands[i]))}
+	}
+	ctx.SendChain(message.Text("斗地主开始! 底分", r.base, ", 手牌已私聊发送"))
+	dealfailed(ctx, deal(ctx, r.gid, hands), "可在群内发送\"我的手牌\"重试")
+	r.prompt(ctx)
+}
+
+// sendhand 私聊发送剩余手牌
+func (r *ddzroom) sendhand(ctx *zero.Ctx, seat int) bool {
+	h := r.game.Hands[seat]
+	return sendprivate(ctx, r.gid, r.game.IDs[seat], message.Message{message.Text("你的手牌(", len(h), "张):\n", cards.Format(h))})
+}
+
+// prompt 提示当前行动者, 并开始计时
+func (r *ddzroom) prompt(ctx *zero.Ctx) {
+	g := r.game
+	id := g.IDs[g.Turn]
+	switch {
+	case g.Phase == doudizhu.Bidding:
+		hint := "叫1分/叫2分/叫3分/不叫"
+		if g.Bid > 0 {
+			hint = "当前" + strconv.Itoa(g.Bid) + "分, 可以叫更高的分或不叫"
+		}
+		ctx.SendChain(message.At(id), message.Text(" 请叫地主: ", hint))
+	case g.Leading():
+		ctx.SendChain(message.At(id), message.Text(" 请出牌, 如: 出 33344"))
+	default:
+		ctx.SendChain(message.At(id), message.Text(" 请出牌或发送\"不要\""))
+	}
+	r.timer.reset(&ddzmu, func() {
+		seat := g.Turn
+		_ = g.Auto()
+		ctx.SendChain(message.Text(name(ctx, id), " 超时, 自动操作"))
+		r.after(ctx, seat)
+	})
+}
+
+// after seat 行动后推进牌局
+func (r *ddzroom) after(ctx *zero.Ctx, seat int) {
+	g := r.game
+	switch g.Phase {
+	case doudizhu.Redeal:
+		ctx.SendChain(message.Text("无人叫地主, 重新发牌"))
+		r.start(ctx)
+		return
+	case doudizhu.Bidding:
+		r.prompt(ctx)
+		return
+	case doudizhu.Finished:
+		r.settle(ctx)
+		return
+	}
+	if g.Last == nil {
+		// 刚确定地主
+		ctx.SendChain(message.Text("地主是 ", name(ctx, g.IDs[g.Landlord]), " (", g.Bid, "分), 底牌: ", cards.Format(g.Kitty)))
+		r.sendhand(ctx, g.Landlord)
+		r.prompt(ctx)
+		return
+	}
+	if g.Last.Seat == seat {
+		left := len(g.Hands[seat])
+		msg := []message.MessageSegment{message.Text(name(ctx, g.IDs[seat]), " 出 ", g.Last.Pattern.Kind, ": ", cards.Format(g.Last.Cards), "\n剩余", left, "张")}
+		if left <= 2 {
+			msg = append(msg, message.Text(", 只剩", left, "张牌了!"))
+		}
+		ctx.SendChain(msg...)
+		r.sendhand(ctx, seat)
+	} else {
+		ctx.SendChain(message.Text(name(ctx, g.IDs[seat]), " 不要"))
+	}
+	r.prompt(ctx)
+}
+
+// settle 结算, 输家最多付出全部余额, 赢家平分实际收到的ATRI币
+func (r *ddzroom) settle(ctx *zero.Ctx) {
+	r.timer.stop()
+	g := r.game
+	delta := g.Settle()
+	var got [3]int
+	collected := 0
+	for i, d := range delta {
+		if d >= 0 {
+			continue
+		}
+		owe := -d * r.base
+		if bal := wallet.GetWalletOf(g.IDs[i]); owe > bal {
+			owe = bal
+		}
+		if owe > 0 && wallet.InsertWalletOf(g.IDs[i], -owe) == nil {
+			collected += owe
+			got[i] = -owe
+		}
+	}
+	var winners []int
+	for i, d := range delta {
+		if d > 0 {
+			winners = append(winners, i)
+		}
+	}
+	for j, i := range winners {
+		n := collected / len(winners)
+		if j == 0 {
+			n += collected - n*len(winners)
+		}
+		refund(g.IDs[i], n)
+		got[i] = n
+	}
+	var sb strings.Builder
+	if g.Winner == g.Landlord {
+		sb.WriteString("地主胜利!")
+	} else {
+		sb.WriteString("农民胜利!")
+	}
+	if g.Spring() {
+		sb.WriteString(" 春天!")
+	}
+	sb.WriteString("\n叫分" + strconv.Itoa(g.Bid) + ", 炸弹" + strconv.Itoa(g.Bombs) + ", 总倍数" + strconv.Itoa(g.Multiple()))
+	for i, id := range g.IDs {
+		sb.WriteString("\n" + name(ctx, id))
+		if i == g.Landlord {
+			sb.WriteString("(地主)")
+		}
+		sb.WriteString(": " + strconv.Itoa(got[i]) + "ATRI币")
+		if len(g.Hands[i]) > 0 {
+			sb.WriteString(", 余牌 " + cards.Format(g.Hands[i]))
+		}
+	}
+	ctx.SendChain(message.Text(sb.String()))
+	delete(ddzs, r.gid)
+}
+
+func init() {
+	engine.OnRegex(`^斗地主\s*(\d*)$`, zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			base := ddzBase
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				base, _ = strconv.Atoi(s)
+			}
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+			r, ok := ddzs[gid]
+			if !ok {
+				if base <= 0 || base > ddzMaxBase {
+					ctx.SendChain(message.Text("ERROR: 底分应在1-", ddzMaxBase, "之间"))
+					return
+				}
+				r = &ddzroom{gid: gid, base: base}
+			}
+			if r.game != nil {
+				ctx.SendChain(message.Text("本群斗地主进行中"))
+				return
+			}
+			if r.joined(uid) {
+				ctx.SendChain(message.Text("你已加入, 等待其他玩家(", len(r.ids), "/3)"))
+				return
+			}
+			if wallet.GetWalletOf(uid) < r.base {
+				ctx.SendChain(message.Text("ERROR: ", errNoMoney, ", 至少需要", r.base))
+				return
+			}
+			r.ids = append(r.ids, uid)
+			ddzs[gid] = r
+			if len(r.ids) < 3 {
+				ctx.SendChain(message.Text("加入成功, 底分", r.base, ", 等待其他玩家(", len(r.ids), "/3), 发送\"斗地主\"加入"))
+				return
+			}
+			r.start(ctx)
+		})
+	engine.OnRegex(`^(?:叫([123])分?|不叫)$`, zero.OnlyGroup, ddzplaying).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			r, ok := ddzs[ctx.Event.GroupID]
+			if !ok || r.game == nil {
+				return
+			}
+			score, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			seat := r.game.Turn
+			if err := r.game.CallBid(ctx.Event.UserID, score); err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: ", err))
+				return
+			}
+			r.after(ctx, seat)
+		})
+	engine.OnRegex(`^出\s*(.+)$`, zero.OnlyGroup, ddzplaying).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			r, ok := ddzs[ctx.Event.GroupID]
+			if !ok || r.game == nil || r.game.Seat(ctx.Event.UserID) < 0 {
+				return
+			}
+			vs, err := doudizhu.ParseValues(ctx.State["regex_matched"].([]string)[1])
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: ", err))
+				return
+			}
+			seat := r.game.Turn
+			if _, err = r.game.PlayValues(ctx.Event.UserID, vs); err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: ", err))
+				return
+			}
+			r.after(ctx, seat)
+		})
+	engine.OnRegex(`^(过|不要|要不起)$`, zero.OnlyGroup, ddzplaying).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			r, ok := ddzs[ctx.Event.GroupID]
+			if !ok || r.game == nil || r.game.Seat(ctx.Event.UserID) < 0 {
+				return
+			}
+			seat := r.game.Turn
+			if err := r.game.Pass(ctx.Event.UserID); err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: ", err))
+				return
+			}
+			r.after(ctx, seat)
+		})
+	engine.OnFullMatch("我的手牌", zero.OnlyGroup, ddzplaying).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			r, ok := ddzs[ctx.Event.GroupID]
+			if !ok || r.game == nil {
+				return
+			}
+			seat := r.game.Seat(ctx.Event.UserID)
+			if seat < 0 {
+				return
+			}
+			if !r.sendhand(ctx, seat) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("无法私聊发送手牌, 请先添加好友或允许临时会话"))
+			}
+		})
+	engine.OnFullMatch("退出斗地主", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			r, ok := ddzs[ctx.Event.GroupID]
+			if !ok || !r.joined(ctx.Event.UserID) {
+				return
+			}
+			if r.game != nil {
+				ctx.SendChain(message.Text("牌局已开始, 不能退出"))
+				return
+			}
+			for i, id := range r.ids {
+				if id == ctx.Event.UserID {
+					r.ids = append(r.ids[:i], r.ids[i+1:]...)
+					break
+				}
+			}
+			if len(r.ids) == 0 {
+				delete(ddzs, r.gid)
+			}
+			ctx.SendChain(message.Text("已退出斗地主"))
+		})
+	engine.OnFullMatch("结束斗地主", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ddzmu.Lock()
+			defer ddzmu.Unlock()
+			r, ok := ddzs[ctx.Event.GroupID]
+			if !ok {
+				return
+			}
+			if !r.joined(ctx.Event.UserID) && !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Text("只有玩家或管理员可以结束斗地主"))
+				return
+			}
+			r.timer.stop()
+			delete(ddzs, r.gid)
+			ctx.SendChain(message.Text("斗地主已结束, 本局不结算"))
+		})
+}
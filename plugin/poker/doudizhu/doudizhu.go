@@ -0,0 +1,266 @@
+// Package doudizhu 三人斗地主的牌局
+package doudizhu
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+var (
+	// ErrNotYourTurn 还没轮到
+	ErrNotYourTurn = errors.New("还没轮到你")
+	// ErrWrongPhase 当前阶段不能这样做
+	ErrWrongPhase = errors.New("当前阶段不能这样做")
+	// ErrBadBid 叫分应高于当前最高分且不超过3
+	ErrBadBid = errors.New("叫分应高于当前最高分且不超过3")
+	// ErrNotInHand 手上没有这些牌
+	ErrNotInHand = errors.New("手上没有这些牌")
+	// ErrInvalid 不成牌型
+	ErrInvalid = errors.New("不成牌型")
+	// ErrCannotBeat 压不过上家
+	ErrCannotBeat = errors.New("压不过上家")
+	// ErrMustPlay 自由出牌时不能不要
+	ErrMustPlay = errors.New("你是首家, 必须出牌")
+)
+
+// Phase 阶段
+type Phase int
+
+const (
+	// Bidding 叫地主
+	Bidding Phase = iota
+	// Playing 出牌
+	Playing
+	// Finished 结束
+	Finished
+	// Redeal 无人叫地主, 需要重新发牌
+	Redeal
+)
+
+// Play 一次出牌
+type Play struct {
+	Seat    int
+	Cards   []cards.Card
+	Pattern Pattern
+}
+
+// Game 一局
+type Game struct {
+	IDs      [3]int64
+	Hands    [3][]cards.Card
+	Kitty    []cards.Card // Kitty 底牌
+	Phase    Phase
+	Turn     int
+	Bid      int // Bid 最高叫分
+	Landlord int // Landlord 地主的座位, 叫分阶段为 -1
+	Bombs    int // Bombs 打出的炸弹与王炸数
+	Last     *Play
+	Winner   int
+	plays    [3]int // plays 各座位出牌的次数
+	bids     int    // bids 已表态的人数
+}
+
+// New 发牌并从 first 开始叫分
+func New(ids [3]int64, first int, r *rand.Rand) *Game {
+	d := cards.Shuffled(r, true)
+	g := &Game{IDs: ids, Turn: first % 3, Landlord: -1, Winner: -1}
+	for i := range g.Hands {
+		g.Hands[i] = d.Draw(17)
+		sorthand(g.Hands[i])
+	}
+	g.Kitty = d.Draw(3)
+	sorthand(g.Kitty)
+	return g
+}
+
+// sorthand 按斗地主大小降序
+func sorthand(cs []cards.Card) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		vi, vj := value(cs[i]), value(cs[j])
+		if vi != vj {
+			return vi > vj
+		}
+		return cs[i].Suit < cs[j].Suit
+	})
+}
+
+// Seat 玩家的座位, 不在局中时为 -1
+func (g *Game) Seat(id int64) int {
+	for i, x := range g.IDs {
+		if x == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Game) check(id int64, phase Phase) (int, error) {
+	if g.Phase != phase {
+		return 0, ErrWrongPhase
+	}
+	s := g.Seat(id)
+	if s != g.Turn {
+		return 0, ErrNotYourTurn
+	}
+	return s, nil
+}
+
+// CallBid 叫分, score 为 0 表示不叫. 叫3分或三人都表态后确定地主
+func (g *Game) CallBid(id int64, score int) error {
+	s, err := g.check(id, Bidding)
+	if err != nil {
+		return err
+	}
+	if score != 0 && (score <= g.Bid || score > 3) {
+		return ErrBadBid
+	}
+	if score > 0 {
+		g.Bid, g.Landlord = score, s
+	}
+	g.bids++
+	g.Turn = (g.Turn + 1) % 3
+	switch {
+	case g.Bid == 3 || (g.bids == 3 && g.Landlord >= 0):
+		g.Phase, g.Turn = Playing, g.Landlord
+		g.Hands[g.Landlord] = append(g.Hands[g.Landlord], g.Kitty...)
+		sorthand(g.Hands[g.Landlord])
+	case g.bids == 3:
+		g.Phase = Redeal
+	}
+	return nil
+}
+
+// Leading 当前行动者是否可以自由出牌
+func (g *Game) Leading() bool {
+	return g.Last == nil || g.Last.Seat == g.Turn
+}
+
+// take 从手牌中取出指定点数的牌
+func take(hand []cards.Card, vs []int) (picked, rest []cards.Card, ok bool) {
+	need := make(map[int]int, len(vs))
+	for _, v := range vs {
+		need[v]++
+	}
+	for _, c := range hand {
+		if v := value(c); need[v] > 0 {
+			need[v]--
+			picked = append(picked, c)
+			continue
+		}
+		rest = append(rest, c)
+	}
+	for _, n := range need {
+		if n > 0 {
+			return nil, nil, false
+		}
+	}
+	return picked, rest, true
+}
+
+// PlayValues 按点数出牌
+func (g *Game) PlayValues(id int64, vs []int) (*Play, error) {
+	s, err := g.check(id, Playing)
+	if err != nil {
+		return nil, err
+	}
+	picked, rest, ok := take(g.Hands[s], vs)
+	if !ok {
+		return nil, ErrNotInHand
+	}
+	p := Analyze(picked)
+	if p.Kind == Invalid {
+		return nil, ErrInvalid
+	}
+	if !g.Leading() && !p.Beats(g.Last.Pattern) {
+		return nil, ErrCannotBeat
+	}
+	g.Hands[s] = rest
+	g.Last = &Play{Seat: s, Cards: picked, Pattern: p}
+	g.plays[s]++
+	if p.Kind == Bomb || p.Kind == Rocket {
+		g.Bombs++
+	}
+	if len(rest) == 0 {
+		g.Phase, g.Winner = Finished, s
+		return g.Last, nil
+	}
+	g.Turn = (g.Turn + 1) % 3
+	return g.Last, nil
+}
+
+// Pass 不要
+func (g *Game) Pass(id int64) error {
+	_, err := g.check(id, Playing)
+	if err != nil {
+		return err
+	}
+	if g.Leading() {
+		return ErrMustPlay
+	}
+	g.Turn = (g.Turn + 1) % 3
+	return nil
+}
+
+// Auto 超时时的默认动作: 首家出最小的单张, 否则不要
+func (g *Game) Auto() error {
+	id := g.IDs[g.Turn]
+	switch g.Phase {
+	case Bidding:
+		return g.CallBid(id, 0)
+	case Playing:
+		if g.Leading() {
+			h := g.Hands[g.Turn]
+			_, err := g.PlayValues(id, []int{value(h[len(h)-1])})
+			return err
+		}
+		return g.Pass(id)
+	}
+	return ErrWrongPhase
+}
+
+// Spring 地主春天或农民反春
+func (g *Game) Spring() bool {
+	if g.Phase != Finished {
+		return false
+	}
+	if g.Winner == g.Landlord {
+		return g.plays[(g.Landlord+1)%3] == 0 && g.plays[(g.Landlord+2)%3] == 0
+	}
+	return g.plays[g.Landlord] == 1
+}
+
+// Multiple 总倍数: 叫分 × 2^(炸弹数+春天)
+func (g *Game) Multiple() int {
+	m := g.Bid
+	if m == 0 {
+		m = 1
+	}
+	n := g.Bombs
+	if g.Spring() {
+		n++
+	}
+	return m << n
+}
+
+// Settle 每个座位的输赢, 单位为底分
+func (g *Game) Settle() (delta [3]int) {
+	if g.Phase != Finished {
+		return
+	}
+	m := g.Multiple()
+	sign := 1
+	if g.Winner != g.Landlord {
+		sign = -1
+	}
+	for i := range delta {
+		if i == g.Landlord {
+			delta[i] = 2 * m * sign
+		} else {
+			delta[i] = -m * sign
+		}
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package doudizhu
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+// cs 由点数生成任意花色的牌
+func cs(vs ...int) []cards.Card {
+	ret := make([]cards.Card, len(vs))
+	for i, v := range vs {
+		switch v {
+		case 15:
+			ret[i] = cards.Card{Suit: cards.Suit(i % 4), Rank: cards.Two}
+		case 16:
+			ret[i] = cards.Card{Suit: cards.Joker, Rank: cards.BlackJoker}
+		case 17:
+			ret[i] = cards.Card{Suit: cards.Joker, Rank: cards.RedJoker}
+		default:
+			ret[i] = cards.Card{Suit: cards.Suit(i % 4), Rank: cards.Rank(v)}
+		}
+	}
+	return ret
+}
+
+func TestAnalyze(t *testing.T) {
+	for want, vs := range map[Pattern][]int{
+		{Single, 15, 1}:      {15},
+		{Pair, 3, 1}:         {3, 3},
+		{Triple, 9, 1}:       {9, 9, 9},
+		{TripleSingle, 9, 1}: {9, 9, 9, 4},
+		{TriplePair, 9, 1}:   {9, 9, 9, 4, 4},
+		{Straight, 14, 8}:    {7, 8, 9, 10, 11, 12, 13, 14},
+		{PairStraight, 5, 3}: {3, 3, 4, 4, 5, 5},
+		{Plane, 4, 2}:        {3, 3, 3, 4, 4, 4},
+		{PlaneSingles, 8, 2}: {7, 7, 7, 8, 8, 8, 3, 15},
+		{PlanePairs, 8, 2}:   {7, 7, 7, 8, 8, 8, 3, 3, 15, 15},
+		{FourTwo, 6, 1}:      {6, 6, 6, 6, 3, 4},
+		{FourTwoPairs, 6, 1}: {6, 6, 6, 6, 3, 3, 4, 4},
+		{Bomb, 15, 1}:        {15, 15, 15, 15},
+		{Rocket, 17, 1}:      {16, 17},
+		{Invalid, 0, 0}:      {13, 14, 15, 3, 4},
+	} {
+		if got := Analyze(cs(vs...)); got != want {
+			t.Fatal(vs, "expect", want, "got", got)
+		}
+	}
+	if Analyze(cs(3, 4)).Kind != Invalid || Analyze(cs(11, 12, 13, 14, 15)).Kind != Invalid {
+		t.Fatal("2 cannot be in a straight")
+	}
+}
+
+func TestBeats(t *testing.T) {
+	p := func(vs ...int) Pattern { return Analyze(cs(vs...)) }
+	switch {
+	case !p(4).Beats(p(3)), p(3).Beats(p(3)):
+		t.Fatal("single")
+	case p(4, 5, 6, 7, 8, 9).Beats(p(3, 4, 5, 6, 7)):
+		t.Fatal("straight length must match")
+	case !p(3, 3, 3, 3).Beats(p(15, 15)), !p(4, 4, 4, 4).Beats(p(3, 3, 3, 3)):
+		t.Fatal("bomb")
+	case !p(16, 17).Beats(p(15, 15, 15, 15)), p(15, 15, 15, 15).Beats(p(16, 17)):
+		t.Fatal("rocket")
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	vs, err := ParseValues("10 jqka2 王炸")
+	if err != nil || len(vs) != 8 || vs[0] != 10 || vs[4] != 14 || vs[5] != 15 || vs[6] != 17 || vs[7] != 16 {
+		t.Fatal("unexpected", vs, err)
+	}
+	if _, err := ParseValues("1"); err != ErrBadCards {
+		t.Fatal("expect error")
+	}
+}
+
+func TestGame(t *testing.T) {
+	for seed := int64(0); seed < 30; seed++ {
+		g := New([3]int64{1, 2, 3}, int(seed), rand.New(rand.NewSource(seed)))
+		if len(g.Hands[0])+len(g.Hands[1])+len(g.Hands[2])+len(g.Kitty) != 54 {
+			t.Fatal("bad deal")
+		}
+		first := g.Turn
+		if err := g.CallBid(g.IDs[(first+1)%3], 1); err != ErrNotYourTurn {
+			t.Fatal("expect not your turn")
+		}
+		if err := g.CallBid(g.IDs[first], 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.CallBid(g.IDs[(first+1)%3], 1); err != ErrBadBid {
+			t.Fatal("bid must increase")
+		}
+		if err := g.CallBid(g.IDs[(first+1)%3], 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.CallBid(g.IDs[(first+2)%3], 2); err != nil {
+			t.Fatal(err)
+		}
+		if g.Phase != Playing || g.Landlord != (first+2)%3 || len(g.Hands[g.Landlord]) != 20 || g.Turn != g.Landlord {
+			t.Fatal("unexpected landlord state")
+		}
+		if err := g.Pass(g.IDs[g.Turn]); err != ErrMustPlay {
+			t.Fatal("leader must play")
+		}
+		for i := 0; g.Phase == Playing; i++ {
+			if i > 200 {
+				t.Fatal("game does not end")
+			}
+			if err := g.Auto(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d := g.Settle()
+		if d[0]+d[1]+d[2] != 0 || d[g.Landlord] == 0 {
+			t.Fatal("unbalanced settle", d)
+		}
+	}
+	g := New([3]int64{1, 2, 3}, 0, rand.New(rand.NewSource(1)))
+	for i := 0; i < 3; i++ {
+		_ = g.Auto()
+	}
+	if g.Phase != Redeal {
+		t.Fatal("all pass must redeal")
+	}
+}
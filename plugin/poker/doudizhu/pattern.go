@@ -0,0 +1,238 @@
+package doudizhu
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+// Kind 牌型
+type Kind int
+
+const (
+	// Invalid 不成牌型
+	Invalid Kind = iota
+	// Single 单张
+	Single
+	// Pair 对子
+	Pair
+	// Triple 三张
+	Triple
+	// TripleSingle 三带一
+	TripleSingle
+	// TriplePair 三带二
+	TriplePair
+	// Straight 顺子
+	Straight
+	// PairStraight 连对
+	PairStraight
+	// Plane 飞机
+	Plane
+	// PlaneSingles 飞机带单张
+	PlaneSingles
+	// PlanePairs 飞机带对子
+	PlanePairs
+	// FourTwo 四带二
+	FourTwo
+	// FourTwoPairs 四带两对
+	FourTwoPairs
+	// Bomb 炸弹
+	Bomb
+	// Rocket 王炸
+	Rocket
+)
+
+var kindnames = [...]string{"无效", "单张", "对子", "三张", "三带一", "三带二", "顺子", "连对", "飞机", "飞机带翅膀", "飞机带对子", "四带二", "四带两对", "炸弹", "王炸"}
+
+func (k Kind) String() string {
+	return kindnames[k]
+}
+
+// Pattern 一手牌的牌型
+type Pattern struct {
+	Kind Kind
+	Main int // Main 比较大小的点数, 连续牌型为最大的一组
+	Len  int // Len 连续的组数, 其余牌型为 1
+}
+
+// value 斗地主中的大小: 3-K 为 3-13, A 为 14, 2 为 15, 小王 16, 大王 17
+func value(c cards.Card) int {
+	if c.Rank == cards.Two {
+		return 15
+	}
+	return int(c.Rank)
+}
+
+// Analyze 识别牌型
+func Analyze(cs []cards.Card) Pattern {
+	n := len(cs)
+	var counts [18]int
+	for _, c := range cs {
+		counts[value(c)]++
+	}
+	// 各张数的点数, 升序
+	var byn [5][]int
+	for v := 3; v <= 17; v++ {
+		if counts[v] > 0 {
+			byn[counts[v]] = append(byn[counts[v]], v)
+		}
+	}
+	switch {
+	case n == 0:
+		return Pattern{}
+	case n == 2 && counts[16] == 1 && counts[17] == 1:
+		return Pattern{Kind: Rocket, Main: 17, Len: 1}
+	case n == 4 && len(byn[4]) == 1:
+		return Pattern{Kind: Bomb, Main: byn[4][0], Len: 1}
+	case n == 1:
+		return Pattern{Kind: Single, Main: value(cs[0]), Len: 1}
+	case n == 2 && len(byn[2]) == 1:
+		return Pattern{Kind: Pair, Main: byn[2][0], Len: 1}
+	case n == 3 && len(byn[3]) == 1:
+		return Pattern{Kind: Triple, Main: byn[3][0], Len: 1}
+	case n == 4 && len(byn[3]) == 1:
+		return Pattern{Kind: TripleSingle, Main: byn[3][0], Len: 1}
+	case n == 5 && len(byn[3]) == 1 && len(byn[2]) == 1:
+		return Pattern{Kind: TriplePair, Main: byn[3][0], Len: 1}
+	}
+	if n >= 5 && len(byn[1]) == n && consecutive(byn[1]) {
+		return Pattern{Kind: Straight, Main: byn[1][n-1], Len: n}
+	}
+	if n >= 6 && len(byn[2])*2 == n && consecutive(byn[2]) {
+		return Pattern{Kind: PairStraight, Main: byn[2][len(byn[2])-1], Len: n / 2}
+	}
+	if p, ok := plane(counts[:], n); ok {
+		return p
+	}
+	if len(byn[4]) == 1 {
+		switch {
+		case n == 6:
+			return Pattern{Kind: FourTwo, Main: byn[4][0], Len: 1}
+		case n == 8 && len(byn[2]) == 2:
+			return Pattern{Kind: FourTwoPairs, Main: byn[4][0], Len: 1}
+		}
+	}
+	return Pattern{}
+}
+
+// consecutive 升序的点数是否连续, 且不含 2 与王
+func consecutive(vs []int) bool {
+	if vs[len(vs)-1] > 14 {
+		return false
+	}
+	for i := 1; i < len(vs); i++ {
+		if vs[i] != vs[i-1]+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// plane 识别飞机, 优先取最大的连续三张
+func plane(counts []int, n int) (Pattern, bool) {
+	for _, w := range []struct {
+		kind Kind
+		per  int
+	}{{Plane, 3}, {PlaneSingles, 4}, {PlanePairs, 5}} {
+		if n%w.per != 0 || n/w.per < 2 {
+			continue
+		}
+		k := n / w.per
+		for hi := 14; hi-k+1 >= 3; hi-- {
+			ok := true
+			for v := hi - k + 1; v <= hi; v++ {
+				if counts[v] < 3 {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			// 剩下的牌作为翅膀
+			rest := make([]int, len(counts))
+			copy(rest, counts)
+			for v := hi - k + 1; v <= hi; v++ {
+				rest[v] -= 3
+			}
+			switch w.kind {
+			case Plane:
+				for _, c := range rest {
+					if c != 0 {
+						ok = false
+					}
+				}
+			case PlanePairs:
+				pairs := 0
+				for _, c := range rest {
+					if c%2 != 0 {
+						ok = false
+					}
+					pairs += c / 2
+				}
+				ok = ok && pairs == k
+			}
+			if ok {
+				return Pattern{Kind: w.kind, Main: hi, Len: k}, true
+			}
+		}
+	}
+	return Pattern{}, false
+}
+
+// Beats a 能否压过 b
+func (a Pattern) Beats(b Pattern) bool {
+	switch {
+	case a.Kind == Invalid:
+		return false
+	case a.Kind == Rocket:
+		return true
+	case b.Kind == Rocket:
+		return false
+	case a.Kind == Bomb && b.Kind != Bomb:
+		return true
+	}
+	return a.Kind == b.Kind && a.Len == b.Len && a.Main > b.Main
+}
+
+// ErrBadCards 无法识别的牌
+var ErrBadCards = errors.New("无法识别的牌, 示例: 出 33344 / 出 10JQKA / 出 王炸")
+
+// ParseValues 解析输入的点数, 如 "33 344", "10JQKA", "大王小王", "王炸"
+func ParseValues(s string) ([]int, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	s = strings.ReplaceAll(s, "王炸", "大王小王")
+	var vs []int
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "10"):
+			vs, s = append(vs, 10), s[2:]
+		case strings.HasPrefix(s, "大王"):
+			vs, s = append(vs, 17), s[len("大王"):]
+		case strings.HasPrefix(s, "小王"):
+			vs, s = append(vs, 16), s[len("小王"):]
+		default:
+			v := strings.IndexByte("3456789TJQKA2", s[0])
+			if v < 0 {
+				switch s[0] {
+				case '0':
+					v = 7 // 0 表示 10
+				case 'W':
+					vs, s = append(vs, 17), s[1:]
+					continue
+				case 'X':
+					vs, s = append(vs, 16), s[1:]
+					continue
+				default:
+					return nil, ErrBadCards
+				}
+			}
+			vs, s = append(vs, v+3), s[1:]
+		}
+	}
+	if len(vs) == 0 {
+		return nil, ErrBadCards
+	}
+	return vs, nil
+}
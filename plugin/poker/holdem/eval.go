@@ -0,0 +1,137 @@
+package holdem
+
+import (
+	"sort"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+// Category 牌型
+type Category int
+
+const (
+	// HighCard 高牌
+	HighCard Category = iota
+	// OnePair 一对
+	OnePair
+	// TwoPair 两对
+	TwoPair
+	// ThreeOfAKind 三条
+	ThreeOfAKind
+	// Straight 顺子
+	Straight
+	// Flush 同花
+	Flush
+	// FullHouse 葫芦
+	FullHouse
+	// FourOfAKind 四条
+	FourOfAKind
+	// StraightFlush 同花顺
+	StraightFlush
+)
+
+var categorynames = [...]string{"高牌", "一对", "两对", "三条", "顺子", "同花", "葫芦", "四条", "同花顺"}
+
+func (c Category) String() string {
+	return categorynames[c]
+}
+
+// Value 可直接比较大小的牌力, 越大越好
+type Value uint32
+
+// Category 牌型
+func (v Value) Category() Category {
+	return Category(v >> 20)
+}
+
+// String 牌型名称
+func (v Value) String() string {
+	if v.Category() == StraightFlush && v&0xf0000 == Value(cards.Ace)<<16 {
+		return "皇家同花顺"
+	}
+	return v.Category().String()
+}
+
+// eval5 五张牌的牌力: 牌型占高位, 其后依次为比较用的点数
+func eval5(cs []cards.Card) Value {
+	var counts [15]int
+	flush := true
+	for i, c := range cs {
+		counts[c.Rank]++
+		if i > 0 && c.Suit != cs[0].Suit {
+			flush = false
+		}
+	}
+	// 按 (张数, 点数) 降序排列的点数
+	ranks := make([]cards.Rank, 0, 5)
+	for r := cards.Ace; r >= cards.Two; r-- {
+		if counts[r] > 0 {
+			ranks = append(ranks, r)
+		}
+	}
+	sort.SliceStable(ranks, func(i, j int) bool {
+		return counts[ranks[i]] > counts[ranks[j]]
+	})
+	straight, high := false, cards.Rank(0)
+	if len(ranks) == 5 {
+		switch {
+		case ranks[0]-ranks[4] == 4:
+			straight, high = true, ranks[0]
+		case ranks[0] == cards.Ace && ranks[1] == 5:
+			// A2345
+			straight, high = true, 5
+		}
+	}
+	var cat Category
+	switch {
+	case straight && flush:
+		cat = StraightFlush
+	case counts[ranks[0]] == 4:
+		cat = FourOfAKind
+	case counts[ranks[0]] == 3 && counts[ranks[1]] == 2:
+		cat = FullHouse
+	case flush:
+		cat = Flush
+	case straight:
+		cat = Straight
+	case counts[ranks[0]] == 3:
+		cat = ThreeOfAKind
+	case counts[ranks[0]] == 2 && counts[ranks[1]] == 2:
+		cat = TwoPair
+	case counts[ranks[0]] == 2:
+		cat = OnePair
+	}
+	v := Value(cat) << 20
+	if straight {
+		return v | Value(high)<<16
+	}
+	for i, r := range ranks {
+		v |= Value(r) << (16 - 4*i)
+	}
+	return v
+}
+
+// Best 从至少五张牌中选出最大的五张
+func Best(cs []cards.Card) (best Value, hand []cards.Card) {
+	n := len(cs)
+	idx := [5]int{}
+	five := make([]cards.Card, 5)
+	var rec func(start, k int)
+	rec = func(start, k int) {
+		if k == 5 {
+			for i, j := range idx {
+				five[i] = cs[j]
+			}
+			if v := eval5(five); v > best || hand == nil {
+				best, hand = v, append([]cards.Card(nil), five...)
+			}
+			return
+		}
+		for i := start; i <= n-(5-k); i++ {
+			idx[k] = i
+			rec(i+1, k+1)
+		}
+	}
+	rec(0, 0)
+	return
+}
@@ -0,0 +1,410 @@
+// Package holdem 德州扑克 (无限注) 的牌局
+package holdem
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+var (
+	// ErrNotYourTurn 还没轮到
+	ErrNotYourTurn = errors.New("还没轮到你")
+	// ErrFinished 本局已结束
+	ErrFinished = errors.New("本局已结束")
+	// ErrCannotCheck 需要跟注时不能过牌
+	ErrCannotCheck = errors.New("需要跟注, 不能过牌")
+	// ErrRaiseTooSmall 加注额不足
+	ErrRaiseTooSmall = errors.New("加注额不足")
+	// ErrNotEnoughChips 筹码不足
+	ErrNotEnoughChips = errors.New("筹码不足")
+	// ErrTooFewPlayers 至少需要两名有筹码的玩家
+	ErrTooFewPlayers = errors.New("至少需要两名有筹码的玩家")
+)
+
+// Stage 下注轮
+type Stage int
+
+const (
+	// PreFlop 翻牌前
+	PreFlop Stage = iota
+	// Flop 翻牌
+	Flop
+	// Turn 转牌
+	Turn
+	// River 河牌
+	River
+	// Showdown 结束
+	Showdown
+)
+
+var stagenames = [...]string{"翻牌前", "翻牌", "转牌", "河牌", "结束"}
+
+func (s Stage) String() string {
+	return stagenames[s]
+}
+
+// Player 座位上的玩家
+type Player struct {
+	ID     int64
+	Chips  int          // Chips 手上剩余的筹码
+	Hole   []cards.Card // Hole 底牌
+	Bet    int          // Bet 本轮已下注
+	Total  int          // Total 本局已下注
+	Folded bool
+	AllIn  bool
+	acted  bool
+}
+
+// active 仍可行动
+func (p *Player) active() bool {
+	return !p.Folded && !p.AllIn
+}
+
+// Payout 结算结果
+type Payout struct {
+	ID   int64
+	Win  int    // Win 从底池赢得的筹码
+	Hand string // Hand 摊牌时的牌型, 未摊牌时为空
+	Best []cards.Card
+}
+
+// Game 一局
+type Game struct {
+	Players    []*Player
+	Board      []cards.Card
+	Dealer     int
+	SmallBlind int
+	BigBlind   int
+	Stage      Stage
+	Turn       int // Turn 当前行动者的座位
+	CurrentBet int // CurrentBet 本轮需要跟到的注额
+	MinRaise   int // MinRaise 最小加注幅度
+	Payouts    []Payout
+	deck       cards.Deck
+}
+
+// New 开始一局, 发底牌并下盲注. 筹码为 0 的玩家应在调用前移除
+func New(players []*Player, dealer, smallblind, bigblind int, r *rand.Rand) (*Game, error) {
+	if len(players) < 2 {
+		return nil, ErrTooFewPlayers
+	}
+	g := &Game{
+		Players: players, Dealer: dealer % len(players),
+		SmallBlind: smallblind, BigBlind: bigblind,
+		MinRaise: bigblind, deck: cards.Shuffled(r, false),
+	}
+	for _, p := range players {
+		p.Hole, p.Bet, p.Total, p.Folded, p.AllIn, p.acted = nil, 0, 0, false, false, false
+	}
+	for i := 0; i < 2; i++ {
+		for _, p := range players {
+			p.Hole = append(p.Hole, g.deck.Draw(1)...)
+		}
+	}
+	sb := g.next(g.Dealer)
+	if len(players) == 2 {
+		// 单挑时庄家下小盲并先行动
+		sb = g.Dealer
+	}
+	bb := g.next(sb)
+	g.post(players[sb], smallblind)
+	g.post(players[bb], bigblind)
+	g.CurrentBet = bigblind
+	g.Turn = g.next(bb)
+	g.advance()
+	return g, nil
+}
+
+// next 座位 i 之后的下一个座位
+func (g *Game) next(i int) int {
+	return (i + 1) % len(g.Players)
+}
+
+// post 下注 n, 不够时全下
+func (g *Game) post(p *Player, n int) {
+	if n >= p.Chips {
+		n = p.Chips
+		p.AllIn = true
+	}
+	p.Chips -= n
+	p.Bet += n
+	p.Total += n
+}
+
+// Current 当前行动者, 已结束时为 nil
+func (g *Game) Current() *Player {
+	if g.Over() {
+		return nil
+	}
+	return g.Players[g.Turn]
+}
+
+// Over 是否已结束
+func (g *Game) Over() bool {
+	return g.Stage == Showdown
+}
+
+// Pot 底池总额
+func (g *Game) Pot() (n int) {
+	for _, p := range g.Players {
+		n += p.Total
+	}
+	return
+}
+
+// ToCall 当前行动者需要跟注的数额
+func (g *Game) ToCall() int {
+	p := g.Current()
+	if p == nil {
+		return 0
+	}
+	n := g.CurrentBet - p.Bet
+	if n > p.Chips {
+		n = p.Chips
+	}
+	return n
+}
+
+// Fold 弃牌
+func (g *Game) Fold(id int64) error {
+	p, err := g.check(id)
+	if err != nil {
+		return err
+	}
+	p.Folded = true
+	g.advance()
+	return nil
+}
+
+// Check 过牌
+func (g *Game) Check(id int64) error {
+	p, err := g.check(id)
+	if err != nil {
+		return err
+	}
+	if p.Bet < g.CurrentBet {
+		return ErrCannotCheck
+	}
+	p.acted = true
+	g.advance()
+	return nil
+}
+
+// Call 跟注, 筹码不足时全下
+func (g *Game) Call(id int64) error {
+	p, err := g.check(id)
+	if err != nil {
+		return err
+	}
+	g.post(p, g.CurrentBet-p.Bet)
+	p.acted = true
+	g.advance()
+	return nil
+}
+
+// Raise 加注到本轮共 to
+func (g *Game) Raise(id int64, to int) error {
+	p, err := g.check(id)
+	if err != nil {
+		return err
+	}
+	if to-p.Bet > p.Chips {
+		return ErrNotEnoughChips
+	}
+	if to-p.Bet == p.Chips {
+		return g.allin(p)
+	}
+	if to < g.CurrentBet+g.MinRaise {
+		return ErrRaiseTooSmall
+	}
+	g.raise(p, to)
+	g.advance()
+	return nil
+}
+
+// AllIn 全下
+func (g *Game) AllIn(id int64) error {
+	p, err := g.check(id)
+	if err != nil {
+		return err
+	}
+	return g.allin(p)
+}
+
+func (g *Game) allin(p *Player) error {
+	to := p.Bet + p.Chips
+	if to > g.CurrentBet {
+		g.raise(p, to)
+	} else {
+		g.post(p, p.Chips)
+		p.acted = true
+	}
+	g.advance()
+	return nil
+}
+
+// raise 加注并要求其他人重新表态
+func (g *Game) raise(p *Player, to int) {
+	if d := to - g.CurrentBet; d > g.MinRaise {
+		g.MinRaise = d
+	}
+	g.CurrentBet = to
+	g.post(p, to-p.Bet)
+	for _, o := range g.Players {
+		o.acted = false
+	}
+	p.acted = true
+}
+
+func (g *Game) check(id int64) (*Player, error) {
+	if g.Over() {
+		return nil, ErrFinished
+	}
+	p := g.Players[g.Turn]
+	if p.ID != id {
+		return nil, ErrNotYourTurn
+	}
+	return p, nil
+}
+
+// advance 轮到下一个需要行动的人, 本轮结束时发公共牌, 需要时结算
+func (g *Game) advance() {
+	alive, active := 0, 0
+	for _, p := range g.Players {
+		if !p.Folded {
+			alive++
+			if !p.AllIn {
+				active++
+			}
+		}
+	}
+	if alive == 1 {
+		g.finish(false)
+		return
+	}
+	// 本轮还有人需要表态
+	for i, j := 0, g.Turn; i < len(g.Players); i, j = i+1, g.next(j) {
+		p := g.Players[j]
+		if p.active() && (!p.acted || p.Bet < g.CurrentBet) {
+			if active == 1 && p.Bet >= g.CurrentBet {
+				// 其他人都已全下, 无需再表态
+				break
+			}
+			g.Turn = j
+			return
+		}
+	}
+	// 进入下一轮
+	for _, p := range g.Players {
+		p.Bet, p.acted = 0, false
+	}
+	g.CurrentBet, g.MinRaise = 0, g.BigBlind
+	switch g.Stage {
+	case PreFlop:
+		g.Board = append(g.Board, g.deck.Draw(3)...)
+	case Flop, Turn:
+		g.Board = append(g.Board, g.deck.Draw(1)...)
+	case River:
+		g.finish(true)
+		return
+	}
+	g.Stage++
+	if active <= 1 {
+		// 无人可以继续下注, 直接发完公共牌
+		g.Board = append(g.Board, g.deck.Draw(5-len(g.Board))...)
+		g.finish(true)
+		return
+	}
+	g.Turn = g.next(g.Dealer)
+	for !g.Players[g.Turn].active() {
+		g.Turn = g.next(g.Turn)
+	}
+}
+
+// finish 分配底池, showdown 为 false 时最后剩下的人赢得全部
+func (g *Game) finish(showdown bool) {
+	g.Stage = Showdown
+	win := make(map[int64]int, len(g.Players))
+	hands := make(map[int64]Value, len(g.Players))
+	bests := make(map[int64][]cards.Card, len(g.Players))
+	if showdown {
+		for _, p := range g.Players {
+			if !p.Folded {
+				hands[p.ID], bests[p.ID] = Best(append(append([]cards.Card(nil), p.Hole...), g.Board...))
+			}
+		}
+	}
+	// 按投入额分层形成主池与边池
+	levels := make([]int, 0, len(g.Players))
+	for _, p := range g.Players {
+		levels = append(levels, p.Total)
+	}
+	sort.Ints(levels)
+	prev := 0
+	for _, lv := range levels {
+		if lv == prev {
+			continue
+		}
+		pot := 0
+		var eligible []*Player
+		for _, p := range g.Players {
+			if p.Total > prev {
+				pot += min(p.Total, lv) - prev
+			}
+			if !p.Folded && p.Total >= lv {
+				eligible = append(eligible, p)
+			}
+		}
+		prev = lv
+		if len(eligible) == 0 {
+			// 无人跟注的部分退还给投入最多的未弃牌玩家
+			for _, p := range g.Players {
+				if !p.Folded && (len(eligible) == 0 || p.Total > eligible[0].Total) {
+					eligible = []*Player{p}
+				}
+			}
+		}
+		var winners []*Player
+		if showdown {
+			var best Value
+			for _, p := range eligible {
+				switch v := hands[p.ID]; {
+				case winners == nil || v > best:
+					best, winners = v, []*Player{p}
+				case v == best:
+					winners = append(winners, p)
+				}
+			}
+		} else {
+			winners = eligible
+		}
+		share := pot / len(winners)
+		for i, p := range winners {
+			n := share
+			if i == 0 {
+				// 除不尽的零头给座位最靠前的赢家
+				n += pot - share*len(winners)
+			}
+			win[p.ID] += n
+		}
+	}
+	g.Payouts = g.Payouts[:0]
+	for _, p := range g.Players {
+		p.Chips += win[p.ID]
+		po := Payout{ID: p.ID, Win: win[p.ID]}
+		if v, ok := hands[p.ID]; ok {
+			po.Hand, po.Best = v.String(), bests[p.ID]
+		}
+		g.Payouts = append(g.Payouts, po)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
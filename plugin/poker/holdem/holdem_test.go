@@ -0,0 +1,170 @@
+package holdem
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+func hand(s ...string) []cards.Card {
+	suits := map[byte]cards.Suit{'s': cards.Spade, 'h': cards.Heart, 'c': cards.Club, 'd': cards.Diamond}
+	ranks := map[byte]cards.Rank{'T': cards.Ten, 'J': cards.Jack, 'Q': cards.Queen, 'K': cards.King, 'A': cards.Ace}
+	cs := make([]cards.Card, len(s))
+	for i, x := range s {
+		r, ok := ranks[x[0]]
+		if !ok {
+			r = cards.Rank(x[0] - '0')
+		}
+		cs[i] = cards.Card{Suit: suits[x[1]], Rank: r}
+	}
+	return cs
+}
+
+func TestEval(t *testing.T) {
+	order := [][]cards.Card{
+		hand("2s", "4h", "6c", "8d", "Ts", "Jh", "Kc"),
+		hand("2s", "2h", "6c", "8d", "Ts", "Jh", "Kc"),
+		hand("2s", "2h", "6c", "6d", "Ts", "Jh", "Kc"),
+		hand("2s", "2h", "2c", "6d", "Ts", "Jh", "Kc"),
+		hand("As", "2h", "3c", "4d", "5s", "Jh", "Kc"),
+		hand("6s", "2h", "3c", "4d", "5s", "Jh", "Kc"),
+		hand("2s", "4s", "6s", "8s", "Ts", "Jh", "Kc"),
+		hand("2s", "2h", "2c", "6d", "6s", "Jh", "Kc"),
+		hand("2s", "2h", "2c", "2d", "Ts", "Jh", "Kc"),
+		hand("9s", "Ts", "Js", "Qs", "Ks", "Jh", "Kc"),
+		hand("As", "Ts", "Js", "Qs", "Ks", "Jh", "Kc"),
+	}
+	var prev Value
+	for i, cs := range order {
+		v, best := Best(cs)
+		if len(best) != 5 || (i > 0 && v <= prev) {
+			t.Fatal(i, "unexpected order", v.String())
+		}
+		prev = v
+	}
+	if prev.String() != "皇家同花顺" {
+		t.Fatal("unexpected", prev.String())
+	}
+	// 踢脚比较
+	a, _ := Best(hand("As", "Ah", "Kc", "8d", "4s", "3h", "2c"))
+	b, _ := Best(hand("As", "Ah", "Qc", "8d", "4s", "3h", "2c"))
+	if a <= b {
+		t.Fatal("kicker not compared")
+	}
+}
+
+func players(chips ...int) []*Player {
+	ps := make([]*Player, len(chips))
+	for i, c := range chips {
+		ps[i] = &Player{ID: int64(i + 1), Chips: c}
+	}
+	return ps
+}
+
+func total(g *Game) (n int) {
+	for _, p := range g.Players {
+		n += p.Chips
+	}
+	return
+}
+
+func TestFoldAround(t *testing.T) {
+	g, err := New(players(100, 100, 100), 0, 1, 2, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 庄家0, 小盲1, 大盲2, 由庄家先行动
+	if g.Current().ID != 1 || g.Pot() != 3 {
+		t.Fatal("unexpected first actor", g.Current().ID)
+	}
+	if g.Check(1) != ErrCannotCheck || g.Call(2) != ErrNotYourTurn {
+		t.Fatal("expect errors")
+	}
+	if err := g.Fold(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Fold(2); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Over() || g.Players[2].Chips != 101 || total(g) != 300 {
+		t.Fatal("big blind should win the blinds")
+	}
+}
+
+func TestShowdown(t *testing.T) {
+	g, _ := New(players(100, 100), 0, 1, 2, rand.New(rand.NewSource(3)))
+	// 单挑时庄家为小盲并先行动
+	if g.Current().ID != 1 {
+		t.Fatal("dealer acts first heads-up")
+	}
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(g.Call(1))
+	must(g.Check(2)) // 大盲的选择权
+	if g.Stage != Flop || len(g.Board) != 3 || g.Current().ID != 2 {
+		t.Fatal("unexpected flop state", g.Stage, g.Current().ID)
+	}
+	must(g.Raise(2, 10))
+	if g.Raise(1, 12) != ErrRaiseTooSmall {
+		t.Fatal("min raise not enforced")
+	}
+	must(g.Call(1))
+	must(g.Check(2))
+	must(g.Check(1))
+	must(g.Check(2))
+	must(g.Check(1))
+	if !g.Over() || len(g.Board) != 5 || total(g) != 200 {
+		t.Fatal("unexpected showdown")
+	}
+	for _, p := range g.Payouts {
+		if p.Hand == "" {
+			t.Fatal("hands must be shown")
+		}
+	}
+}
+
+func TestSidePot(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		g, _ := New(players(50, 200, 200), 0, 5, 10, rand.New(rand.NewSource(seed)))
+		if err := g.AllIn(1); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.AllIn(2); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Call(3); err != nil {
+			t.Fatal(err)
+		}
+		if !g.Over() || len(g.Board) != 5 {
+			t.Fatal("board should be run out")
+		}
+		if total(g) != 450 {
+			t.Fatal("chips not conserved", total(g))
+		}
+		// 玩家1最多从主池赢得 150
+		if g.Payouts[0].Win > 150 {
+			t.Fatal("short stack won side pot", g.Payouts[0].Win)
+		}
+	}
+}
+
+func TestUncalled(t *testing.T) {
+	g, _ := New(players(100, 300, 100), 0, 1, 2, rand.New(rand.NewSource(5)))
+	// 玩家2全下 300, 其余弃牌, 未被跟注的部分退还
+	if err := g.Fold(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AllIn(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Fold(3); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Over() || g.Players[1].Chips != 302 || total(g) != 500 {
+		t.Fatal("unexpected result", g.Players[1].Chips)
+	}
+}
@@ -1,4 +1,4 @@
-// Package poker 抽扑克牌
+// Package poker 抽扑克牌与群内扑克游戏
 package poker
 
 import (
@@ -17,15 +17,31 @@ import (
 
 var cardImgPathList []string
 
-func init() {
-	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+var (
+	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "抽扑克牌",
-		Help:             "- 抽扑克\n- poker",
+		Help: "- 抽扑克\n- poker\n" +
+			"德州扑克:\n" +
+			"- 德州扑克[买入筹码] (加入牌桌, 默认200)\n" +
+			"- 开始德州\n" +
+			"- 跟注 | 过牌 | 加注[数额] | 全下 | 弃牌\n" +
+			"- 德州状态 | 离开德州 | 结束德州\n" +
+			"斗地主:\n" +
+			"- 斗地主[底分] (默认10, 满三人自动开始)\n" +
+			"- 叫[1|2|3]分 | 不叫\n" +
+			"- 出[牌] (如 出33344 出10JQKA 出王炸) | 不要\n" +
+			"- 我的手牌 | 退出斗地主 | 结束斗地主\n" +
+			"21点:\n" +
+			"- 21点[下注] (默认10)\n" +
+			"- 开始21点\n" +
+			"- 要牌 | 停牌 | 加倍\n" +
+			"- 退出21点\n" +
+			"注: 使用ATRI币结算, 手牌通过私聊或群临时会话发送, 每回合限时60秒, 超时自动过牌/弃牌/不要/停牌\n" +
+			"bot 重启时牌局作废, 德州筹码与21点下注退还钱包",
 		PublicDataFolder: "Poker",
 	}).ApplySingle(ctxext.DefaultSingle)
-
-	getImg := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+	getImg = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
 		data, err := engine.GetLazyData("imgdata.json", true)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR:", err))
@@ -36,9 +52,12 @@ func init() {
 			ctx.SendChain(message.Text("ERROR:", err))
 			return false
 		}
+		indeximages(cardImgPathList)
 		return true
 	})
+)
 
+func init() {
 	engine.OnFullMatchGroup([]string{"抽扑克", "poker"}, getImg).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			randomIndex := rand.Intn(len(cardImgPathList))
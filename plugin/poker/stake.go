@@ -0,0 +1,108 @@
+package poker
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+const stakeTable = "stake"
+
+// stake 玩家已从钱包扣除、尚留在牌桌上的ATRI币, 重启后牌桌丢失, 启动时据此退还
+type stake struct {
+	ID      string `db:"id"` // 游戏_群号_QQ
+	Game    string `db:"game"`
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Amount  int    `db:"amount"`
+}
+
+// stakedb 牌桌押金数据库
+type stakedb struct {
+	sync.Mutex
+	sql.Sqlite
+}
+
+var stakes = &stakedb{}
+
+func init() {
+	go func() {
+		// 退还完成前不处理德州与21点的指令
+		texasmu.Lock()
+		defer texasmu.Unlock()
+		bjmu.Lock()
+		defer bjmu.Unlock()
+		err := stakes.init(engine.DataFolder() + "stake.db")
+		if err != nil {
+			logrus.Errorln("[poker] open stake db err:", err)
+			return
+		}
+		err = stakes.restore()
+		if err != nil {
+			logrus.Errorln("[poker] restore stakes err:", err)
+		}
+	}()
+}
+
+func (sdb *stakedb) init(path string) error {
+	sdb.DBPath = path
+	err := sdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	return sdb.Create(stakeTable, &stake{})
+}
+
+// restore 退还重启前留在牌桌上的ATRI币
+func (sdb *stakedb) restore() error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	var (
+		s  stake
+		ss []stake
+	)
+	err := sdb.FindFor(stakeTable, &s, "", func() error {
+		ss = append(ss, s)
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		refund(s.UserID, s.Amount)
+		logrus.Infoln("[poker] 退还", s.Game, "群", s.GroupID, "的", s.UserID, s.Amount, "ATRI币")
+	}
+	return sdb.Del(stakeTable, "")
+}
+
+// save 以 amounts 覆盖群内该游戏的押金, amounts 为空时清除
+func (sdb *stakedb) save(game string, gid int64, amounts map[int64]int) {
+	sdb.Lock()
+	defer sdb.Unlock()
+	g := strconv.FormatInt(gid, 10)
+	err := sdb.Del(stakeTable, "WHERE game = '"+game+"' AND gid = "+g)
+	for uid, n := range amounts {
+		if err != nil {
+			break
+		}
+		if n <= 0 {
+			continue
+		}
+		err = sdb.Insert(stakeTable, &stake{
+			ID:      game + "_" + g + "_" + strconv.FormatInt(uid, 10),
+			Game:    game,
+			GroupID: gid,
+			UserID:  uid,
+			Amount:  n,
+		})
+	}
+	if err != nil {
+		logrus.Warnln("[poker] save", game, "stakes of", gid, "err:", err)
+	}
+}
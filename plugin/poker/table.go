@@ -0,0 +1,216 @@
+package poker
+
+import (
+	"errors"
+	"math/rand"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+)
+
+// turntimeout 每回合的思考时间
+const turntimeout = time.Minute
+
+var (
+	errNoMoney = errors.New("ATRI币不足")
+	rng        = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rngmu      sync.Mutex // rng 不是并发安全的
+)
+
+// newrand 为一局牌生成独立的随机源
+func newrand() *rand.Rand {
+	rngmu.Lock()
+	defer rngmu.Unlock()
+	return rand.New(rand.NewSource(rng.Int63()))
+}
+
+// pay 从钱包扣除 n
+func pay(uid int64, n int) error {
+	if wallet.GetWalletOf(uid) < n {
+		return errNoMoney
+	}
+	return wallet.InsertWalletOf(uid, -n)
+}
+
+// refund 向钱包退还或发放 n
+func refund(uid int64, n int) {
+	if n <= 0 {
+		return
+	}
+	if err := wallet.InsertWalletOf(uid, n); err != nil {
+		logrus.Warnln("[poker] refund", uid, n, "err:", err)
+	}
+}
+
+// sendprivate 私聊发送, 非好友时通过群临时会话
+func sendprivate(ctx *zero.Ctx, gid, uid int64, msg message.Message) bool {
+	return ctx.CallAction("send_private_msg", zero.Params{
+		"group_id": gid,
+		"user_id":  uid,
+		"message":  msg,
+	}).RetCode == 0
+}
+
+// turntimer 回合计时, 超时后执行默认动作
+type turntimer struct {
+	t   *time.Timer
+	seq uint64
+}
+
+// reset 重新计时, 之前的计时作废. fn 在持有 mu 时调用
+func (tt *turntimer) reset(mu sync.Locker, fn func()) {
+	tt.stop()
+	seq := tt.seq
+	tt.t = time.AfterFunc(turntimeout, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if tt.seq != seq {
+			return
+		}
+		fn()
+	})
+}
+
+// stop 停止计时
+func (tt *turntimer) stop() {
+	tt.seq++
+	if tt.t != nil {
+		tt.t.Stop()
+		tt.t = nil
+	}
+}
+
+var (
+	cardimgs     = map[cards.Card]string{} // 牌到图片路径, 无法识别的图片不收录
+	suitwords    = map[cards.Suit][]string{cards.Spade: {"黑桃", "spade"}, cards.Heart: {"红桃", "红心", "heart"}, cards.Club: {"梅花", "club"}, cards.Diamond: {"方块", "方片", "diamond"}}
+	shortcardreg = regexp.MustCompile(`^(?:([shcd])[_\-]?([0-9a-z]+)|([0-9a-z]+?)[_\-]?([shcd]))$`)
+)
+
+// indeximages 由图片文件名识别对应的牌, 如 黑桃A.png spade_1.png h13.png 大王.png
+func indeximages(paths []string) {
+	for _, p := range paths {
+		if c, ok := parsecard(p); ok {
+			cardimgs[c] = p
+		}
+	}
+	logrus.Debugln("[poker] indexed", len(cardimgs), "card images")
+}
+
+func parsecard(p string) (cards.Card, bool) {
+	name := strings.ToLower(path.Base(p))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	compact := strings.NewReplacer("_", "", "-", "", " ", "").Replace(name)
+	switch {
+	case strings.Contains(compact, "大王") || strings.Contains(compact, "redjoker") || strings.Contains(compact, "bigjoker") || strings.Contains(compact, "jokerred"):
+		return cards.Card{Suit: cards.Joker, Rank: cards.RedJoker}, true
+	case strings.Contains(compact, "小王") || strings.Contains(compact, "blackjoker") || strings.Contains(compact, "smalljoker") || strings.Contains(compact, "jokerblack"):
+		return cards.Card{Suit: cards.Joker, Rank: cards.BlackJoker}, true
+	}
+	for s, ws := range suitwords {
+		for _, w := range ws {
+			if i := strings.Index(compact, w); i >= 0 {
+				j := i + len(w)
+				if w[0] < 0x80 && j < len(compact) && compact[j] == 's' {
+					j++ // spades, hearts...
+				}
+				if r, ok := parserank(compact[:i] + compact[j:]); ok {
+					return cards.Card{Suit: s, Rank: r}, true
+				}
+			}
+		}
+	}
+	m := shortcardreg.FindStringSubmatch(name)
+	if m == nil {
+		return cards.Card{}, false
+	}
+	letter, rank := m[1], m[2]
+	if letter == "" {
+		letter, rank = m[4], m[3]
+	}
+	r, ok := parserank(rank)
+	if !ok {
+		return cards.Card{}, false
+	}
+	return cards.Card{Suit: cards.Suit(strings.Index("shcd", letter)), Rank: r}, true
+}
+
+func parserank(s string) (cards.Rank, bool) {
+	switch s {
+	case "a", "ace", "1":
+		return cards.Ace, true
+	case "j", "jack":
+		return cards.Jack, true
+	case "q", "queen":
+		return cards.Queen, true
+	case "k", "king":
+		return cards.King, true
+	}
+	for i, w := range []string{"two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"} {
+		if s == w {
+			return cards.Rank(i + 2), true
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 2 || n > 13 {
+		return 0, false
+	}
+	return cards.Rank(n), true
+}
+
+// cardsmsg 牌面文字, 张数不多且都有图片时附上图片
+func cardsmsg(cs []cards.Card) message.Message {
+	msg := message.Message{message.Text(cards.Format(cs))}
+	if len(cs) > 7 {
+		return msg
+	}
+	imgs := make(message.Message, 0, len(cs))
+	for _, c := range cs {
+		p, ok := cardimgs[c]
+		if !ok {
+			return msg
+		}
+		data, err := engine.GetLazyData(p, true)
+		if err != nil {
+			return msg
+		}
+		imgs = append(imgs, message.ImageBytes(data))
+	}
+	return append(msg, imgs...)
+}
+
+// name 群名片或昵称
+func name(ctx *zero.Ctx, uid int64) string {
+	return ctx.CardOrNickName(uid)
+}
+
+// deal 私聊发送手牌, 失败时返回无法私聊的人
+func deal(ctx *zero.Ctx, gid int64, hands map[int64]message.Message) (failed []int64) {
+	for uid, msg := range hands {
+		if !sendprivate(ctx, gid, uid, msg) {
+			failed = append(failed, uid)
+		}
+	}
+	return
+}
+
+// dealfailed 提示无法私聊的玩家
+func dealfailed(ctx *zero.Ctx, failed []int64, hint string) {
+	if len(failed) == 0 {
+		return
+	}
+	msg := message.Message{}
+	for _, uid := range failed {
+		msg = append(msg, message.At(uid))
+	}
+	ctx.Send(append(msg, message.Text(" 无法私聊发送手牌, 请先添加好友或允许临时会话, ", hint)))
+}
@@ -0,0 +1,350 @@
+package poker
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/cards"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/poker/holdem"
+)
+
+const (
+	texasSmallBlind = 5
+	texasBigBlind   = 10
+	texasBuyIn      = 200
+	texasMinBuyIn   = 100
+	texasMaxSeats   = 9
+)
+
+// texasseat 德州牌桌上的座位, chips 为已从钱包兑换的筹码
+type texasseat struct {
+	id    int64
+	chips int
+}
+
+// texasroom 一个群的德州牌桌
+type texasroom struct {
+	gid    int64
+	owner  int64
+	seats  []*texasseat
+	game   *holdem.Game
+	dealer int
+	timer  turntimer
+}
+
+var (
+	texasmu sync.Mutex
+	texases = map[int64]*texasroom{}
+)
+
+func (r *texasroom) seat(uid int64) *texasseat {
+	for _, s := range r.seats {
+		if s.id == uid {
+			return s
+		}
+	}
+	return nil
+}
+
+// playing 是否有正在进行的一局
+func (r *texasroom) playing() bool {
+	return r.game != nil && !r.game.Over()
+}
+
+// savestakes 记录各座位尚未兑回的筹码, 进行中的一局作废, 按开局时的筹码计
+func (r *texasroom) savestakes() {
+	amounts := make(map[int64]int, len(r.seats))
+	for _, s := range r.seats {
+		amounts[s.id] = s.chips
+	}
+	stakes.save("texas", r.gid, amounts)
+}
+
+// texasplaying 本群有进行中的德州且发送者在牌桌上, 其余消息交给后续插件
+func texasplaying(ctx *zero.Ctx) bool {
+	texasmu.Lock()
+	defer texasmu.Unlock()
+	r, ok := texases[ctx.Event.GroupID]
+	return ok && r.playing() && r.seat(ctx.Event.UserID) != nil
+}
+
+// status 座位与筹码
+func (r *texasroom) status(ctx *zero.Ctx) string {
+	var sb strings.Builder
+	sb.WriteString("德州牌桌 (盲注" + strconv.Itoa(texasSmallBlind) + "/" + strconv.Itoa(texasBigBlind) + ")")
+	for i, s := range r.seats {
+		sb.WriteString("\n" + strconv.Itoa(i+1) + ". " + name(ctx, s.id) + ": " + strconv.Itoa(s.chips))
+		if r.playing() {
+			for _, p := range r.game.Players {
+				if p.ID == s.id {
+					sb.WriteString(" (剩余" + strconv.Itoa(p.Chips) + ", 已下注" + strconv.Itoa(p.Total) + ")")
+					if p.Folded {
+						sb.WriteString(" 已弃牌")
+					} else if p.AllIn {
+						sb.WriteString(" 已全下")
+					}
+				}
+			}
+		}
+	}
+	if r.playing() {
+		sb.WriteString("\n当前: " + r.game.Stage.String() + ", 底池" + strconv.Itoa(r.game.Pot()))
+		if len(r.game.Board) > 0 {
+			sb.WriteString(", 公共牌: " + cards.Format(r.game.Board))
+		}
+	}
+	return sb.String()
+}
+
+// prompt 提示当前行动者, 并开始计时
+func (r *texasroom) prompt(ctx *zero.Ctx) {
+	p := r.game.Current()
+	tocall := r.game.ToCall()
+	hint := "可以 过牌/加注/全下/弃牌"
+	if tocall > 0 {
+		hint = "需跟注" + strconv.Itoa(tocall) + ", 可以 跟注/加注/全下/弃牌"
+	}
+	ctx.SendChain(message.At(p.ID), message.Text(" 轮到你了, 底池", r.game.Pot(), ", 剩余筹码", p.Chips, ", ", hint))
+	r.timer.reset(&texasmu, func() {
+		nboard := len(r.game.Board)
+		// 超时能过牌则过牌, 否则弃牌
+		if r.game.ToCall() == 0 {
+			_ = r.game.Check(p.ID)
+			ctx.SendChain(message.Text(name(ctx, p.ID), " 超时, 自动过牌"))
+		} else {
+			_ = r.game.Fold(p.ID)
+			ctx.SendChain(message.Text(name(ctx, p.ID), " 超时, 自动弃牌"))
+		}
+		r.after(ctx, nboard)
+	})
+}
+
+// after 行动后发送新发出的公共牌, 轮到下一人或结算. nboard 为行动前的公共牌数
+func (r *texasroom) after(ctx *zero.Ctx, nboard int) {
+	g := r.game
+	if len(g.Board) > nboard {
+		label := "公共牌: "
+		if !g.Over() {
+			label = g.Stage.String() + label
+		}
+		msg := message.Message{message.Text(label)}
+		ctx.Send(append(msg, cardsmsg(g.Board)...))
+	}
+	if !g.Over() {
+		r.prompt(ctx)
+		return
+	}
+	r.timer.stop()
+	var sb strings.Builder
+	sb.WriteString("本局结束")
+	showdown := false
+	for _, po := range g.Payouts {
+		if po.Hand != "" {
+			showdown = true
+		}
+	}
+	for _, p := range g.Players {
+		s := r.seat(p.ID)
+		s.chips = p.Chips
+		for _, po := range g.Payouts {
+			if po.ID != p.ID {
+				continue
+			}
+			sb.WriteString("\n" + name(ctx, p.ID))
+			if showdown && !p.Folded {
+				sb.WriteString(" [" + cards.Format(p.Hole) + "] " + po.Hand)
+			}
+			if po.Win > 0 {
+				sb.WriteString(" 赢得" + strconv.Itoa(po.Win))
+			}
+			sb.WriteString(", 筹码" + strconv.Itoa(p.Chips))
+		}
+	}
+	r.savestakes()
+	sb.WriteString("\n发送\"开始德州\"继续下一局, \"离开德州\"兑回ATRI币")
+	ctx.SendChain(message.Text(sb.String()))
+	r.dealer++
+}
+
+func init() {
+	engine.OnRegex(`^德州扑克\s*(\d*)$`, zero.OnlyGroup, getImg).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			buyin := texasBuyIn
+			if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+				buyin, _ = strconv.Atoi(s)
+			}
+			if buyin < texasMinBuyIn {
+				ctx.SendChain(message.Text("ERROR: 买入至少", texasMinBuyIn, "ATRI币"))
+				return
+			}
+			texasmu.Lock()
+			defer texasmu.Unlock()
+			gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+			r, ok := texases[gid]
+			if !ok {
+				r = &texasroom{gid: gid, owner: uid}
+			}
+			if r.playing() {
+				ctx.SendChain(message.Text("牌局进行中, 请在本局结束后加入"))
+				return
+			}
+			s := r.seat(uid)
+			if s == nil && len(r.seats) >= texasMaxSeats {
+				ctx.SendChain(message.Text("牌桌已满"))
+				return
+			}
+			if err := pay(uid, buyin); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if s == nil {
+				s = &texasseat{id: uid}
+				r.seats = append(r.seats, s)
+			}
+			s.chips += buyin
+			texases[gid] = r
+			r.savestakes()
+			ctx.SendChain(message.Text("买入成功, 当前筹码", s.chips, "\n", r.status(ctx), "\n人齐后发送\"开始德州\""))
+		})
+	engine.OnFullMatch("开始德州", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			texasmu.Lock()
+			defer texasmu.Unlock()
+			gid := ctx.Event.GroupID
+			r, ok := texases[gid]
+			if !ok || r.seat(ctx.Event.UserID) == nil {
+				ctx.SendChain(message.Text("你不在牌桌上, 发送\"德州扑克\"加入"))
+				return
+			}
+			if r.playing() {
+				ctx.SendChain(message.Text("牌局进行中"))
+				return
+			}
+			var ps []*holdem.Player
+			for _, s := range r.seats {
+				if s.chips > 0 {
+					ps = append(ps, &holdem.Player{ID: s.id, Chips: s.chips})
+				}
+			}
+			g, err := holdem.New(ps, r.dealer, texasSmallBlind, texasBigBlind, newrand())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			r.game = g
+			hands := make(map[int64]message.Message, len(ps))
+			for _, p := range ps {
+				hands[p.ID] = append(message.Message{message.Text("群", gid, "德州扑克, 你的底牌: ")}, cardsmsg(p.Hole)...)
+			}
+			ctx.SendChain(message.Text("新的一局开始! 庄家: ", name(ctx, ps[g.Dealer].ID), ", 底牌已私聊发送"))
+			dealfailed(ctx, deal(ctx, gid, hands), "本局可发送\"德州状态\"查看牌桌")
+			r.prompt(ctx)
+		})
+	engine.OnRegex(`^(跟注|过牌|加注\s*(\d+)|全下|梭哈|弃牌)$`, zero.OnlyGroup, texasplaying).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			texasmu.Lock()
+			defer texasmu.Unlock()
+			r, ok := texases[ctx.Event.GroupID]
+			if !ok || !r.playing() {
+				return
+			}
+			g, uid := r.game, ctx.Event.UserID
+			nboard := len(g.Board)
+			m := ctx.State["regex_matched"].([]string)
+			var err error
+			action := m[1]
+			switch {
+			case action == "跟注":
+				err = g.Call(uid)
+			case action == "过牌":
+				err = g.Check(uid)
+			case action == "全下" || action == "梭哈":
+				err = g.AllIn(uid)
+			case action == "弃牌":
+				err = g.Fold(uid)
+			default:
+				n, _ := strconv.Atoi(m[2])
+				err = g.Raise(uid, g.CurrentBet+n)
+				action = "加注" + strconv.Itoa(n)
+			}
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text(name(ctx, uid), " ", action))
+			r.after(ctx, nboard)
+		})
+	engine.OnFullMatch("德州状态", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			texasmu.Lock()
+			defer texasmu.Unlock()
+			r, ok := texases[ctx.Event.GroupID]
+			if !ok {
+				ctx.SendChain(message.Text("本群没有德州牌桌"))
+				return
+			}
+			ctx.SendChain(message.Text(r.status(ctx)))
+		})
+	engine.OnFullMatch("离开德州", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			texasmu.Lock()
+			defer texasmu.Unlock()
+			r, ok := texases[ctx.Event.GroupID]
+			if !ok || r.seat(ctx.Event.UserID) == nil {
+				return
+			}
+			if r.playing() {
+				ctx.SendChain(message.Text("牌局进行中, 请在本局结束后离开"))
+				return
+			}
+			for i, s := range r.seats {
+				if s.id == ctx.Event.UserID {
+					refund(s.id, s.chips)
+					r.seats = append(r.seats[:i], r.seats[i+1:]...)
+					ctx.SendChain(message.Text("已离开牌桌, 兑回", s.chips, "ATRI币"))
+					break
+				}
+			}
+			r.savestakes()
+			if len(r.seats) == 0 {
+				delete(texases, r.gid)
+			}
+		})
+	engine.OnFullMatch("结束德州", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			texasmu.Lock()
+			defer texasmu.Unlock()
+			r, ok := texases[ctx.Event.GroupID]
+			if !ok {
+				return
+			}
+			if ctx.Event.UserID != r.owner && !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Text("只有开桌的人或管理员可以结束牌桌"))
+				return
+			}
+			r.timer.stop()
+			// 进行中的一局作废, 退还已下注的筹码
+			chips := make(map[int64]int, len(r.seats))
+			for _, s := range r.seats {
+				chips[s.id] = s.chips
+			}
+			if r.playing() {
+				for _, p := range r.game.Players {
+					chips[p.ID] = p.Chips + p.Total
+				}
+			}
+			var sb strings.Builder
+			sb.WriteString("牌桌已结束, 筹码已兑回ATRI币:")
+			for _, s := range r.seats {
+				refund(s.id, chips[s.id])
+				sb.WriteString("\n" + name(ctx, s.id) + ": " + strconv.Itoa(chips[s.id]))
+			}
+			stakes.save("texas", r.gid, nil)
+			delete(texases, r.gid)
+			ctx.SendChain(message.Text(sb.String()))
+		})
+}
@@ -3,6 +3,7 @@ package qzone
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/jinzhu/gorm"
 )
@@ -28,7 +29,7 @@ func initialize(dbpath string) *qzonedb {
 	if err != nil {
 		panic(err)
 	}
-	qdb.AutoMigrate(&qzoneConfig{}).AutoMigrate(&emotion{})
+	qdb.AutoMigrate(&qzoneConfig{}).AutoMigrate(&emotion{}).AutoMigrate(&reviewer{}).AutoMigrate(&qzoneSetting{})
 	return (*qzonedb)(qdb)
 }
 
@@ -74,8 +75,13 @@ type emotion struct {
 	Anonymous bool   `gorm:"column:anonymous"`
 	QQ        int64  `gorm:"column:qq"`
 	Msg       string `gorm:"column:msg"`
-	Status    int    `gorm:"column:status"` // 1-审核中,2-同意,3-拒绝
+	Status    int    `gorm:"column:status"` // 1-审核中,2-同意,3-拒绝,4-待发布
 	Tag       string `gorm:"column:tag"`
+	GroupID   int64  `gorm:"column:group_id"` // 投稿所在的群, 私聊为 0
+	Reason    string `gorm:"column:reason"`   // 拒绝理由
+	Screen    string `gorm:"column:screen"`   // 自动审核结果
+	Fee       int    `gorm:"column:fee"`      // 投稿时支付的费用
+	Reviewer  int64  `gorm:"column:reviewer"` // 审核人, 自动审核为 0
 }
 
 func (e emotion) textBrief() (t string) {
@@ -87,6 +93,17 @@ func (e emotion) textBrief() (t string) {
 		t += "状态: 同意\n"
 	case 3:
 		t += "状态: 拒绝\n"
+		if e.Reason != "" {
+			t += "理由: " + e.Reason + "\n"
+		}
+	case 4:
+		t += "状态: 待发布\n"
+	}
+	if e.GroupID != 0 {
+		t += fmt.Sprintf("来源群: %v\n", e.GroupID)
+	}
+	if e.Screen != "" {
+		t += "自动审核: " + e.Screen + "\n"
 	}
 	if e.Anonymous {
 		t += "匿名: 是"
@@ -114,13 +131,23 @@ func (qdb *qzonedb) getEmotionByIDList(idList []int64) (el []emotion, err error)
 	return
 }
 
-func (qdb *qzonedb) getLoveEmotionByStatus(status int, pageNum int) (el []emotion, err error) {
-	db := (*gorm.DB)(qdb)
-	if status == 0 {
-		err = db.Order("created_at desc").Limit(5).Offset(pageNum*5).Find(&el, "tag like ?", "%"+loveTag+"%").Error
-		return
+// getLoveEmotionByStatus 分页查看表白墙, groups 不为空时只查看这些群的投稿
+func (qdb *qzonedb) getLoveEmotionByStatus(status int, pageNum int, groups ...int64) (el []emotion, err error) {
+	db := (*gorm.DB)(qdb).Order("created_at desc").Limit(5).Offset(pageNum*5).Where("tag like ?", "%"+loveTag+"%")
+	if status != 0 {
+		db = db.Where("status = ?", status)
+	}
+	if len(groups) > 0 {
+		db = db.Where("group_id in (?)", groups)
 	}
-	err = db.Order("created_at desc").Limit(5).Offset(pageNum*5).Find(&el, "status = ? and tag like ?", status, "%"+loveTag+"%").Error
+	err = db.Find(&el).Error
+	return
+}
+
+// getEmotionByStatus 按投稿顺序取出至多 n 条该状态的说说
+func (qdb *qzonedb) getEmotionByStatus(status int, n int) (el []emotion, err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.Order("id").Limit(n).Find(&el, "status = ?", status).Error
 	return
 }
 
@@ -129,3 +156,91 @@ func (qdb *qzonedb) updateEmotionStatusByIDList(idList []int64, status int) (err
 	err = db.Model(&emotion{}).Where("id in (?)", idList).Update("status", status).Error
 	return
 }
+
+// reviewEmotion 审核说说, 记录审核人与拒绝理由
+func (qdb *qzonedb) reviewEmotion(idList []int64, status int, reviewer int64, reason string) (err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.Model(&emotion{}).Where("id in (?)", idList).Updates(map[string]interface{}{
+		"status":   status,
+		"reviewer": reviewer,
+		"reason":   reason,
+	}).Error
+	return
+}
+
+// reviewer 群内代为审核表白墙的成员
+type reviewer struct {
+	ID      uint  `gorm:"primary_key;AUTO_INCREMENT"`
+	GroupID int64 `gorm:"column:group_id;unique_index:idx_reviewer"`
+	QQ      int64 `gorm:"column:qq;unique_index:idx_reviewer"`
+}
+
+// TableName 表名
+func (reviewer) TableName() string {
+	return "reviewer"
+}
+
+func (qdb *qzonedb) addReviewer(gid, qq int64) (err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.FirstOrCreate(&reviewer{}, reviewer{GroupID: gid, QQ: qq}).Error
+	return
+}
+
+func (qdb *qzonedb) delReviewer(gid, qq int64) (err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.Where("group_id = ? and qq = ?", gid, qq).Delete(&reviewer{}).Error
+	return
+}
+
+func (qdb *qzonedb) getReviewers(gid int64) (rl []reviewer, err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.Find(&rl, "group_id = ?", gid).Error
+	return
+}
+
+// reviewGroups 用户可以审核的群
+func (qdb *qzonedb) reviewGroups(qq int64) (gids []int64, err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.Model(&reviewer{}).Where("qq = ?", qq).Pluck("group_id", &gids).Error
+	return
+}
+
+// qzoneSetting 表白墙设置, 只有一行
+type qzoneSetting struct {
+	ID          uint `gorm:"primary_key"`
+	Fee         int  `gorm:"column:fee"`          // 投稿费用
+	Reward      int  `gorm:"column:reward"`       // 发表后给作者的奖励
+	WindowStart int  `gorm:"column:window_start"` // 发布时段的开始小时
+	WindowEnd   int  `gorm:"column:window_end"`   // 发布时段的结束小时, 与开始相同表示不限
+	AutoReview  bool `gorm:"column:auto_review"`  // 自动审核通过未检出问题的投稿
+}
+
+// TableName 表名
+func (qzoneSetting) TableName() string {
+	return "qzone_setting"
+}
+
+// inWindow t 是否在发布时段内, 结束小时小于开始时跨越零点
+func (s *qzoneSetting) inWindow(t time.Time) bool {
+	if s.WindowStart == s.WindowEnd {
+		return true
+	}
+	h := t.Hour()
+	if s.WindowStart < s.WindowEnd {
+		return h >= s.WindowStart && h < s.WindowEnd
+	}
+	return h >= s.WindowStart || h < s.WindowEnd
+}
+
+func (qdb *qzonedb) getSetting() (s qzoneSetting, err error) {
+	db := (*gorm.DB)(qdb)
+	err = db.FirstOrInit(&s, qzoneSetting{ID: 1}).Error
+	return
+}
+
+func (qdb *qzonedb) saveSetting(s qzoneSetting) (err error) {
+	db := (*gorm.DB)(qdb)
+	s.ID = 1
+	err = db.Save(&s).Error
+	return
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/FloatTech/AnimeAPI/qzone"
+	"github.com/FloatTech/AnimeAPI/wallet"
 	"github.com/FloatTech/floatbox/binary"
 	"github.com/FloatTech/floatbox/web"
 	"github.com/FloatTech/gg"
@@ -22,14 +23,18 @@ import (
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/FloatTech/zbputils/img/text"
 	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
 )
 
 const (
 	waitStatus = iota + 1
 	agreeStatus
 	disagreeStatus
+	scheduledStatus
 	loveTag      = "表白"
 	faceURL      = "http://q4.qlogo.cn/g?b=qq&nk=%v&s=640"
 	anonymousURL = "https://gitcode.net/anto_july/avatar/-/raw/master/%v.png"
@@ -42,12 +47,20 @@ func init() {
 		Help: "- 登录QQ空间 (Cookie过期很快, 要经常登录)\n" +
 			"- 发说说[xxx]\n" +
 			"- (匿名)发表白墙[xxx]\n" +
-			"- [ 同意 | 拒绝 ]表白墙 1,2,3 (最后一个参数是表白墙的序号数组, 用英文逗号连接)\n" +
-			"- 查看[ 等待 | 同意 | 拒绝 | 所有 ]表白墙 0 (最后一个参数是页码, 建议私聊审稿)",
+			"- [ 同意 | 拒绝 ]表白墙 1,2,3 [理由] (序号数组用英文逗号连接, 拒绝时可附理由私聊告知作者, 只能审核等待或待发布的投稿)\n" +
+			"- 查看[ 等待 | 同意 | 拒绝 | 待发布 | 所有 ]表白墙 0 (最后一个参数是页码, 建议私聊审稿)\n" +
+			"- [ 添加 | 删除 ]表白墙审核员@xxx (群管理员, 审核员只能审核本群的投稿)\n" +
+			"- 查看表白墙审核员\n" +
+			"- 设置表白墙[ 费用 | 奖励 ]N (投稿费用在被拒绝时退还, 奖励在发表后发放)\n" +
+			"- 设置表白墙发布时段8-22 (开始与结束相同表示不限, 时段外通过的投稿将在时段内自动发表)\n" +
+			"- [ 开启 | 关闭 ]表白墙自动审核 (开启后未检出问题的投稿直接通过)\n" +
+			"- 查看表白墙设置\n" +
+			"注: 投稿会经过 moderation 插件的检测器筛查, 违规的投稿直接拒绝, 疑似的投稿留待人工审核",
 		PrivateDataFolder: "qzone",
 	})
 	go func() {
 		qdb = initialize(engine.DataFolder() + "qzone.db")
+		runScheduler()
 	}()
 	engine.OnFullMatch("登录QQ空间").SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
@@ -136,18 +149,64 @@ func init() {
 				Status:    waitStatus,
 				Tag:       loveTag,
 				Anonymous: false,
+				GroupID:   ctx.Event.GroupID,
 			}
 			if regexMatched[1] == "匿名" {
 				e.Anonymous = true
 			}
-			_, err := qdb.saveEmotion(e)
+			s, err := qdb.getSetting()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
+			lv, desc := screen(ctx, e.GroupID, qq, e.Msg)
+			if lv == pipeline.Violation {
+				e.Status, e.Screen, e.Reason = disagreeStatus, desc, "自动审核未通过"
+				_, err = qdb.saveEmotion(e)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				ctx.SendChain(message.Text("投稿未通过自动审核: ", desc))
+				return
+			}
+			if s.Fee > 0 {
+				money := wallet.GetWalletOf(qq)
+				if money < s.Fee {
+					ctx.SendChain(message.Text("投稿需要", s.Fee, "ATRI币, 你的钱包当前只有", money, "ATRI币"))
+					return
+				}
+				err = wallet.InsertWalletOf(qq, -s.Fee)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				e.Fee = s.Fee
+			}
+			e.Screen = desc
+			if lv == pipeline.Pass && s.AutoReview {
+				e.Status = scheduledStatus
+			}
+			id, err := qdb.saveEmotion(e)
+			if err != nil {
+				if e.Fee > 0 {
+					// 投稿未保存, 退还费用
+					if rerr := wallet.InsertWalletOf(qq, e.Fee); rerr != nil {
+						logrus.Warnln("[qzone] refund", qq, "err:", rerr)
+					}
+				}
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if e.Status == scheduledStatus {
+				ctx.SendChain(message.Text("已通过自动审核, 将在发布时段内发表"))
+				return
+			}
+			e.ID = uint(id)
+			notifyReviewers(ctx, &e)
 			ctx.SendChain(message.Text("已收稿, 请耐心等待审核"))
 		})
-	engine.OnRegex(`^(同意|拒绝)表白墙\s?((?:\d+,){0,8}\d+)$`, zero.SuperUserPermission).SetBlock(true).
+	engine.OnRegex(`^(同意|拒绝)表白墙\s?((?:\d+,){0,8}\d+)(?:\s+([\s\S]+))?$`, canReview).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			var err error
 			var ti int64
@@ -161,29 +220,193 @@ func init() {
 				}
 				idList = append(idList, ti)
 			}
+			el, err := qdb.getEmotionByIDList(idList)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(el) != len(idList) {
+				ctx.SendChain(message.Text("ERROR: 部分序号不存在"))
+				return
+			}
+			err = checkReviewable(ctx, el)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
 			switch regexMatched[1] {
 			case "同意":
-				err = getAndPublishEmotion(ctx.Event.SelfID, idList)
+				// 只能同意审核中或待发布的投稿, 被拒绝的投稿已退还费用
+				for _, e := range el {
+					switch e.Status {
+					case agreeStatus:
+						ctx.SendChain(message.Text("ERROR: 序号", e.ID, "已发表"))
+						return
+					case disagreeStatus:
+						ctx.SendChain(message.Text("ERROR: 序号", e.ID, "已被拒绝"))
+						return
+					}
+				}
+				s, err := qdb.getSetting()
 				if err != nil {
 					ctx.SendChain(message.Text("ERROR: ", err))
 					return
 				}
-				err = qdb.updateEmotionStatusByIDList(idList, agreeStatus)
+				if !s.inWindow(time.Now()) {
+					err = qdb.reviewEmotion(idList, scheduledStatus, ctx.Event.UserID, "")
+					if err != nil {
+						ctx.SendChain(message.Text("ERROR: ", err))
+						return
+					}
+					ctx.SendChain(message.Text("同意表白墙", regexMatched[2], ", 将在", s.WindowStart, "-", s.WindowEnd, "时发表"))
+					return
+				}
+				err = publishEmotions(ctx.Event.SelfID, el)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				err = qdb.reviewEmotion(idList, agreeStatus, ctx.Event.UserID, "")
+				if err == nil {
+					err = published(ctx, el)
+				}
 				if err != nil {
 					ctx.SendChain(message.Text("ERROR: ", err))
 					return
 				}
 				ctx.SendChain(message.Text("同意表白墙", regexMatched[2], ", 发表成功"))
 			case "拒绝":
-				err = qdb.updateEmotionStatusByIDList(idList, disagreeStatus)
+				// 已发表的投稿已发放奖励, 不能再拒绝
+				for _, e := range el {
+					switch e.Status {
+					case agreeStatus:
+						ctx.SendChain(message.Text("ERROR: 序号", e.ID, "已发表"))
+						return
+					case disagreeStatus:
+						ctx.SendChain(message.Text("ERROR: 序号", e.ID, "已被拒绝"))
+						return
+					}
+				}
+				reason := strings.TrimSpace(regexMatched[3])
+				err = qdb.reviewEmotion(idList, disagreeStatus, ctx.Event.UserID, reason)
 				if err != nil {
 					ctx.SendChain(message.Text("ERROR: ", err))
 					return
 				}
+				rejected(ctx, el, reason)
 				ctx.SendChain(message.Text("拒绝表白墙", regexMatched[2]))
 			}
 		})
-	engine.OnRegex(`^查看(.{0,2})表白墙\s?(\d*)$`, zero.SuperUserPermission).SetBlock(true).
+	engine.OnRegex(`^(添加|删除)表白墙审核员\s*\[CQ:at,qq=(\d+)\]`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			regexMatched := ctx.State["regex_matched"].([]string)
+			qq, _ := strconv.ParseInt(regexMatched[2], 10, 64)
+			var err error
+			if regexMatched[1] == "添加" {
+				err = qdb.addReviewer(ctx.Event.GroupID, qq)
+			} else {
+				err = qdb.delReviewer(ctx.Event.GroupID, qq)
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text(regexMatched[1], "成功"))
+		})
+	engine.OnFullMatch("查看表白墙审核员", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			rl, err := qdb.getReviewers(ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rl) == 0 {
+				ctx.SendChain(message.Text("本群没有表白墙审核员, 投稿由超级用户审核"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("本群表白墙审核员:")
+			for _, r := range rl {
+				sb.WriteString("\n" + ctx.CardOrNickName(r.QQ) + "(" + strconv.FormatInt(r.QQ, 10) + ")")
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置表白墙(费用|奖励)\s*(\d+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			regexMatched := ctx.State["regex_matched"].([]string)
+			n, _ := strconv.Atoi(regexMatched[2])
+			s, err := qdb.getSetting()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if regexMatched[1] == "费用" {
+				s.Fee = n
+			} else {
+				s.Reward = n
+			}
+			err = qdb.saveSetting(s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("设置成功"))
+		})
+	engine.OnRegex(`^设置表白墙发布时段\s*(\d{1,2})\s*-\s*(\d{1,2})$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			regexMatched := ctx.State["regex_matched"].([]string)
+			start, _ := strconv.Atoi(regexMatched[1])
+			end, _ := strconv.Atoi(regexMatched[2])
+			if start > 23 || end > 24 {
+				ctx.SendChain(message.Text("ERROR: 时段应在0-24之间"))
+				return
+			}
+			s, err := qdb.getSetting()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			s.WindowStart, s.WindowEnd = start, end%24
+			err = qdb.saveSetting(s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("设置成功"))
+		})
+	engine.OnRegex(`^(开启|关闭)表白墙自动审核$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			s, err := qdb.getSetting()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			s.AutoReview = ctx.State["regex_matched"].([]string)[1] == "开启"
+			err = qdb.saveSetting(s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("设置成功"))
+		})
+	engine.OnFullMatch("查看表白墙设置").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			s, err := qdb.getSetting()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			window := "不限"
+			if s.WindowStart != s.WindowEnd {
+				window = strconv.Itoa(s.WindowStart) + "-" + strconv.Itoa(s.WindowEnd) + "时"
+			}
+			auto := "关闭"
+			if s.AutoReview {
+				auto = "开启"
+			}
+			ctx.SendChain(message.Text("投稿费用: ", s.Fee, "ATRI币\n发表奖励: ", s.Reward, "ATRI币\n发布时段: ", window, "\n自动审核: ", auto))
+		})
+	engine.OnRegex(`^查看(.{0,3})表白墙\s?(\d*)$`, canReview).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			var (
 				pageNum   int
@@ -208,12 +431,22 @@ func init() {
 				status = 2
 			case "拒绝":
 				status = 3
+			case "待发布":
+				status = 4
 			case "所有":
 				status = 0
 			default:
 				status = 1
 			}
-			el, err := qdb.getLoveEmotionByStatus(status, pageNum)
+			var groups []int64
+			if !zero.SuperUserPermission(ctx) {
+				groups, err = qdb.reviewGroups(ctx.Event.UserID)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+			}
+			el, err := qdb.getLoveEmotionByStatus(status, pageNum, groups...)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -245,12 +478,8 @@ func init() {
 		})
 }
 
-func getAndPublishEmotion(botqq int64, idList []int64) (err error) {
+func publishEmotions(botqq int64, el []emotion) (err error) {
 	var b []byte
-	el, err := qdb.getEmotionByIDList(idList)
-	if err != nil {
-		return
-	}
 	base64imgs := make([]string, 0, 5)
 	for _, v := range el {
 		if v.Anonymous {
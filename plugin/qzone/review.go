@@ -0,0 +1,170 @@
+package qzone
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/moderation/pipeline"
+)
+
+// screen 用已注册的内容审核检测器检查投稿, 返回最严重的等级与描述
+func screen(ctx *zero.Ctx, gid, uid int64, raw string) (lv pipeline.Level, desc string) {
+	c := &pipeline.Content{GroupID: gid, UserID: uid}
+	for _, v := range message.ParseMessageFromString(raw) {
+		switch {
+		case v.Type == "text":
+			c.Text += v.Data["text"]
+		case v.Type == "image" && v.Data["url"] != "":
+			c.Images = append(c.Images, v.Data["url"])
+		}
+	}
+	var descs []string
+	for _, v := range pipeline.Check(ctx, c) {
+		if v.Level > lv {
+			lv = v.Level
+		}
+		d := v.Level.String() + v.Category
+		if v.Detail != "" {
+			d += "(" + v.Detail + ")"
+		}
+		descs = append(descs, d)
+	}
+	desc = strings.Join(descs, ", ")
+	return
+}
+
+// canReview 超级用户或任一群的表白墙审核员
+func canReview(ctx *zero.Ctx) bool {
+	if zero.SuperUserPermission(ctx) {
+		return true
+	}
+	gids, err := qdb.reviewGroups(ctx.Event.UserID)
+	return err == nil && len(gids) > 0
+}
+
+// checkReviewable 非超级用户只能审核自己负责的群的投稿
+func checkReviewable(ctx *zero.Ctx, el []emotion) error {
+	if zero.SuperUserPermission(ctx) {
+		return nil
+	}
+	gids, err := qdb.reviewGroups(ctx.Event.UserID)
+	if err != nil {
+		return err
+	}
+	for _, e := range el {
+		ok := false
+		for _, gid := range gids {
+			if e.GroupID != 0 && e.GroupID == gid {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errNoPermission(e.ID)
+		}
+	}
+	return nil
+}
+
+type errNoPermission uint
+
+func (e errNoPermission) Error() string {
+	return "无权审核序号" + strconv.FormatUint(uint64(e), 10) + "的投稿"
+}
+
+// notifyReviewers 私聊通知群内的审核员有新投稿
+func notifyReviewers(ctx *zero.Ctx, e *emotion) {
+	if e.GroupID == 0 {
+		return
+	}
+	rl, err := qdb.getReviewers(e.GroupID)
+	if err != nil {
+		return
+	}
+	for _, r := range rl {
+		ctx.SendPrivateMessage(r.QQ, message.Text("群", e.GroupID, "有新的表白墙投稿, 序号: ", e.ID,
+			"\n发送\"查看等待表白墙\"审核"))
+	}
+}
+
+// published 发表成功后更新状态, 发放奖励并通知作者
+func published(ctx *zero.Ctx, el []emotion) error {
+	s, err := qdb.getSetting()
+	if err != nil {
+		return err
+	}
+	idList := make([]int64, len(el))
+	for i, e := range el {
+		idList[i] = int64(e.ID)
+	}
+	err = qdb.updateEmotionStatusByIDList(idList, agreeStatus)
+	if err != nil {
+		return err
+	}
+	for _, e := range el {
+		msg := "你的表白墙投稿(序号" + strconv.FormatUint(uint64(e.ID), 10) + ")已发表"
+		if s.Reward > 0 {
+			err = wallet.InsertWalletOf(e.QQ, s.Reward)
+			if err != nil {
+				logrus.Warnln("[qzone] reward", e.QQ, "err:", err)
+			} else {
+				msg += ", 获得" + strconv.Itoa(s.Reward) + "ATRI币"
+			}
+		}
+		ctx.SendPrivateMessage(e.QQ, message.Text(msg))
+	}
+	return nil
+}
+
+// rejected 通知作者投稿被拒绝
+func rejected(ctx *zero.Ctx, el []emotion, reason string) {
+	for _, e := range el {
+		msg := "你的表白墙投稿(序号" + strconv.FormatUint(uint64(e.ID), 10) + ")未通过审核"
+		if reason != "" {
+			msg += ", 理由: " + reason
+		}
+		if e.Fee > 0 {
+			err := wallet.InsertWalletOf(e.QQ, e.Fee)
+			if err != nil {
+				logrus.Warnln("[qzone] refund", e.QQ, "err:", err)
+			} else {
+				msg += ", 已退还投稿费用" + strconv.Itoa(e.Fee) + "ATRI币"
+			}
+		}
+		ctx.SendPrivateMessage(e.QQ, message.Text(msg))
+	}
+}
+
+// runScheduler 在发布时段内定时发表已通过审核的投稿
+func runScheduler() {
+	for range time.NewTicker(time.Minute).C {
+		s, err := qdb.getSetting()
+		if err != nil || !s.inWindow(time.Now()) {
+			continue
+		}
+		// 与手动同意一致, 一条说说至多附带 9 张图
+		el, err := qdb.getEmotionByStatus(scheduledStatus, 9)
+		if err != nil || len(el) == 0 {
+			continue
+		}
+		zero.RangeBot(func(id int64, ctx *zero.Ctx) bool {
+			if _, err := qdb.getByUin(id); err != nil {
+				return true
+			}
+			err = publishEmotions(id, el)
+			if err == nil {
+				err = published(ctx, el)
+			}
+			if err != nil {
+				logrus.Warnln("[qzone] scheduled publish err:", err)
+			}
+			return false
+		})
+	}
+}
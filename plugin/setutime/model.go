@@ -0,0 +1,203 @@
+package setutime
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	pooledTable  = "pooled"
+	policyTable  = "policy"
+	statTable    = "stat"
+	settingTable = "setting"
+)
+
+// pooled 缓冲池中已预取的一张图, 重启后恢复
+type pooled struct {
+	ID    int64  `db:"id"` // ID 入池时间 (ns)
+	Type  string `db:"type"`
+	Pid   int64  `db:"pid"`
+	R18   bool   `db:"r18"`
+	File  string `db:"file"`  // File 图片消息的 file 字段
+	Cache string `db:"cache"` // Cache 图片消息的 cache 字段, 可为空
+}
+
+// policy 群内的涩图策略
+type policy struct {
+	GroupID int64  `db:"gid"`
+	Types   string `db:"types"`  // Types 允许的分类, 空格分隔, 为空时不限
+	NoR18   bool   `db:"nor18"`  // NoR18 禁止 R-18
+	Recall  int64  `db:"recall"` // Recall 发送后多少秒撤回, 0 表示不撤回
+}
+
+// allowed 分类是否在群内可用
+func (p *policy) allowed(imgtype string) bool {
+	if p.Types == "" {
+		return true
+	}
+	for _, t := range strings.Fields(p.Types) {
+		if t == imgtype {
+			return true
+		}
+	}
+	return false
+}
+
+// stat 各群请求各分类的次数
+type stat struct {
+	ID      string `db:"id"` // ID 群号/分类
+	GroupID int64  `db:"gid"`
+	Type    string `db:"type"`
+	Count   int64  `db:"count"`
+}
+
+// setting 全局设置
+type setting struct {
+	Name  string `db:"name"`
+	Value int64  `db:"value"`
+}
+
+// settingWorkers 后台预取的并发数
+const settingWorkers = "workers"
+
+var pdb = &pooldb{}
+
+// pooldb 缓冲池与群策略, 与图库 SetuTime.db 分开存放
+type pooldb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+func (pdb *pooldb) init(dbpath string) error {
+	pdb.DBPath = dbpath
+	err := pdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = pdb.Create(pooledTable, &pooled{})
+	if err != nil {
+		return err
+	}
+	err = pdb.Create(policyTable, &policy{})
+	if err != nil {
+		return err
+	}
+	err = pdb.Create(statTable, &stat{})
+	if err != nil {
+		return err
+	}
+	return pdb.Create(settingTable, &setting{})
+}
+
+func (pdb *pooldb) pooled() (ps []*pooled, err error) {
+	pdb.RLock()
+	defer pdb.RUnlock()
+	ps, err = sql.FindAll[pooled](&pdb.Sqlite, pooledTable, "ORDER BY id")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+func (pdb *pooldb) addPooled(p *pooled) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+	return pdb.Insert(pooledTable, p)
+}
+
+func (pdb *pooldb) delPooled(id int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+	return pdb.Del(pooledTable, "WHERE id = "+strconv.FormatInt(id, 10))
+}
+
+// policy 群策略, 未设置时返回默认值
+func (pdb *pooldb) policy(gid int64) *policy {
+	pdb.RLock()
+	defer pdb.RUnlock()
+	p := &policy{}
+	if pdb.Find(policyTable, p, "WHERE gid = "+strconv.FormatInt(gid, 10)) != nil {
+		p = &policy{GroupID: gid}
+	}
+	return p
+}
+
+func (pdb *pooldb) setPolicy(p *policy) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+	return pdb.Insert(policyTable, p)
+}
+
+// hit 记录一次请求
+func (pdb *pooldb) hit(gid int64, imgtype string) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+	s := &stat{}
+	id := strconv.FormatInt(gid, 10) + "/" + imgtype
+	if pdb.Find(statTable, s, "WHERE id = "+quote(id)) != nil {
+		s = &stat{ID: id, GroupID: gid, Type: imgtype}
+	}
+	s.Count++
+	return pdb.Insert(statTable, s)
+}
+
+// typecount 分类与请求次数
+type typecount struct {
+	Type  string
+	Count int64
+}
+
+// ranking 各分类的请求次数降序, gid 为 0 时统计所有群
+func (pdb *pooldb) ranking(gid int64) ([]typecount, error) {
+	pdb.RLock()
+	defer pdb.RUnlock()
+	cond := ""
+	if gid != 0 {
+		cond = "WHERE gid = " + strconv.FormatInt(gid, 10)
+	}
+	m := make(map[string]int64)
+	s := &stat{}
+	err := pdb.FindFor(statTable, s, cond, func() error {
+		m[s.Type] += s.Count
+		return nil
+	})
+	if err != nil && err != sql.ErrNullResult {
+		return nil, err
+	}
+	tc := make([]typecount, 0, len(m))
+	for t, c := range m {
+		tc = append(tc, typecount{Type: t, Count: c})
+	}
+	sort.Slice(tc, func(i, j int) bool {
+		if tc[i].Count != tc[j].Count {
+			return tc[i].Count > tc[j].Count
+		}
+		return tc[i].Type < tc[j].Type
+	})
+	return tc, nil
+}
+
+func (pdb *pooldb) getSetting(name string, def int64) int64 {
+	pdb.RLock()
+	defer pdb.RUnlock()
+	s := &setting{}
+	if pdb.Find(settingTable, s, "WHERE name = "+quote(name)) != nil {
+		return def
+	}
+	return s.Value
+}
+
+func (pdb *pooldb) setSetting(name string, value int64) error {
+	pdb.Lock()
+	defer pdb.Unlock()
+	return pdb.Insert(settingTable, &setting{Name: name, Value: value})
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/FloatTech/AnimeAPI/pixiv"
@@ -19,6 +20,7 @@ import (
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
 	imagepool "github.com/FloatTech/zbputils/img/pool"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
@@ -29,8 +31,27 @@ type imgpool struct {
 	dbmu   sync.RWMutex
 	path   string
 	max    int
-	pool   map[string][]*message.MessageSegment
+	pool   map[string][]*poolitem
 	poolmu sync.Mutex
+	jobs   chan job
+	// pending 各分类正在预取的数量, 与 pool 一同由 poolmu 保护
+	pending map[string]int
+	// 后台预取的并发上限与当前数量
+	workers, running int32
+}
+
+// poolitem 缓冲池中的一张图
+type poolitem struct {
+	id  int64
+	r18 bool
+	msg message.MessageSegment
+}
+
+// job 一次补充池子的任务, 执行时再按 selfid 取得 bot
+type job struct {
+	selfid  int64
+	imgtype string
+	nor18   bool
 }
 
 func (p *imgpool) List() (l []string) {
@@ -45,12 +66,18 @@ func (p *imgpool) List() (l []string) {
 }
 
 var pool = &imgpool{
-	db:   &sql.Sqlite{},
-	path: pixiv.CacheDir,
-	max:  10,
-	pool: make(map[string][]*message.MessageSegment),
+	db:      &sql.Sqlite{},
+	path:    pixiv.CacheDir,
+	max:     10,
+	pool:    make(map[string][]*poolitem),
+	pending: make(map[string]int),
+	jobs:    make(chan job, 64),
+	workers: 1,
 }
 
+// maxworkers 后台预取并发数的上限
+const maxworkers = 8
+
 func init() { // 插件主体
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
@@ -58,10 +85,25 @@ func init() { // 插件主体
 		Help: "- 来份[涩图/二次元/风景/车万]\n" +
 			"- 添加[涩图/二次元/风景/车万][P站图片ID]\n" +
 			"- 删除[涩图/二次元/风景/车万][P站图片ID]\n" +
-			"- >setu status",
+			"- >setu status\n" +
+			"- 设置本群setu分类[涩图 二次元 ...]\n" +
+			"- 清除本群setu分类\n" +
+			"- [允许|禁止]本群R18涩图\n" +
+			"- 设置本群setu撤回[N]秒 (0为不撤回)\n" +
+			"- 查看本群setu设置\n" +
+			"- 设置setu预取并发[1-8]",
 		PublicDataFolder: "SetuTime",
 	})
 
+	err := pdb.init(engine.DataFolder() + "pool.db")
+	if err != nil {
+		panic(err)
+	}
+	pool.restore()
+	atomic.StoreInt32(&pool.workers, int32(pdb.getSetting(settingWorkers, 1)))
+	go pool.dispatch()
+	go pool.topup()
+
 	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
 		// 如果数据库不存在则下载
 		pool.db.DBPath = engine.DataFolder() + "SetuTime.db"
@@ -83,21 +125,41 @@ func init() { // 插件主体
 	engine.OnRegex(`^来份(.+)$`, getdb, fcext.ValueInList(func(ctx *zero.Ctx) string { return ctx.State["regex_matched"].([]string)[1] }, pool)).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			var imgtype = ctx.State["regex_matched"].([]string)[1]
+			plc := pdb.policy(ctx.Event.GroupID)
+			if !plc.allowed(imgtype) {
+				ctx.SendChain(message.Text("本群未开放分类", imgtype))
+				return
+			}
+			if err := pdb.hit(ctx.Event.GroupID, imgtype); err != nil {
+				logrus.Warnln("[setutime] hit err:", err)
+			}
 			// 补充池子
-			go pool.fill(ctx, imgtype)
+			pool.request(ctx.Event.SelfID, imgtype, plc.NoR18)
 			// 如果没有缓存，阻塞10秒
-			if pool.size(imgtype) == 0 {
+			if pool.size(imgtype, plc.NoR18) == 0 {
 				ctx.SendChain(message.Text("INFO: 正在填充弹药......"))
 				time.Sleep(time.Second * 10)
-				if pool.size(imgtype) == 0 {
+				if pool.size(imgtype, plc.NoR18) == 0 {
 					ctx.SendChain(message.Text("ERROR: 等待填充，请稍后再试......"))
 					return
 				}
 			}
 			// 从缓冲池里抽一张
-			m := message.Message{ctxext.FakeSenderForwardNode(ctx, *pool.pop(imgtype))}
-			if id := ctx.Send(m).ID(); id == 0 {
+			item := pool.pop(imgtype, plc.NoR18)
+			if item == nil {
+				ctx.SendChain(message.Text("ERROR: 等待填充，请稍后再试......"))
+				return
+			}
+			m := message.Message{ctxext.FakeSenderForwardNode(ctx, item.msg)}
+			id := ctx.Send(m)
+			if id.ID() == 0 {
 				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+				return
+			}
+			if plc.Recall > 0 {
+				time.AfterFunc(time.Duration(plc.Recall)*time.Second, func() {
+					ctx.DeleteMessage(id)
+				})
 			}
 		})
 
@@ -134,7 +196,6 @@ func init() { // 插件主体
 		Handle(func(ctx *zero.Ctx) {
 			state := []string{"[SetuTime]"}
 			pool.dbmu.RLock()
-			defer pool.dbmu.RUnlock()
 			for _, imgtype := range pool.List() {
 				num, err := pool.db.Count(imgtype)
 				if err != nil {
@@ -143,73 +204,310 @@ func init() { // 插件主体
 				state = append(state, "\n")
 				state = append(state, imgtype)
 				state = append(state, ": ")
-				state = append(state, fmt.Sprintf("%d", num))
+				state = append(state, fmt.Sprintf("%d (缓冲%d)", num, pool.size(imgtype, false)))
+			}
+			pool.dbmu.RUnlock()
+			state = append(state, fmt.Sprintf("\n预取并发: %d", atomic.LoadInt32(&pool.workers)))
+			rank := func(title string, gid int64) {
+				tc, err := pdb.ranking(gid)
+				if err != nil || len(tc) == 0 {
+					return
+				}
+				if len(tc) > 5 {
+					tc = tc[:5]
+				}
+				state = append(state, "\n"+title+":")
+				for _, t := range tc {
+					state = append(state, fmt.Sprintf(" %s(%d)", t.Type, t.Count))
+				}
+			}
+			rank("最常请求", 0)
+			if ctx.Event.GroupID != 0 {
+				rank("本群最常请求", ctx.Event.GroupID)
 			}
 			ctx.SendChain(message.Text(state))
 		})
+
+	engine.OnRegex(`^设置本群setu分类\s*(.+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			types := strings.Fields(ctx.State["regex_matched"].([]string)[1])
+			all := pool.List()
+			for _, t := range types {
+				found := false
+				for _, a := range all {
+					if a == t {
+						found = true
+						break
+					}
+				}
+				if !found {
+					ctx.SendChain(message.Text("ERROR: 没有分类", t))
+					return
+				}
+			}
+			plc := pdb.policy(ctx.Event.GroupID)
+			plc.Types = strings.Join(types, " ")
+			if err := pdb.setPolicy(plc); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！本群仅可使用: ", plc.Types))
+		})
+	engine.OnFullMatch("清除本群setu分类", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			plc := pdb.policy(ctx.Event.GroupID)
+			plc.Types = ""
+			if err := pdb.setPolicy(plc); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！本群可使用所有分类"))
+		})
+	engine.OnRegex(`^(允许|禁止)本群R18涩图$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			plc := pdb.policy(ctx.Event.GroupID)
+			plc.NoR18 = ctx.State["regex_matched"].([]string)[1] == "禁止"
+			if err := pdb.setPolicy(plc); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！"))
+		})
+	engine.OnRegex(`^设置本群setu撤回\s*(\d+)\s*秒$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			n, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			if n > 3600 {
+				ctx.SendChain(message.Text("ERROR: 最长1小时"))
+				return
+			}
+			plc := pdb.policy(ctx.Event.GroupID)
+			plc.Recall = n
+			if err := pdb.setPolicy(plc); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功！"))
+		})
+	engine.OnFullMatch("查看本群setu设置", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			plc := pdb.policy(ctx.Event.GroupID)
+			types := plc.Types
+			if types == "" {
+				types = "所有"
+			}
+			r18 := "允许"
+			if plc.NoR18 {
+				r18 = "禁止"
+			}
+			recall := "不撤回"
+			if plc.Recall > 0 {
+				recall = strconv.FormatInt(plc.Recall, 10) + "秒后撤回"
+			}
+			ctx.SendChain(message.Text("分类: ", types, "\nR18: ", r18, "\n撤回: ", recall))
+		})
+	engine.OnRegex(`^设置setu预取并发\s*(\d+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			n, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			if n < 1 || n > maxworkers {
+				ctx.SendChain(message.Text("ERROR: 并发数应在1-", maxworkers, "之间"))
+				return
+			}
+			if err := pdb.setSetting(settingWorkers, n); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			atomic.StoreInt32(&pool.workers, int32(n))
+			ctx.SendChain(message.Text("成功！"))
+		})
+}
+
+// restore 从数据库恢复上次的缓冲池
+func (p *imgpool) restore() {
+	ps, err := pdb.pooled()
+	if err != nil {
+		logrus.Warnln("[setutime] restore pool err:", err)
+		return
+	}
+	p.poolmu.Lock()
+	defer p.poolmu.Unlock()
+	for _, it := range ps {
+		// 本地缓存已被清理的图片不再恢复
+		if f := strings.TrimPrefix(it.File, "file:///"); f != it.File && fileutil.IsNotExist(f) {
+			_ = pdb.delPooled(it.ID)
+			continue
+		}
+		msg := message.Image(it.File)
+		if it.Cache != "" {
+			msg = msg.Add("cache", it.Cache)
+		}
+		p.pool[it.Type] = append(p.pool[it.Type], &poolitem{id: it.ID, r18: it.R18, msg: msg})
+	}
+}
+
+// request 提交补充池子的任务, 由后台按并发上限执行
+func (p *imgpool) request(selfid int64, imgtype string, nor18 bool) {
+	select {
+	case p.jobs <- job{selfid: selfid, imgtype: imgtype, nor18: nor18}:
+	default: // 队列已满, 丢弃
+	}
+}
+
+// dispatch 按并发上限执行补充任务
+func (p *imgpool) dispatch() {
+	for j := range p.jobs {
+		for atomic.LoadInt32(&p.running) >= atomic.LoadInt32(&p.workers) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		atomic.AddInt32(&p.running, 1)
+		go func(j job) {
+			defer atomic.AddInt32(&p.running, -1)
+			ctx := zero.GetBot(j.selfid)
+			if ctx == nil { // bot 已离线
+				return
+			}
+			p.fill(ctx, j.selfid, j.imgtype, j.nor18)
+		}(j)
+	}
+}
+
+// topup 定时用任意一个在线的 bot 将各分类补充至上限
+func (p *imgpool) topup() {
+	for range time.NewTicker(10 * time.Minute).C {
+		if p.db.DB == nil {
+			continue
+		}
+		var selfid int64
+		zero.RangeBot(func(id int64, _ *zero.Ctx) bool {
+			selfid = id
+			return false
+		})
+		if selfid == 0 {
+			continue
+		}
+		for _, imgtype := range p.List() {
+			if p.size(imgtype, false) < p.max {
+				p.request(selfid, imgtype, false)
+			}
+		}
+	}
 }
 
-// size 返回缓冲池指定类型的现有大小
-func (p *imgpool) size(imgtype string) int {
-	return len(p.pool[imgtype])
+// size 返回缓冲池指定类型的现有大小, nor18 时只计非 R-18 的图
+func (p *imgpool) size(imgtype string, nor18 bool) int {
+	p.poolmu.Lock()
+	defer p.poolmu.Unlock()
+	return p.sizelocked(imgtype, nor18)
 }
 
-func (p *imgpool) push(ctx *zero.Ctx, imgtype string, illust *pixiv.Illust) {
+func (p *imgpool) sizelocked(imgtype string, nor18 bool) int {
+	if !nor18 {
+		return len(p.pool[imgtype])
+	}
+	n := 0
+	for _, it := range p.pool[imgtype] {
+		if !it.r18 {
+			n++
+		}
+	}
+	return n
+}
+
+// push 下载图片并发送给 bot 自己以获得缓存, 之后加入缓冲池
+func (p *imgpool) push(ctx *zero.Ctx, selfid int64, imgtype string, illust *pixiv.Illust) error {
 	if len(illust.ImageUrls) == 0 {
-		return
+		return nil
 	}
 	u := illust.ImageUrls[0]
 	n := u[strings.LastIndex(u, "/")+1 : len(u)-4]
 	m, err := imagepool.GetImage(n)
 	var msg message.MessageSegment
 	f := fileutil.BOTPATH + "/" + illust.Path(0)
+	sendtoself := func(msg any) int64 {
+		return ctx.SendPrivateMessage(selfid, msg)
+	}
 	if err != nil {
 		if fileutil.IsNotExist(f) {
 			// 下载图片
 			if err := illust.DownloadToCache(0); err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
+				return err
 			}
 		}
 		m.SetFile(f)
-		_, _ = m.Push(ctxext.SendToSelf(ctx), ctxext.GetMessage(ctx))
+		_, _ = m.Push(sendtoself, ctxext.GetMessage(ctx))
 		msg = message.Image("file:///" + f)
 	} else {
 		msg = message.Image(m.String())
-		if ctxext.SendToSelf(ctx)(msg) == 0 {
+		if sendtoself(msg) == 0 {
 			msg = msg.Add("cache", "0")
 		}
 	}
+	it := &poolitem{id: time.Now().UnixNano(), r18: illust.AgeLimit == "r18", msg: msg}
+	err = pdb.addPooled(&pooled{ID: it.id, Type: imgtype, Pid: illust.Pid, R18: it.r18, File: msg.Data["file"], Cache: msg.Data["cache"]})
+	if err != nil {
+		logrus.Warnln("[setutime] persist pool err:", err)
+	}
 	p.poolmu.Lock()
-	p.pool[imgtype] = append(p.pool[imgtype], &msg)
+	p.pool[imgtype] = append(p.pool[imgtype], it)
 	p.poolmu.Unlock()
+	return nil
 }
 
-func (p *imgpool) pop(imgtype string) (msg *message.MessageSegment) {
+// pop 取出最早入池的一张图, nor18 时跳过 R-18 的图
+func (p *imgpool) pop(imgtype string, nor18 bool) (it *poolitem) {
 	p.poolmu.Lock()
 	defer p.poolmu.Unlock()
-	if p.size(imgtype) == 0 {
-		return
+	items := p.pool[imgtype]
+	for i, x := range items {
+		if nor18 && x.r18 {
+			continue
+		}
+		it = x
+		p.pool[imgtype] = append(items[:i:i], items[i+1:]...)
+		break
+	}
+	if it != nil {
+		if err := pdb.delPooled(it.id); err != nil {
+			logrus.Warnln("[setutime] persist pool err:", err)
+		}
 	}
-	msg = p.pool[imgtype][0]
-	p.pool[imgtype] = p.pool[imgtype][1:]
 	return
 }
 
-// fill 补充池子
-func (p *imgpool) fill(ctx *zero.Ctx, imgtype string) {
-	times := math.Min(p.max-p.size(imgtype), 2)
+// fill 补充池子, nor18 时确保至少有一张非 R-18 的图
+//
+//	先在 poolmu 下预留数量, 多个 worker 同时补充时不会超过上限
+func (p *imgpool) fill(ctx *zero.Ctx, selfid int64, imgtype string, nor18 bool) {
+	p.poolmu.Lock()
+	times := math.Min(p.max-len(p.pool[imgtype])-p.pending[imgtype], 2)
+	safe := nor18 && p.sizelocked(imgtype, true) == 0
+	if safe && times < 1 {
+		times = 1
+	}
+	if times < 0 {
+		times = 0
+	}
+	p.pending[imgtype] += times
+	p.poolmu.Unlock()
 	p.dbmu.RLock()
 	defer p.dbmu.RUnlock()
 	for i := 0; i < times; i++ {
 		illust := &pixiv.Illust{}
 		// 查询出一张图片
-		if err := p.db.Pick(imgtype, illust); err != nil {
-			ctx.SendChain(message.Text("ERROR: ", err))
-			continue
+		var err error
+		if safe {
+			err = p.db.Find(imgtype, illust, "WHERE age_limit <> 'r18' ORDER BY RANDOM() limit 1")
+		} else {
+			err = p.db.Pick(imgtype, illust)
+		}
+		if err != nil {
+			logrus.Warnln("[setutime] pick", imgtype, "err:", err)
+		} else if err = p.push(ctx, selfid, imgtype, illust); err != nil { // 向缓冲池添加一张图片
+			logrus.Warnln("[setutime] push", imgtype, "err:", err)
 		}
-		// 向缓冲池添加一张图片
-		p.push(ctx, imgtype, illust)
+		// 无论成功与否都释放本次预留
+		p.poolmu.Lock()
+		p.pending[imgtype]--
+		p.poolmu.Unlock()
 		process.SleepAbout1sTo2s()
 	}
 }
@@ -0,0 +1,190 @@
+package sleepmanage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SleepLog 作息记录, 每人每群每晚一条
+type SleepLog struct {
+	ID      uint      `gorm:"primary_key"`
+	GroupID int64     `gorm:"column:group_id;index"`
+	UserID  int64     `gorm:"column:user_id;index"`
+	Night   string    `gorm:"column:night;index"` // Night 入睡当晚在用户时区的日期
+	SleepAt time.Time `gorm:"column:sleep_at"`    // SleepAt 晚安时间, 只说了早安时为零值
+	WakeAt  time.Time `gorm:"column:wake_at"`     // WakeAt 早安时间, 尚未起床时为零值
+}
+
+// TableName 表名
+func (SleepLog) TableName() string {
+	return "sleep_log"
+}
+
+// Duration 睡眠时长, 缺少晚安或早安时为 0
+func (l *SleepLog) Duration() time.Duration {
+	if l.SleepAt.IsZero() || l.WakeAt.IsZero() || !l.WakeAt.After(l.SleepAt) {
+		return 0
+	}
+	return l.WakeAt.Sub(l.SleepAt)
+}
+
+const nightLayout = "2006-01-02"
+
+// nightOf 晚安所属的夜晚, 中午以前算作前一晚
+func nightOf(t time.Time, loc *time.Location) string {
+	t = t.In(loc)
+	if t.Hour() < 12 {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t.Format(nightLayout)
+}
+
+// logSleep 记录晚安, 同一晚多次晚安以最后一次为准
+func (sdb *sleepdb) logSleep(gid, uid int64, now time.Time, loc *time.Location) error {
+	db := (*gorm.DB)(sdb)
+	night := nightOf(now, loc)
+	l := SleepLog{}
+	err := db.Where("group_id = ? and user_id = ? and night = ?", gid, uid, night).First(&l).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return db.Create(&SleepLog{GroupID: gid, UserID: uid, Night: night, SleepAt: now}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Model(&l).Updates(map[string]any{"sleep_at": now, "wake_at": time.Time{}}).Error
+}
+
+// logWake 记录早安, 补全最近一次尚未起床的晚安, 没有时单独记一条
+func (sdb *sleepdb) logWake(gid, uid int64, now time.Time, loc *time.Location) error {
+	db := (*gorm.DB)(sdb)
+	ls, err := sdb.logs(gid, uid, now.In(loc).AddDate(0, 0, -2).Format(nightLayout))
+	if err != nil {
+		return err
+	}
+	for i := len(ls) - 1; i >= 0; i-- {
+		l := &ls[i]
+		if l.SleepAt.IsZero() || !l.WakeAt.IsZero() {
+			continue
+		}
+		if l.SleepAt.Before(now) && now.Sub(l.SleepAt) < 24*time.Hour {
+			return db.Model(l).Update("wake_at", now).Error
+		}
+		break
+	}
+	night := now.In(loc).AddDate(0, 0, -1).Format(nightLayout)
+	l := SleepLog{}
+	err = db.Where("group_id = ? and user_id = ? and night = ?", gid, uid, night).First(&l).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return db.Create(&SleepLog{GroupID: gid, UserID: uid, Night: night, WakeAt: now}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Model(&l).Update("wake_at", now).Error
+}
+
+// logs 用户 since 当晚及以后的记录, 按日期升序
+func (sdb *sleepdb) logs(gid, uid int64, since string) (ls []SleepLog, err error) {
+	db := (*gorm.DB)(sdb)
+	err = db.Where("group_id = ? and user_id = ? and night >= ?", gid, uid, since).Order("night").Find(&ls).Error
+	return
+}
+
+// groupLogs 群内 since 当晚及以后的记录
+func (sdb *sleepdb) groupLogs(gid int64, since string) (ls []SleepLog, err error) {
+	db := (*gorm.DB)(sdb)
+	err = db.Where("group_id = ? and night >= ?", gid, since).Find(&ls).Error
+	return
+}
+
+// clockOf 一天中的分钟数, noon 为 true 时以中午为界, 凌晨记为 24 点以后, 便于平均入睡时间
+func clockOf(t time.Time, loc *time.Location, noon bool) int {
+	t = t.In(loc)
+	m := t.Hour()*60 + t.Minute()
+	if noon && m < 12*60 {
+		m += 24 * 60
+	}
+	return m
+}
+
+// summary 一段时间内的作息统计
+type summary struct {
+	Nights   int           // Nights 有记录的天数
+	Slept    int           // Slept 有完整睡眠时长的天数
+	Duration time.Duration // Duration 平均睡眠时长
+	Bedtime  int           // Bedtime 平均入睡时间 (分钟, 以中午为界), 没有时为 -1
+	Wake     int           // Wake 平均起床时间 (分钟), 没有时为 -1
+}
+
+// summarize 统计记录
+func summarize(ls []SleepLog, loc *time.Location) (s summary) {
+	var dur time.Duration
+	bed, nbed, wake, nwake := 0, 0, 0, 0
+	for i := range ls {
+		l := &ls[i]
+		s.Nights++
+		if d := l.Duration(); d > 0 {
+			s.Slept++
+			dur += d
+		}
+		if !l.SleepAt.IsZero() {
+			bed += clockOf(l.SleepAt, loc, true)
+			nbed++
+		}
+		if !l.WakeAt.IsZero() {
+			wake += clockOf(l.WakeAt, loc, false)
+			nwake++
+		}
+	}
+	s.Bedtime, s.Wake = -1, -1
+	if s.Slept > 0 {
+		s.Duration = dur / time.Duration(s.Slept)
+	}
+	if nbed > 0 {
+		s.Bedtime = bed / nbed
+	}
+	if nwake > 0 {
+		s.Wake = wake / nwake
+	}
+	return
+}
+
+// rank 排行中的一项
+type rank struct {
+	UserID int64
+	Clock  int // Clock 平均时间 (分钟)
+	Nights int
+}
+
+// ranking 群内平均起床时间 (wake 为 true) 或入睡时间的排行, 早起升序, 夜猫子降序
+func (sdb *sleepdb) ranking(gid int64, since string, wake bool) ([]rank, error) {
+	ls, err := sdb.groupLogs(gid, since)
+	if err != nil {
+		return nil, err
+	}
+	byuser := make(map[int64][]SleepLog)
+	for _, l := range ls {
+		byuser[l.UserID] = append(byuser[l.UserID], l)
+	}
+	rs := make([]rank, 0, len(byuser))
+	for uid, ul := range byuser {
+		s := summarize(ul, sdb.schedule(uid).location())
+		c := s.Bedtime
+		if wake {
+			c = s.Wake
+		}
+		if c < 0 {
+			continue
+		}
+		rs = append(rs, rank{UserID: uid, Clock: c, Nights: s.Nights})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Clock != rs[j].Clock {
+			return rs[i].Clock < rs[j].Clock == wake
+		}
+		return rs[i].UserID < rs[j].UserID
+	})
+	return rs, nil
+}
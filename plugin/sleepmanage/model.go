@@ -29,7 +29,7 @@ func initialize(dbpath string) *sleepdb {
 	if err != nil {
 		panic(err)
 	}
-	gdb.AutoMigrate(&SleepManage{})
+	gdb.AutoMigrate(&SleepManage{}, &SleepLog{}, &SleepSchedule{})
 	return (*sleepdb)(gdb)
 }
 
@@ -56,11 +56,10 @@ func (SleepManage) TableName() string {
 func (sdb *sleepdb) sleep(gid, uid int64) (position int, awakeTime time.Duration) {
 	db := (*gorm.DB)(sdb)
 	now := time.Now()
-	var today time.Time
-	if now.Hour() >= 21 {
-		today = now.Add(-time.Hour*time.Duration(-21+now.Hour()) - time.Minute*time.Duration(now.Minute()) - time.Second*time.Duration(now.Second()))
-	} else if now.Hour() <= 3 {
-		today = now.Add(-time.Hour*time.Duration(3+now.Hour()) - time.Minute*time.Duration(now.Minute()) - time.Second*time.Duration(now.Second()))
+	sc := sdb.schedule(uid)
+	today := windowStart(now, sc.location(), sc.EveningStart)
+	if err := sdb.logSleep(gid, uid, now, sc.location()); err != nil {
+		log.Warnln("[sleepmanage] log sleep err:", err)
 	}
 	st := SleepManage{
 		GroupID:   gid,
@@ -88,7 +87,11 @@ func (sdb *sleepdb) sleep(gid, uid int64) (position int, awakeTime time.Duration
 func (sdb *sleepdb) getUp(gid, uid int64) (position int, sleepTime time.Duration) {
 	db := (*gorm.DB)(sdb)
 	now := time.Now()
-	today := now.Add(-time.Hour*time.Duration(-6+now.Hour()) - time.Minute*time.Duration(now.Minute()) - time.Second*time.Duration(now.Second()))
+	sc := sdb.schedule(uid)
+	today := windowStart(now, sc.location(), sc.MorningStart)
+	if err := sdb.logWake(gid, uid, now, sc.location()); err != nil {
+		log.Warnln("[sleepmanage] log wake err:", err)
+	}
 	st := SleepManage{
 		GroupID:   gid,
 		UserID:    uid,
@@ -0,0 +1,125 @@
+package sleepmanage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/golang/freetype"
+	"github.com/wcharczuk/go-chart/v2"
+)
+
+// clock 分钟数转为 hh:mm, 超过 24 点的回绕
+func clock(m int) string {
+	if m < 0 {
+		return "无记录"
+	}
+	m %= 24 * 60
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
+
+func hms(d time.Duration) string {
+	if d <= 0 {
+		return "无记录"
+	}
+	return fmt.Sprintf("%d时%d分", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// report 近7天与近30天的作息报告正文
+func report(name string, sc *SleepSchedule, ls []SleepLog, now time.Time) string {
+	loc := sc.location()
+	week := now.In(loc).AddDate(0, 0, -7).Format(nightLayout)
+	var wl []SleepLog
+	for _, l := range ls {
+		if l.Night >= week {
+			wl = append(wl, l)
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString(name + " 的作息报告\n")
+	sb.WriteString("时区: " + now.In(loc).Format("MST -07:00") + "\n")
+	for _, p := range []struct {
+		title string
+		ls    []SleepLog
+	}{{"近7天", wl}, {"近30天", ls}} {
+		s := summarize(p.ls, loc)
+		sb.WriteString(fmt.Sprintf("\n%s: 记录%d天, 完整睡眠%d天\n", p.title, s.Nights, s.Slept))
+		sb.WriteString("平均睡眠时长: " + hms(s.Duration) + "\n")
+		sb.WriteString("平均入睡时间: " + clock(s.Bedtime) + "\n")
+		sb.WriteString("平均起床时间: " + clock(s.Wake) + "\n")
+	}
+	return sb.String()
+}
+
+// drawchart 每晚的睡眠时长与入睡时间
+func drawchart(ls []SleepLog, loc *time.Location) ([]byte, error) {
+	var dx, dy, bx, by []float64
+	for i := range ls {
+		l := &ls[i]
+		night, err := time.ParseInLocation(nightLayout, l.Night, loc)
+		if err != nil {
+			continue
+		}
+		x := chart.TimeToFloat64(night)
+		if d := l.Duration(); d > 0 {
+			dx, dy = append(dx, x), append(dy, d.Hours())
+		}
+		if !l.SleepAt.IsZero() {
+			bx, by = append(bx, x), append(by, float64(clockOf(l.SleepAt, loc, true))/60)
+		}
+	}
+	if len(dx) < 2 && len(bx) < 2 {
+		// 至少两个点才能画线
+		return nil, errNoData
+	}
+	_, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(text.FontFile)
+	if err != nil {
+		return nil, err
+	}
+	font, err := freetype.ParseFont(b)
+	if err != nil {
+		return nil, err
+	}
+	graph := chart.Chart{
+		Font:   font,
+		Title:  "近30天作息",
+		Width:  1000,
+		Height: 400,
+		Background: chart.Style{
+			Padding: chart.Box{Top: 50, Left: 20},
+		},
+		XAxis: chart.XAxis{
+			ValueFormatter: chart.TimeValueFormatterWithFormat("01-02"),
+		},
+		YAxis: chart.YAxis{
+			Name:           "睡眠时长(时)",
+			ValueFormatter: func(v any) string { return fmt.Sprintf("%.1f", v) },
+		},
+		YAxisSecondary: chart.YAxis{
+			Name: "入睡时间",
+			ValueFormatter: func(v any) string {
+				f, _ := v.(float64)
+				return clock(int(f * 60))
+			},
+		},
+	}
+	if len(dx) >= 2 {
+		graph.Series = append(graph.Series, chart.ContinuousSeries{Name: "睡眠时长", XValues: dx, YValues: dy})
+	}
+	if len(bx) >= 2 {
+		graph.Series = append(graph.Series, chart.ContinuousSeries{Name: "入睡时间", XValues: bx, YValues: by, YAxis: chart.YAxisSecondary})
+	}
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+	var buf bytes.Buffer
+	err = graph.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,136 @@
+package sleepmanage
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SleepSchedule 用户的时区与早安/晚安时段, 没有记录时使用默认值
+type SleepSchedule struct {
+	UserID       int64  `gorm:"column:user_id;primary_key;auto_increment:false"`
+	TimeZone     string `gorm:"column:time_zone"` // TimeZone 为空时使用服务器时区
+	MorningStart int    `gorm:"column:morning_start"`
+	MorningEnd   int    `gorm:"column:morning_end"`
+	EveningStart int    `gorm:"column:evening_start"`
+	EveningEnd   int    `gorm:"column:evening_end"`
+}
+
+// TableName 表名
+func (SleepSchedule) TableName() string {
+	return "sleep_schedule"
+}
+
+// defaultSchedule 6点到12点早安, 21点到凌晨3点晚安
+func defaultSchedule(uid int64) *SleepSchedule {
+	return &SleepSchedule{UserID: uid, MorningStart: 6, MorningEnd: 12, EveningStart: 21, EveningEnd: 3}
+}
+
+var errZone = errors.New("时区应为 Asia/Tokyo 或 UTC+9 这样的格式")
+
+// parseZone 解析 IANA 时区名或 UTC±h[:mm]
+func parseZone(s string) (*time.Location, error) {
+	u := strings.ToUpper(s)
+	for _, p := range []string{"UTC", "GMT"} {
+		if !strings.HasPrefix(u, p) {
+			continue
+		}
+		off := u[len(p):]
+		if off == "" {
+			return time.UTC, nil
+		}
+		sign := 1
+		switch off[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			return nil, errZone
+		}
+		hs, ms, _ := strings.Cut(off[1:], ":")
+		h, err := strconv.Atoi(hs)
+		if err != nil || h > 14 {
+			return nil, errZone
+		}
+		m := 0
+		if ms != "" {
+			m, err = strconv.Atoi(ms)
+			if err != nil || m >= 60 {
+				return nil, errZone
+			}
+		}
+		return time.FixedZone(u, sign*(h*3600+m*60)), nil
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return nil, errZone
+	}
+	return loc, nil
+}
+
+// location 用户所在时区
+func (s *SleepSchedule) location() *time.Location {
+	if s.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := parseZone(s.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// inWindow 小时 h 是否在 [start, end] 内, start > end 时跨越零点
+func inWindow(h, start, end int) bool {
+	if start <= end {
+		return h >= start && h <= end
+	}
+	return h >= start || h <= end
+}
+
+// windowStart 时段开始的时刻, 即 loc 时区最近一次到达 hour 点整
+func windowStart(now time.Time, loc *time.Location, hour int) time.Time {
+	t := now.In(loc)
+	s := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, loc)
+	if s.After(now) {
+		s = s.AddDate(0, 0, -1)
+	}
+	return s
+}
+
+// String 当前设置
+func (s *SleepSchedule) String() string {
+	tz := s.TimeZone
+	if tz == "" {
+		tz = "服务器时区(" + time.Now().Format("MST") + ")"
+	}
+	return "时区: " + tz +
+		"\n早安时段: " + strconv.Itoa(s.MorningStart) + "-" + strconv.Itoa(s.MorningEnd) + "点" +
+		"\n晚安时段: " + strconv.Itoa(s.EveningStart) + "-" + strconv.Itoa(s.EveningEnd) + "点"
+}
+
+// schedule 用户的设置, 数据库尚未就绪时返回默认值
+func (sdb *sleepdb) schedule(uid int64) *SleepSchedule {
+	s := defaultSchedule(uid)
+	if sdb == nil {
+		return s
+	}
+	db := (*gorm.DB)(sdb)
+	_ = db.Model(&SleepSchedule{}).Where("user_id = ?", uid).First(s).Error
+	return s
+}
+
+// setSchedule 保存用户的设置
+func (sdb *sleepdb) setSchedule(s *SleepSchedule) error {
+	db := (*gorm.DB)(sdb)
+	return db.Save(s).Error
+}
+
+// resetSchedule 恢复默认设置
+func (sdb *sleepdb) resetSchedule(uid int64) error {
+	db := (*gorm.DB)(sdb)
+	return db.Where("user_id = ?", uid).Delete(&SleepSchedule{}).Error
+}
@@ -2,22 +2,41 @@
 package sleepmanage
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
 
+	"github.com/FloatTech/floatbox/binary"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+)
+
+var (
+	errNoData   = errors.New("记录太少, 多说几次早安晚安吧")
+	errNotReady = errors.New("数据库尚未加载完成, 请稍后再试")
 )
 
 func init() {
 	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault:  false,
-		Brief:             "睡眠小助手",
-		Help:              "- 早安\n- 晚安",
+		DisableOnDefault: false,
+		Brief:            "睡眠小助手",
+		Help: "- 早安\n- 晚安\n" +
+			"- 作息报告\n" +
+			"- 早起排行\n" +
+			"- 夜猫子排行\n" +
+			"- 设置作息时区[Asia/Tokyo|UTC+9]\n" +
+			"- 设置早安时段6-12\n" +
+			"- 设置晚安时段21-3\n" +
+			"- 查看作息设置\n" +
+			"- 重置作息设置\n" +
+			"注: 早安/晚安时段与作息统计按个人设置的时区计算, 排行统计近7天的平均时间",
 		PrivateDataFolder: "sleep",
 	})
 	go func() {
@@ -45,6 +64,123 @@ func init() {
 				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(fmt.Sprintf("晚安成功！你的清醒时长为%d时%d分%d秒,你是今天第%d个睡觉的", hour, minute, second, position)))
 			}
 		})
+	engine.OnFullMatch("作息报告", zero.OnlyGroup, ready).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			uid := ctx.Event.UserID
+			sc := sdb.schedule(uid)
+			now := time.Now()
+			ls, err := sdb.logs(ctx.Event.GroupID, uid, now.In(sc.location()).AddDate(0, 0, -30).Format(nightLayout))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(ls) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(errNoData))
+				return
+			}
+			data, err := text.RenderToBase64(report(ctx.CardOrNickName(uid), sc, ls, now), text.FontFile, 400, 20)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			msg := message.Message{message.Reply(ctx.Event.MessageID), message.Image("base64://" + binary.BytesToString(data))}
+			img, err := drawchart(ls, sc.location())
+			switch {
+			case err == nil:
+				msg = append(msg, message.ImageBytes(img))
+			case err != errNoData:
+				log.Warnln("[sleepmanage] draw chart err:", err)
+			}
+			ctx.Send(msg)
+		})
+	engine.OnRegex(`^(早起|夜猫子)排行$`, zero.OnlyGroup, ready).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			wake := ctx.State["regex_matched"].([]string)[1] == "早起"
+			since := time.Now().AddDate(0, 0, -7).Format(nightLayout)
+			rs, err := sdb.ranking(ctx.Event.GroupID, since, wake)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(rs) == 0 {
+				ctx.SendChain(message.Text("近7天还没有记录"))
+				return
+			}
+			if len(rs) > 10 {
+				rs = rs[:10]
+			}
+			var sb strings.Builder
+			if wake {
+				sb.WriteString("近7天早起排行 (平均起床时间)")
+			} else {
+				sb.WriteString("近7天夜猫子排行 (平均入睡时间)")
+			}
+			for i, r := range rs {
+				sb.WriteString(fmt.Sprintf("\n%d. %s %s (%d天)", i+1, ctx.CardOrNickName(r.UserID), clock(r.Clock), r.Nights))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置作息时区\s*(\S+)$`, ready).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			tz := ctx.State["regex_matched"].([]string)[1]
+			loc, err := parseZone(tz)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			sc := sdb.schedule(ctx.Event.UserID)
+			sc.TimeZone = tz
+			err = sdb.setSchedule(sc)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！当前当地时间: ", time.Now().In(loc).Format("2006-01-02 15:04")))
+		})
+	engine.OnRegex(`^设置(早安|晚安)时段\s*(\d{1,2})\s*[-~到]\s*(\d{1,2})$`, ready).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			m := ctx.State["regex_matched"].([]string)
+			start, _ := strconv.Atoi(m[2])
+			end, _ := strconv.Atoi(m[3])
+			if start > 23 || end > 23 || start == end {
+				ctx.SendChain(message.Text("ERROR: 时段应为0-23点之间的两个不同整点"))
+				return
+			}
+			sc := sdb.schedule(ctx.Event.UserID)
+			if m[1] == "早安" {
+				sc.MorningStart, sc.MorningEnd = start, end
+			} else {
+				sc.EveningStart, sc.EveningEnd = start, end
+			}
+			err := sdb.setSchedule(sc)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！\n", sc.String()))
+		})
+	engine.OnFullMatch("查看作息设置", ready).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sdb.schedule(ctx.Event.UserID).String()))
+		})
+	engine.OnFullMatch("重置作息设置", ready).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			err := sdb.resetSchedule(ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功！\n", defaultSchedule(ctx.Event.UserID).String()))
+		})
+}
+
+// ready 数据库加载完成
+func ready(ctx *zero.Ctx) bool {
+	if sdb == nil {
+		ctx.SendChain(message.Text("ERROR: ", errNotReady))
+		return false
+	}
+	return true
 }
 
 func timeDuration(time time.Duration) (hour, minute, second int64) {
@@ -54,14 +190,14 @@ func timeDuration(time time.Duration) (hour, minute, second int64) {
 	return hour, minute, second
 }
 
-// 只统计6点到12点的早安
-func isMorning(*zero.Ctx) bool {
-	now := time.Now().Hour()
-	return now >= 6 && now <= 12
+// 只统计用户时区内早安时段 (默认6点到12点) 的早安
+func isMorning(ctx *zero.Ctx) bool {
+	sc := sdb.schedule(ctx.Event.UserID)
+	return inWindow(time.Now().In(sc.location()).Hour(), sc.MorningStart, sc.MorningEnd)
 }
 
-// 只统计21点到凌晨3点的晚安
-func isEvening(*zero.Ctx) bool {
-	now := time.Now().Hour()
-	return now >= 21 || now <= 3
+// 只统计用户时区内晚安时段 (默认21点到凌晨3点) 的晚安
+func isEvening(ctx *zero.Ctx) bool {
+	sc := sdb.schedule(ctx.Event.UserID)
+	return inWindow(time.Now().In(sc.location()).Hour(), sc.EveningStart, sc.EveningEnd)
 }
@@ -0,0 +1,75 @@
+package steam
+
+import (
+	"fmt"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/web"
+	"github.com/tidwall/gjson"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// achievementurl 根据用户steamID与游戏ID获取成就
+const achievementurl = "ISteamUserStats/GetPlayerAchievements/v1/?key=%+v&steamid=%+v&appid=%+v&l=schinese"
+
+// achievement 已解锁的成就
+type achievement struct {
+	Name        string
+	Description string
+	UnlockTime  int64
+}
+
+// getAchievements 获取用户在游戏中已解锁的成就与成就总数
+func getAchievements(steamID, appID int64) (unlocked []achievement, total int, err error) {
+	apiKeyMu.Lock()
+	url := fmt.Sprintf(apiurl+achievementurl, apiKey, steamID, appID)
+	apiKeyMu.Unlock()
+	data, err := web.GetData(url)
+	if err != nil {
+		return
+	}
+	list := gjson.Get(binary.BytesToString(data), "playerstats.achievements").Array()
+	for _, a := range list {
+		if a.Get("achieved").Int() == 0 {
+			continue
+		}
+		unlocked = append(unlocked, achievement{
+			Name:        a.Get("name").String(),
+			Description: a.Get("description").String(),
+			UnlockTime:  a.Get("unlocktime").Int(),
+		})
+	}
+	return unlocked, len(list), nil
+}
+
+// achievementMessages 上次检查之后新解锁的成就, 第一次检查某个游戏时只记录进度.
+// 资料未公开或游戏没有成就时不提示
+func achievementMessages(info *player, appID int64, gameName string) (msgs []message.Message) {
+	unlocked, total, err := getAchievements(info.SteamID, appID)
+	if err != nil || total == 0 {
+		return
+	}
+	seen, ok, err := database.findAchievement(info.SteamID, appID)
+	if err != nil {
+		return
+	}
+	last := seen.LastUnlock
+	for _, a := range unlocked {
+		if ok && a.UnlockTime > seen.LastUnlock {
+			desc := ""
+			if a.Description != "" {
+				desc = ": " + a.Description
+			}
+			msgs = append(msgs, message.Message{message.Text(info.PersonaName, " 在 ", gameName, " 中解锁了成就「", a.Name, "」",
+				desc, " (", len(unlocked), "/", total, ")")})
+		}
+		if a.UnlockTime > last {
+			last = a.UnlockTime
+		}
+	}
+	if !ok || last != seen.LastUnlock {
+		seen.LastUnlock = last
+		_ = database.updateAchievement(&seen)
+	}
+	return
+}
@@ -46,6 +46,10 @@ func init() {
 	})
 	engine.OnFullMatch("拉取steam订阅", getDB).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		su := zero.BotConfig.SuperUsers[0]
+		// 查询订阅游戏的价格
+		if err := checkWishes(ctx, time.Now()); err != nil {
+			ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err, "\nEXP: 查询游戏价格失败"))
+		}
 		// 获取所有处于监听状态的用户信息
 		infos, err := database.findAll()
 		if err != nil {
@@ -85,17 +89,31 @@ func init() {
 				msg = append(msg, message.Text(playerInfo.PersonaName, "正在玩", playerInfo.GameExtraInfo))
 				localInfo.LastUpdate = now.Unix()
 			}
+			// 游玩中与刚结束的游戏检查成就
+			var achievements []message.Message
+			if localInfo.GameID != 0 && playerInfo.GameID != localInfo.GameID {
+				achievements = achievementMessages(playerInfo, localInfo.GameID, localInfo.GameExtraInfo)
+			}
+			if playerInfo.GameID != 0 {
+				achievements = append(achievements, achievementMessages(playerInfo, playerInfo.GameID, playerInfo.GameExtraInfo)...)
+			}
 			// 更换游戏
 			if localInfo.GameID != 0 && playerInfo.GameID != localInfo.GameID && playerInfo.GameID != 0 {
 				msg = append(msg, message.Text(playerInfo.PersonaName, "玩了", (now.Unix()-localInfo.LastUpdate)/60, "分钟后, 丢下了", localInfo.GameExtraInfo, ", 转头去玩", playerInfo.GameExtraInfo))
+				if err = recordSession(localInfo, now.Unix()); err != nil {
+					ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err, "\nEXP: 记录游戏时长失败\nOTHER: SteamID ", localInfo.SteamID))
+				}
 				localInfo.LastUpdate = now.Unix()
 			}
 			// 关闭游戏
 			if playerInfo.GameID != localInfo.GameID && playerInfo.GameID == 0 {
 				msg = append(msg, message.Text(playerInfo.PersonaName, "玩了", (now.Unix()-localInfo.LastUpdate)/60, "分钟后, 关掉了", localInfo.GameExtraInfo))
+				if err = recordSession(localInfo, now.Unix()); err != nil {
+					ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err, "\nEXP: 记录游戏时长失败\nOTHER: SteamID ", localInfo.SteamID))
+				}
 				localInfo.LastUpdate = 0
 			}
-			if len(msg) != 0 {
+			if len(msg) != 0 || len(achievements) != 0 {
 				groups := strings.Split(localInfo.Target, ",")
 				for _, groupString := range groups {
 					group, err := strconv.ParseInt(groupString, 10, 64)
@@ -103,7 +121,12 @@ func init() {
 						ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err, "\nOTHER: SteamID ", localInfo.SteamID))
 						continue
 					}
-					ctx.SendGroupMessage(group, msg)
+					if len(msg) != 0 {
+						ctx.SendGroupMessage(group, msg)
+					}
+					for _, a := range achievements {
+						ctx.SendGroupMessage(group, a)
+					}
 				}
 			}
 			// 更新数据
@@ -0,0 +1,201 @@
+package steam
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// reportDays 周报统计的天数
+const reportDays = 7
+
+func init() {
+	// 查询本群的周报
+	engine.OnFullMatch("steam游戏时长周报", zero.OnlyGroup, getDB).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		infos, err := database.findAll()
+		if err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err, "\nEXP: 查询周报失败, 数据库错误"))
+			return
+		}
+		report, err := weeklyReport(ctx.Event.GroupID, infos, time.Now())
+		if err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err, "\nEXP: 查询周报失败, 数据库错误"))
+			return
+		}
+		if report == "" {
+			ctx.SendChain(message.Text("本群订阅的用户最近", reportDays, "天都没有玩游戏"))
+			return
+		}
+		data, err := text.RenderToBase64(report, text.FontFile, 400, 18)
+		if err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Image("base64://" + binary.BytesToString(data)))
+	})
+	// 向所有订阅了用户的群推送周报
+	engine.OnFullMatch("拉取steam周报", getDB).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		su := zero.BotConfig.SuperUsers[0]
+		infos, err := database.findAll()
+		if err != nil {
+			ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err))
+			return
+		}
+		now := time.Now()
+		for _, group := range targetGroups(infos) {
+			report, err := weeklyReport(group, infos, now)
+			if err != nil {
+				ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err))
+				return
+			}
+			if report == "" {
+				continue
+			}
+			data, err := text.RenderToBase64(report, text.FontFile, 400, 18)
+			if err != nil {
+				ctx.SendPrivateMessage(su, message.Text("[steam] ERROR: ", err))
+				return
+			}
+			ctx.SendGroupMessage(group, message.Message{message.Image("base64://" + binary.BytesToString(data))})
+		}
+	})
+}
+
+// hasTarget 推送群列表中是否包含该群
+func hasTarget(target string, groupID int64) bool {
+	g := strconv.FormatInt(groupID, 10)
+	for _, t := range strings.Split(target, ",") {
+		if t == g {
+			return true
+		}
+	}
+	return false
+}
+
+// targetGroups 所有的推送群
+func targetGroups(infos []*player) (groups []int64) {
+	seen := make(map[int64]bool)
+	for _, info := range infos {
+		for _, t := range strings.Split(info.Target, ",") {
+			g, err := strconv.ParseInt(t, 10, 64)
+			if err != nil || seen[g] {
+				continue
+			}
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	return
+}
+
+// recordSession 记录刚结束的一次游玩
+func recordSession(info *player, now int64) error {
+	if info.GameID == 0 || info.LastUpdate == 0 || now <= info.LastUpdate {
+		return nil
+	}
+	return database.addSession(&playSession{
+		SteamID:  info.SteamID,
+		GameID:   info.GameID,
+		GameName: info.GameExtraInfo,
+		Start:    info.LastUpdate,
+		End:      now,
+	})
+}
+
+// formatMinutes 将分钟数格式化为 x小时y分钟
+func formatMinutes(m int64) string {
+	if m < 60 {
+		return strconv.FormatInt(m, 10) + "分钟"
+	}
+	return fmt.Sprintf("%d小时%d分钟", m/60, m%60)
+}
+
+// weeklyReport 群内订阅用户最近 reportDays 天的游戏时长, 包括正在进行的游玩, 没有记录时返回空
+func weeklyReport(groupID int64, infos []*player, now time.Time) (string, error) {
+	since := now.AddDate(0, 0, -reportDays).Unix()
+	sessions, err := database.sessionsSince(since)
+	if err != nil {
+		return "", err
+	}
+	members := make(map[int64]*player)
+	for _, info := range infos {
+		if hasTarget(info.Target, groupID) {
+			members[info.SteamID] = info
+			if info.GameID != 0 && info.LastUpdate != 0 {
+				sessions = append(sessions, &playSession{SteamID: info.SteamID, GameID: info.GameID, GameName: info.GameExtraInfo, Start: info.LastUpdate, End: now.Unix()})
+			}
+		}
+	}
+	type gametime struct {
+		name    string
+		seconds int64
+	}
+	type usertime struct {
+		name    string
+		seconds int64
+		games   map[int64]*gametime
+	}
+	users := make(map[int64]*usertime)
+	for _, s := range sessions {
+		info, ok := members[s.SteamID]
+		if !ok {
+			continue
+		}
+		start := s.Start
+		if start < since {
+			start = since
+		}
+		if s.End <= start {
+			continue
+		}
+		u, ok := users[s.SteamID]
+		if !ok {
+			u = &usertime{name: info.PersonaName, games: make(map[int64]*gametime)}
+			users[s.SteamID] = u
+		}
+		g, ok := u.games[s.GameID]
+		if !ok {
+			g = &gametime{name: s.GameName}
+			u.games[s.GameID] = g
+		}
+		g.seconds += s.End - start
+		u.seconds += s.End - start
+	}
+	if len(users) == 0 {
+		return "", nil
+	}
+	ranking := make([]*usertime, 0, len(users))
+	for _, u := range users {
+		ranking = append(ranking, u)
+	}
+	sort.Slice(ranking, func(i, j int) bool { return ranking[i].seconds > ranking[j].seconds })
+	var sb strings.Builder
+	sb.WriteString(" steam游戏时长周报 (")
+	sb.WriteString(time.Unix(since, 0).Format("01-02"))
+	sb.WriteString(" ~ ")
+	sb.WriteString(now.Format("01-02"))
+	sb.WriteString(")\n")
+	for i, u := range ranking {
+		games := make([]*gametime, 0, len(u.games))
+		for _, g := range u.games {
+			games = append(games, g)
+		}
+		sort.Slice(games, func(i, j int) bool { return games[i].seconds > games[j].seconds })
+		fmt.Fprintf(&sb, " %d. %s 共%s\n", i+1, u.name, formatMinutes(u.seconds/60))
+		for j, g := range games {
+			if j == 3 {
+				fmt.Fprintf(&sb, "     ...等%d个游戏\n", len(games))
+				break
+			}
+			fmt.Fprintf(&sb, "     %s %s\n", g.name, formatMinutes(g.seconds/60))
+		}
+	}
+	return sb.String(), nil
+}
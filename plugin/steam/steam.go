@@ -24,15 +24,22 @@ var (
 		Help: "- steam添加订阅 xxxxxxx (可输入需要绑定的 steamid)\n" +
 			"- steam删除订阅 xxxxxxx (删除你创建的对于 steamid 的绑定)\n" +
 			"- steam查询订阅 (查询本群内所有的绑定对象)\n" +
+			"- steam游戏时长周报 (查询本群订阅用户最近7天的游戏时长)\n" +
+			"- steam订阅游戏 xxxxxxx [目标价] (游戏降价或降到目标价以下时提醒, appid在商店页链接上)\n" +
+			"- steam取消订阅游戏 xxxxxxx\n" +
+			"- steam游戏订阅列表\n" +
 			"-----------------------\n" +
 			"- steam绑定 api key xxxxxxx (密钥在steam网站申请, 申请地址: https://steamcommunity.com/dev/apikey)\n" +
 			"- 查看apikey (查询已经绑定的密钥)\n" +
-			"- 拉取steam订阅 (使用插件定时任务开始)\n" +
+			"- 拉取steam订阅 (使用插件定时任务开始, 同时检查成就解锁与游戏价格)\n" +
+			"- 拉取steam周报 (向所有订阅群推送游戏时长周报)\n" +
 			"-----------------------\n" +
 			"Tips: steamID在用户资料页的链接上面, 形如7656119820673xxxx\n" +
 			"需要先私聊绑定apikey, 订阅用户之后使用job插件设置定时, 例: \n" +
 			"记录在\"@every 1m\"触发的指令\n" +
-			"拉取steam订阅",
+			"拉取steam订阅\n" +
+			"记录在\"0 20 * * 0\"触发的指令\n" +
+			"拉取steam周报",
 		PrivateDataFolder: "steam",
 	}).ApplySingle(ctxext.DefaultSingle)
 )
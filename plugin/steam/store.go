@@ -26,6 +26,18 @@ var (
 			ctx.SendChain(message.Text("[steam] ERROR: ", err))
 			return false
 		}
+		if err = database.db.Create(tablePlaySession, &playSession{}); err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err))
+			return false
+		}
+		if err = database.db.Create(tableAchievement, &achievementSeen{}); err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err))
+			return false
+		}
+		if err = database.db.Create(tableWishGame, &wishGame{}); err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err))
+			return false
+		}
 		// 校验密钥是否初始化
 		m := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
 		apiKeyMu.Lock()
@@ -48,6 +60,12 @@ type streamDB struct {
 const (
 	// tableListenPlayer 存储查询用户信息
 	tableListenPlayer = "listen_player"
+	// tablePlaySession 存储每次游玩的起止时间
+	tablePlaySession = "play_session"
+	// tableAchievement 存储已通知到的成就解锁时间
+	tableAchievement = "achievement"
+	// tableWishGame 存储群订阅的游戏价格
+	tableWishGame = "wish_game"
 )
 
 // player 用户状态存储结构体
@@ -95,7 +113,11 @@ func (sdb *streamDB) findWithGroupID(steamID int64, groupID string) (dbInfo play
 func (sdb *streamDB) findAll() (dbInfos []*player, err error) {
 	sdb.Lock()
 	defer sdb.Unlock()
-	return sql.FindAll[player](&sdb.db, tableListenPlayer, "")
+	dbInfos, err = sql.FindAll[player](&sdb.db, tableListenPlayer, "")
+	if err == sql.ErrNullResult { // 还没有订阅时返回空列表
+		err = nil
+	}
+	return
 }
 
 // del 删除指定数据
@@ -104,3 +126,105 @@ func (sdb *streamDB) del(steamID int64) error {
 	defer sdb.Unlock()
 	return sdb.db.Del(tableListenPlayer, "where steam_id = "+strconv.FormatInt(steamID, 10))
 }
+
+// playSession 一次游玩记录
+type playSession struct {
+	ID       string `json:"id"`        // steamID_开始时间
+	SteamID  int64  `json:"steam_id"`  // 用户标识ID
+	GameID   int64  `json:"game_id"`   // 游戏ID
+	GameName string `json:"game_name"` // 游戏名
+	Start    int64  `json:"start_at"`  // 开始时间
+	End      int64  `json:"end_at"`    // 结束时间
+}
+
+// achievementSeen 用户在某个游戏中已通知到的成就
+type achievementSeen struct {
+	ID         string `json:"id"`          // steamID_appID
+	SteamID    int64  `json:"steam_id"`    // 用户标识ID
+	AppID      int64  `json:"app_id"`      // 游戏ID
+	LastUnlock int64  `json:"last_unlock"` // 最后一个已通知成就的解锁时间
+}
+
+// wishGame 群订阅的游戏价格
+type wishGame struct {
+	ID        string `json:"id"`         // 群号_appID
+	GroupID   int64  `json:"group_id"`   // 推送群
+	AppID     int64  `json:"app_id"`     // 游戏ID
+	Name      string `json:"name"`       // 游戏名
+	Target    int64  `json:"target"`     // 目标价, 单位分, 0 表示任意降价都提醒
+	Price     int64  `json:"price"`      // 上次查询的价格, 单位分
+	Discount  int64  `json:"discount"`   // 上次查询的折扣
+	LastCheck int64  `json:"last_check"` // 上次查询时间
+}
+
+// addSession 记录一次游玩
+func (sdb *streamDB) addSession(s *playSession) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	s.ID = strconv.FormatInt(s.SteamID, 10) + "_" + strconv.FormatInt(s.Start, 10)
+	return sdb.db.Insert(tablePlaySession, s)
+}
+
+// sessionsSince 查询 since 之后结束的游玩记录
+func (sdb *streamDB) sessionsSince(since int64) ([]*playSession, error) {
+	sdb.Lock()
+	defer sdb.Unlock()
+	ss, err := sql.FindAll[playSession](&sdb.db, tablePlaySession, "where end_at > "+strconv.FormatInt(since, 10))
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return ss, err
+}
+
+// findAchievement 查询已通知的成就进度, ok 为 false 表示还没有记录
+func (sdb *streamDB) findAchievement(steamID, appID int64) (a achievementSeen, ok bool, err error) {
+	sdb.Lock()
+	defer sdb.Unlock()
+	id := strconv.FormatInt(steamID, 10) + "_" + strconv.FormatInt(appID, 10)
+	err = sdb.db.Find(tableAchievement, &a, "where id = '"+id+"'")
+	if err == sql.ErrNullResult {
+		return achievementSeen{ID: id, SteamID: steamID, AppID: appID}, false, nil
+	}
+	return a, err == nil, err
+}
+
+// updateAchievement 更新已通知的成就进度
+func (sdb *streamDB) updateAchievement(a *achievementSeen) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	return sdb.db.Insert(tableAchievement, a)
+}
+
+// updateWish 如果主键不存在则插入一条新的数据，如果主键存在直接复写
+func (sdb *streamDB) updateWish(w *wishGame) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	w.ID = strconv.FormatInt(w.GroupID, 10) + "_" + strconv.FormatInt(w.AppID, 10)
+	return sdb.db.Insert(tableWishGame, w)
+}
+
+// findWishes 查询订阅的游戏, groupID 为 0 时查询所有群
+func (sdb *streamDB) findWishes(groupID int64) ([]*wishGame, error) {
+	sdb.Lock()
+	defer sdb.Unlock()
+	condition := ""
+	if groupID != 0 {
+		condition = "where group_id = " + strconv.FormatInt(groupID, 10)
+	}
+	ws, err := sql.FindAll[wishGame](&sdb.db, tableWishGame, condition)
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return ws, err
+}
+
+// delWish 删除群订阅的游戏, 不存在时返回 sql.ErrNullResult
+func (sdb *streamDB) delWish(groupID, appID int64) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	condition := "where id = '" + strconv.FormatInt(groupID, 10) + "_" + strconv.FormatInt(appID, 10) + "'"
+	if !sdb.db.CanFind(tableWishGame, condition) {
+		return sql.ErrNullResult
+	}
+	return sdb.db.Del(tableWishGame, condition)
+}
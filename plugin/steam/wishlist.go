@@ -0,0 +1,207 @@
+package steam
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/web"
+	sql "github.com/FloatTech/sqlite"
+	"github.com/tidwall/gjson"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	storeurl   = "https://store.steampowered.com/api/appdetails?appids=%v&cc=cn&l=schinese" // 获取游戏详情
+	priceurl   = storeurl + "&filters=price_overview"                                       // 批量获取游戏价格
+	appurl     = "https://store.steampowered.com/app/%d"                                    // 商店页面
+	priceCheck = time.Hour                                                                  // 价格查询间隔, 商店接口有频率限制
+	priceBatch = 50                                                                         // 每次批量查询的游戏数
+)
+
+var errNoPrice = errors.New("该游戏免费或未在国区发售")
+
+// price 游戏当前价格
+type price struct {
+	Final    int64 // 现价, 单位分
+	Initial  int64 // 原价, 单位分
+	Discount int64 // 折扣百分比
+}
+
+// formatPrice 将分格式化为 ¥x.xx
+func formatPrice(cent int64) string {
+	return fmt.Sprintf("¥%d.%02d", cent/100, cent%100)
+}
+
+func parsePrice(r gjson.Result) price {
+	return price{
+		Final:    r.Get("final").Int(),
+		Initial:  r.Get("initial").Int(),
+		Discount: r.Get("discount_percent").Int(),
+	}
+}
+
+// getGame 获取游戏名与价格
+func getGame(appID int64) (name string, p price, err error) {
+	data, err := web.GetData(fmt.Sprintf(storeurl, appID))
+	if err != nil {
+		return
+	}
+	r := gjson.Get(binary.BytesToString(data), strconv.FormatInt(appID, 10))
+	if !r.Get("success").Bool() {
+		err = errors.New("游戏不存在")
+		return
+	}
+	name = r.Get("data.name").String()
+	po := r.Get("data.price_overview")
+	if !po.Exists() {
+		err = errNoPrice
+		return
+	}
+	return name, parsePrice(po), nil
+}
+
+// getPrices 批量获取游戏价格, 免费或未发售的游戏不在结果中
+func getPrices(appIDs []int64) (map[int64]price, error) {
+	ids := make([]string, len(appIDs))
+	for i, id := range appIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	data, err := web.GetData(fmt.Sprintf(priceurl, strings.Join(ids, ",")))
+	if err != nil {
+		return nil, err
+	}
+	prices := make(map[int64]price, len(appIDs))
+	gjson.ParseBytes(data).ForEach(func(key, value gjson.Result) bool {
+		if po := value.Get("data.price_overview"); po.Exists() {
+			prices[key.Int()] = parsePrice(po)
+		}
+		return true
+	})
+	return prices, nil
+}
+
+func init() {
+	engine.OnRegex(`^steam订阅游戏\s*(\d+)(?:\s+(\d+(?:\.\d{1,2})?)元?)?$`, zero.OnlyGroup, getDB).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		appID, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+		var target int64
+		if s := ctx.State["regex_matched"].([]string)[2]; s != "" {
+			f, _ := strconv.ParseFloat(s, 64)
+			target = int64(math.Round(f * 100))
+		}
+		name, p, err := getGame(appID)
+		if err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err, "\nEXP: 订阅失败, 获取游戏信息错误"))
+			return
+		}
+		w := wishGame{
+			GroupID:   ctx.Event.GroupID,
+			AppID:     appID,
+			Name:      name,
+			Target:    target,
+			Price:     p.Final,
+			Discount:  p.Discount,
+			LastCheck: time.Now().Unix(),
+		}
+		if err = database.updateWish(&w); err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err, "\nEXP: 订阅失败, 数据库错误"))
+			return
+		}
+		msg := "订阅成功, " + name + " 当前价格 " + formatPrice(p.Final)
+		if p.Discount > 0 {
+			msg += " (-" + strconv.FormatInt(p.Discount, 10) + "%)"
+		}
+		if target > 0 {
+			msg += ", 降到 " + formatPrice(target) + " 以下时提醒"
+		} else {
+			msg += ", 降价时提醒"
+		}
+		ctx.SendChain(message.Text(msg))
+	})
+	engine.OnRegex(`^steam取消订阅游戏\s*(\d+)$`, zero.OnlyGroup, getDB).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		appID, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+		err := database.delWish(ctx.Event.GroupID, appID)
+		if err == sql.ErrNullResult {
+			ctx.SendChain(message.Text("[steam] ERROR: 本群没有订阅该游戏"))
+			return
+		}
+		if err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err, "\nEXP: 取消订阅失败, 数据库错误"))
+			return
+		}
+		ctx.SendChain(message.Text("取消订阅成功"))
+	})
+	engine.OnFullMatch("steam游戏订阅列表", zero.OnlyGroup, getDB).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		ws, err := database.findWishes(ctx.Event.GroupID)
+		if err != nil {
+			ctx.SendChain(message.Text("[steam] ERROR: ", err, "\nEXP: 查询失败, 数据库错误"))
+			return
+		}
+		if len(ws) == 0 {
+			ctx.SendChain(message.Text("本群还没有订阅游戏"))
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("本群订阅的游戏有:")
+		for _, w := range ws {
+			fmt.Fprintf(&sb, "\n%d %s %s", w.AppID, w.Name, formatPrice(w.Price))
+			if w.Discount > 0 {
+				fmt.Fprintf(&sb, " (-%d%%)", w.Discount)
+			}
+			if w.Target > 0 {
+				sb.WriteString(" 目标价 " + formatPrice(w.Target))
+			}
+		}
+		ctx.SendChain(message.Text(sb.String()))
+	})
+}
+
+// checkWishes 查询到期的游戏价格, 降价时通知订阅的群
+func checkWishes(ctx *zero.Ctx, now time.Time) error {
+	ws, err := database.findWishes(0)
+	if err != nil {
+		return err
+	}
+	due := make([]*wishGame, 0, len(ws))
+	seen := make(map[int64]bool)
+	appIDs := make([]int64, 0, len(ws))
+	for _, w := range ws {
+		if now.Unix()-w.LastCheck < int64(priceCheck/time.Second) {
+			continue
+		}
+		due = append(due, w)
+		if !seen[w.AppID] && len(appIDs) < priceBatch {
+			seen[w.AppID] = true
+			appIDs = append(appIDs, w.AppID)
+		}
+	}
+	if len(appIDs) == 0 {
+		return nil
+	}
+	prices, err := getPrices(appIDs)
+	if err != nil {
+		return err
+	}
+	for _, w := range due {
+		if !seen[w.AppID] {
+			continue // 超出本次批量查询的数量, 下次再查
+		}
+		w.LastCheck = now.Unix()
+		if p, ok := prices[w.AppID]; ok {
+			if p.Final < w.Price && (w.Target == 0 || p.Final <= w.Target) {
+				ctx.SendGroupMessage(w.GroupID, message.Text("[steam] ", w.Name, " 降价了: ", formatPrice(w.Price), " → ", formatPrice(p.Final),
+					" (-", p.Discount, "%)\n", fmt.Sprintf(appurl, w.AppID)))
+			}
+			w.Price, w.Discount = p.Final, p.Discount
+		}
+		if err = database.updateWish(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
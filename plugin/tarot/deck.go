@@ -0,0 +1,211 @@
+package tarot
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FloatTech/floatbox/file"
+)
+
+const (
+	defaultDeck = "默认"
+	majorCount  = 22
+)
+
+var (
+	errNoCards     = errors.New("牌组中没有牌")
+	errCardIndex   = errors.New("牌的序号必须从0开始连续编号")
+	errRepresent   = errors.New("牌阵的释义数量少于牌数")
+	errNoMinor     = errors.New("该牌组没有小阿卡纳")
+	errTooManyDraw = errors.New("抽取张数超过牌组大小")
+)
+
+// deck 一套塔罗牌及其牌阵, dir 为空表示在线的默认牌组
+type deck struct {
+	name            string
+	dir             string
+	cards           cardSet
+	infos           map[string]cardInfo
+	formations      map[string]formation
+	majorArcanaName []string
+	minorArcanaName []string
+	formationName   []string
+}
+
+// newDeck 解析与默认牌组相同格式的 tarots.json 与 formation.json
+func newDeck(name, dir string, cardsData, formationData []byte) (*deck, error) {
+	d := &deck{name: name, dir: dir}
+	err := json.Unmarshal(cardsData, &d.cards)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.cards) == 0 {
+		return nil, errNoCards
+	}
+	d.infos = make(map[string]cardInfo, len(d.cards))
+	for i := 0; i < len(d.cards); i++ {
+		c, ok := d.cards[strconv.Itoa(i)]
+		if !ok {
+			return nil, errCardIndex
+		}
+		d.infos[c.Name] = c.cardInfo
+		if i < majorCount {
+			d.majorArcanaName = append(d.majorArcanaName, c.Name)
+		} else {
+			d.minorArcanaName = append(d.minorArcanaName, c.Name)
+		}
+	}
+	err = json.Unmarshal(formationData, &d.formations)
+	if err != nil {
+		return nil, err
+	}
+	for k, f := range d.formations {
+		if len(f.Represent) == 0 || len(f.Represent[0]) < f.CardsNum {
+			return nil, errors.New(k + ": " + errRepresent.Error())
+		}
+		d.formationName = append(d.formationName, k)
+	}
+	return d, nil
+}
+
+// loadDeck 从本地文件夹读取牌组, 没有 formation.json 时沿用 fallback 的牌阵
+func loadDeck(name, dir string, fallback *deck) (*deck, error) {
+	cardsData, err := os.ReadFile(filepath.Join(dir, "tarots.json"))
+	if err != nil {
+		return nil, err
+	}
+	formationData := []byte("{}")
+	if p := filepath.Join(dir, "formation.json"); file.IsExist(p) {
+		formationData, err = os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	d, err := newDeck(name, dir, cardsData, formationData)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.formations) == 0 && fallback != nil {
+		d.formations = fallback.formations
+		d.formationName = fallback.formationName
+	}
+	return d, nil
+}
+
+// span 按牌的种类返回抽取范围
+func (d *deck) span(cardType string) (start, length int, err error) {
+	switch {
+	case strings.Contains(cardType, "小"):
+		start, length = majorCount, len(d.cards)-majorCount
+		if length <= 0 {
+			err = errNoMinor
+		}
+	case cardType == "混合":
+		length = len(d.cards)
+	default:
+		length = len(d.majorArcanaName)
+	}
+	return
+}
+
+// localImage 本地牌组中牌的图片, 缺少逆位图片时使用正位图片
+func (d *deck) localImage(c card, p int) (string, error) {
+	if p == 1 {
+		if path := filepath.Join(d.dir, "Reverse", c.ImgURL); file.IsExist(path) {
+			return path, nil
+		}
+	}
+	path := filepath.Join(d.dir, c.ImgURL)
+	if file.IsNotExist(path) {
+		return "", errors.New("找不到图片: " + c.ImgURL)
+	}
+	return path, nil
+}
+
+// cardList 牌组的文字列表
+func (d *deck) cardList() string {
+	var build strings.Builder
+	build.WriteString("塔罗牌列表\n大阿尔卡纳:\n")
+	writeRows(&build, d.majorArcanaName)
+	if len(d.minorArcanaName) == 0 {
+		return build.String()
+	}
+	build.WriteString("小阿尔卡纳:\n")
+	if d.dir == "" {
+		build.WriteString("[圣杯|星币|宝剑|权杖] [0-10|侍从|骑士|王后|国王]")
+		return build.String()
+	}
+	writeRows(&build, d.minorArcanaName)
+	return build.String()
+}
+
+// writeRows 每行7个牌名, 最后只剩一个时并入上一行
+func writeRows(build *strings.Builder, names []string) {
+	for i := 0; i < len(names); i += 7 {
+		end := i + 7
+		if end >= len(names)-1 {
+			end = len(names)
+		}
+		build.WriteString(strings.Join(names[i:end], " "))
+		build.WriteString("\n")
+		if end == len(names) {
+			return
+		}
+	}
+}
+
+// deckSet 所有已加载的牌组
+type deckSet struct {
+	sync.RWMutex
+	m map[string]*deck
+}
+
+var decks = deckSet{m: make(map[string]*deck, 4)}
+
+func (s *deckSet) get(name string) (*deck, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	d, ok := s.m[name]
+	return d, ok
+}
+
+func (s *deckSet) set(d *deck) {
+	s.Lock()
+	defer s.Unlock()
+	s.m[d.name] = d
+}
+
+func (s *deckSet) del(name string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.m, name)
+}
+
+func (s *deckSet) names() []string {
+	s.RLock()
+	defer s.RUnlock()
+	names := make([]string, 0, len(s.m))
+	names = append(names, defaultDeck)
+	for k := range s.m {
+		if k != defaultDeck {
+			names = append(names, k)
+		}
+	}
+	return names
+}
+
+// of 群当前使用的牌组, 私聊与未设置的群使用默认牌组
+func (s *deckSet) of(gid int64) *deck {
+	if gid != 0 {
+		if d, ok := s.get(db.getGroupDeck(gid)); ok {
+			return d
+		}
+	}
+	d, _ := s.get(defaultDeck)
+	return d
+}
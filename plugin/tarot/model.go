@@ -0,0 +1,142 @@
+package tarot
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	recordTable    = "record"
+	deckTable      = "deck"
+	groupDeckTable = "groupdeck"
+)
+
+// tarotdb 塔罗牌数据库
+type tarotdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// drawRecord 一次抽牌的记录
+type drawRecord struct {
+	ID      int64  `db:"id"` // 时间 UnixNano
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Deck    string `db:"deck"`
+	Kind    string `db:"kind"`  // 抽牌/每日塔罗/牌阵名
+	Cards   string `db:"cards"` // 每行一张牌
+}
+
+// deckInfo 已安装的牌组
+type deckInfo struct {
+	Name string `db:"name"`
+	Dir  string `db:"dir"`
+}
+
+// groupDeck 群使用的牌组
+type groupDeck struct {
+	GroupID int64  `db:"gid"`
+	Deck    string `db:"deck"`
+}
+
+var db = &tarotdb{}
+
+func (tdb *tarotdb) init(path string) error {
+	tdb.DBPath = path
+	err := tdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = tdb.Create(recordTable, &drawRecord{})
+	if err != nil {
+		return err
+	}
+	err = tdb.Create(deckTable, &deckInfo{})
+	if err != nil {
+		return err
+	}
+	return tdb.Create(groupDeckTable, &groupDeck{})
+}
+
+// quote 转义 sql 字符串
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (tdb *tarotdb) addRecord(r *drawRecord) error {
+	tdb.Lock()
+	defer tdb.Unlock()
+	r.ID = time.Now().UnixNano()
+	return tdb.Insert(recordTable, r)
+}
+
+// records 用户最近的 n 条记录, 新的在前
+func (tdb *tarotdb) records(uid int64, n int) ([]*drawRecord, error) {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	rs, err := sql.FindAll[drawRecord](&tdb.Sqlite, recordTable,
+		"WHERE uid = "+strconv.FormatInt(uid, 10)+" ORDER BY id DESC LIMIT "+strconv.Itoa(n))
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return rs, err
+}
+
+// drewToday 用户今天是否已在该牌组抽过每日塔罗
+func (tdb *tarotdb) drewToday(uid int64, deck string) bool {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local).UnixNano()
+	return tdb.CanFind(recordTable, "WHERE uid = "+strconv.FormatInt(uid, 10)+
+		" AND kind = "+quote(dailyKind)+" AND deck = "+quote(deck)+
+		" AND id >= "+strconv.FormatInt(today, 10))
+}
+
+func (tdb *tarotdb) decks() ([]*deckInfo, error) {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	ds, err := sql.FindAll[deckInfo](&tdb.Sqlite, deckTable, "")
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return ds, err
+}
+
+func (tdb *tarotdb) addDeck(name, dir string) error {
+	tdb.Lock()
+	defer tdb.Unlock()
+	return tdb.Insert(deckTable, &deckInfo{Name: name, Dir: dir})
+}
+
+// delDeck 删除牌组, 并将使用该牌组的群恢复默认
+func (tdb *tarotdb) delDeck(name string) error {
+	tdb.Lock()
+	defer tdb.Unlock()
+	err := tdb.Del(deckTable, "WHERE name = "+quote(name))
+	if err != nil {
+		return err
+	}
+	return tdb.Del(groupDeckTable, "WHERE deck = "+quote(name))
+}
+
+func (tdb *tarotdb) getGroupDeck(gid int64) string {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	var g groupDeck
+	_ = tdb.Find(groupDeckTable, &g, "WHERE gid = "+strconv.FormatInt(gid, 10))
+	return g.Deck
+}
+
+func (tdb *tarotdb) setGroupDeck(gid int64, deck string) error {
+	tdb.Lock()
+	defer tdb.Unlock()
+	if deck == "" {
+		return tdb.Del(groupDeckTable, "WHERE gid = "+strconv.FormatInt(gid, 10))
+	}
+	return tdb.Insert(groupDeckTable, &groupDeck{GroupID: gid, Deck: deck})
+}
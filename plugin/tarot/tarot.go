@@ -2,11 +2,12 @@
 package tarot
 
 import (
-	"encoding/json"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/FloatTech/floatbox/binary"
 	fcext "github.com/FloatTech/floatbox/ctxext"
@@ -23,7 +24,11 @@ import (
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
-const bed = "https://gitcode.net/shudorcl/zbp-tarot/-/raw/master/"
+const (
+	bed       = "https://gitcode.net/shudorcl/zbp-tarot/-/raw/master/"
+	drawKind  = "抽牌"
+	dailyKind = "每日塔罗"
+)
 
 type cardInfo struct {
 	Description        string `json:"description"`
@@ -43,11 +48,8 @@ type formation struct {
 type cardSet = map[string]card
 
 var (
-	cardMap         = make(cardSet, 80)
-	infoMap         = make(map[string]cardInfo, 80)
-	formationMap    = make(map[string]formation, 10)
-	majorArcanaName = make([]string, 0, 80)
-	formationName   = make([]string, 0, 10)
+	position = [...]string{"『正位』", "『逆位』"}
+	reverse  = [...]string{"", "Reverse/"}
 )
 
 func init() {
@@ -57,7 +59,16 @@ func init() {
 		Help: "- 抽[塔罗牌|大阿卡纳|小阿卡纳]\n" +
 			"- 抽n张[塔罗牌|大阿卡纳|小阿卡纳]\n" +
 			"- 解塔罗牌[牌名]\n" +
-			"- [塔罗|大阿卡纳|小阿卡纳|混合]牌阵[圣三角|时间之流|四要素|五牌阵|吉普赛十字|马蹄|六芒星]",
+			"- [塔罗|大阿卡纳|小阿卡纳|混合]牌阵[圣三角|时间之流|四要素|五牌阵|吉普赛十字|马蹄|六芒星]\n" +
+			"- 今日塔罗\n" +
+			"- 我的塔罗记录\n" +
+			"- 塔罗牌组列表\n" +
+			"- [群管] 设置塔罗牌组[牌组名]\n" +
+			"- [群管] 重置塔罗牌组\n" +
+			"- [超级用户] 安装塔罗牌组[牌组名] [文件夹路径]\n" +
+			"- [超级用户] 卸载塔罗牌组[牌组名]\n" +
+			"注: 牌组文件夹内需有与默认牌组格式相同的 tarots.json, 可选 formation.json,\n" +
+			"图片按 imgUrl 相对文件夹存放, 逆位图片放在 Reverse 子文件夹内",
 		PublicDataFolder: "Tarot",
 	}).ApplySingle(ctxext.DefaultSingle)
 
@@ -69,37 +80,43 @@ func init() {
 	}
 
 	getTarot := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
-		data, err := engine.GetLazyData("tarots.json", true)
+		err := db.init(engine.DataFolder() + "tarot.db")
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return false
 		}
-		err = json.Unmarshal(data, &cardMap)
+		data, err := engine.GetLazyData("tarots.json", true)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return false
 		}
-		for _, card := range cardMap {
-			infoMap[card.Name] = card.cardInfo
-		}
-		for i := 0; i < 22; i++ {
-			majorArcanaName = append(majorArcanaName, cardMap[strconv.Itoa(i)].Name)
-		}
-		logrus.Infof("[tarot]读取%d张塔罗牌", len(cardMap))
 		formation, err := engine.GetLazyData("formation.json", true)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return false
 		}
-		err = json.Unmarshal(formation, &formationMap)
+		def, err := newDeck(defaultDeck, "", data, formation)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return false
 		}
-		for k := range formationMap {
-			formationName = append(formationName, k)
+		decks.set(def)
+		logrus.Infof("[tarot]读取%d张塔罗牌", len(def.cards))
+		logrus.Infof("[tarot]读取%d组塔罗牌阵", len(def.formations))
+		installed, err := db.decks()
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return false
+		}
+		for _, info := range installed {
+			d, err := loadDeck(info.Name, info.Dir, def)
+			if err != nil {
+				logrus.Warnln("[tarot]加载牌组", info.Name, "失败:", err)
+				continue
+			}
+			decks.set(d)
+			logrus.Infof("[tarot]加载牌组%s, 共%d张牌", d.name, len(d.cards))
 		}
-		logrus.Infof("[tarot]读取%d组塔罗牌阵", len(formationMap))
 		return true
 	})
 	engine.OnRegex(`^抽(\d{1,2}张)?((塔罗牌|大阿(尔)?卡纳)|小阿(尔)?卡纳)$`, getTarot).SetBlock(true).Limit(ctxext.LimitByGroup).Handle(func(ctx *zero.Ctx) {
@@ -107,12 +124,13 @@ func init() {
 		cardType := ctx.State["regex_matched"].([]string)[2]
 		n := 1
 		reasons := [...]string{"您抽到的是~\n", "锵锵锵，塔罗牌的预言是~\n", "诶，让我看看您抽到了~\n"}
-		position := [...]string{"『正位』", "『逆位』"}
-		reverse := [...]string{"", "Reverse/"}
-		start := 0
-		length := 22
+		d := decks.of(ctx.Event.GroupID)
+		start, length, err := d.span(cardType)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
 		if match != "" {
-			var err error
 			n, err = strconv.Atoi(match[:len(match)-3])
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
@@ -126,74 +144,44 @@ func init() {
 				ctx.SendChain(message.Text("ERROR: 抽取张数过多"))
 				return
 			}
-		}
-		if strings.Contains(cardType, "小") {
-			start = 22
-			length = 55
+			if n > length {
+				ctx.SendChain(message.Text("ERROR: ", errTooManyDraw))
+				return
+			}
 		}
 		if n == 1 {
 			i := rand.Intn(length) + start
 			p := rand.Intn(2)
-			card := cardMap[strconv.Itoa(i)]
-			name := card.Name
+			card := d.cards[strconv.Itoa(i)]
 			description := card.Description
 			if p == 1 {
 				description = card.ReverseDescription
 			}
-			imgurl := bed + reverse[p] + card.ImgURL
-			imgname := ""
-			if p == 1 {
-				imgname = reverse[p][:len(reverse[p])-1] + name
-			} else {
-				imgname = name
-			}
-			imgpath := cache + "/" + imgname + ".png"
-			err := pool.SendImageFromPool("pool"+imgname, imgpath, func() error {
-				data, err := web.RequestDataWith(web.NewTLS12Client(), imgurl, "GET", "gitcode.net", web.RandUA(), nil)
-				if err != nil {
-					return err
-				}
-				f, err := os.Create(imgpath)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-				return os.WriteFile(f.Name(), data, 0755)
-			}, ctxext.Send(ctx), ctxext.GetMessage(ctx))
+			imgmsg, err := d.image(ctx, card, p, cache)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
+			if id := ctx.SendChain(imgmsg).ID(); id == 0 {
+				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+				return
+			}
 			process.SleepAbout1sTo2s()
-			ctx.SendChain(message.Text(reasons[rand.Intn(len(reasons))], position[p], "的『", name, "』\n其释义为: ", description))
+			ctx.SendChain(message.Text(reasons[rand.Intn(len(reasons))], position[p], "的『", card.Name, "』\n其释义为: ", description))
+			record(ctx, d, drawKind, position[p]+card.Name)
 			return
 		}
 		msg := make(message.Message, n)
-		randomIntMap := make(map[int]int, 30)
-		for i := range msg {
-			j := rand.Intn(length)
-			_, ok := randomIntMap[j]
-			for ok {
-				j = rand.Intn(length)
-				_, ok = randomIntMap[j]
-			}
-			randomIntMap[j] = 0
+		drawn := make([]string, n)
+		for i, j := range rand.Perm(length)[:n] {
 			p := rand.Intn(2)
-			card := cardMap[strconv.Itoa(j+start)]
-			name := card.Name
+			card := d.cards[strconv.Itoa(j+start)]
 			description := card.Description
 			if p == 1 {
 				description = card.ReverseDescription
 			}
-			imgurl := bed + reverse[p] + card.ImgURL
-			tarotmsg := message.Message{message.Text(reasons[rand.Intn(len(reasons))], position[p], "的『", name, "』\n")}
-			var imgmsg message.MessageSegment
-			var err error
-			if p == 1 {
-				imgmsg, err = poolimg(ctx, imgurl, reverse[p][:len(reverse[p])-1]+name, cache)
-			} else {
-				imgmsg, err = poolimg(ctx, imgurl, name, cache)
-			}
+			tarotmsg := message.Message{message.Text(reasons[rand.Intn(len(reasons))], position[p], "的『", card.Name, "』\n")}
+			imgmsg, err := d.image(ctx, card, p, cache)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -201,19 +189,46 @@ func init() {
 			tarotmsg = append(tarotmsg, imgmsg)
 			tarotmsg = append(tarotmsg, message.Text("\n其释义为: ", description))
 			msg[i] = ctxext.FakeSenderForwardNode(ctx, tarotmsg...)
+			drawn[i] = position[p] + card.Name
 		}
 		if id := ctx.Send(msg).ID(); id == 0 {
 			ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			return
+		}
+		record(ctx, d, drawKind, drawn...)
+	})
+
+	engine.OnRegex(`^(今日|每日)塔罗$`, getTarot).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		d := decks.of(ctx.Event.GroupID)
+		// 同一用户同一天在同一牌组内结果固定
+		r := fcext.RandSenderPerDayN(ctx.Event.UserID, len(d.cards)*2)
+		i, p := r/2, r%2
+		card := d.cards[strconv.Itoa(i)]
+		description := card.Description
+		if p == 1 {
+			description = card.ReverseDescription
+		}
+		imgmsg, err := d.image(ctx, card, p, cache)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if id := ctx.SendChain(message.At(ctx.Event.UserID), message.Text(" 今天的塔罗牌是", position[p], "的『", card.Name, "』\n"), imgmsg, message.Text("\n其释义为: ", description)).ID(); id == 0 {
+			ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			return
+		}
+		if !db.drewToday(ctx.Event.UserID, d.name) {
+			record(ctx, d, dailyKind, position[p]+card.Name)
 		}
 	})
 
 	engine.OnRegex(`^解塔罗牌\s?(.*)`, getTarot).SetBlock(true).Limit(ctxext.LimitByGroup).Handle(func(ctx *zero.Ctx) {
 		match := ctx.State["regex_matched"].([]string)[1]
-		info, ok := infoMap[match]
+		d := decks.of(ctx.Event.GroupID)
+		info, ok := d.infos[match]
 		if ok {
-			imgurl := bed + info.ImgURL
 			var tarotmsg message.Message
-			imgmsg, err := poolimg(ctx, imgurl, match, cache)
+			imgmsg, err := d.image(ctx, card{Name: match, cardInfo: info}, 0, cache)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -225,16 +240,7 @@ func init() {
 			}
 			return
 		}
-		var build strings.Builder
-		build.WriteString("塔罗牌列表\n大阿尔卡纳:\n")
-		build.WriteString(strings.Join(majorArcanaName[:7], " "))
-		build.WriteString("\n")
-		build.WriteString(strings.Join(majorArcanaName[7:14], " "))
-		build.WriteString("\n")
-		build.WriteString(strings.Join(majorArcanaName[14:22], " "))
-		build.WriteString("\n小阿尔卡纳:\n[圣杯|星币|宝剑|权杖] [0-10|侍从|骑士|王后|国王]")
-		txt := build.String()
-		cardList, err := text.RenderToBase64(txt, text.FontFile, 420, 20)
+		cardList, err := text.RenderToBase64(d.cardList(), text.FontFile, 420, 20)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
@@ -244,79 +250,194 @@ func init() {
 	engine.OnRegex(`^((塔罗|大阿(尔)?卡纳)|小阿(尔)?卡纳|混合)牌阵\s?(.*)`, getTarot).SetBlock(true).Limit(ctxext.LimitByGroup).Handle(func(ctx *zero.Ctx) {
 		cardType := ctx.State["regex_matched"].([]string)[1]
 		match := ctx.State["regex_matched"].([]string)[5]
-		info, ok := formationMap[match]
-		position := [...]string{"『正位』", "『逆位』"}
-		reverse := [...]string{"", "Reverse/"}
-		start, length := 0, 22
-		if strings.Contains(cardType, "小") {
-			start = 22
-			length = 55
-		} else if cardType == "混合" {
-			start = 0
-			length = 77
+		d := decks.of(ctx.Event.GroupID)
+		info, ok := d.formations[match]
+		if !ok {
+			ctx.SendChain(message.Text("没有找到", match, "噢~\n现有牌阵列表: \n", strings.Join(d.formationName, "\n")))
+			return
 		}
-		if ok {
-			ctx.SendChain(message.Text("少女祈祷中..."))
-			var build strings.Builder
-			build.WriteString(ctx.CardOrNickName(ctx.Event.UserID))
-			build.WriteString("---")
-			build.WriteString(match)
-			build.WriteString("\n")
-			msg := make(message.Message, info.CardsNum+1)
-			randomIntMap := make(map[int]int, 30)
-			for i := 0; i < info.CardsNum; i++ {
-				j := rand.Intn(length)
-				_, ok := randomIntMap[j]
-				for ok {
-					j = rand.Intn(length)
-					_, ok = randomIntMap[j]
-				}
-				randomIntMap[j] = 0
-				p := rand.Intn(2)
-				card := cardMap[strconv.Itoa(j+start)]
-				name := card.Name
-				description := card.Description
-				if p == 1 {
-					description = card.ReverseDescription
-				}
-				var tarotmsg message.Message
-				imgurl := bed + reverse[p] + card.ImgURL
-				var imgmsg message.MessageSegment
-				var err error
-				if p == 1 {
-					imgmsg, err = poolimg(ctx, imgurl, reverse[p][:len(reverse[p])-1]+name, cache)
-				} else {
-					imgmsg, err = poolimg(ctx, imgurl, name, cache)
-				}
-				if err != nil {
-					ctx.SendChain(message.Text("ERROR: ", err))
-					return
-				}
-				tarotmsg = append(tarotmsg, imgmsg)
-				build.WriteString(info.Represent[0][i])
-				build.WriteString(":")
-				build.WriteString(position[p])
-				build.WriteString("的『")
-				build.WriteString(name)
-				build.WriteString("』\n其释义为: \n")
-				build.WriteString(description)
-				build.WriteString("\n")
-				msg[i] = ctxext.FakeSenderForwardNode(ctx, tarotmsg...)
+		start, length, err := d.span(cardType)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if info.CardsNum > length {
+			ctx.SendChain(message.Text("ERROR: ", errTooManyDraw))
+			return
+		}
+		ctx.SendChain(message.Text("少女祈祷中..."))
+		var build strings.Builder
+		build.WriteString(ctx.CardOrNickName(ctx.Event.UserID))
+		build.WriteString("---")
+		build.WriteString(match)
+		build.WriteString("\n")
+		msg := make(message.Message, info.CardsNum+1)
+		drawn := make([]string, info.CardsNum)
+		for i, j := range rand.Perm(length)[:info.CardsNum] {
+			p := rand.Intn(2)
+			card := d.cards[strconv.Itoa(j+start)]
+			description := card.Description
+			if p == 1 {
+				description = card.ReverseDescription
 			}
-			txt := build.String()
-			formation, err := text.RenderToBase64(txt, text.FontFile, 420, 20)
+			imgmsg, err := d.image(ctx, card, p, cache)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			msg[info.CardsNum] = ctxext.FakeSenderForwardNode(ctx, message.Message{message.Image("base64://" + binary.BytesToString(formation))}...)
-			if id := ctx.Send(msg).ID(); id == 0 {
-				ctx.SendChain(message.Text("ERROR: 可能被风控了"))
-			}
-		} else {
-			ctx.SendChain(message.Text("没有找到", match, "噢~\n现有牌阵列表: \n", strings.Join(formationName, "\n")))
+			build.WriteString(info.Represent[0][i])
+			build.WriteString(":")
+			build.WriteString(position[p])
+			build.WriteString("的『")
+			build.WriteString(card.Name)
+			build.WriteString("』\n其释义为: \n")
+			build.WriteString(description)
+			build.WriteString("\n")
+			msg[i] = ctxext.FakeSenderForwardNode(ctx, imgmsg)
+			drawn[i] = info.Represent[0][i] + ": " + position[p] + card.Name
+		}
+		txt := build.String()
+		formation, err := text.RenderToBase64(txt, text.FontFile, 420, 20)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		msg[info.CardsNum] = ctxext.FakeSenderForwardNode(ctx, message.Message{message.Image("base64://" + binary.BytesToString(formation))}...)
+		if id := ctx.Send(msg).ID(); id == 0 {
+			ctx.SendChain(message.Text("ERROR: 可能被风控了"))
+			return
+		}
+		record(ctx, d, match, drawn...)
+	})
+
+	engine.OnFullMatch("我的塔罗记录", getTarot).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		rs, err := db.records(ctx.Event.UserID, 10)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if len(rs) == 0 {
+			ctx.SendChain(message.Text("你还没有抽过塔罗牌噢~"))
+			return
+		}
+		var build strings.Builder
+		build.WriteString(ctx.CardOrNickName(ctx.Event.UserID))
+		build.WriteString("的塔罗记录\n")
+		for _, r := range rs {
+			build.WriteString("\n")
+			build.WriteString(time.Unix(0, r.ID).Format("2006-01-02 15:04"))
+			build.WriteString(" [")
+			build.WriteString(r.Deck)
+			build.WriteString("] ")
+			build.WriteString(r.Kind)
+			build.WriteString("\n")
+			build.WriteString(r.Cards)
+			build.WriteString("\n")
+		}
+		journal, err := text.RenderToBase64(build.String(), text.FontFile, 420, 20)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Image("base64://" + binary.BytesToString(journal)))
+	})
+
+	engine.OnFullMatch("塔罗牌组列表", getTarot).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		ctx.SendChain(message.Text("当前牌组: ", decks.of(ctx.Event.GroupID).name, "\n可用牌组: \n", strings.Join(decks.names(), "\n")))
+	})
+	engine.OnPrefix("设置塔罗牌组", zero.OnlyGroup, zero.AdminPermission, getTarot).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		name := strings.TrimSpace(ctx.State["args"].(string))
+		if _, ok := decks.get(name); !ok {
+			ctx.SendChain(message.Text("没有找到牌组", name, "噢~\n可用牌组: \n", strings.Join(decks.names(), "\n")))
+			return
+		}
+		if name == defaultDeck {
+			name = ""
+		}
+		err := db.setGroupDeck(ctx.Event.GroupID, name)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("成功"))
+	})
+	engine.OnFullMatch("重置塔罗牌组", zero.OnlyGroup, zero.AdminPermission, getTarot).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		err := db.setGroupDeck(ctx.Event.GroupID, "")
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
 		}
+		ctx.SendChain(message.Text("成功"))
 	})
+	engine.OnRegex(`^安装塔罗牌组\s*(\S+)\s+(.+)$`, zero.SuperUserPermission, getTarot).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		name := ctx.State["regex_matched"].([]string)[1]
+		if name == defaultDeck {
+			ctx.SendChain(message.Text("ERROR: 不能覆盖默认牌组"))
+			return
+		}
+		dir, err := filepath.Abs(strings.TrimSpace(ctx.State["regex_matched"].([]string)[2]))
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		def, _ := decks.get(defaultDeck)
+		d, err := loadDeck(name, dir, def)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		err = db.addDeck(name, dir)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		decks.set(d)
+		ctx.SendChain(message.Text("成功安装牌组", name, ", 共", len(d.cards), "张牌, ", len(d.formations), "组牌阵"))
+	})
+	engine.OnPrefix("卸载塔罗牌组", zero.SuperUserPermission, getTarot).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		name := strings.TrimSpace(ctx.State["args"].(string))
+		if _, ok := decks.get(name); !ok || name == defaultDeck {
+			ctx.SendChain(message.Text("没有找到可卸载的牌组", name, "噢~"))
+			return
+		}
+		err := db.delDeck(name)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		decks.del(name)
+		ctx.SendChain(message.Text("成功"))
+	})
+}
+
+// record 记录一次抽牌, 失败时只记录日志
+func record(ctx *zero.Ctx, d *deck, kind string, cards ...string) {
+	err := db.addRecord(&drawRecord{
+		GroupID: ctx.Event.GroupID,
+		UserID:  ctx.Event.UserID,
+		Deck:    d.name,
+		Kind:    kind,
+		Cards:   strings.Join(cards, "\n"),
+	})
+	if err != nil {
+		logrus.Warnln("[tarot]记录抽牌失败:", err)
+	}
+}
+
+// image 牌的图片, 本地牌组直接读取文件, 默认牌组从图床下载并缓存
+func (d *deck) image(ctx *zero.Ctx, c card, p int, cache string) (message.MessageSegment, error) {
+	if d.dir != "" {
+		path, err := d.localImage(c, p)
+		if err != nil {
+			return message.MessageSegment{}, err
+		}
+		return message.Image("file:///" + path), nil
+	}
+	imgname := c.Name
+	if p == 1 {
+		imgname = reverse[p][:len(reverse[p])-1] + c.Name
+	}
+	return poolimg(ctx, bed+reverse[p]+c.ImgURL, imgname, cache)
 }
 
 func poolimg(ctx *zero.Ctx, imgurl, imgname, cache string) (msg message.MessageSegment, err error) {
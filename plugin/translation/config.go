@@ -0,0 +1,172 @@
+package translation
+
+import (
+	"strings"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/translation/translator"
+)
+
+func init() {
+	engine.OnFullMatch("翻译引擎列表", getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			cur := tdb.group(ctx.Event.GroupID).Engine
+			def := tdb.getSetting(settingDefault, defaultEngine)
+			sb := strings.Builder{}
+			sb.WriteString("可用的翻译引擎:")
+			for _, n := range translator.Names() {
+				sb.WriteString("\n- " + n)
+				if strings.EqualFold(n, def) {
+					sb.WriteString(" (默认)")
+				}
+				if strings.EqualFold(n, cur) {
+					sb.WriteString(" (本群)")
+				}
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnRegex(`^设置翻译引擎\s*(\S+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			t, ok := translator.Lookup(ctx.State["regex_matched"].([]string)[1])
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 没有这个引擎, 发送\"翻译引擎列表\"查看"))
+				return
+			}
+			g := tdb.group(ctx.Event.GroupID)
+			g.Engine = t.Name()
+			err := tdb.setGroup(g)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("本群的翻译引擎已设置为", t.Name()))
+		})
+	engine.OnRegex(`^设置默认翻译引擎\s*(\S+)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			t, ok := translator.Lookup(ctx.State["regex_matched"].([]string)[1])
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 没有这个引擎, 发送\"翻译引擎列表\"查看"))
+				return
+			}
+			err := tdb.setSetting(settingDefault, t.Name())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("默认翻译引擎已设置为", t.Name()))
+		})
+	engine.OnRegex(`^设置LibreTranslate地址\s*(https?://\S+)\s*(\S*)$`, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			err := tdb.setSetting(settingLibreURL, args[1])
+			if err == nil {
+				err = tdb.setSetting(settingLibreKey, args[2])
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			translator.Register(&translator.LibreTranslate{URL: args[1], APIKey: args[2]})
+			ctx.SendChain(message.Text("已设置LibreTranslate地址, 发送\"设置翻译引擎libretranslate\"启用"))
+		})
+	engine.OnRegex(`^(开启|关闭)自动翻译$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			g := tdb.group(ctx.Event.GroupID)
+			g.Auto = ctx.State["regex_matched"].([]string)[1] == "开启"
+			if g.Auto && g.Langs == "" {
+				g.Langs = "en ja ko"
+			}
+			err := tdb.setGroup(g)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !g.Auto {
+				ctx.SendChain(message.Text("已关闭自动翻译"))
+				return
+			}
+			ctx.SendChain(message.Text("已开启自动翻译, 将", langnames(g.Langs), "的消息译为", langname(g.Target)))
+		})
+	engine.OnRegex(`^设置自动翻译语言\s*(.+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			var codes []string
+			for _, s := range strings.FieldsFunc(ctx.State["regex_matched"].([]string)[1], func(r rune) bool {
+				return r == ' ' || r == ',' || r == '，' || r == '、'
+			}) {
+				c, ok := translator.Code(s)
+				if !ok {
+					ctx.SendChain(message.Text("ERROR: 不支持的语言", s))
+					return
+				}
+				codes = append(codes, c)
+			}
+			g := tdb.group(ctx.Event.GroupID)
+			g.Langs = strings.Join(codes, " ")
+			err := tdb.setGroup(g)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("自动翻译语言: ", langnames(g.Langs)))
+		})
+	engine.OnRegex(`^设置自动翻译目标\s*(\S+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c, ok := translator.Code(ctx.State["regex_matched"].([]string)[1])
+			if !ok {
+				ctx.SendChain(message.Text("ERROR: 不支持的语言"))
+				return
+			}
+			g := tdb.group(ctx.Event.GroupID)
+			g.Target = c
+			err := tdb.setGroup(g)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("自动翻译目标: ", langname(c)))
+		})
+	engine.OnRegex(`^(添加|删除)术语\s*(.+)$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			t := strings.TrimSpace(args[2])
+			var (
+				ok  bool
+				err error
+			)
+			if args[1] == "添加" {
+				ok, err = tdb.addTerm(ctx.Event.GroupID, t)
+			} else {
+				ok, err = tdb.delTerm(ctx.Event.GroupID, t)
+			}
+			switch {
+			case err != nil:
+				ctx.SendChain(message.Text("ERROR: ", err))
+			case !ok && args[1] == "添加":
+				ctx.SendChain(message.Text("术语已存在"))
+			case !ok:
+				ctx.SendChain(message.Text("没有这个术语"))
+			default:
+				ctx.SendChain(message.Text("已", args[1], "术语: ", t))
+			}
+		})
+	engine.OnFullMatch("查看术语", zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			ts := tdb.glossary(ctx.Event.GroupID)
+			if len(ts) == 0 {
+				ctx.SendChain(message.Text("本群还没有术语"))
+				return
+			}
+			ctx.SendChain(message.Text("本群术语 (翻译时保持原样):\n", strings.Join(ts, "\n")))
+		})
+}
+
+// langnames 空格分隔的语言代码转为名称
+func langnames(codes string) string {
+	fs := strings.Fields(codes)
+	for i, c := range fs {
+		fs[i] = langname(c)
+	}
+	return strings.Join(fs, "、")
+}
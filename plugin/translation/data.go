@@ -0,0 +1,184 @@
+package translation
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	groupTable    = "groupcfg"
+	glossaryTable = "glossary"
+	settingTable  = "setting"
+)
+
+// group 群的翻译设置
+type group struct {
+	GroupID int64  `db:"gid"`
+	Engine  string `db:"engine"` // Engine 为空时使用默认引擎
+	Auto    bool   `db:"auto"`   // Auto 自动翻译外语消息
+	Langs   string `db:"langs"`  // Langs 需要自动翻译的语言代码, 空格分隔
+	Target  string `db:"target"` // Target 自动翻译的目标语言
+}
+
+// autolang 该语言是否需要自动翻译
+func (g *group) autolang(lang string) bool {
+	for _, l := range strings.Fields(g.Langs) {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// term 群内不翻译的术语
+type term struct {
+	ID      string `db:"id"` // ID 群号/术语
+	GroupID int64  `db:"gid"`
+	Term    string `db:"term"`
+}
+
+// setting 全局设置
+type setting struct {
+	Name  string `db:"name"`
+	Value string `db:"value"`
+}
+
+const (
+	settingDefault    = "default"
+	settingLibreURL   = "libreurl"
+	settingLibreKey   = "librekey"
+	defaultEngine     = "cloolc"
+	defaultAutoTarget = "zh"
+)
+
+var tdb = &tldb{groups: map[int64]*group{}, terms: map[int64][]string{}}
+
+// tldb 翻译设置与术语表, 群设置与术语缓存在内存中供自动翻译使用
+type tldb struct {
+	sync.RWMutex
+	sql.Sqlite
+	groups map[int64]*group
+	terms  map[int64][]string
+}
+
+func (tdb *tldb) init(dbpath string) error {
+	tdb.DBPath = dbpath
+	err := tdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = tdb.Create(groupTable, &group{})
+	if err != nil {
+		return err
+	}
+	err = tdb.Create(glossaryTable, &term{})
+	if err != nil {
+		return err
+	}
+	err = tdb.Create(settingTable, &setting{})
+	if err != nil {
+		return err
+	}
+	gs, err := sql.FindAll[group](&tdb.Sqlite, groupTable, "")
+	if err != nil && err != sql.ErrNullResult {
+		return err
+	}
+	for _, g := range gs {
+		tdb.groups[g.GroupID] = g
+	}
+	ts, err := sql.FindAll[term](&tdb.Sqlite, glossaryTable, "ORDER BY id")
+	if err != nil && err != sql.ErrNullResult {
+		return err
+	}
+	for _, t := range ts {
+		tdb.terms[t.GroupID] = append(tdb.terms[t.GroupID], t.Term)
+	}
+	return nil
+}
+
+// group 群设置的副本, 未设置时返回默认值
+func (tdb *tldb) group(gid int64) group {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	if g, ok := tdb.groups[gid]; ok {
+		return *g
+	}
+	return group{GroupID: gid, Target: defaultAutoTarget}
+}
+
+func (tdb *tldb) setGroup(g group) error {
+	tdb.Lock()
+	defer tdb.Unlock()
+	err := tdb.Insert(groupTable, &g)
+	if err != nil {
+		return err
+	}
+	tdb.groups[g.GroupID] = &g
+	return nil
+}
+
+// glossary 群术语表的副本
+func (tdb *tldb) glossary(gid int64) []string {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	return append([]string(nil), tdb.terms[gid]...)
+}
+
+// addTerm 添加术语, 已存在时返回 false
+func (tdb *tldb) addTerm(gid int64, t string) (bool, error) {
+	tdb.Lock()
+	defer tdb.Unlock()
+	for _, x := range tdb.terms[gid] {
+		if x == t {
+			return false, nil
+		}
+	}
+	err := tdb.Insert(glossaryTable, &term{ID: strconv.FormatInt(gid, 10) + "/" + t, GroupID: gid, Term: t})
+	if err != nil {
+		return false, err
+	}
+	tdb.terms[gid] = append(tdb.terms[gid], t)
+	return true, nil
+}
+
+// delTerm 删除术语, 不存在时返回 false
+func (tdb *tldb) delTerm(gid int64, t string) (bool, error) {
+	tdb.Lock()
+	defer tdb.Unlock()
+	ts := tdb.terms[gid]
+	for i, x := range ts {
+		if x == t {
+			err := tdb.Del(glossaryTable, "WHERE id = "+quote(strconv.FormatInt(gid, 10)+"/"+t))
+			if err != nil {
+				return false, err
+			}
+			tdb.terms[gid] = append(ts[:i:i], ts[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (tdb *tldb) getSetting(name, def string) string {
+	tdb.RLock()
+	defer tdb.RUnlock()
+	s := &setting{}
+	if tdb.Find(settingTable, s, "WHERE name = "+quote(name)) != nil {
+		return def
+	}
+	return s.Value
+}
+
+func (tdb *tldb) setSetting(name, value string) error {
+	tdb.Lock()
+	defer tdb.Unlock()
+	return tdb.Insert(settingTable, &setting{Name: name, Value: value})
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
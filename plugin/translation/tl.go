@@ -2,27 +2,177 @@
 package translation
 
 import (
-	"github.com/FloatTech/AnimeAPI/tl"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	fcext "github.com/FloatTech/floatbox/ctxext"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/translation/translator"
 )
 
+// autominlen 自动翻译的最短消息长度
+const autominlen = 4
+
+var engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	DisableOnDefault: false,
+	Brief:            "单词翻译",
+	Help: "- >TL [好|good]\n" +
+		"- >TL -日语 你好 (指定目标语言)\n" +
+		"- (回复一条消息) 翻译[成日语]\n" +
+		"- 翻译引擎列表\n" +
+		"- 设置翻译引擎[cloolc|mymemory|libretranslate] (群管理员, 本群使用的引擎)\n" +
+		"- [开启|关闭]自动翻译 (群管理员, 自动翻译群内的外语消息)\n" +
+		"- 设置自动翻译语言[日语 英语...]\n" +
+		"- 设置自动翻译目标[中文]\n" +
+		"- [添加|删除]术语[xxx] (术语在翻译时保持原样)\n" +
+		"- 查看术语\n" +
+		"- 设置默认翻译引擎[xxx] (超级用户)\n" +
+		"- 设置LibreTranslate地址[http://127.0.0.1:5000] [api_key] (超级用户, 自建或兼容的服务)\n" +
+		"注: 未指定源语言时自动检测, 中文默认译为英语, 其余译为中文; 引擎不支持时依次尝试其它引擎",
+	PrivateDataFolder: "translation",
+})
+
+var getdb = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+	err := tdb.init(engine.DataFolder() + "translation.db")
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return false
+	}
+	if u := tdb.getSetting(settingLibreURL, ""); u != "" {
+		translator.Register(&translator.LibreTranslate{URL: u, APIKey: tdb.getSetting(settingLibreKey, "")})
+	}
+	return true
+})
+
 func init() {
-	control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault: false,
-		Brief:            "单词翻译",
-		Help:             ">TL [好|good]",
-	}).OnRegex(`^>TL\s(-.{1,10}? )?(.*)$`).SetBlock(true).Limit(ctxext.LimitByUser).
+	engine.OnRegex(`^>TL\s(-.{1,10}? )?(.*)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
-			msg := []string{ctx.State["regex_matched"].([]string)[2]}
-			data, err := tl.Translate(msg[0])
+			args := ctx.State["regex_matched"].([]string)
+			to := ""
+			if args[1] != "" {
+				var ok bool
+				to, ok = translator.Code(strings.TrimPrefix(strings.TrimSpace(args[1]), "-"))
+				if !ok {
+					ctx.SendChain(message.Text("ERROR: 不支持的语言", args[1]))
+					return
+				}
+			}
+			out, _, err := translate(ctx.Event.GroupID, args[2], to)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text(out))
+		})
+	// 回复一条消息翻译其文字内容
+	engine.OnRegex(`^\[CQ:reply,id=(-?\d+)\][\s\S]*?翻译(?:成|为|到)?\s*(\S*)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			to := ""
+			if args[2] != "" {
+				var ok bool
+				to, ok = translator.Code(args[2])
+				if !ok {
+					ctx.SendChain(message.Text("ERROR: 不支持的语言", args[2]))
+					return
+				}
+			}
+			id, _ := strconv.ParseInt(args[1], 10, 64)
+			text := strings.TrimSpace(ctx.GetMessage(id).Elements.ExtractPlainText())
+			if text == "" {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("ERROR: 这条消息没有文字"))
+				return
+			}
+			out, from, err := translate(ctx.Event.GroupID, text, to)
 			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", data))
+				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			ctx.SendChain(message.Text(data))
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(out, "\n(", langname(from), "→", langname(to, from), ")"))
 		})
+	engine.OnMessage(zero.OnlyGroup, getdb, autotranslatable).SetBlock(false).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			g := tdb.group(ctx.Event.GroupID)
+			out, from, err := translate(ctx.Event.GroupID, ctx.State["tl_text"].(string), g.Target)
+			if err != nil || out == "" {
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(out, "\n(", langname(from), "→", langname(g.Target), ")"))
+		})
+}
+
+// autotranslatable 群开启了自动翻译, 且消息为需要翻译的语言
+func autotranslatable(ctx *zero.Ctx) bool {
+	if ctx.Event.UserID == ctx.Event.SelfID {
+		return false
+	}
+	g := tdb.group(ctx.Event.GroupID)
+	if !g.Auto {
+		return false
+	}
+	text := strings.TrimSpace(ctx.ExtractPlainText())
+	if utf8.RuneCountInString(text) < autominlen || strings.HasPrefix(text, ">") || strings.HasPrefix(text, "/") {
+		return false
+	}
+	lang := translator.Detect(text)
+	if lang == "" || lang == g.Target || !g.autolang(lang) {
+		return false
+	}
+	ctx.State["tl_text"] = text
+	return true
+}
+
+// langname 语言名称, lang 为空时取 def 的默认目标语言
+func langname(lang string, def ...string) string {
+	if lang == "" && len(def) > 0 {
+		lang = translator.Target(def[0])
+	}
+	if n, ok := translator.Languages[lang]; ok {
+		return n
+	}
+	if lang == translator.Auto {
+		return "自动"
+	}
+	return lang
+}
+
+// engines 群使用的引擎在前, 其余引擎作为备选
+func engines(gid int64) []translator.Translator {
+	first := tdb.group(gid).Engine
+	if first == "" {
+		first = tdb.getSetting(settingDefault, defaultEngine)
+	}
+	ts := make([]translator.Translator, 0, 4)
+	if t, ok := translator.Lookup(first); ok {
+		ts = append(ts, t)
+	}
+	for _, n := range translator.Names() {
+		if !strings.EqualFold(n, first) {
+			t, _ := translator.Lookup(n)
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// translate 用群的引擎与术语表翻译, 引擎不支持该语言时换下一个
+func translate(gid int64, text, to string) (out, from string, err error) {
+	glossary := tdb.glossary(gid)
+	for _, t := range engines(gid) {
+		out, from, err = translator.Translate(t, text, translator.Auto, to, glossary)
+		if err == nil || !errors.Is(err, translator.ErrUnsupported) {
+			return
+		}
+	}
+	if err == nil {
+		err = errors.New("没有可用的翻译引擎")
+	}
+	return
 }
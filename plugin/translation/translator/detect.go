@@ -0,0 +1,83 @@
+package translator
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latinwords 常见的虚词, 用于区分使用拉丁字母的语言
+var latinwords = map[string][]string{
+	"fr": {"le", "la", "les", "est", "et", "un", "une", "je", "vous", "pas", "que", "de", "du", "c'est", "merci", "bonjour"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "ein", "eine", "zu", "mit", "sie", "danke", "ja", "nein"},
+	"es": {"el", "los", "las", "es", "y", "que", "no", "por", "una", "con", "para", "gracias", "hola", "muy"},
+	"en": {"the", "is", "and", "a", "an", "to", "of", "in", "it", "you", "i", "not", "that", "this", "are", "what"},
+}
+
+// Detect 按文字的书写系统检测语言, 无法判断时返回空字符串
+//
+// 含假名为日语, 含谚文为韩语, 其余汉字为中文, 西里尔字母为俄语,
+// 拉丁字母再按常见虚词区分英法德西, 默认英语
+func Detect(text string) string {
+	var han, kana, hangul, cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r) && r != 'ー' && r != '・':
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	switch {
+	case kana > 0:
+		return "ja"
+	case hangul > 0 && hangul >= han:
+		return "ko"
+	case han > 0 && han*2 >= latin:
+		return "zh"
+	case cyrillic > 0 && cyrillic >= latin:
+		return "ru"
+	case latin > 0:
+		return detectlatin(text)
+	}
+	return ""
+}
+
+// detectlatin 统计常见虚词与特有字母, 取得分最高的语言
+func detectlatin(text string) string {
+	lower := strings.ToLower(text)
+	score := map[string]int{}
+	for _, w := range strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for l, ws := range latinwords {
+			for _, x := range ws {
+				if w == x {
+					score[l]++
+				}
+			}
+		}
+	}
+	for _, r := range lower {
+		switch r {
+		case 'ß', 'ä', 'ö', 'ü':
+			score["de"] += 2
+		case 'ñ', '¿', '¡':
+			score["es"] += 2
+		case 'ç', 'è', 'ê', 'à', 'œ':
+			score["fr"] += 2
+		}
+	}
+	best, max := "en", 0
+	for _, l := range []string{"en", "fr", "de", "es"} {
+		if score[l] > max {
+			best, max = l, score[l]
+		}
+	}
+	return best
+}
@@ -0,0 +1,154 @@
+package translator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Cloolc 原有的中英互译接口, 只能自动判断方向
+type Cloolc struct {
+	Client *http.Client
+	URL    string
+}
+
+// NewCloolc 默认配置
+func NewCloolc() *Cloolc {
+	return &Cloolc{URL: "http://api.cloolc.club/fanyi"}
+}
+
+// Name cloolc
+func (*Cloolc) Name() string { return "cloolc" }
+
+// Translate 只支持中英互译
+func (c *Cloolc) Translate(text, from, to string) (string, error) {
+	if (to != "zh" && to != "en") || (from != Auto && from != "zh" && from != "en") {
+		return "", ErrUnsupported
+	}
+	data, err := get(c.Client, c.URL+"?data="+url.QueryEscape(text))
+	if err != nil {
+		return "", err
+	}
+	ms := gjson.GetBytes(data, "translation").Array()
+	ss := make([]string, 0, len(ms))
+	for _, m := range ms {
+		ss = append(ss, m.String())
+	}
+	return strings.Join(ss, ", "), nil
+}
+
+// LibreTranslate 兼容 LibreTranslate 的接口, 可以自建
+type LibreTranslate struct {
+	Client *http.Client
+	URL    string // URL 服务地址, 如 http://127.0.0.1:5000
+	APIKey string
+}
+
+// Name libretranslate
+func (*LibreTranslate) Name() string { return "libretranslate" }
+
+func (l *LibreTranslate) call(path string, body map[string]string) ([]byte, error) {
+	if l.APIKey != "" {
+		body["api_key"] = l.APIKey
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	data, err := post(l.Client, strings.TrimSuffix(l.URL, "/")+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		if e := gjson.GetBytes(data, "error").String(); e != "" {
+			return nil, &Error{Engine: l.Name(), Msg: e}
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Translate 翻译
+func (l *LibreTranslate) Translate(text, from, to string) (string, error) {
+	data, err := l.call("/translate", map[string]string{
+		"q":      text,
+		"source": from,
+		"target": to,
+		"format": "text",
+	})
+	if err != nil {
+		return "", err
+	}
+	return gjson.GetBytes(data, "translatedText").String(), nil
+}
+
+// Detect 检测语言, 取置信度最高的结果
+func (l *LibreTranslate) Detect(text string) (string, error) {
+	data, err := l.call("/detect", map[string]string{"q": text})
+	if err != nil {
+		return "", err
+	}
+	lang := gjson.GetBytes(data, "0.language").String()
+	if lang == "" {
+		return "", ErrEmptyResult
+	}
+	return lang, nil
+}
+
+// MyMemory MyMemory 的免费接口, 需要明确的源语言
+type MyMemory struct {
+	Client *http.Client
+	URL    string
+	Email  string // Email 填写后每日额度更高
+}
+
+// NewMyMemory 默认配置
+func NewMyMemory() *MyMemory {
+	return &MyMemory{URL: "https://api.mymemory.translated.net/get"}
+}
+
+// Name mymemory
+func (*MyMemory) Name() string { return "mymemory" }
+
+// Translate 翻译
+func (m *MyMemory) Translate(text, from, to string) (string, error) {
+	if from == Auto {
+		return "", ErrUnsupported
+	}
+	q := url.Values{"q": {text}, "langpair": {mymemorycode(from) + "|" + mymemorycode(to)}}
+	if m.Email != "" {
+		q.Set("de", m.Email)
+	}
+	data, err := get(m.Client, m.URL+"?"+q.Encode())
+	if err != nil {
+		return "", err
+	}
+	r := gjson.ParseBytes(data)
+	if s := r.Get("responseStatus").Int(); s != 0 && s != 200 {
+		return "", &Error{Engine: m.Name(), Msg: r.Get("responseDetails").String()}
+	}
+	return r.Get("responseData.translatedText").String(), nil
+}
+
+func mymemorycode(l string) string {
+	if l == "zh" {
+		return "zh-CN"
+	}
+	return l
+}
+
+// Error 引擎返回的错误信息
+type Error struct {
+	Engine string
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return e.Engine + ": " + e.Msg
+}
+
+func init() {
+	Register(NewCloolc())
+	Register(NewMyMemory())
+}
@@ -0,0 +1,83 @@
+package translator
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// placeholderre 匹配占位符, 引擎可能在其中插入空格
+var placeholderre = regexp.MustCompile(`_\s*_\s*(\d+)\s*_\s*_`)
+
+// Protect 将术语替换为占位符, 返回替换后的文本与还原函数
+//
+// 较长的术语优先匹配, 避免术语互相包含时只替换了一部分
+func Protect(text string, terms []string) (string, func(string) string) {
+	ts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if t != "" && strings.Contains(text, t) {
+			ts = append(ts, t)
+		}
+	}
+	if len(ts) == 0 {
+		return text, func(s string) string { return s }
+	}
+	sort.SliceStable(ts, func(i, j int) bool {
+		return len(ts[i]) > len(ts[j])
+	})
+	pairs := make([]string, 0, len(ts)*2)
+	for i, t := range ts {
+		pairs = append(pairs, t, " __"+strconv.Itoa(i)+"__ ")
+	}
+	masked := strings.NewReplacer(pairs...).Replace(text)
+	return strings.TrimSpace(masked), func(s string) string {
+		return restore(s, ts)
+	}
+}
+
+// restore 将占位符还原为术语. 占位符两侧的空格只在术语与相邻文字都不是中日韩文字时保留
+func restore(s string, terms []string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range placeholderre.FindAllStringSubmatchIndex(s, -1) {
+		i, err := strconv.Atoi(s[m[2]:m[3]])
+		if err != nil || i >= len(terms) {
+			continue
+		}
+		t := terms[i]
+		sb.WriteString(s[last:m[0]])
+		before := strings.TrimRightFunc(sb.String(), unicode.IsSpace)
+		spaced := len(before) < sb.Len()
+		if spaced {
+			r, _ := utf8.DecodeLastRuneInString(before)
+			first, _ := utf8.DecodeRuneInString(t)
+			sb.Reset()
+			sb.WriteString(before)
+			if before != "" && !wide(r) && !wide(first) && r != '(' && r != '[' {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(t)
+		last = m[1]
+		// 跳过占位符后的空格, 需要时补回一个
+		rest := strings.TrimLeftFunc(s[last:], unicode.IsSpace)
+		if len(rest) < len(s[last:]) {
+			r, _ := utf8.DecodeRuneInString(rest)
+			end, _ := utf8.DecodeLastRuneInString(t)
+			if rest != "" && !wide(r) && !wide(end) && (!unicode.IsPunct(r) || r == '(' || r == '[') {
+				sb.WriteByte(' ')
+			}
+			last = len(s) - len(rest)
+		}
+	}
+	sb.WriteString(s[last:])
+	return strings.TrimSpace(sb.String())
+}
+
+// wide 中日韩文字与全角标点
+func wide(r rune) bool {
+	return r >= 0x2E80 && r <= 0x9FFF || r >= 0xAC00 && r <= 0xD7AF || r >= 0xFF00 && r <= 0xFFEF || r >= 0x3000 && r <= 0x303F
+}
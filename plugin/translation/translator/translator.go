@@ -0,0 +1,186 @@
+// Package translator 翻译引擎与语言检测
+package translator
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Auto 自动检测源语言
+const Auto = "auto"
+
+var (
+	// ErrUnsupported 引擎不支持该语言
+	ErrUnsupported = errors.New("引擎不支持该语言")
+	// ErrEmptyResult 引擎没有返回译文
+	ErrEmptyResult = errors.New("引擎没有返回译文")
+)
+
+// Translator 翻译引擎
+type Translator interface {
+	// Name 引擎名
+	Name() string
+	// Translate 将 text 从 from 翻译为 to, from 可以为 Auto
+	Translate(text, from, to string) (string, error)
+}
+
+// Detector 能检测语言的引擎
+type Detector interface {
+	Detect(text string) (string, error)
+}
+
+// Languages 支持的语言代码与名称
+var Languages = map[string]string{
+	"zh": "中文",
+	"en": "英语",
+	"ja": "日语",
+	"ko": "韩语",
+	"ru": "俄语",
+	"fr": "法语",
+	"de": "德语",
+	"es": "西班牙语",
+}
+
+// Code 由语言名称或代码得到语言代码, 如 日语 日文 日 ja
+func Code(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, ok := Languages[s]; ok {
+		return s, true
+	}
+	for c, n := range Languages {
+		short := strings.TrimSuffix(strings.TrimSuffix(n, "语"), "文")
+		if s == n || s == short || s == short+"文" || s == short+"语" {
+			return c, true
+		}
+	}
+	switch s {
+	case "汉语", "简体中文", "zh-cn", "chinese":
+		return "zh", true
+	case "english":
+		return "en", true
+	case "japanese":
+		return "ja", true
+	}
+	return "", false
+}
+
+var (
+	mu          sync.RWMutex
+	translators = map[string]Translator{}
+)
+
+// Register 注册引擎, 同名时替换
+func Register(t Translator) {
+	mu.Lock()
+	defer mu.Unlock()
+	translators[t.Name()] = t
+}
+
+// Unregister 移除引擎
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(translators, name)
+}
+
+// Lookup 按名称查找引擎, 不区分大小写
+func Lookup(name string) (Translator, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for n, t := range translators {
+		if strings.EqualFold(n, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Names 已注册的引擎名
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	ns := make([]string, 0, len(translators))
+	for n := range translators {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// Target 未指定目标语言时, 中文译为英语, 其余译为中文
+func Target(from string) string {
+	if from == "zh" {
+		return "en"
+	}
+	return "zh"
+}
+
+// Translate 保护术语后用 t 翻译, from 为 Auto 时先检测语言. 返回译文与源语言
+func Translate(t Translator, text, from, to string, glossary []string) (string, string, error) {
+	if from == "" || from == Auto {
+		from = Detect(text)
+		if d, ok := t.(Detector); ok && from == "" {
+			if l, err := d.Detect(text); err == nil {
+				from = l
+			}
+		}
+		if from == "" {
+			from = Auto
+		}
+	}
+	if to == "" {
+		to = Target(from)
+	}
+	if from == to {
+		return text, from, nil
+	}
+	masked, restore := Protect(text, glossary)
+	out, err := t.Translate(masked, from, to)
+	if err != nil {
+		return "", from, err
+	}
+	if strings.TrimSpace(out) == "" {
+		return "", from, ErrEmptyResult
+	}
+	return restore(out), from, nil
+}
+
+// post 发送 POST 请求
+func post(client *http.Client, u, contenttype string, body io.Reader) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(u, contenttype, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return data, errors.New("HTTP " + resp.Status)
+	}
+	return data, nil
+}
+
+// get 发送 GET 请求
+func get(client *http.Client, u string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("HTTP " + resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
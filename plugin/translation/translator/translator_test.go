@@ -0,0 +1,190 @@
+package translator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	for text, want := range map[string]string{
+		"今天天气很好":                      "zh",
+		"今日はいい天気ですね":                  "ja",
+		"カタカナだけ":                      "ja",
+		"오늘 날씨가 좋네요":                  "ko",
+		"Привет, как дела?":           "ru",
+		"What a nice day, isn't it?":  "en",
+		"Je ne sais pas ce que c'est": "fr",
+		"Ich weiß nicht, was das ist": "de",
+		"¿Qué es esto? No lo sé":      "es",
+		"我用 Go 写了一个 bot":              "zh",
+		"12345 !!!":                   "",
+	} {
+		if got := Detect(text); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	for in, want := range map[string]string{"日语": "ja", "日文": "ja", "日": "ja", "JA": "ja", "英文": "en", "中文": "zh", "汉语": "zh", "西班牙语": "es"} {
+		if got, ok := Code(in); !ok || got != want {
+			t.Errorf("Code(%q) = %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := Code("火星文"); ok {
+		t.Error("unknown language should fail")
+	}
+}
+
+func TestProtect(t *testing.T) {
+	masked, restore := Protect("I love ZeroBot and ZeroBot-Plugin!", []string{"ZeroBot", "ZeroBot-Plugin", "absent"})
+	if strings.Contains(masked, "ZeroBot") {
+		t.Fatal("terms should be masked:", masked)
+	}
+	// 模拟引擎在占位符中插入空格并翻译其余部分
+	out := strings.ReplaceAll(strings.ReplaceAll(masked, "I love", "我爱"), "and", "和")
+	out = strings.ReplaceAll(out, "__1__", "_ _1_ _")
+	if got := restore(out); got != "我爱ZeroBot和ZeroBot-Plugin!" {
+		t.Fatalf("restore = %q", got)
+	}
+	_, restore = Protect("Use the ZeroBot framework.", []string{"ZeroBot"})
+	if got := restore("Utilisez le framework __0__ ."); got != "Utilisez le framework ZeroBot." {
+		t.Fatalf("restore = %q", got)
+	}
+	if got := restore("使用 __0__ 框架。"); got != "使用ZeroBot框架。" {
+		t.Fatalf("restore = %q", got)
+	}
+	same, restore := Protect("nothing here", nil)
+	if same != "nothing here" || restore("x") != "x" {
+		t.Fatal("no terms should be identity")
+	}
+}
+
+// echo 返回固定译文, 并记录收到的文本
+type echo struct {
+	got, from, to string
+	out           string
+}
+
+func (*echo) Name() string { return "echo" }
+
+func (e *echo) Translate(text, from, to string) (string, error) {
+	e.got, e.from, e.to = text, from, to
+	return e.out, nil
+}
+
+func TestTranslate(t *testing.T) {
+	e := &echo{out: "__0__ は最高"}
+	out, from, err := Translate(e, "原神 is the best", Auto, "ja", []string{"原神"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != "en" || e.from != "en" || e.to != "ja" || strings.Contains(e.got, "原神") {
+		t.Fatalf("from=%q engine got %+v", from, e)
+	}
+	if out != "原神は最高" {
+		t.Fatalf("out = %q", out)
+	}
+	e.out = "hello"
+	if out, _, _ = Translate(e, "你好", "", "", nil); out != "hello" || e.to != "en" {
+		t.Fatalf("default target for zh should be en, got %q -> %q", out, e.to)
+	}
+	if out, _, _ = Translate(e, "你好", "zh", "zh", nil); out != "你好" {
+		t.Fatal("same language should not be translated")
+	}
+	e.out = " "
+	if _, _, err = Translate(e, "hello", "en", "zh", nil); err != ErrEmptyResult {
+		t.Fatal("expect ErrEmptyResult, got", err)
+	}
+}
+
+func TestLibreTranslate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["api_key"] != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":"Invalid API key"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/translate":
+			if body["source"] != "en" || body["target"] != "zh" || body["format"] != "text" {
+				t.Errorf("bad request %v", body)
+			}
+			_, _ = w.Write([]byte(`{"translatedText":"你好, 世界"}`))
+		case "/detect":
+			_, _ = w.Write([]byte(`[{"confidence":90.0,"language":"fr"},{"confidence":10.0,"language":"en"}]`))
+		}
+	}))
+	defer srv.Close()
+	l := &LibreTranslate{URL: srv.URL + "/", APIKey: "key"}
+	out, err := l.Translate("hello, world", "en", "zh")
+	if err != nil || out != "你好, 世界" {
+		t.Fatal(out, err)
+	}
+	lang, err := l.Detect("bonjour")
+	if err != nil || lang != "fr" {
+		t.Fatal(lang, err)
+	}
+	l.APIKey = "wrong"
+	_, err = l.Translate("hello", "en", "zh")
+	if e, ok := err.(*Error); !ok || e.Msg != "Invalid API key" {
+		t.Fatal("expect engine error, got", err)
+	}
+}
+
+func TestMyMemory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("langpair") != "en|zh-CN" {
+			_, _ = w.Write([]byte(`{"responseData":{"translatedText":""},"responseStatus":"403","responseDetails":"INVALID LANGUAGE PAIR"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"responseData":{"translatedText":"早上好"},"responseStatus":200}`))
+	}))
+	defer srv.Close()
+	m := &MyMemory{URL: srv.URL}
+	out, err := m.Translate("good morning", "en", "zh")
+	if err != nil || out != "早上好" {
+		t.Fatal(out, err)
+	}
+	if _, err = m.Translate("good morning", "en", "xx"); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err = m.Translate("good morning", Auto, "zh"); err != ErrUnsupported {
+		t.Fatal("expect ErrUnsupported, got", err)
+	}
+}
+
+func TestCloolc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("data") != "好" {
+			t.Error("bad query", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"translation":["good","fine"]}`))
+	}))
+	defer srv.Close()
+	c := &Cloolc{URL: srv.URL}
+	out, err := c.Translate("好", "zh", "en")
+	if err != nil || out != "good, fine" {
+		t.Fatal(out, err)
+	}
+	if _, err = c.Translate("好", "zh", "ja"); err != ErrUnsupported {
+		t.Fatal("expect ErrUnsupported, got", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if _, ok := Lookup("CLOOLC"); !ok {
+		t.Fatal("lookup should ignore case")
+	}
+	Register(&echo{})
+	defer Unregister("echo")
+	if ns := Names(); len(ns) != 3 || ns[1] != "echo" {
+		t.Fatal(ns)
+	}
+}
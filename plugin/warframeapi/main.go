@@ -2,6 +2,7 @@
 package warframeapi
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/RomiChan/syncx"
 	"github.com/lithammer/fuzzysearch/fuzzy"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
@@ -25,7 +27,15 @@ func init() {
 			"- .wm [物品名称]\n" +
 			"- wf仲裁\n" +
 			"- wf警报\n" +
-			"- wf每日特惠",
+			"- wf每日特惠\n" +
+			"- [订阅|取消订阅][金星|地球|火卫二]平原[白天|夜晚|温暖|寒冷|fass|vome][提前N分钟]\n" +
+			"- [订阅|取消订阅]wf警报[奖励关键词]\n" +
+			"- [订阅|取消订阅]wf入侵[奖励关键词]\n" +
+			"- [订阅|取消订阅]wf仲裁[任务类型] (类型为空时任意仲裁都提醒)\n" +
+			"- [订阅|取消订阅]wf奸商[提前N分钟]\n" +
+			"- wf订阅列表\n" +
+			"- wf订阅检测 (立即列出订阅的下一次事件)\n" +
+			"注: 提醒在订阅的群内@订阅者, 私聊订阅则私聊提醒, 默认提前5分钟",
 		PrivateDataFolder: "warframeapi",
 	})
 
@@ -89,92 +99,112 @@ func init() {
 				ctx.SendChain(msgs...)
 			}
 		})
-	//TODO:订阅功能-等待重做
-	// eng.OnRegex(`^(订阅|取消订阅)(.*)平原(.*)$`).SetBlock(true).
-	//	Handle(func(ctx *zero.Ctx) {
-	//		args := ctx.State["regex_matched"].([]string)
-	//		var isEnable bool
-	//		if args[1] == "订阅" {
-	//			isEnable = true
-	//		}
-	//		updateWFAPI()
-	//		status := false
-	//		switch args[3] {
-	//		case "fass", "白天", "温暖":
-	//			status = true
-	//		}
-	//		switch args[2] {
-	//		case "金星", "奥布山谷":
-	//			//sublist = append(sublist, subList{ctx.Event.GroupID, ctx.Event.UserID, 1, status, false})
-	//			if isEnable {
-	//				addUseSub(ctx.Event.UserID, ctx.Event.GroupID, 1, status)
-	//			} else {
-	//				removeUseSub(ctx.Event.UserID, ctx.Event.GroupID, 1)
-	//			}
-	//			ctx.SendChain(
-	//				message.At(ctx.Event.UserID),
-	//				message.Text("已成功", args[1]),
-	//				message.Text(gameTimes[1].Name),
-	//				message.Text(status),
-	//			)
-	//		case "地球", "夜灵":
-	//			if isEnable {
-	//				addUseSub(ctx.Event.UserID, ctx.Event.GroupID, 0, status)
-	//			} else {
-	//				removeUseSub(ctx.Event.UserID, ctx.Event.GroupID, 0)
-	//			}
-	//			ctx.SendChain(
-	//				message.At(ctx.Event.UserID),
-	//				message.Text("已成功", args[1]),
-	//				message.Text(gameTimes[0].Name),
-	//				message.Text(status),
-	//			)
-	//		case "魔胎之境", "火卫", "火卫二":
-	//			if isEnable {
-	//				addUseSub(ctx.Event.UserID, ctx.Event.GroupID, 2, status)
-	//			} else {
-	//				removeUseSub(ctx.Event.UserID, ctx.Event.GroupID, 2)
-	//			}
-	//			ctx.SendChain(
-	//				message.At(ctx.Event.UserID),
-	//				message.Text("已成功", args[1]),
-	//				message.Text(gameTimes[2].Name),
-	//				message.Text(status),
-	//			)
-	//		default:
-	//			ctx.SendChain(message.Text("ERROR: 平原不存在"))
-	//			return
-	//		}
-	//	})
-	// eng.OnFullMatch(`wf订阅检测`).SetBlock(true).Handle(func(ctx *zero.Ctx) {
-	//	rwm.Lock()
-	//	var msg []message.MessageSegment
-	//	for i, v := range gameTimes {
-	//		nt := time.Until(v.NextTime).Seconds()
-	//		switch {
-	//		case nt < 0:
-	//			if v.Status {
-	//				v.NextTime = v.NextTime.Add(time.Duration(v.NightTime) * time.Second)
-	//			} else {
-	//				v.NextTime = v.NextTime.Add(time.Duration(v.DayTime) * time.Second)
-	//			}
-	//			v.Status = !v.Status
-	//
-	//			msg = callUser(i, v.Status, 0)
-	//		case nt < float64(5)*60:
-	//			msg = callUser(i, !v.Status, 5)
-	//		case nt < float64(15)*60:
-	//			if i == 2 && !v.Status {
-	//				return
-	//			}
-	//			msg = callUser(i, !v.Status, 15)
-	//		}
-	//	}
-	//	rwm.Unlock()
-	//	if msg != nil && len(msg) > 0 {
-	//		ctx.SendChain(msg...)
-	//	}
-	// })
+	go func() {
+		err := sdb.init(eng.DataFolder() + "sub.db")
+		if err != nil {
+			logrus.Errorln("[wfapi] 打开订阅数据库失败:", err)
+			return
+		}
+		runReminder(eng)
+	}()
+	eng.OnRegex(`^(订阅|取消订阅)\s*(金星|奥布山谷|地球|夜灵|火卫二|火卫|魔胎之境)平原\s*(\S+?)\s*(?:提前(\d+)分钟?)?$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			i := worldindex(args[2])
+			isday, ok := parsestate(args[3])
+			if !ok {
+				t := gameWorld.w[i]
+				ctx.SendChain(message.Text("ERROR: 状态应为", t.DayDesc, "或", t.NightDesc))
+				return
+			}
+			ahead, err := parseahead(args[4])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			key := strconv.Itoa(i) + ":0"
+			if isday {
+				key = strconv.Itoa(i) + ":1"
+			}
+			subscribe(ctx, args[1] == "订阅", newsub(ctx.Event.GroupID, ctx.Event.UserID, kindCycle, key, ahead))
+		})
+	eng.OnRegex(`^(订阅|取消订阅)wf(警报|入侵|仲裁|奸商)\s*(.*?)\s*(?:提前(\d+)分钟?)?$`).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			args := ctx.State["regex_matched"].([]string)
+			kind, key := args[2], args[3]
+			switch kind {
+			case kindAlert, kindInvasion:
+				if key == "" {
+					ctx.SendChain(message.Text("ERROR: 请输入奖励关键词, 如: 订阅wf", kind, " 奥罗金催化剂"))
+					return
+				}
+			case kindBaro:
+				key = ""
+			}
+			ahead, err := parseahead(args[4])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			subscribe(ctx, args[1] == "订阅", newsub(ctx.Event.GroupID, ctx.Event.UserID, kind, key, ahead))
+		})
+	eng.OnFullMatch("wf订阅列表").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			sl, err := sdb.subs(ctx.Event.GroupID, ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(sl) == 0 {
+				ctx.SendChain(message.Text("你在这里还没有订阅"))
+				return
+			}
+			sb := strings.Builder{}
+			sb.WriteString("你的订阅:")
+			for _, s := range sl {
+				sb.WriteString("\n- ")
+				sb.WriteString(s.String())
+			}
+			ctx.SendChain(message.Text(&sb))
+		})
+	// 立即检查自己的订阅, 列出即将到来或正在进行的事件
+	eng.OnFullMatch("wf订阅检测").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			sl, err := sdb.subs(ctx.Event.GroupID, ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(sl) == 0 {
+				ctx.SendChain(message.Text("你在这里还没有订阅"))
+				return
+			}
+			now := time.Now()
+			api := fetch(now)
+			if api == nil {
+				ctx.SendChain(message.Text("ERROR: 获取服务器状态失败"))
+				return
+			}
+			sb := strings.Builder{}
+			for _, s := range sl {
+				sb.WriteString("[")
+				sb.WriteString(s.String())
+				sb.WriteString("]")
+				// 不限提前时间, 列出下一次事件
+				tmp := *s
+				tmp.Ahead = maxAhead * 24 * 30
+				rs := due(&tmp, api, now)
+				if len(rs) == 0 {
+					sb.WriteString("\n暂无\n")
+				}
+				for _, r := range rs {
+					sb.WriteString("\n")
+					sb.WriteString(r.text)
+					sb.WriteString("\n")
+				}
+			}
+			ctx.SendChain(message.Text(strings.TrimSpace(sb.String())))
+		})
 	eng.OnFullMatch("wf仲裁").SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
 			// 通过wfapi获取仲裁信息
@@ -416,3 +446,56 @@ func getitemnameindex(ctx *zero.Ctx) int {
 	ctx.SendChain(message.Text("连续输入错误, 会话已结束!"))
 	return -3
 }
+
+// worldindex 平原名称对应的编号
+func worldindex(name string) int {
+	switch name {
+	case "金星", "奥布山谷":
+		return 1
+	case "魔胎之境", "火卫二", "火卫":
+		return 2
+	}
+	return 0
+}
+
+// parsestate 解析平原状态, 白天/温暖/fass 为 true
+func parsestate(s string) (isday bool, ok bool) {
+	switch strings.ToLower(s) {
+	case "白天", "温暖", "fass", "day", "warm":
+		return true, true
+	case "夜晚", "晚上", "黑夜", "寒冷", "vome", "night", "cold":
+		return false, true
+	}
+	return false, false
+}
+
+// parseahead 解析提前的分钟数, 为空时取默认值
+func parseahead(s string) (int64, error) {
+	if s == "" {
+		return defaultAhead, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 || n > maxAhead {
+		return 0, errors.New("提前时间应在1-" + strconv.Itoa(maxAhead) + "分钟之间")
+	}
+	return n, nil
+}
+
+// subscribe 订阅或取消订阅
+func subscribe(ctx *zero.Ctx, enable bool, s *subscription) {
+	var err error
+	if enable {
+		err = sdb.add(s)
+	} else {
+		err = sdb.del(s.ID)
+	}
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	if enable {
+		ctx.SendChain(message.At(ctx.Event.UserID), message.Text(" 已订阅: ", s))
+		return
+	}
+	ctx.SendChain(message.At(ctx.Event.UserID), message.Text(" 已取消订阅: ", s))
+}
@@ -0,0 +1,180 @@
+package warframeapi
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/zbputils/control"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// refreshInterval 后台拉取服务器状态的间隔
+const refreshInterval = 5 * time.Minute
+
+var errNoSub = errors.New("没有这条订阅")
+
+// latest 后台最近一次拉取的服务器状态
+var latest struct {
+	sync.RWMutex
+	api *wfapi
+	at  time.Time
+}
+
+// fetch 距上次拉取超过 refreshInterval 时重新拉取, 并同步平原时间
+func fetch(now time.Time) *wfapi {
+	latest.Lock()
+	defer latest.Unlock()
+	if latest.api != nil && now.Sub(latest.at) < refreshInterval {
+		return latest.api
+	}
+	api, err := newwfapi()
+	if err != nil {
+		logrus.Warnln("[wfapi] 拉取服务器状态失败:", err)
+		return latest.api
+	}
+	gameWorld.refresh(&api)
+	latest.api, latest.at = &api, now
+	return latest.api
+}
+
+// reminder 一条待发送的提醒
+type reminder struct {
+	event string // event 事件标识, 同一订阅的同一事件只提醒一次
+	text  string
+}
+
+// mins 剩余分钟数, 向上取整
+func mins(d time.Duration) int {
+	return int((d + time.Minute - 1) / time.Minute)
+}
+
+// contains 不区分大小写的关键词匹配
+func contains(s, key string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(key))
+}
+
+// due 订阅在 now 时需要发送的提醒
+func due(s *subscription, api *wfapi, now time.Time) (rs []reminder) {
+	ahead := time.Duration(s.Ahead) * time.Minute
+	switch s.Kind {
+	case kindCycle:
+		i, isday := s.cycle()
+		if i < 0 || i >= len(gameWorld.w) {
+			return
+		}
+		t := gameWorld.w[i]
+		start := t.next(isday, now)
+		if start.IsZero() || start.Sub(now) > ahead {
+			return
+		}
+		rs = append(rs, reminder{
+			event: strconv.FormatInt(start.Unix(), 10),
+			text:  t.Name + "将在" + strconv.Itoa(mins(start.Sub(now))) + "分钟后进入" + t.desc(isday),
+		})
+	case kindAlert:
+		for _, a := range api.Alerts {
+			if !a.Expiry.After(now) || !contains(a.Mission.Reward.AsString+" "+a.Mission.Reward.ItemString, s.Key) {
+				continue
+			}
+			rs = append(rs, reminder{
+				event: a.ID,
+				text: "警报: " + a.Mission.Node + " " + a.Mission.Type +
+					"\n奖励: " + a.Mission.Reward.AsString +
+					"\n剩余时间: " + a.Eta,
+			})
+		}
+	case kindInvasion:
+		for _, v := range api.Invasions {
+			if v.Completed {
+				continue
+			}
+			var rewards []string
+			for _, r := range []reward{v.Attacker.Reward, v.Defender.Reward} {
+				if r.AsString != "" && contains(r.AsString+" "+r.ItemString, s.Key) {
+					rewards = append(rewards, r.AsString)
+				}
+			}
+			if len(rewards) == 0 {
+				continue
+			}
+			rs = append(rs, reminder{
+				event: v.ID,
+				text: "入侵: " + v.Node + " " + v.Desc +
+					"\n奖励: " + strings.Join(rewards, ", ") +
+					"\n进度: " + strconv.FormatFloat(v.Completion, 'f', 1, 64) + "%",
+			})
+		}
+	case kindArbitration:
+		a := api.Arbitration
+		if a.Expired || !a.Expiry.After(now) || !contains(a.Type, s.Key) {
+			return
+		}
+		rs = append(rs, reminder{
+			event: a.ID + strconv.FormatInt(a.Activation.Unix(), 10),
+			text: "仲裁: " + a.Node + " " + a.Type + " (" + a.Enemy + ")" +
+				"\n剩余时间: " + strconv.Itoa(mins(a.Expiry.Sub(now))) + "分钟",
+		})
+	case kindBaro:
+		v := api.VoidTrader
+		if v.Active || !v.Activation.After(now) || v.Activation.Sub(now) > ahead {
+			return
+		}
+		rs = append(rs, reminder{
+			event: strconv.FormatInt(v.Activation.Unix(), 10),
+			text:  "虚空商人将在" + strconv.Itoa(mins(v.Activation.Sub(now))) + "分钟后到达" + v.Location,
+		})
+	}
+	return
+}
+
+// check 检查所有订阅并发送提醒
+func check(eng *control.Engine, now time.Time) {
+	sl, err := sdb.subs(0, 0)
+	if err != nil {
+		logrus.Warnln("[wfapi] 读取订阅失败:", err)
+		return
+	}
+	if len(sl) == 0 {
+		return
+	}
+	api := fetch(now)
+	if api == nil {
+		return
+	}
+	zero.RangeBot(func(_ int64, ctx *zero.Ctx) bool {
+		for _, s := range sl {
+			if s.GroupID != 0 && !eng.IsEnabledIn(s.GroupID) {
+				continue
+			}
+			for _, r := range due(s, api, now) {
+				if !sdb.notify(s.ID+"|"+r.event, now) {
+					continue
+				}
+				if s.GroupID == 0 {
+					ctx.SendPrivateMessage(s.UserID, message.Text(r.text))
+				} else {
+					ctx.SendGroupMessage(s.GroupID, message.Message{message.At(s.UserID), message.Text(" ", r.text)})
+				}
+				time.Sleep(time.Millisecond * 100)
+			}
+		}
+		return false
+	})
+}
+
+// runReminder 每分钟检查一次订阅
+func runReminder(eng *control.Engine) {
+	for now := range time.NewTicker(time.Minute).C {
+		check(eng, now)
+		if now.Minute() == 0 && now.Hour() == 4 {
+			if err := sdb.prune(now); err != nil {
+				logrus.Warnln("[wfapi] 清理提醒记录失败:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package warframeapi
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+// 订阅类型
+const (
+	kindCycle       = "平原"
+	kindAlert       = "警报"
+	kindInvasion    = "入侵"
+	kindArbitration = "仲裁"
+	kindBaro        = "奸商"
+)
+
+const (
+	subTable      = "sub"
+	notifiedTable = "notified"
+	// defaultAhead 默认提前提醒的分钟数
+	defaultAhead = 5
+	maxAhead     = 120
+)
+
+// subscription 一条订阅, 私聊订阅的 GroupID 为 0
+type subscription struct {
+	ID      string `db:"id"` // ID 群号/QQ/类型/关键词
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Kind    string `db:"kind"`
+	Key     string `db:"key"`   // Key 平原为 平原编号:1白天/0夜晚, 警报与入侵为奖励关键词, 仲裁为任务类型
+	Ahead   int64  `db:"ahead"` // Ahead 提前多少分钟提醒, 只对平原与奸商有效
+}
+
+func newsub(gid, uid int64, kind, key string, ahead int64) *subscription {
+	return &subscription{
+		ID:      strconv.FormatInt(gid, 10) + "/" + strconv.FormatInt(uid, 10) + "/" + kind + "/" + key,
+		GroupID: gid,
+		UserID:  uid,
+		Kind:    kind,
+		Key:     key,
+		Ahead:   ahead,
+	}
+}
+
+// cycle 平原订阅的平原编号与状态
+func (s *subscription) cycle() (i int, isday bool) {
+	a, b, _ := strings.Cut(s.Key, ":")
+	i, _ = strconv.Atoi(a)
+	return i, b == "1"
+}
+
+// String 订阅说明
+func (s *subscription) String() string {
+	switch s.Kind {
+	case kindCycle:
+		i, isday := s.cycle()
+		if i < 0 || i >= len(gameWorld.w) {
+			return s.Kind + s.Key
+		}
+		return gameWorld.w[i].Name + gameWorld.w[i].desc(isday) + " (提前" + strconv.FormatInt(s.Ahead, 10) + "分钟)"
+	case kindBaro:
+		return "奸商到达 (提前" + strconv.FormatInt(s.Ahead, 10) + "分钟)"
+	case kindArbitration:
+		if s.Key == "" {
+			return "仲裁: 任意类型"
+		}
+		return "仲裁: " + s.Key
+	}
+	return s.Kind + "奖励: " + s.Key
+}
+
+// notified 已发送的提醒, 防止重复提醒
+type notified struct {
+	ID string `db:"id"` // ID 订阅ID|事件
+	At int64  `db:"at"`
+}
+
+var sdb = &subdb{}
+
+// subdb 订阅数据库
+type subdb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+func (sdb *subdb) init(dbpath string) error {
+	sdb.DBPath = dbpath
+	err := sdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = sdb.Create(subTable, &subscription{})
+	if err != nil {
+		return err
+	}
+	return sdb.Create(notifiedTable, &notified{})
+}
+
+func (sdb *subdb) add(s *subscription) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	return sdb.Insert(subTable, s)
+}
+
+func (sdb *subdb) del(id string) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	if !sdb.CanFind(subTable, "WHERE id = "+quote(id)) {
+		return errNoSub
+	}
+	return sdb.Del(subTable, "WHERE id = "+quote(id))
+}
+
+// subs 订阅列表, uid 为 0 时返回所有订阅
+func (sdb *subdb) subs(gid, uid int64) (sl []*subscription, err error) {
+	sdb.RLock()
+	defer sdb.RUnlock()
+	cond := "ORDER BY id"
+	if uid != 0 {
+		cond = "WHERE gid = " + strconv.FormatInt(gid, 10) + " AND uid = " + strconv.FormatInt(uid, 10) + " " + cond
+	}
+	sl, err = sql.FindAll[subscription](&sdb.Sqlite, subTable, cond)
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+// notify 标记已提醒, 返回是否为首次
+func (sdb *subdb) notify(id string, now time.Time) bool {
+	sdb.Lock()
+	defer sdb.Unlock()
+	if sdb.CanFind(notifiedTable, "WHERE id = "+quote(id)) {
+		return false
+	}
+	return sdb.Insert(notifiedTable, &notified{ID: id, At: now.Unix()}) == nil
+}
+
+// prune 清理一周前的提醒记录
+func (sdb *subdb) prune(now time.Time) error {
+	sdb.Lock()
+	defer sdb.Unlock()
+	return sdb.Del(notifiedTable, "WHERE at < "+strconv.FormatInt(now.AddDate(0, 0, -7).Unix(), 10))
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -91,21 +91,56 @@ func (w *world) update() {
 	if !w.hasSync() {
 		return
 	}
+	now := time.Now()
 	for _, t := range w.w {
 		t.Lock()
-		// 当前时间对比下一次游戏状态更新时间，看看还剩多少秒
-		nt := time.Until(t.NextTime).Seconds()
-		// 已经过了游戏时间状态更新时间
-		if nt < 0 {
-			// 更新游戏状态，如果是白天就切换到晚上，反之亦然
-			if t.IsDay {
-				// 计算下次的晚上更新时间
-				t.NextTime = t.NextTime.Add(time.Duration(t.NightLen) * time.Second)
-			} else {
-				// 计算下次的白天更新时间
-				t.NextTime = t.NextTime.Add(time.Duration(t.DayLen) * time.Second)
-			}
-		}
+		t.advance(now)
 		t.Unlock()
 	}
 }
+
+// length 状态的持续时长
+func (t *timezone) length(isday bool) time.Duration {
+	if isday {
+		return time.Duration(t.DayLen) * time.Second
+	}
+	return time.Duration(t.NightLen) * time.Second
+}
+
+// advance 推进到 now 时的状态, 调用者需持有写锁
+func (t *timezone) advance(now time.Time) {
+	if t.NextTime.IsZero() {
+		return
+	}
+	// 已经过了游戏时间状态更新时间, 白天就切换到晚上, 反之亦然
+	for !t.NextTime.After(now) {
+		t.IsDay = !t.IsDay
+		t.NextTime = t.NextTime.Add(t.length(t.IsDay))
+	}
+}
+
+// next now 之后下一次进入 isday 状态的时间, 未同步过服务器时间时返回零值
+func (t *timezone) next(isday bool, now time.Time) time.Time {
+	t.RLock()
+	nt, s := t.NextTime, !t.IsDay // s 为 nt 时开始的状态
+	t.RUnlock()
+	if nt.IsZero() {
+		return nt
+	}
+	for !nt.After(now) {
+		nt = nt.Add(t.length(s))
+		s = !s
+	}
+	if s != isday {
+		nt = nt.Add(t.length(s))
+	}
+	return nt
+}
+
+// desc 状态说明
+func (t *timezone) desc(isday bool) string {
+	if isday {
+		return t.DayDesc
+	}
+	return t.NightDesc
+}
@@ -0,0 +1,142 @@
+package wordle
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	recordTable = "record"
+	dictTable   = "groupdict"
+)
+
+// wordledb 猜单词数据库
+type wordledb struct {
+	sync.RWMutex
+	sql.Sqlite
+}
+
+// gameRecord 一局个人游戏的结果, 团队游戏不计入统计
+type gameRecord struct {
+	ID      int64  `db:"id"` // 结束时间 UnixNano
+	GroupID int64  `db:"gid"`
+	UserID  int64  `db:"uid"`
+	Class   int    `db:"class"`
+	Word    string `db:"word"`
+	Guesses int    `db:"guesses"` // 猜中所用次数, 0 表示失败
+	Daily   bool   `db:"daily"`
+	Hard    bool   `db:"hard"`
+	Date    string `db:"date"` // 20060102
+}
+
+// groupDict 群使用的自定义词库
+type groupDict struct {
+	GroupID int64  `db:"gid"`
+	Dict    string `db:"dict"`
+}
+
+// userStats 用户的统计数据
+type userStats struct {
+	Games     int
+	Wins      int
+	Streak    int
+	MaxStreak int
+	// Dist 猜中所用次数的分布, 下标为次数-1
+	Dist []int
+}
+
+// rankItem 群排行榜的一项
+type rankItem struct {
+	UserID int64 `db:"uid"`
+	Games  int   `db:"games"`
+	Wins   int   `db:"wins"`
+}
+
+var db = &wordledb{}
+
+func (wdb *wordledb) init(path string) error {
+	wdb.DBPath = path
+	err := wdb.Open(time.Hour)
+	if err != nil {
+		return err
+	}
+	err = wdb.Create(recordTable, &gameRecord{})
+	if err != nil {
+		return err
+	}
+	return wdb.Create(dictTable, &groupDict{})
+}
+
+func (wdb *wordledb) addRecord(r *gameRecord) error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	r.ID = time.Now().UnixNano()
+	r.Date = time.Now().Format("20060102")
+	return wdb.Insert(recordTable, r)
+}
+
+// playedDaily 今天是否已经玩过每日谜题
+func (wdb *wordledb) playedDaily(uid int64) bool {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	return wdb.CanFind(recordTable, "WHERE uid = "+strconv.FormatInt(uid, 10)+
+		" AND daily = 1 AND date = '"+time.Now().Format("20060102")+"'")
+}
+
+// stats 统计用户的全部个人游戏
+func (wdb *wordledb) stats(uid int64) (s userStats, err error) {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	var r gameRecord
+	s.Dist = make([]int, 8)
+	err = wdb.FindFor(recordTable, &r, "WHERE uid = "+strconv.FormatInt(uid, 10)+" ORDER BY id ASC", func() error {
+		s.Games++
+		if r.Guesses <= 0 {
+			s.Streak = 0
+			return nil
+		}
+		s.Wins++
+		if r.Guesses <= len(s.Dist) {
+			s.Dist[r.Guesses-1]++
+		}
+		s.Streak++
+		if s.Streak > s.MaxStreak {
+			s.MaxStreak = s.Streak
+		}
+		return nil
+	})
+	if err == sql.ErrNullResult {
+		err = nil
+	}
+	return
+}
+
+// rank 群内排行榜, 按胜场与胜率排序
+func (wdb *wordledb) rank(gid int64, n int) ([]*rankItem, error) {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	return sql.QueryAll[rankItem](&wdb.Sqlite,
+		"SELECT uid, COUNT(*) AS games, SUM(guesses > 0) AS wins FROM "+recordTable+
+			" WHERE gid = "+strconv.FormatInt(gid, 10)+
+			" GROUP BY uid ORDER BY wins DESC, CAST(wins AS REAL) / games DESC LIMIT "+strconv.Itoa(n)+";")
+}
+
+func (wdb *wordledb) getGroupDict(gid int64) string {
+	wdb.RLock()
+	defer wdb.RUnlock()
+	var d groupDict
+	_ = wdb.Find(dictTable, &d, "WHERE gid = "+strconv.FormatInt(gid, 10))
+	return d.Dict
+}
+
+func (wdb *wordledb) setGroupDict(gid int64, dict string) error {
+	wdb.Lock()
+	defer wdb.Unlock()
+	if dict == "" {
+		return wdb.Del(dictTable, "WHERE gid = "+strconv.FormatInt(gid, 10))
+	}
+	return wdb.Insert(dictTable, &groupDict{GroupID: gid, Dict: dict})
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"image/color"
 	"math/rand"
+	"os"
+	"path"
 	"sort"
 	"strings"
 	"sync"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/FloatTech/floatbox/binary"
 	fcext "github.com/FloatTech/floatbox/ctxext"
+	"github.com/FloatTech/floatbox/web"
 	"github.com/FloatTech/gg"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
@@ -30,6 +33,7 @@ var (
 	errLengthNotEnough = errors.New("length not enough")
 	errUnknownWord     = errors.New("unknown word")
 	errTimesRunOut     = errors.New("times run out")
+	errHardMode        = errors.New("hard mode")
 )
 
 const (
@@ -60,6 +64,15 @@ type dictionary map[int]struct {
 
 var words = make(dictionary)
 
+// customs 自定义词库, 词库名 -> 单词长度 -> 有序单词表
+var (
+	customs   = make(map[string]map[int][]string)
+	customsmu sync.RWMutex
+)
+
+// customPrefix 超级用户上传该前缀的群文件以添加自定义词库
+const customPrefix = "wordle-"
+
 func init() {
 	en := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
@@ -67,7 +80,16 @@ func init() {
 		Help: "- 个人猜单词\n" +
 			"- 团队猜单词\n" +
 			"- 团队六阶猜单词\n" +
-			"- 团队七阶猜单词",
+			"- 团队七阶猜单词\n" +
+			"- 个人困难猜单词 (困难模式: 已提示的字母必须在之后的猜测中使用)\n" +
+			"- 每日猜单词 / 每日困难猜单词 (每天所有人同一个单词, 每人每天一次)\n" +
+			"- 我的猜单词统计\n" +
+			"- 猜单词排行榜\n" +
+			"- 猜单词词库列表\n" +
+			"- [群管]设置猜单词词库GRE\n" +
+			"- [群管]重置猜单词词库\n" +
+			"- [超级用户]上传名为 wordle-xxx.txt 的群文件以添加词库xxx, 每行一个单词\n" +
+			"注: 个人模式与每日谜题会计入统计",
 		PublicDataFolder: "Wordle",
 	}).ApplySingle(single.New(
 		single.WithKeyFn(func(ctx *zero.Ctx) int64 { return ctx.Event.GroupID }),
@@ -79,8 +101,20 @@ func init() {
 			)
 		}),
 	))
-
-	en.OnRegex(`^(个人|团队)(五阶|六阶|七阶)?猜单词$`, zero.OnlyGroup, fcext.DoOnceOnSuccess(
+	customFolder := en.DataFolder() + "custom/"
+	err := os.MkdirAll(customFolder, 0755)
+	if err != nil {
+		panic(err)
+	}
+	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+		err := db.init(en.DataFolder() + "wordle.db")
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return false
+		}
+		return true
+	})
+	getdict := fcext.DoOnceOnSuccess(
 		func(ctx *zero.Ctx) bool {
 			var errcnt uint32
 			var wg sync.WaitGroup
@@ -123,99 +157,370 @@ func init() {
 				ctx.SendChain(message.Text("ERROR: 下载字典时发生", errcnt, "个错误"))
 				return false
 			}
+			err := loadCustoms(customFolder)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: 加载自定义词库失败: ", err))
+				return false
+			}
 			return true
 		},
-	)).SetBlock(true).Limit(ctxext.LimitByUser).
+	)
+
+	en.OnRegex(`^(个人|团队)(困难)?(五阶|六阶|七阶)?猜单词$`, zero.OnlyGroup, getdict, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			class := classdict[matched[3]]
+			dict := db.getGroupDict(ctx.Event.GroupID)
+			answers := words[class].cet4
+			if dict != "" {
+				customsmu.RLock()
+				answers = customs[dict][class]
+				customsmu.RUnlock()
+				if len(answers) == 0 {
+					ctx.SendChain(message.Text("词库", dict, "中没有长度为", class, "的单词"))
+					return
+				}
+			}
+			target := answers[rand.Intn(len(answers))]
+			personal := matched[1] == "个人"
+			play(ctx, target, personal, matched[2] != "", false)
+		})
+	en.OnRegex(`^每日(困难)?猜单词$`, zero.OnlyGroup, getdict, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
-			class := classdict[ctx.State["regex_matched"].([]string)[2]]
-			target := words[class].cet4[rand.Intn(len(words[class].cet4))]
-			tt, err := tl.Translate(target)
+			if db.playedDaily(ctx.Event.UserID) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你今天已经玩过每日猜单词了, 明天再来吧~"))
+				return
+			}
+			answers := words[5].cet4
+			// uid 固定为 0, 保证每天所有人的单词相同
+			target := answers[fcext.RandSenderPerDayN(0, len(answers))]
+			play(ctx, target, true, ctx.State["regex_matched"].([]string)[1] != "", true)
+		})
+	en.OnFullMatch("我的猜单词统计", getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			s, err := db.stats(ctx.Event.UserID)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			game := newWordleGame(target)
-			_, img, _ := game("")
-			ctx.Send(
-				message.ReplyWithMessage(ctx.Event.MessageID,
-					message.ImageBytes(img),
-					message.Text("你有", class+1, "次机会猜出单词，单词长度为", class, "，请发送单词"),
-				),
+			if s.Games == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你还没有玩过个人猜单词哦~"))
+				return
+			}
+			img, err := drawStats(&s)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(
+				message.Reply(ctx.Event.MessageID),
+				message.Text(fmt.Sprintf("共%d局, 胜率%.1f%%, 当前连胜%d, 最长连胜%d\n猜中次数分布:",
+					s.Games, float64(s.Wins)*100/float64(s.Games), s.Streak, s.MaxStreak)),
+				message.ImageBytes(img),
 			)
-			var next *zero.FutureEvent
-			if ctx.State["regex_matched"].([]string)[1] == "个人" {
-				next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([A-Z]|[a-z]){%d}$`, class)),
-					zero.OnlyGroup, ctx.CheckSession())
-			} else {
-				next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([A-Z]|[a-z]){%d}$`, class)),
-					zero.OnlyGroup, zero.CheckGroup(ctx.Event.GroupID))
+		})
+	en.OnFullMatch("猜单词排行榜", zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			items, err := db.rank(ctx.Event.GroupID, 10)
+			if err != nil || len(items) == 0 {
+				ctx.SendChain(message.Text("本群还没有人玩过个人猜单词哦~"))
+				return
 			}
-			var win bool
-			recv, cancel := next.Repeat()
-			defer cancel()
-			tick := time.NewTimer(105 * time.Second)
-			after := time.NewTimer(120 * time.Second)
-			for {
-				select {
-				case <-tick.C:
-					ctx.SendChain(message.Text("猜单词，你还有15s作答时间"))
-				case <-after.C:
-					ctx.Send(
-						message.ReplyWithMessage(ctx.Event.MessageID,
-							message.Text("猜单词超时，游戏结束...答案是: ", target, "(", tt, ")"),
-						),
-					)
+			var sb strings.Builder
+			sb.WriteString("猜单词排行榜:")
+			for i, item := range items {
+				sb.WriteString(fmt.Sprintf("\n第%d名: %s - 胜%d场/共%d场 (%.1f%%)",
+					i+1, ctx.CardOrNickName(item.UserID), item.Wins, item.Games, float64(item.Wins)*100/float64(item.Games)))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	en.OnFullMatch("猜单词词库列表", getdict, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			var sb strings.Builder
+			sb.WriteString("可用词库:\n- cet4 (默认)")
+			customsmu.RLock()
+			names := make([]string, 0, len(customs))
+			for name := range customs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				sb.WriteString(fmt.Sprintf("\n- %s (五阶%d个, 六阶%d个, 七阶%d个)",
+					name, len(customs[name][5]), len(customs[name][6]), len(customs[name][7])))
+			}
+			customsmu.RUnlock()
+			if ctx.Event.GroupID != 0 {
+				dict := db.getGroupDict(ctx.Event.GroupID)
+				if dict == "" {
+					dict = "cet4"
+				}
+				sb.WriteString("\n本群当前使用: " + dict)
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	en.OnPrefix("设置猜单词词库", zero.OnlyGroup, zero.AdminPermission, getdict, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			name := strings.TrimSpace(ctx.State["args"].(string))
+			if strings.EqualFold(name, "cet4") {
+				name = ""
+			}
+			if name != "" {
+				customsmu.RLock()
+				_, ok := customs[name]
+				customsmu.RUnlock()
+				if !ok {
+					ctx.SendChain(message.Text("没有名为", name, "的词库"))
 					return
-				case c := <-recv:
-					tick.Reset(105 * time.Second)
-					after.Reset(120 * time.Second)
-					win, img, err = game(c.Event.Message.String())
-					switch {
-					case win:
-						tick.Stop()
-						after.Stop()
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-								message.Text("太棒了，你猜出来了！答案是: ", target, "(", tt, ")"),
-							),
-						)
-						return
-					case err == errTimesRunOut:
-						tick.Stop()
-						after.Stop()
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-								message.Text("游戏结束...答案是: ", target, "(", tt, ")"),
-							),
-						)
-						return
-					case err == errLengthNotEnough:
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.Text("单词长度错误"),
-							),
-						)
-					case err == errUnknownWord:
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.Text("你确定存在这样的单词吗？"),
-							),
-						)
-					default:
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-							),
-						)
-					}
 				}
 			}
+			err := db.setGroupDict(ctx.Event.GroupID, name)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功"))
+		})
+	en.OnFullMatch("重置猜单词词库", zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			err := db.setGroupDict(ctx.Event.GroupID, "")
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("成功"))
 		})
+	en.On("notice/group_upload", zero.SuperUserPermission, func(ctx *zero.Ctx) bool {
+		return path.Ext(ctx.Event.File.Name) == ".txt" && strings.HasPrefix(ctx.Event.File.Name, customPrefix)
+	}).SetBlock(false).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			name := strings.TrimSuffix(strings.TrimPrefix(ctx.Event.File.Name, customPrefix), ".txt")
+			if name == "" || strings.ContainsAny(name, `/\.`) || strings.EqualFold(name, "cet4") {
+				ctx.SendChain(message.Text("ERROR: 非法的词库名"))
+				return
+			}
+			fileURL := ctx.GetThisGroupFileUrl(ctx.Event.File.BusID, ctx.Event.File.ID)
+			data, err := web.GetData(fileURL)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			list := parseWordList(data)
+			if len(list[5])+len(list[6])+len(list[7]) == 0 {
+				ctx.SendChain(message.Text("ERROR: 词库中没有长度为5~7的单词"))
+				return
+			}
+			err = os.WriteFile(customFolder+name+".txt", data, 0644)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			customsmu.Lock()
+			customs[name] = list
+			customsmu.Unlock()
+			ctx.SendChain(message.Text("已添加词库", name, ": 五阶", len(list[5]), "个, 六阶", len(list[6]), "个, 七阶", len(list[7]), "个"))
+		})
+}
+
+// loadCustoms 加载文件夹内的全部自定义词库
+func loadCustoms(folder string) error {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	customsmu.Lock()
+	defer customsmu.Unlock()
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".txt" {
+			continue
+		}
+		data, err := os.ReadFile(folder + e.Name())
+		if err != nil {
+			return err
+		}
+		customs[strings.TrimSuffix(e.Name(), ".txt")] = parseWordList(data)
+	}
+	return nil
+}
+
+// parseWordList 解析每行一个单词的词库, 忽略非纯字母与长度不在5~7的行
+func parseWordList(data []byte) map[int][]string {
+	list := make(map[int][]string, 3)
+	for _, line := range strings.Split(binary.BytesToString(data), "\n") {
+		w := strings.ToLower(strings.TrimSpace(line))
+		if len(w) < 5 || len(w) > 7 || strings.IndexFunc(w, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+			continue
+		}
+		list[len(w)] = append(list[len(w)], w)
+	}
+	for k, v := range list {
+		sort.Strings(v)
+		list[k] = v
+	}
+	return list
+}
+
+// isValid 判断单词是否在字典或任一自定义词库中
+func isValid(s string) bool {
+	d := words[len(s)].dict
+	i := sort.SearchStrings(d, s)
+	if i < len(d) && d[i] == s {
+		return true
+	}
+	customsmu.RLock()
+	defer customsmu.RUnlock()
+	for _, c := range customs {
+		l := c[len(s)]
+		i := sort.SearchStrings(l, s)
+		if i < len(l) && l[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// play 进行一局游戏, 个人模式的结果会被记录
+func play(ctx *zero.Ctx, target string, personal, hard, daily bool) {
+	class := len(target)
+	tt, err := tl.Translate(target)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	game := newWordleGame(target, hard)
+	_, img, _ := game("")
+	tip := ""
+	if hard {
+		tip = "(困难模式)"
+	}
+	ctx.Send(
+		message.ReplyWithMessage(ctx.Event.MessageID,
+			message.ImageBytes(img),
+			message.Text("你有", class+1, "次机会猜出单词", tip, "，单词长度为", class, "，请发送单词"),
+		),
+	)
+	var next *zero.FutureEvent
+	if personal {
+		next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([A-Z]|[a-z]){%d}$`, class)),
+			zero.OnlyGroup, ctx.CheckSession())
+	} else {
+		next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([A-Z]|[a-z]){%d}$`, class)),
+			zero.OnlyGroup, zero.CheckGroup(ctx.Event.GroupID))
+	}
+	// record 保存个人游戏结果, guesses 为 0 表示失败
+	record := func(guesses int) {
+		if !personal {
+			return
+		}
+		err := db.addRecord(&gameRecord{
+			GroupID: ctx.Event.GroupID,
+			UserID:  ctx.Event.UserID,
+			Class:   class,
+			Word:    target,
+			Guesses: guesses,
+			Daily:   daily,
+			Hard:    hard,
+		})
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: 保存记录失败: ", err))
+		}
+	}
+	var (
+		win     bool
+		guesses int
+	)
+	recv, cancel := next.Repeat()
+	defer cancel()
+	tick := time.NewTimer(105 * time.Second)
+	after := time.NewTimer(120 * time.Second)
+	for {
+		select {
+		case <-tick.C:
+			ctx.SendChain(message.Text("猜单词，你还有15s作答时间"))
+		case <-after.C:
+			record(0)
+			ctx.Send(
+				message.ReplyWithMessage(ctx.Event.MessageID,
+					message.Text("猜单词超时，游戏结束...答案是: ", target, "(", tt, ")"),
+				),
+			)
+			return
+		case c := <-recv:
+			tick.Reset(105 * time.Second)
+			after.Reset(120 * time.Second)
+			win, img, err = game(c.Event.Message.String())
+			if err == nil || err == errTimesRunOut {
+				guesses++
+			}
+			switch {
+			case win:
+				tick.Stop()
+				after.Stop()
+				record(guesses)
+				ctx.Send(
+					message.ReplyWithMessage(c.Event.MessageID,
+						message.ImageBytes(img),
+						message.Text("太棒了，你猜出来了！答案是: ", target, "(", tt, ")"),
+					),
+				)
+				return
+			case err == errTimesRunOut:
+				tick.Stop()
+				after.Stop()
+				record(0)
+				ctx.Send(
+					message.ReplyWithMessage(c.Event.MessageID,
+						message.ImageBytes(img),
+						message.Text("游戏结束...答案是: ", target, "(", tt, ")"),
+					),
+				)
+				return
+			case err == errLengthNotEnough:
+				ctx.Send(
+					message.ReplyWithMessage(c.Event.MessageID,
+						message.Text("单词长度错误"),
+					),
+				)
+			case err == errUnknownWord:
+				ctx.Send(
+					message.ReplyWithMessage(c.Event.MessageID,
+						message.Text("你确定存在这样的单词吗？"),
+					),
+				)
+			case errors.Is(err, errHardMode):
+				ctx.Send(
+					message.ReplyWithMessage(c.Event.MessageID,
+						message.Text("困难模式下", strings.TrimPrefix(err.Error(), errHardMode.Error()+": ")),
+					),
+				)
+			default:
+				ctx.Send(
+					message.ReplyWithMessage(c.Event.MessageID,
+						message.ImageBytes(img),
+					),
+				)
+			}
+		}
+	}
+}
+
+// checkHard 检查猜测是否使用了之前所有的提示
+func checkHard(target string, record []string, s string) error {
+	for _, r := range record {
+		for j := 0; j < len(r); j++ {
+			if r[j] == target[j] && s[j] != r[j] {
+				return fmt.Errorf("%w: 第%d个字母必须是%c", errHardMode, j+1, r[j]-'a'+'A')
+			}
+		}
+		for j := 0; j < len(r); j++ {
+			if r[j] != target[j] && strings.IndexByte(target, r[j]) != -1 && strings.IndexByte(s, r[j]) == -1 {
+				return fmt.Errorf("%w: 必须包含字母%c", errHardMode, r[j]-'a'+'A')
+			}
+		}
+	}
+	return nil
 }
 
-func newWordleGame(target string) func(string) (bool, []byte, error) {
+func newWordleGame(target string, hard bool) func(string) (bool, []byte, error) {
 	var class = len(target)
 	record := make([]string, 0, len(target)+1)
 	return func(s string) (win bool, data []byte, err error) {
@@ -228,14 +533,19 @@ func newWordleGame(target string) func(string) (bool, []byte, error) {
 					err = errLengthNotEnough
 					return
 				}
-				i := sort.SearchStrings(words[class].dict, s)
-				if i >= len(words[class].dict) || words[class].dict[i] != s {
+				if !isValid(s) {
 					err = errUnknownWord
 					return
 				}
+				if hard {
+					err = checkHard(target, record, s)
+					if err != nil {
+						return
+					}
+				}
 			}
 			record = append(record, s)
-			if len(record) >= cap(record) {
+			if !win && len(record) >= cap(record) {
 				err = errTimesRunOut
 				return
 			}
@@ -272,3 +582,47 @@ func newWordleGame(target string) func(string) (bool, []byte, error) {
 		return
 	}
 }
+
+// drawStats 绘制猜中次数分布直方图
+func drawStats(s *userStats) ([]byte, error) {
+	// 去掉末尾为 0 的次数, 但至少显示 6 行
+	n := len(s.Dist)
+	for n > 6 && s.Dist[n-1] == 0 {
+		n--
+	}
+	maxv := 1
+	for _, v := range s.Dist[:n] {
+		if v > maxv {
+			maxv = v
+		}
+	}
+	const (
+		barh   = 20
+		gap    = 6
+		space  = 10
+		labelw = 20
+		barw   = 260
+	)
+	ctx := gg.NewContext(space*2+labelw+barw+30, space*2+n*(barh+gap)-gap)
+	ctx.SetColor(color.RGBA{255, 255, 255, 255})
+	ctx.Clear()
+	for i, v := range s.Dist[:n] {
+		y := float64(space + i*(barh+gap))
+		ctx.SetColor(colors[notexist])
+		ctx.DrawString(fmt.Sprint(i+1), space, y+15)
+		w := float64(barw) * float64(v) / float64(maxv)
+		if w < 16 {
+			w = 16
+		}
+		ctx.DrawRectangle(space+labelw, y, w, barh)
+		if v > 0 {
+			ctx.SetColor(colors[match])
+		} else {
+			ctx.SetColor(colors[undone])
+		}
+		ctx.Fill()
+		ctx.SetColor(color.RGBA{255, 255, 255, 255})
+		ctx.DrawStringAnchored(fmt.Sprint(v), space+labelw+w-4, y+barh/2, 1, 0.35)
+	}
+	return imgfactory.ToBytes(ctx.Image())
+}